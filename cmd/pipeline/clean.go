@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/ingest"
+	"github.com/jonkmatsumo/bulk-ocr/internal/pipeline"
+)
+
+// intermediateArtifacts are the files and directories a run writes to the output
+// directory besides its final outputs.
+var intermediateArtifacts = []string{
+	"preprocessed",
+	pagesDir,
+	"combined.pdf",
+	"combined_ocr.pdf",
+	"extracted.txt",
+	"extracted.html",
+	"chunks_raw.jsonl",
+	"result_exact.md",
+	"alignment.tsv",
+	"kept_chunks.jsonl",
+	"filtered_out.jsonl",
+	"distance_histogram.json",
+	"chrome_suggestions.txt",
+	"resolved_config.json",
+	"run_summary.json",
+	ocrInputsFile,
+}
+
+// finalOutputs are the results and reports of a run, removed by clean only with --all.
+var finalOutputs = []string{
+	"result.md",
+	"result.json",
+	"result.txt",
+	"dedupe_report.json",
+	"dedupe_report.csv",
+	"dedupe_summary.csv",
+	"dedupe_report.html",
+	ingest.ManifestFile,
+	watchStateFile,
+	watchProcessedFile,
+	watchBatchesFile,
+}
+
+// generatedArtifacts returns the paths of generated files present in outputDir:
+// the intermediate artifacts, plus the final outputs if all is set.
+func generatedArtifacts(outputDir string, all bool) ([]string, error) {
+	names := intermediateArtifacts
+	if all {
+		names = append(append([]string{}, intermediateArtifacts...), finalOutputs...)
+	}
+
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(outputDir, name)
+		if _, err := os.Lstat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to check %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// cleanCommand removes generated artifacts from an output directory.
+func cleanCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	outputDir := fs.String("out", "output", "Output directory to clean")
+	all := fs.Bool("all", false, "Also remove result.* and dedupe report files")
+	dryRun := fs.Bool("dry-run", false, "List what would be removed without removing anything")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	info, err := os.Stat(*outputDir)
+	if err != nil {
+		return fmt.Errorf("output directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output directory %s is not a directory", *outputDir)
+	}
+
+	paths, err := generatedArtifacts(*outputDir, *all)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if *dryRun {
+			_, _ = fmt.Fprintf(w, "would remove %s\n", path)
+			continue
+		}
+		if base := filepath.Base(path); base == "preprocessed" || base == pagesDir {
+			err = os.RemoveAll(path)
+		} else {
+			err = pipeline.CleanupArtifact(path)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		_, _ = fmt.Fprintf(w, "removed %s\n", path)
+	}
+
+	if *dryRun {
+		_, _ = fmt.Fprintf(w, "%d artifacts would be removed\n", len(paths))
+	} else {
+		_, _ = fmt.Fprintf(w, "%d artifacts removed\n", len(paths))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+)
+
+// commandLogStderrLines is how many trailing lines of stderr a --command-log entry keeps.
+const commandLogStderrLines = 20
+
+// commandLogEntry is one line of the --command-log JSONL file, for one external command.
+type commandLogEntry struct {
+	Time       string `json:"time"`                  // When the command finished, RFC3339
+	Cmd        string `json:"cmd"`                   // Copy/pasteable command line
+	ExitCode   int    `json:"exit_code"`             // -1 if the command did not start or was killed
+	DurationMs int64  `json:"duration_ms"`           // Duration of the last attempt
+	StderrTail string `json:"stderr_tail,omitempty"` // Last lines of captured stderr
+	Error      string `json:"error,omitempty"`       // Failure message, empty on success
+}
+
+// commandLog appends a JSONL entry for each external command to a file. It is safe
+// for concurrent use, as parallel OCR runs several commands at once.
+type commandLog struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	logger *slog.Logger // Receives failures to write the log
+}
+
+// openCommandLog opens path for appending, creating it if needed, so that the
+// entries of earlier runs are kept. Failures to write it are logged to logger.
+func openCommandLog(path string, logger *slog.Logger) (*commandLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open command log: %w", err)
+	}
+	return &commandLog{file: file, enc: json.NewEncoder(file), logger: logger}, nil
+}
+
+// record appends an entry for a command's result; it has the signature of
+// runner.Runner.OnResult.
+func (l *commandLog) record(result runner.Result, err error) {
+	entry := commandLogEntry{
+		Time:       time.Now().Format(time.RFC3339),
+		Cmd:        result.Cmd,
+		ExitCode:   result.ExitCode,
+		DurationMs: result.DurationMs,
+		StderrTail: lastLines(result.Stderr, commandLogStderrLines),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// The log is best effort; failing to write it must not fail the command
+	if err := l.enc.Encode(entry); err != nil {
+		logWarn(l.logger, "failed to write command log: %v", err)
+	}
+}
+
+// Close closes the log file.
+func (l *commandLog) Close() error {
+	return l.file.Close()
+}
+
+// lastLines returns the last n lines of s, without trailing newlines.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyConfigFile sets flags in fs from the YAML file at path. Keys are flag names
+// without dashes (e.g. "simhash-threshold: 3"); flags already set on the command line
+// keep their values. "chrome-regex" may be a single pattern or a list, and is
+// returned rather than set so that patterns given on the command line replace it.
+// Other repeatable flags, such as "exclude", also accept a single value or a list.
+// Unknown keys are reported together in one error.
+func applyConfigFile(fs *flag.FlagSet, path string) ([]string, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".toml" {
+		return nil, fmt.Errorf("config file %s: TOML is not supported, use YAML", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]any
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var unknown []string
+	var chromePatterns []string
+	for _, key := range keys {
+		if fs.Lookup(key) == nil || key == "config" {
+			unknown = append(unknown, key)
+			continue
+		}
+		if explicit[key] {
+			continue
+		}
+
+		value := values[key]
+		if key == "chrome-regex" {
+			patterns, err := stringList(value)
+			if err != nil {
+				return nil, fmt.Errorf("config key %q: %w", key, err)
+			}
+			chromePatterns = patterns
+			continue
+		}
+		if _, ok := fs.Lookup(key).Value.(*stringListFlag); ok {
+			items, err := stringList(value)
+			if err != nil {
+				return nil, fmt.Errorf("config key %q: %w", key, err)
+			}
+			for _, item := range items {
+				if err := fs.Set(key, item); err != nil {
+					return nil, fmt.Errorf("config key %q: %w", key, err)
+				}
+			}
+			continue
+		}
+		switch value.(type) {
+		case []any, map[string]any:
+			return nil, fmt.Errorf("config key %q: expected a single value", key)
+		case nil:
+			return nil, fmt.Errorf("config key %q: missing value", key)
+		}
+		if err := fs.Set(key, fmt.Sprint(value)); err != nil {
+			return nil, fmt.Errorf("config key %q: %w", key, err)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("config file %s: unknown keys: %s", path, strings.Join(unknown, ", "))
+	}
+
+	return chromePatterns, nil
+}
+
+// stringList converts a YAML string or list of strings to a slice.
+func stringList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings, got %v", item)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("expected a string or list of strings, got %v", value)
+	}
+}
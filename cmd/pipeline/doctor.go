@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jonkmatsumo/bulk-ocr/internal/pipeline"
 	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
 )
 
@@ -18,117 +23,220 @@ type runnerInterface interface {
 	Run(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error)
 }
 
-// doctorCommand runs the doctor subcommand to validate the toolchain.
-func doctorCommand(args []string) error {
-	return doctorCommandWithRunner(args, runner.New())
+// binOverrideUsage is the usage of the --bin-override flag, which run and doctor share.
+const binOverrideUsage = "Run this path for an external tool, as name=path, e.g. ocrmypdf=/opt/venv/bin/ocrmypdf (can be repeated)"
+
+// parseBinOverrides parses --bin-override values of the form name=path into a map
+// for runner.Runner.BinOverride, or nil if there are none.
+func parseBinOverrides(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	overrides := make(map[string]string, len(values))
+	for _, value := range values {
+		name, path, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(path) == "" {
+			return nil, fmt.Errorf("invalid --bin-override %q: must be name=path", value)
+		}
+		overrides[strings.TrimSpace(name)] = strings.TrimSpace(path)
+	}
+	return overrides, nil
 }
 
-// doctorCommandWithRunner allows injecting a mock runner for testing
-func doctorCommandWithRunner(args []string, r runnerInterface) error {
-	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
-	smoke := fs.Bool("smoke", false, "Run smoke test to verify end-to-end functionality")
-	if err := fs.Parse(args); err != nil {
-		return fmt.Errorf("failed to parse flags: %w", err)
+// toolEnv returns the environment for external tools given --tool-path: PATH set
+// to it, or nil if it is empty.
+func toolEnv(toolPath string) map[string]string {
+	if toolPath == "" {
+		return nil
 	}
+	return map[string]string{"PATH": toolPath}
+}
 
-	ctx := context.Background()
+// withRunnerOverrides returns a copy of r with bins and env as its BinOverride and
+// Env, leaving r itself unchanged. Mocked runners are returned as they are.
+func withRunnerOverrides(r runnerInterface, bins, env map[string]string) runnerInterface {
+	realRunner, ok := r.(*runner.Runner)
+	if !ok {
+		return r
+	}
+	overridden := *realRunner
+	overridden.BinOverride = bins
+	overridden.Env = env
+	return &overridden
+}
 
-	log.Println("Doctor report:")
+// minToolVersions are the oldest versions, keyed by tool name, that support the flags
+// and features the pipeline relies on.
+var minToolVersions = map[string]string{
+	"python3":     "3.8",
+	"ocrmypdf":    "13",
+	"tesseract":   "4.1",
+	"pdftotext":   "0.62",
+	"ghostscript": "9.50",
+}
 
-	// Define required tools
-	tools := []struct {
-		name    string
-		bin     string
-		version []string
-	}{
-		{"python3", "python3", []string{"--version"}},
-		{"ocrmypdf", "ocrmypdf", []string{"--version"}},
-		{"tesseract", "tesseract", []string{"--version"}},
-		{"pdftotext", "pdftotext", []string{"-v"}},
-	}
+// versionRunner runs version queries for --record-versions and the tool checks before
+// a run; swapped in tests.
+var versionRunner runnerInterface = runner.New()
 
-	var hasErrors bool
+// toolVersion runs a tool's version command and extracts the version string.
+// It returns "OK" when the tool runs but no version can be extracted.
+func toolVersion(ctx context.Context, r runnerInterface, tool pipeline.ToolCheck) (string, error) {
+	opts := runner.RunOpts{
+		Timeout:         10 * time.Second,
+		StderrMode:      runner.Capture, // pdftotext prints to stderr
+		StdoutMode:      runner.Capture,
+		MaxCaptureBytes: 1024,
+	}
+	result, err := r.Run(ctx, tool.Bin, tool.VersionArgs, opts)
+	if err != nil {
+		return "", err
+	}
+	version := extractVersion(result.Stdout + result.Stderr)
+	if version == "" {
+		version = "OK"
+	}
+	return version, nil
+}
 
-	// Check presence and versions
+// recordToolVersions returns the version of each tool required with OCR language lang,
+// keyed by tool name. Tools that are missing or fail to run are recorded as "missing"
+// or "error", and the failures are logged to logger.
+func recordToolVersions(ctx context.Context, r runnerInterface, lang string, logger *slog.Logger) map[string]string {
+	tools := pipeline.RequiredTools(lang)
+	versions := make(map[string]string, len(tools))
 	for _, tool := range tools {
-		// Check presence
-		path, err := r.LookPath(tool.bin)
-		if err != nil {
-			log.Printf("- %s: MISSING", tool.name)
-			hasErrors = true
+		if _, err := r.LookPath(tool.Bin); err != nil {
+			versions[tool.Name] = "missing"
 			continue
 		}
-
-		// Get version
-		opts := runner.RunOpts{
-			Timeout:         10 * time.Second,
-			StderrMode:      runner.StreamAndCapture, // pdftotext prints to stderr
-			StdoutMode:      runner.StreamAndCapture,
-			MaxCaptureBytes: 1024,
-		}
-
-		result, err := r.Run(ctx, tool.bin, tool.version, opts)
+		version, err := toolVersion(ctx, r, tool)
 		if err != nil {
-			log.Printf("- %s: ERROR (%s)", tool.name, err)
-			hasErrors = true
+			logWarn(logger, "failed to query %s version: %v", tool.Name, err)
+			versions[tool.Name] = "error"
 			continue
 		}
+		versions[tool.Name] = version
+	}
+	return versions
+}
 
-		// Extract version from output (stdout or stderr)
-		version := extractVersion(result.Stdout + result.Stderr)
-		if version == "" {
-			version = "OK"
-		}
+// toolStatus values reported by the doctor.
+const (
+	toolOK       = "ok"
+	toolMissing  = "missing"
+	toolError    = "error"
+	toolOutdated = "outdated"
+)
 
-		log.Printf("- %s: OK (%s) [%s]", tool.name, version, path)
-	}
+// toolStatus is the doctor's finding for one external tool.
+type toolStatus struct {
+	Name       string `json:"name"`
+	Present    bool   `json:"present"`
+	Required   bool   `json:"required"`
+	Path       string `json:"path,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Status     string `json:"status"`
+	MinVersion string `json:"min_version,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
 
-	// Optional: Check ghostscript
-	gsPath, err := r.LookPath("gs")
-	if err == nil {
-		opts := runner.RunOpts{
-			Timeout:    10 * time.Second,
-			StdoutMode: runner.Capture,
-			StderrMode: runner.Capture,
-		}
-		result, err := r.Run(ctx, "gs", []string{"--version"}, opts)
-		if err == nil {
-			version := extractVersion(result.Stdout + result.Stderr)
-			if version == "" {
-				version = "OK"
-			}
-			log.Printf("- ghostscript: OK (%s) [%s]", version, gsPath)
-		}
+// smokeStatus is the outcome of doctor --smoke: "passed", "failed" or "skipped".
+type smokeStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// doctorReport is everything the doctor checked. It is printed as log lines, or
+// written as JSON with --json.
+type doctorReport struct {
+	OK                 bool         `json:"ok"`
+	Tools              []toolStatus `json:"tools"`
+	TesseractLanguages []string     `json:"tesseract_languages,omitempty"`
+	Smoke              *smokeStatus `json:"smoke,omitempty"`
+
+	langErr error
+}
+
+// doctorCommand runs the doctor subcommand to validate the toolchain.
+func doctorCommand(args []string) error {
+	return doctorCommandWithRunner(args, runner.New(), os.Stdout)
+}
+
+// doctorCommandWithRunner allows injecting a mock runner for testing. The JSON
+// report of --json is written to w.
+func doctorCommandWithRunner(args []string, r runnerInterface, w io.Writer) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	smoke := fs.Bool("smoke", false, "Run smoke test to verify end-to-end functionality")
+	tmpDir := fs.String("tmp-dir", "", "Directory for smoke test files (default: system temp directory)")
+	logFormat := fs.String("log-format", "text", "Log output format on stderr: text or json (one JSON object per line)")
+	jsonOut := fs.Bool("json", false, "Write the report to stdout as JSON instead of logging it")
+	toolPath := fs.String("tool-path", "", "PATH searched for external tools, with $VAR expanded, as for run")
+	img2pdfCmd := fs.String("img2pdf-cmd", "", "Python interpreter or img2pdf executable to check, as for run (default: python3 -m img2pdf)")
+	lang := fs.String("lang", "", "OCR language a run would use; auto also requires pdftoppm")
+	var binOverrideFlags stringListFlag
+	fs.Var(&binOverrideFlags, "bin-override", binOverrideUsage)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	binOverrides, err := parseBinOverrides(binOverrideFlags)
+	if err != nil {
+		return err
+	}
+	r = withRunnerOverrides(r, binOverrides, toolEnv(*toolPath))
+	logger, err := newLogger(*logFormat, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("invalid --log-format: %w", err)
 	}
 
+	ctx := context.Background()
+	img2pdf := pipeline.ParseImg2PDFCommand(*img2pdfCmd)
+	rep := checkTools(ctx, r, doctorTools(img2pdf, *lang), logger)
+
 	// Smoke test
 	if *smoke {
-		log.Println("Running smoke test...")
+		if !*jsonOut {
+			logInfo(logger, "Running smoke test...")
+		}
+		rep.Smoke = &smokeStatus{Status: "passed"}
 		// Type assertion to *runner.Runner for runSmokeTest
 		if realRunner, ok := r.(*runner.Runner); ok {
-			if err := runSmokeTest(ctx, realRunner); err != nil {
-				log.Printf("Smoke test: FAILED (%v)", err)
-				// In test mode, return error instead of exiting
-				if _, ok := r.(*runner.Runner); !ok {
-					return fmt.Errorf("smoke test failed: %w", err)
-				}
-				os.Exit(2)
+			if err := runSmokeTest(ctx, realRunner, img2pdf, *tmpDir, logger); err != nil {
+				rep.Smoke = &smokeStatus{Status: "failed", Detail: err.Error()}
+				rep.OK = false
 			}
-			log.Println("Smoke test: PASSED")
 		} else {
 			// In tests, skip smoke test if runner is mocked
-			log.Println("Smoke test: SKIPPED (mocked runner)")
+			rep.Smoke = &smokeStatus{Status: "skipped", Detail: "mocked runner"}
+		}
+	}
+
+	if *jsonOut {
+		data, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode doctor report: %w", err)
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write doctor report: %w", err)
 		}
 	} else {
-		log.Println("Smoke test: SKIPPED (use --smoke to run)")
+		logDoctorReport(rep, logger)
 	}
 
-	if hasErrors {
+	if rep.Smoke != nil && rep.Smoke.Status == "failed" {
+		// In test mode, return error instead of exiting
+		if _, ok := r.(*runner.Runner); !ok {
+			return fmt.Errorf("smoke test failed: %s", rep.Smoke.Detail)
+		}
+		os.Exit(2)
+	}
+
+	if !rep.OK {
 		// In test mode, return error instead of exiting
 		// Check if we're in a test by checking if runner is mocked
 		if _, ok := r.(*runner.Runner); !ok {
 			// Mocked runner means we're in a test - return error instead of exiting
-			return fmt.Errorf("doctor found errors: missing or failed tools")
+			return fmt.Errorf("doctor found errors: missing, outdated or failed tools")
 		}
 		os.Exit(1)
 	}
@@ -136,6 +244,129 @@ func doctorCommandWithRunner(args []string, r runnerInterface) error {
 	return nil
 }
 
+// doctorTools returns the tools a run with OCR language lang uses (see
+// pipeline.ToolsForLang) with a check that the img2pdf invocation runs
+// (img2pdf --version) after the other required tools.
+func doctorTools(img2pdf pipeline.Img2PDFCommand, lang string) []pipeline.ToolCheck {
+	tools := make([]pipeline.ToolCheck, 0, len(pipeline.Tools)+1)
+	added := false
+	for _, tool := range pipeline.ToolsForLang(lang) {
+		if !tool.Required && !added {
+			tools = append(tools, img2pdf.ToolCheck())
+			added = true
+		}
+		tools = append(tools, tool)
+	}
+	if !added {
+		tools = append(tools, img2pdf.ToolCheck())
+	}
+	return tools
+}
+
+// checkTools checks the presence and version of every tool in tools and the installed
+// tesseract languages. Only problems with required tools clear rep.OK.
+func checkTools(ctx context.Context, r runnerInterface, tools []pipeline.ToolCheck, logger *slog.Logger) doctorReport {
+	rep := doctorReport{OK: true}
+	for _, tool := range tools {
+		status := checkTool(ctx, r, tool, logger)
+		if status.Status != toolOK && tool.Required {
+			rep.OK = false
+		}
+		rep.Tools = append(rep.Tools, status)
+	}
+
+	// Installed tessdata languages, for --lang and --lang auto
+	if _, err := r.LookPath("tesseract"); err == nil {
+		rep.TesseractLanguages, rep.langErr = tesseractLangs(ctx, r)
+	}
+	return rep
+}
+
+// checkTool finds a tool, queries its version and compares it with minToolVersions.
+func checkTool(ctx context.Context, r runnerInterface, tool pipeline.ToolCheck, logger *slog.Logger) toolStatus {
+	status := toolStatus{Name: tool.Name, Required: tool.Required}
+	path, err := r.LookPath(tool.Bin)
+	if err != nil {
+		status.Status = toolMissing
+		return status
+	}
+	status.Present = true
+	status.Path = path
+
+	version, err := toolVersion(ctx, r, tool)
+	if err != nil {
+		status.Status = toolError
+		status.Error = err.Error()
+		return status
+	}
+	status.Version = version
+	status.Status = toolOK
+	if min, outdated := checkMinVersion(tool.Name, version, logger); outdated {
+		status.Status = toolOutdated
+		status.MinVersion = min
+	}
+	return status
+}
+
+// logDoctorReport logs the report to logger as human-readable lines.
+func logDoctorReport(rep doctorReport, logger *slog.Logger) {
+	logInfo(logger, "Doctor report:")
+	for _, tool := range rep.Tools {
+		optional := ""
+		if !tool.Required {
+			optional = " (optional)"
+		}
+		switch tool.Status {
+		case toolMissing:
+			logInfo(logger, "- %s: MISSING%s", tool.Name, optional)
+		case toolError:
+			logInfo(logger, "- %s: ERROR (%s)%s", tool.Name, tool.Error, optional)
+		case toolOutdated:
+			logInfo(logger, "- %s: OUTDATED (found %s, need ≥%s) [%s]%s", tool.Name, tool.Version, tool.MinVersion, tool.Path, optional)
+		default:
+			logInfo(logger, "- %s: OK (%s) [%s]", tool.Name, tool.Version, tool.Path)
+		}
+	}
+
+	if rep.langErr != nil {
+		logInfo(logger, "- tesseract languages: ERROR (%s)", rep.langErr)
+	} else if len(rep.TesseractLanguages) > 0 {
+		logInfo(logger, "- tesseract languages: %s", strings.Join(rep.TesseractLanguages, ", "))
+	}
+	logInfo(logger, "Note: --lang auto needs tesseract's osd language pack for script detection, plus the pack of every language it may choose (e.g. eng, fra)")
+	logInfo(logger, "Note: --optimize-level 2 and 3 need pngquant; jbig2enc compresses monochrome images when optimizing and is needed for --jbig2-lossy")
+
+	switch {
+	case rep.Smoke == nil:
+		logInfo(logger, "Smoke test: SKIPPED (use --smoke to run)")
+	case rep.Smoke.Status == "failed":
+		logInfo(logger, "Smoke test: FAILED (%s)", rep.Smoke.Detail)
+	case rep.Smoke.Status == "skipped":
+		logInfo(logger, "Smoke test: SKIPPED (%s)", rep.Smoke.Detail)
+	default:
+		logInfo(logger, "Smoke test: PASSED")
+	}
+}
+
+// tesseractLangs returns the languages tesseract has tessdata for, sorted.
+func tesseractLangs(ctx context.Context, r runnerInterface) ([]string, error) {
+	opts := runner.RunOpts{
+		Timeout:    10 * time.Second,
+		StdoutMode: runner.Capture,
+		StderrMode: runner.Capture,
+	}
+	result, err := r.Run(ctx, "tesseract", []string{"--list-langs"}, opts)
+	if err != nil {
+		return nil, err
+	}
+	langs := pipeline.ParseTessLangs(result.Stdout + result.Stderr)
+	if len(langs) == 0 {
+		return nil, fmt.Errorf("no languages listed")
+	}
+	sort.Strings(langs)
+	return langs, nil
+}
+
 // extractVersion extracts a version string from command output.
 func extractVersion(output string) string {
 	// Try to find version patterns
@@ -169,16 +400,88 @@ func extractVersion(output string) string {
 	return ""
 }
 
-// runSmokeTest performs an end-to-end smoke test.
-func runSmokeTest(ctx context.Context, r *runner.Runner) error {
-	tmpDir, err := os.MkdirTemp("", "doctor-smoke-*")
+// checkMinVersion reports whether the version found for a tool is older than its
+// entry in minToolVersions, and returns that minimum. A version that cannot be
+// parsed is logged as a warning and not treated as outdated.
+func checkMinVersion(name, found string, logger *slog.Logger) (string, bool) {
+	min, ok := minToolVersions[name]
+	if !ok {
+		return "", false
+	}
+	have, err := parseVersion(found)
+	if err != nil {
+		logWarn(logger, "cannot check %s version against minimum %s: %v", name, min, err)
+		return min, false
+	}
+	want, err := parseVersion(min)
+	if err != nil {
+		logWarn(logger, "invalid minimum version %q for %s: %v", min, name, err)
+		return min, false
+	}
+	return min, compareVersions(have, want) < 0
+}
+
+// parseVersion parses the first dotted number in s into its numeric components,
+// ignoring any prefix or suffix: "GPL Ghostscript 10.0.0" gives [10 0 0], and
+// "v5.0.0-dev" gives [5 0 0].
+func parseVersion(s string) ([]int, error) {
+	for _, field := range strings.Fields(s) {
+		field = strings.TrimPrefix(strings.TrimPrefix(field, "v"), "V")
+		end := 0
+		for end < len(field) && (field[end] >= '0' && field[end] <= '9' || field[end] == '.') {
+			end++
+		}
+		numeric := strings.Trim(field[:end], ".")
+		if numeric == "" || numeric[0] < '0' || numeric[0] > '9' {
+			continue
+		}
+		var parts []int
+		for _, p := range strings.Split(numeric, ".") {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q: %w", s, err)
+			}
+			parts = append(parts, n)
+		}
+		return parts, nil
+	}
+	return nil, fmt.Errorf("no version number in %q", s)
+}
+
+// compareVersions compares two parsed versions component by component, treating
+// missing components as zero. It returns -1, 0 or 1.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// runSmokeTest performs an end-to-end smoke test, running img2pdf as img2pdf says,
+// in a temp directory under tmpRoot, or under the system temp directory if tmpRoot
+// is empty.
+// Its temp directory name carries the PID and a random suffix so concurrent runs don't collide.
+func runSmokeTest(ctx context.Context, r runnerInterface, img2pdf pipeline.Img2PDFCommand, tmpRoot string, logger *slog.Logger) error {
+	tmpDir, err := os.MkdirTemp(tmpRoot, fmt.Sprintf("doctor-smoke-%d-*", os.Getpid()))
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer func() {
 		if err := os.RemoveAll(tmpDir); err != nil {
 			// Log but don't fail the test - cleanup errors are non-fatal
-			log.Printf("warning: failed to clean up temp directory %s: %v", tmpDir, err)
+			logWarn(logger, "failed to clean up temp directory %s: %v", tmpDir, err)
 		}
 	}()
 
@@ -197,7 +500,7 @@ func runSmokeTest(ctx context.Context, r *runner.Runner) error {
 		Dir:        tmpDir,
 	}
 
-	result, err := r.Run(ctx, "python3", []string{"-m", "img2pdf", testImage, "-o", testPDF}, opts)
+	result, err := r.Run(ctx, img2pdf.Bin, append(append([]string{}, img2pdf.Args...), testImage, "-o", testPDF), opts)
 	if err != nil {
 		return fmt.Errorf("img2pdf failed: %w (stderr: %s)", err, result.Stderr)
 	}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/ingest"
+)
+
+// findDuplicatesCommand reports groups of duplicate images without running OCR.
+func findDuplicatesCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("find-duplicates", flag.ContinueOnError)
+	inputDir := fs.String("input", "input", "Input directory containing images")
+	recursive := fs.Bool("recursive", true, "Recursively search subdirectories for images")
+	hashMethod := fs.String("hash", "sha256", "Hash method: sha256 (byte-identical images)")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	var hasher ingest.ImageHasher
+	switch *hashMethod {
+	case "sha256":
+		hasher = ingest.ByteHash
+	case "perceptual":
+		// Hook for a future perceptual hash of visually similar images
+		return fmt.Errorf("perceptual hashing is not supported yet")
+	default:
+		return fmt.Errorf("unknown hash method: %s", *hashMethod)
+	}
+
+	images, err := ingest.ListImages(*inputDir, *recursive)
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+
+	groups, err := ingest.FindDuplicates(images, hasher)
+	if err != nil {
+		return err
+	}
+
+	duplicateCount := 0
+	for i, g := range groups {
+		_, _ = fmt.Fprintf(w, "duplicate group %d (%s %s):\n", i+1, *hashMethod, g.Hash)
+		for _, path := range g.Paths {
+			_, _ = fmt.Fprintf(w, "  %s\n", path)
+		}
+		duplicateCount += len(g.Paths) - 1
+	}
+	_, _ = fmt.Fprintf(w, "images scanned: %d, duplicate groups: %d, redundant images: %d\n", len(images), len(groups), duplicateCount)
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/pipeline"
+)
+
+// event is a single NDJSON progress record emitted with --json-events.
+type event struct {
+	Event  string         `json:"event"`            // "stage_start", "stage_done", "stage_skipped", "stage_failed", or "run_done"
+	Stage  string         `json:"stage,omitempty"`  // Pipeline stage name (e.g., "ocr")
+	MS     *int64         `json:"ms,omitempty"`     // Elapsed milliseconds (done events only)
+	Counts map[string]int `json:"counts,omitempty"` // Stage-specific counts (e.g., chunks kept)
+	Error  string         `json:"error,omitempty"`  // Failure message (stage_failed only)
+}
+
+// eventEmitter writes progress events as newline-delimited JSON and forwards
+// stage boundaries to a pipeline.Progress.
+// A nil emitter is valid and discards all events.
+type eventEmitter struct {
+	mu       sync.Mutex
+	enc      *json.Encoder // nil disables NDJSON events
+	progress pipeline.Progress
+}
+
+// newEventEmitter returns an emitter writing to w and reporting to progress,
+// or nil if both are nil.
+func newEventEmitter(w io.Writer, progress pipeline.Progress) *eventEmitter {
+	if w == nil && progress == nil {
+		return nil
+	}
+	e := &eventEmitter{progress: pipeline.ProgressOrNop(progress)}
+	if w != nil {
+		e.enc = json.NewEncoder(w)
+	}
+	return e
+}
+
+func (e *eventEmitter) emit(ev event) {
+	if e == nil || e.enc == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// Events are best effort; a broken consumer must not fail the run
+	_ = e.enc.Encode(ev)
+}
+
+// stageStart records the beginning of a stage and returns its start time.
+func (e *eventEmitter) stageStart(stage string) time.Time {
+	return e.stageStartTotal(stage, 0)
+}
+
+// stageStartTotal is stageStart for a stage that reports progress over total items.
+func (e *eventEmitter) stageStartTotal(stage string, total int) time.Time {
+	if e != nil {
+		e.progress.StageStart(stage, total)
+	}
+	e.emit(event{Event: "stage_start", Stage: stage})
+	return time.Now()
+}
+
+// stageProgress reports the number of items a stage has finished.
+// Progress is not written as NDJSON events.
+func (e *eventEmitter) stageProgress(stage string, done int) {
+	if e != nil {
+		e.progress.StageProgress(stage, done)
+	}
+}
+
+// stageDone records a finished stage with its elapsed time and optional counts.
+func (e *eventEmitter) stageDone(stage string, start time.Time, counts map[string]int) {
+	if e != nil {
+		e.progress.StageDone(stage)
+	}
+	ms := time.Since(start).Milliseconds()
+	e.emit(event{Event: "stage_done", Stage: stage, MS: &ms, Counts: counts})
+}
+
+// stageSkipped records a stage that did not run (e.g., served from the OCR cache).
+func (e *eventEmitter) stageSkipped(stage string) {
+	e.emit(event{Event: "stage_skipped", Stage: stage})
+}
+
+// stageFailed records a stage that returned an error. The stage is also reported
+// done to the progress reporter.
+func (e *eventEmitter) stageFailed(stage string, err error) {
+	if e != nil {
+		e.progress.StageDone(stage)
+	}
+	e.emit(event{Event: "stage_failed", Stage: stage, Error: err.Error()})
+}
+
+// runDone records the end of a successful run.
+func (e *eventEmitter) runDone(start time.Time) {
+	ms := time.Since(start).Milliseconds()
+	e.emit(event{Event: "run_done", MS: &ms})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// newLogger returns the logger of a --log-format. "text" (or empty) returns nil: the
+// standard log lines are kept. "json" returns a logger writing one JSON object per
+// line to w with time, level and msg fields; finished stages add stage and
+// duration_ms fields.
+func newLogger(format string, w io.Writer) (*slog.Logger, error) {
+	switch format {
+	case "", "text":
+		return nil, nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q: must be text or json", format)
+	}
+}
+
+// logInfo logs a progress line: a standard log line in text mode (nil logger), level
+// INFO in JSON mode.
+func logInfo(logger *slog.Logger, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if logger != nil {
+		logger.Info(msg)
+		return
+	}
+	log.Print(msg)
+}
+
+// logWarn logs a non-fatal problem: "warning: ..." in text mode, level WARN in JSON mode.
+func logWarn(logger *slog.Logger, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if logger != nil {
+		logger.Warn(msg)
+		return
+	}
+	log.Printf("warning: %s", msg)
+}
+
+// logFatal logs the error that ends the command and exits with status 1: "error: ..."
+// in text mode, level ERROR in JSON mode.
+func logFatal(logger *slog.Logger, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if logger != nil {
+		logger.Error(msg)
+		os.Exit(1)
+	}
+	log.Fatalf("error: %s", msg)
+}
+
+// logStageDone logs the end of a timed stage: "msg (took 1.2s)" in text mode, or msg
+// with stage, duration_ms and any extra key/value attrs in JSON mode.
+func logStageDone(logger *slog.Logger, stage string, start time.Time, msg string, attrs ...any) {
+	elapsed := time.Since(start)
+	if logger != nil {
+		logger.Info(msg, append([]any{"stage", stage, "duration_ms", elapsed.Milliseconds()}, attrs...)...)
+		return
+	}
+	log.Printf("%s (took %v)", msg, elapsed)
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/jonkmatsumo/bulk-ocr/internal/cache"
 	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
 	"github.com/jonkmatsumo/bulk-ocr/internal/ingest"
 	"github.com/jonkmatsumo/bulk-ocr/internal/pipeline"
 	"github.com/jonkmatsumo/bulk-ocr/internal/report"
@@ -20,25 +32,42 @@ const version = "0.0.1"
 
 // pipelineStages interface for mocking pipeline operations in tests
 type pipelineStages interface {
-	BuildPDF(preprocessedDir, outputDir string, timeout time.Duration) (string, error)
-	OCRPDF(pdfPath, outputDir, lang string, timeout time.Duration) (string, error)
-	ExtractText(pdfPath, outputDir string, timeout time.Duration) (string, error)
+	BuildPDF(ctx context.Context, preprocessedDir, outputDir string, timeout time.Duration) (string, error)
+	MergePDFs(ctx context.Context, pdfPaths []string, outputDir string, timeout time.Duration) (string, error)
+	OCRPDF(ctx context.Context, pdfPath, outputDir, lang string, opts pipeline.OCROptions, timeout time.Duration) (string, error)
+	OCRPDFWithSidecar(ctx context.Context, pdfPath, outputDir, lang string, opts pipeline.OCROptions, minChars int, timeout time.Duration) (string, string, error)
+	ExtractText(ctx context.Context, pdfPath, outputDir string, mode pipeline.PDFToTextMode, minChars int, timeout time.Duration) (string, error)
+	DetectLanguage(ctx context.Context, pdfPath string, timeout time.Duration) (string, error)
 	CleanupArtifact(path string) error
 }
 
 // realPipelineStages implements pipelineStages using actual pipeline functions
-type realPipelineStages struct{}
+type realPipelineStages struct {
+	exec pipeline.ExecOptions // How the stages run external commands
+}
+
+func (r *realPipelineStages) BuildPDF(ctx context.Context, preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+	return pipeline.BuildPDF(ctx, r.exec, preprocessedDir, outputDir, timeout)
+}
+
+func (r *realPipelineStages) MergePDFs(ctx context.Context, pdfPaths []string, outputDir string, timeout time.Duration) (string, error) {
+	return pipeline.MergePDFs(ctx, r.exec, pdfPaths, outputDir, timeout)
+}
+
+func (r *realPipelineStages) OCRPDF(ctx context.Context, pdfPath, outputDir, lang string, opts pipeline.OCROptions, timeout time.Duration) (string, error) {
+	return pipeline.OCRPDF(ctx, r.exec, pdfPath, outputDir, lang, opts, timeout)
+}
 
-func (r *realPipelineStages) BuildPDF(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
-	return pipeline.BuildPDF(preprocessedDir, outputDir, timeout)
+func (r *realPipelineStages) OCRPDFWithSidecar(ctx context.Context, pdfPath, outputDir, lang string, opts pipeline.OCROptions, minChars int, timeout time.Duration) (string, string, error) {
+	return pipeline.OCRPDFWithSidecar(ctx, r.exec, pdfPath, outputDir, lang, opts, minChars, timeout)
 }
 
-func (r *realPipelineStages) OCRPDF(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
-	return pipeline.OCRPDF(pdfPath, outputDir, lang, timeout)
+func (r *realPipelineStages) ExtractText(ctx context.Context, pdfPath, outputDir string, mode pipeline.PDFToTextMode, minChars int, timeout time.Duration) (string, error) {
+	return pipeline.ExtractText(ctx, r.exec, pdfPath, outputDir, mode, minChars, timeout)
 }
 
-func (r *realPipelineStages) ExtractText(pdfPath, outputDir string, timeout time.Duration) (string, error) {
-	return pipeline.ExtractText(pdfPath, outputDir, timeout)
+func (r *realPipelineStages) DetectLanguage(ctx context.Context, pdfPath string, timeout time.Duration) (string, error) {
+	return pipeline.DetectLanguage(ctx, r.exec, pdfPath, timeout)
 }
 
 func (r *realPipelineStages) CleanupArtifact(path string) error {
@@ -48,81 +77,896 @@ func (r *realPipelineStages) CleanupArtifact(path string) error {
 // pipelineStagesImpl is a package-level variable that can be swapped in tests
 var pipelineStagesImpl pipelineStages = &realPipelineStages{}
 
+// stagesWithExec returns the stages of a run with exec options execOpts: new real
+// stages carrying them, or stages itself if tests swapped in a mock.
+func stagesWithExec(stages pipelineStages, execOpts pipeline.ExecOptions) pipelineStages {
+	if _, ok := stages.(*realPipelineStages); ok {
+		return &realPipelineStages{exec: execOpts}
+	}
+	return stages
+}
+
 func main() {
-	// Check if first arg is a subcommand (not a flag)
-	// If so, we need to handle flag parsing differently
+	// The first arg selects a subcommand unless it is a flag ("run" is the default).
+	// Each subcommand parses the remaining args with its own flag set.
 	subcommand := "run"
 	args := os.Args[1:]
 	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
 		subcommand = args[0]
 		args = args[1:]
-		// Reconstruct os.Args without subcommand for flag parsing
-		// This allows flags to come after subcommand: "pipeline run --input X"
-		os.Args = append([]string{os.Args[0]}, args...)
 	}
 
-	var (
-		inputDir         = flag.String("input", "input", "Input directory containing images")
-		outputDir        = flag.String("out", "output", "Output directory for results")
-		keepArtifacts    = flag.Bool("keep-artifacts", true, "Keep intermediate artifacts")
-		lang             = flag.String("lang", "eng", "OCR language")
-		recursive        = flag.Bool("recursive", true, "Recursively search subdirectories for images")
-		pdfTimeout       = flag.Duration("pdf-timeout", 5*time.Minute, "Timeout for PDF synthesis")
-		ocrTimeout       = flag.Duration("ocr-timeout", 10*time.Minute, "Timeout for OCR processing")
-		extractTimeout   = flag.Duration("extract-timeout", 2*time.Minute, "Timeout for text extraction")
-		minChunkChars    = flag.Int("min-chunk-chars", 60, "Minimum chunk size in characters")
-		maxBlankLines    = flag.Int("max-blank-lines", 2, "Maximum consecutive blank lines to split on")
-		emitChunksJSONL  = flag.Bool("emit-chunks-jsonl", true, "Emit debug JSONL file with chunks")
-		chromeRegexFlags = flag.String("chrome-regex", "", "Custom chrome filtering regex pattern (can be repeated)")
-		simhashK         = flag.Int("simhash-k", 5, "Character k-gram size for SimHash")
-		simhashThreshold = flag.Int("simhash-threshold", 6, "Hamming distance threshold for SimHash")
-		window           = flag.Int("window", 250, "Sliding window size for deduplication")
-		dedupeMethod     = flag.String("dedupe", "simhash", "Deduplication method: exact, simhash, or both")
-		markdownTitle    = flag.String("markdown-title", "Extracted Notes", "Title for Markdown document")
-		includeChunkIDs  = flag.Bool("include-chunk-ids", false, "Include chunk IDs as HTML comments in Markdown")
-	)
-
-	flag.Parse()
-
-	// Get remaining args after flag parsing
-	remainingArgs := flag.Args()
-
 	switch subcommand {
 	case "run":
-		// Collect chrome regex patterns (for now, single flag; can be extended to repeatable)
-		chromePatterns := text.DefaultChromePatterns()
-		if *chromeRegexFlags != "" {
-			chromePatterns = append(chromePatterns, *chromeRegexFlags)
+		cfg, err := parseRunConfig(args)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
 		}
-		if err := runCommand(*inputDir, *outputDir, *keepArtifacts, *lang, *recursive, *pdfTimeout, *ocrTimeout, *extractTimeout, *minChunkChars, *maxBlankLines, *emitChunksJSONL, chromePatterns, *simhashK, *simhashThreshold, *window, *dedupeMethod, *markdownTitle, *includeChunkIDs); err != nil {
+		if err != nil {
 			log.Fatalf("error: %v", err)
 		}
+		if cfg.DumpConfigExit {
+			data, err := resolvedConfigJSON(cfg)
+			if err != nil {
+				logFatal(cfg.logger, "%v", err)
+			}
+			os.Stdout.Write(data)
+			return
+		}
+		// SIGINT/SIGTERM cancel the run, which kills the external command in progress
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err = runCommand(ctx, cfg)
+		interrupted := ctx.Err() != nil
+		stop()
+		if err != nil && interrupted {
+			logFatal(cfg.logger, "interrupted: %v", err)
+		}
+		if err != nil {
+			logFatal(cfg.logger, "%v", err)
+		}
 	case "doctor":
-		doctorArgs := remainingArgs
-		if err := doctorCommand(doctorArgs); err != nil {
+		if err := doctorCommand(args); err != nil {
 			log.Fatalf("doctor failed: %v", err)
 		}
+	case "find-duplicates":
+		if err := findDuplicatesCommand(args, os.Stdout); err != nil {
+			log.Fatalf("find-duplicates failed: %v", err)
+		}
+	case "clean":
+		if err := cleanCommand(args, os.Stdout); err != nil {
+			log.Fatalf("clean failed: %v", err)
+		}
+	case "watch":
+		if err := watchCommand(args); err != nil {
+			log.Fatalf("watch failed: %v", err)
+		}
+	case "selftest":
+		if err := selftestCommand(args, os.Stdout); err != nil {
+			log.Fatalf("selftest failed: %v", err)
+		}
 	case "version":
 		fmt.Printf("pipeline version %s\n", version)
 		os.Exit(0)
 	default:
 		fmt.Printf("unknown subcommand: %s\n", subcommand)
-		fmt.Println("Available subcommands: run, doctor, version")
+		fmt.Println("Available subcommands: run, watch, doctor, find-duplicates, clean, selftest, version")
 		os.Exit(1)
 	}
 }
 
-func runCommand(inputDir, outputDir string, keepArtifacts bool, lang string, recursive bool, pdfTimeout, ocrTimeout, extractTimeout time.Duration, minChunkChars, maxBlankLines int, emitChunksJSONL bool, chromePatterns []string, simhashK, simhashThreshold, window int, dedupeMethod, markdownTitle string, includeChunkIDs bool) error {
-	// Validate input directory
-	if _, err := os.Stat(inputDir); os.IsNotExist(err) {
-		return fmt.Errorf("input directory does not exist: %s", inputDir)
+// parseRunConfig parses the run subcommand's flags into a resolved runConfig.
+// Flag defaults apply first; explicit flags override them, and shortcut flags
+// such as --global-dedup are applied last.
+func parseRunConfig(args []string) (runConfig, error) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	var (
+		configPath       = fs.String("config", "", "YAML file of run flags (keys are flag names); flags on the command line take precedence")
+		inputDir         = fs.String("input", "input", "Input directory containing images")
+		outputDir        = fs.String("out", "output", "Output directory for results")
+		keepArtifacts    = fs.Bool("keep-artifacts", true, "Keep intermediate artifacts")
+		lang             = fs.String("lang", "eng", "OCR language, or \"auto\" to detect it from the first pages of the PDF")
+		langMap          = fs.String("lang-map", "", "OCR languages by page range, e.g. 1-50:eng,51-100:fra (pages outside the ranges use --lang)")
+		recursive        = fs.Bool("recursive", true, "Recursively search subdirectories for images")
+		since            = fs.Duration("since", 0, "Only process images modified within this duration before the run starts (e.g. 24h; 0 = all)")
+		sinceTime        = fs.String("since-time", "", "Only process images modified at or after this time (RFC3339 or YYYY-MM-DD)")
+		sortMode         = fs.String("sort-mode", string(ingest.SortNatural), "Page order of input images: natural, lexical, mtime, or exifdate (EXIF capture time, falling back to mtime)")
+		reverseOrder     = fs.Bool("reverse", false, "Reverse the page order of input images, e.g. newest first with --sort-mode mtime")
+		orderFile        = fs.String("order-file", "", "File listing image file names, one per line, in page order; unlisted images follow in natural order")
+		maxImages        = fs.Int("max-images", 0, "Stop before processing if --input has more than this many images (0 disables)")
+		maxTotalBytes    = fs.Int64("max-total-bytes", 0, "Stop before processing if the images in --input total more than this many bytes (0 disables)")
+		pdfTimeout       = fs.Duration("pdf-timeout", 5*time.Minute, "Timeout for PDF synthesis")
+		ocrTimeout       = fs.Duration("ocr-timeout", 10*time.Minute, "Timeout for OCR processing")
+		extractTimeout   = fs.Duration("extract-timeout", 2*time.Minute, "Timeout for text extraction")
+		totalTimeout     = fs.Duration("total-timeout", 0, "Deadline for the whole run; stage timeouts are shortened to the time left (0 disables)")
+		minChunkChars    = fs.Int("min-chunk-chars", 60, "Minimum chunk size in characters")
+		noiseCharRatio   = fs.Float64("noise-char-ratio", 0, "Drop chunks where the two most frequent characters exceed this fraction of non-space characters, such as \"|||||\" from scanned borders (e.g. 0.7; 0 = off)")
+		minWords         = fs.Int("min-words", 0, "Drop chunks with fewer words than this after chrome filtering, such as runs of OCR noise (0 = off; text without spaces, e.g. Chinese, is exempt)")
+		maxBlankLines    = fs.Int("max-blank-lines", 1, "Consecutive blank lines needed to split chunks; fewer stay within a chunk")
+		emitChunksJSONL  = fs.Bool("emit-chunks-jsonl", true, "Emit debug JSONL file with chunks")
+		distanceHist     = fs.Bool("distance-histogram", false, "Write distance_histogram.json counting chunks by SimHash distance to their nearest kept chunk")
+		emitAlignment    = fs.Bool("emit-alignment-tsv", false, "Write alignment.tsv mapping kept chunks to source pages")
+		emitKeptJSONL    = fs.Bool("emit-kept-jsonl", false, "Write kept_chunks.jsonl with the kept chunks and the IDs of the duplicates dropped into each")
+		debugFiltered    = fs.Bool("debug-filtered", false, "Write filtered_out.jsonl with every chunk removed by min-chars, chrome filtering or dedup, and why")
+		chunksJSONLPath  = fs.String("chunks-jsonl-path", "", "Destination for the debug chunks JSONL (default: <out>/chunks_raw.jsonl)")
+		noDefaultChrome  = fs.Bool("no-default-chrome", false, "Use only --chrome-regex patterns instead of adding them to the built-in ones")
+		simhashK         = fs.Int("simhash-k", 5, "Character k-gram size for SimHash")
+		simhashThreshold = fs.Int("simhash-threshold", 6, "Hamming distance threshold for SimHash")
+		shortChunkLength = fs.Int("short-chunk-length", 0, "Chunks shorter than this many characters are compared by Levenshtein ratio instead of SimHash (default and minimum: --simhash-k)")
+		shortChunkRatio  = fs.Float64("short-chunk-ratio", 0.8, "Minimum Levenshtein ratio (0-1) at which a short chunk is a near-duplicate")
+		window           = fs.Int("window", 250, "Sliding window size for deduplication (0 = compare all, -1 = indexed global)")
+		globalDedup      = fs.Bool("global-dedup", false, "Match SimHash duplicates across the whole document via an index (same as --window=-1)")
+		dedupeMethod     = fs.String("dedupe", "simhash", "Deduplication method: exact, simhash, both, minhash, or jaccard")
+		parallelBoth     = fs.Bool("dedupe-parallel-both", false, "With --dedupe both, run the exact and SimHash passes concurrently")
+		shingleK         = fs.Int("shingle-k", 5, "Character shingle size for MinHash and Jaccard")
+		minhashHashes    = fs.Int("minhash-hashes", 128, "Number of MinHash functions")
+		minhashBands     = fs.Int("minhash-bands", 16, "Number of LSH bands (must divide --minhash-hashes)")
+		minhashThreshold = fs.Float64("minhash-threshold", 0.7, "Minimum estimated Jaccard similarity for MinHash duplicates")
+		jaccardThreshold = fs.Float64("jaccard-threshold", 0.8, "Jaccard similarity (0-1) above which --dedupe jaccard drops a chunk")
+		dedupState       = fs.String("dedup-state", "", "Persistent signature store for dropping chunks seen in previous runs (disabled if empty)")
+		keepStrategy     = fs.String("keep-strategy", "first", "Which chunk of a duplicate group to keep: first or longest")
+		outputFormat     = fs.String("output-format", "md", "Result formats to write: md (result.md), json (result.json), txt (result.txt), or all")
+		markdownTitle    = fs.String("markdown-title", "Extracted Notes", "Title for Markdown document")
+		includeChunkIDs  = fs.Bool("include-chunk-ids", false, "Include chunk IDs as HTML comments in Markdown")
+		suggestChrome    = fs.Bool("suggest-chrome", false, "Write the most frequent short chunks to chrome_suggestions.txt as candidate chrome patterns")
+		showPages        = fs.Bool("show-pages", false, "Prefix each chunk in Markdown with its source page number")
+		frontmatter      = fs.Bool("frontmatter", false, "Start Markdown with YAML frontmatter (title, date, source image count, chunk count)")
+		frontmatterDate  = fs.String("frontmatter-date-format", "", "Go time layout for the frontmatter date (default: RFC3339)")
+		deterministic    = fs.Bool("deterministic", false, "Make repeated runs on the same input write identical outputs: record --timestamp, SOURCE_DATE_EPOCH or the Unix epoch instead of the current time")
+		timestamp        = fs.String("timestamp", "", "RFC3339 time to record as the report timestamp and frontmatter date instead of the current time")
+		recordVersions   = fs.Bool("record-versions", false, "Record external tool versions in dedupe_report.json")
+		toc              = fs.Bool("toc", false, "Add a table of contents linking to a heading per chunk in Markdown")
+		chunkHeading     = fs.Int("chunk-heading-level", 0, "Markdown heading level (1-6) of a heading before each chunk; 0 for none (2 with --toc)")
+		separatorRule    = fs.Bool("separator-rule", false, "Separate Markdown chunks with a horizontal rule (---)")
+		cleanDisplay     = fs.Bool("clean-display", false, "Collapse repeated spaces and tabs in Markdown chunk text, keeping case and punctuation")
+		chunkLabel       = fs.String("chunk-label", "", "Go template for chunk headings, using .ID, .Index, .Page and .SourceFile, e.g. \"Page {{.Page}}\" (default: \"Chunk <id>\")")
+		appendSummary    = fs.Bool("append-summary", false, "Append a Processing Summary table of run statistics and settings to result.md")
+		appendResult     = fs.Bool("append", false, "Append the chunks to an existing result.md, without repeating its title, instead of replacing it")
+		dryRun           = fs.Bool("dry-run", false, "Log the img2pdf, ocrmypdf and pdftotext commands without running them (images are still staged)")
+		img2pdfCmd       = fs.String("img2pdf-cmd", "", "Python interpreter to run img2pdf as a module with (e.g. /opt/venv/bin/python), or an img2pdf executable (default: python3 -m img2pdf)")
+		toolPath         = fs.String("tool-path", "", "PATH searched for external tools and passed to them, with $VAR expanded, e.g. /opt/venv/bin:$PATH (default: the current PATH)")
+		commandLogPath   = fs.String("command-log", "", "Append a JSONL entry with the command line, exit code, duration and stderr tail of every external command run to this file")
+		pdftotextMode    = fs.String("pdftotext-mode", string(pipeline.PDFToTextLayout), "pdftotext output mode: layout, raw, bbox, or htmlmeta (bbox and htmlmeta also keep extracted.html)")
+		minExtracted     = fs.Int("min-extracted-chars", pipeline.DefaultMinExtractedChars, "Minimum length of extracted text; shorter text fails the run unless --allow-empty")
+		allowEmpty       = fs.Bool("allow-empty", false, "Continue with extracted text below --min-extracted-chars, recording a warning in the report")
+		ocrPolicy        = fs.String("ocr-policy", string(pipeline.OCRPolicySkip), "What OCR does with pages that already have text: skip them, force (rasterize and OCR again), or redo (replace earlier OCR only)")
+		pdfaLevel        = fs.String("pdfa-level", "", "PDF/A part of the OCR PDF: 1, 2 or 3 (ocrmypdf --output-type pdfa-N), or none for a plain PDF (default: ocrmypdf's own)")
+		optimizeLevel    = fs.String("optimize-level", "", "ocrmypdf --optimize level of the OCR PDF, 0 (off) to 3; 2 and 3 need pngquant (default: ocrmypdf's own)")
+		jbig2Lossy       = fs.Bool("jbig2-lossy", false, "Allow lossy JBIG2 compression of monochrome images in the OCR PDF (needs jbig2enc and --optimize-level 1 or more)")
+		useSidecar       = fs.Bool("use-sidecar", false, "Take extracted.txt from ocrmypdf --sidecar output instead of running pdftotext afterwards")
+		optimizePNGs     = fs.Bool("optimize-pngs", false, "Re-encode staged PNGs at maximum compression before building the PDF")
+		maxDimension     = fs.Int("max-dimension", 0, "Downscale staged images whose longest edge exceeds this many pixels (0 disables)")
+		preprocess       = fs.String("preprocess", "none", "Pixel preprocessing of staged images: none, grayscale, or threshold (Otsu binarization to PNG)")
+		autoOrient       = fs.Bool("auto-orient", false, "Rotate staged JPEGs upright according to their EXIF orientation tag, then drop the tag")
+		strict           = fs.Bool("strict", false, "Fail the run on an unreadable or corrupt input image instead of skipping it with a warning")
+		stageRetries     = fs.Int("stage-retries", 0, "Retries per image for transient copy errors while staging (missing sources are not retried)")
+		parallelStages   = fs.Int("parallel-stages", 0, "OCR each image separately, overlapping staging, OCR and extraction of up to N images (0 or 1 OCRs one combined PDF)")
+		cacheDir         = fs.String("cache-dir", "", "Directory for cached OCR text keyed by image content hash (disabled if empty)")
+		stripPageNumbers = fs.Bool("strip-page-numbers", false, "Remove lines that contain only a page number (e.g. \"42\", \"Page 3 of 10\") before chunking")
+		dehyphenate      = fs.Bool("dehyphenate", false, "Join words hyphenated across line breaks (e.g. \"informa-\" and \"tion\") before chunking")
+		stripURLs        = fs.Bool("strip-urls", false, "Remove URLs from normalized text before chrome filtering and deduplication")
+		stripURLsText    = fs.Bool("strip-urls-text", false, "Also remove URLs from the rendered chunk text (requires --strip-urls)")
+		foldAccents      = fs.Bool("fold-accents", false, "Strip diacritics from normalized text so accented and unaccented spellings dedupe together")
+		normalizeSteps   = fs.String("normalize-steps", "", "Ordered transforms building normalized text, from unicode, quotes, ligatures, accents, lowercase (default: unicode,lowercase)")
+		unicodeForm      = fs.String("unicode-form", "nfc", "Unicode normalization form for hashing: nfc or nfkc")
+		force            = fs.Bool("force", false, "Rerun PDF synthesis, OCR and extraction even if artifacts from an earlier run are up to date")
+		partialOnTimeout = fs.Bool("partial-on-timeout", false, "On a stage timeout, keep completed artifacts and write run_summary.json marking the run partial")
+		inputTextGlob    = fs.String("input-text-glob", "", "Re-dedup existing text files matching this glob instead of OCRing images")
+		textSeparator    = fs.String("text-separator", `\f`, "Separator placed between files in --input-text-glob mode (Go escapes such as \\n and \\f are interpreted)")
+		exactPreview     = fs.Bool("exact-first-preview", false, "Write result_exact.md after the fast exact-hash pass, before near-duplicate detection")
+		reportFormat     = fs.String("report-format", "json", "Deduplication report formats, comma-separated: json, csv, html, or both (json and csv)")
+		logFormat        = fs.String("log-format", "text", "Log output format on stderr: text or json (one JSON object per line)")
+		jsonEvents       = fs.Bool("json-events", false, "Emit NDJSON progress events to stdout (logs stay on stderr)")
+		dumpConfig       = fs.Bool("dump-config", false, "Write the resolved configuration to <out>/resolved_config.json before running")
+		dumpConfigExit   = fs.Bool("dump-config-exit", false, "Print the resolved configuration as JSON to stdout and exit without running")
+	)
+
+	var chromeRegexFlags stringListFlag
+	fs.Var(&chromeRegexFlags, "chrome-regex", "Custom chrome filtering regex pattern (can be repeated)")
+	var includeFlags, excludeFlags stringListFlag
+	var inputPDFFlags stringListFlag
+	fs.Var(&inputPDFFlags, "input-pdf", "OCR this existing PDF instead of the images in --input; repeat to merge several PDFs in order (needs qpdf)")
+	fs.Var(&includeFlags, "include", "Only process images whose path relative to --input matches this glob; a pattern without a slash matches the file name (can be repeated)")
+	fs.Var(&excludeFlags, "exclude", "Skip images and directories whose path relative to --input matches this glob, e.g. thumbnails (can be repeated)")
+	var binOverrideFlags stringListFlag
+	fs.Var(&binOverrideFlags, "bin-override", binOverrideUsage)
+
+	if err := fs.Parse(args); err != nil {
+		return runConfig{}, err
+	}
+
+	var fileChromePatterns []string
+	if *configPath != "" {
+		var err error
+		fileChromePatterns, err = applyConfigFile(fs, *configPath)
+		if err != nil {
+			return runConfig{}, err
+		}
+	}
+
+	// Collect chrome regex patterns; command-line patterns replace the config file's list
+	var chromePatterns []string
+	if !*noDefaultChrome {
+		chromePatterns = text.DefaultChromePatterns()
+	}
+	if len(chromeRegexFlags) > 0 {
+		chromePatterns = append(chromePatterns, chromeRegexFlags...)
+	} else {
+		chromePatterns = append(chromePatterns, fileChromePatterns...)
+	}
+	if _, err := text.CompileChromePatterns(chromePatterns); err != nil {
+		return runConfig{}, fmt.Errorf("invalid --chrome-regex: %w", err)
+	}
+	if err := ingest.ValidatePatterns(includeFlags); err != nil {
+		return runConfig{}, fmt.Errorf("invalid --include: %w", err)
+	}
+	if err := ingest.ValidatePatterns(excludeFlags); err != nil {
+		return runConfig{}, fmt.Errorf("invalid --exclude: %w", err)
+	}
+	separator, err := strconv.Unquote(`"` + *textSeparator + `"`)
+	if err != nil {
+		return runConfig{}, fmt.Errorf("invalid --text-separator %q: %w", *textSeparator, err)
+	}
+	pageLangs, err := pipeline.ParseLangMap(*langMap)
+	if err != nil {
+		return runConfig{}, fmt.Errorf("invalid --lang-map: %w", err)
+	}
+	binOverrides, err := parseBinOverrides(binOverrideFlags)
+	if err != nil {
+		return runConfig{}, err
+	}
+	if *globalDedup {
+		*window = dedupe.GlobalWindow
+	}
+	if *since != 0 && *sinceTime != "" {
+		return runConfig{}, fmt.Errorf("--since and --since-time are mutually exclusive")
+	}
+	if *since < 0 {
+		return runConfig{}, fmt.Errorf("invalid --since %v: must not be negative", *since)
+	}
+	if *orderFile != "" && *sortMode != "" && ingest.SortMode(strings.ToLower(*sortMode)) != ingest.SortNatural {
+		return runConfig{}, fmt.Errorf("--order-file cannot be combined with --sort-mode %s", *sortMode)
+	}
+	if *noiseCharRatio < 0 || *noiseCharRatio >= 1 {
+		return runConfig{}, fmt.Errorf("invalid --noise-char-ratio %v: must be at least 0 and below 1", *noiseCharRatio)
+	}
+	if *minWords < 0 {
+		return runConfig{}, fmt.Errorf("invalid --min-words %d: must not be negative", *minWords)
+	}
+	if *maxBlankLines < 1 {
+		return runConfig{}, fmt.Errorf("invalid --max-blank-lines %d: must be at least 1", *maxBlankLines)
+	}
+	if *maxImages < 0 {
+		return runConfig{}, fmt.Errorf("invalid --max-images %d: must not be negative", *maxImages)
+	}
+	if *maxTotalBytes < 0 {
+		return runConfig{}, fmt.Errorf("invalid --max-total-bytes %d: must not be negative", *maxTotalBytes)
+	}
+	if *parallelStages < 0 {
+		return runConfig{}, fmt.Errorf("invalid --parallel-stages %d: must not be negative", *parallelStages)
+	}
+	if *parallelStages > 1 && (*cacheDir != "" || *partialOnTimeout) {
+		return runConfig{}, fmt.Errorf("--parallel-stages cannot be combined with --cache-dir or --partial-on-timeout")
+	}
+	policy, err := pipeline.ParseOCRPolicy(*ocrPolicy)
+	if err != nil {
+		return runConfig{}, fmt.Errorf("invalid --ocr-policy: %w", err)
+	}
+	ocrOpts := pipeline.OCROptions{Policy: policy, PDFALevel: strings.ToLower(*pdfaLevel), OptimizeLevel: *optimizeLevel, JBIG2Lossy: *jbig2Lossy}
+	if err := ocrOpts.Validate(); err != nil {
+		return runConfig{}, fmt.Errorf("invalid --pdfa-level, --optimize-level or --jbig2-lossy: %w", err)
+	}
+	if len(inputPDFFlags) > 0 && (*inputTextGlob != "" || *parallelStages > 1 || *cacheDir != "" || len(pageLangs) > 0 || *partialOnTimeout) {
+		return runConfig{}, fmt.Errorf("--input-pdf cannot be combined with --input-text-glob, --parallel-stages, --cache-dir, --lang-map or --partial-on-timeout")
+	}
+	if *useSidecar && *parallelStages > 1 {
+		return runConfig{}, fmt.Errorf("--use-sidecar cannot be combined with --parallel-stages")
+	}
+	if mode := pipeline.PDFToTextMode(strings.ToLower(*pdftotextMode)); *useSidecar && (mode == pipeline.PDFToTextBBox || mode == pipeline.PDFToTextHTMLMeta) {
+		return runConfig{}, fmt.Errorf("--use-sidecar cannot be combined with --pdftotext-mode %s", *pdftotextMode)
+	}
+	if *stripURLsText && !*stripURLs {
+		return runConfig{}, fmt.Errorf("--strip-urls-text needs --strip-urls")
+	}
+	if *chunkHeading < 0 || *chunkHeading > 6 {
+		return runConfig{}, fmt.Errorf("invalid --chunk-heading-level %d: must be between 0 and 6", *chunkHeading)
+	}
+	if *chunkLabel != "" {
+		if *chunkHeading == 0 && !*toc {
+			return runConfig{}, fmt.Errorf("--chunk-label needs --chunk-heading-level or --toc")
+		}
+		if _, err := text.ParseChunkLabel(*chunkLabel); err != nil {
+			return runConfig{}, fmt.Errorf("invalid --chunk-label: %w", err)
+		}
+	}
+	if *totalTimeout < 0 {
+		return runConfig{}, fmt.Errorf("invalid --total-timeout %v: must not be negative", *totalTimeout)
+	}
+	if *maxDimension < 0 {
+		return runConfig{}, fmt.Errorf("invalid --max-dimension %d: must not be negative", *maxDimension)
+	}
+	var sinceAt time.Time
+	if *sinceTime != "" {
+		var err error
+		sinceAt, err = parseSinceTime(*sinceTime)
+		if err != nil {
+			return runConfig{}, fmt.Errorf("invalid --since-time: %w", err)
+		}
+	}
+	var timestampAt time.Time
+	if *timestamp != "" {
+		var err error
+		timestampAt, err = time.Parse(time.RFC3339, *timestamp)
+		if err != nil {
+			return runConfig{}, fmt.Errorf("invalid --timestamp %q: must be an RFC3339 timestamp", *timestamp)
+		}
+	} else if *deterministic {
+		epoch, ok, err := report.SourceDateEpoch()
+		if err != nil {
+			return runConfig{}, err
+		}
+		if !ok {
+			epoch = time.Unix(0, 0).UTC()
+		}
+		timestampAt = epoch
+	}
+	cfg := runConfig{
+		InputDir:          *inputDir,
+		OutputDir:         *outputDir,
+		KeepArtifacts:     *keepArtifacts,
+		Lang:              *lang,
+		LangMap:           pageLangs,
+		Recursive:         *recursive,
+		Include:           includeFlags,
+		Exclude:           excludeFlags,
+		InputPDFs:         inputPDFFlags,
+		Since:             *since,
+		SinceTime:         sinceAt,
+		SortMode:          *sortMode,
+		Reverse:           *reverseOrder,
+		OrderFile:         *orderFile,
+		MaxImages:         *maxImages,
+		MaxTotalBytes:     *maxTotalBytes,
+		PDFTimeout:        *pdfTimeout,
+		OCRTimeout:        *ocrTimeout,
+		ExtractTimeout:    *extractTimeout,
+		TotalTimeout:      *totalTimeout,
+		MinChunkChars:     *minChunkChars,
+		MinWords:          *minWords,
+		NoiseCharRatio:    *noiseCharRatio,
+		MaxBlankLines:     *maxBlankLines,
+		EmitChunksJSONL:   *emitChunksJSONL,
+		ChunksJSONLPath:   *chunksJSONLPath,
+		EmitAlignmentTSV:  *emitAlignment,
+		EmitKeptJSONL:     *emitKeptJSONL,
+		DebugFiltered:     *debugFiltered,
+		DistanceHistogram: *distanceHist,
+		ChromePatterns:    chromePatterns,
+		SimHashK:          *simhashK,
+		ShortChunkLength:  *shortChunkLength,
+		ShortChunkRatio:   *shortChunkRatio,
+		SimHashThreshold:  *simhashThreshold,
+		Window:            *window,
+		DedupeMethod:      *dedupeMethod,
+		ParallelBoth:      *parallelBoth,
+		ShingleK:          *shingleK,
+		MinHashNumHashes:  *minhashHashes,
+		MinHashBands:      *minhashBands,
+		MinHashThreshold:  *minhashThreshold,
+		JaccardThreshold:  *jaccardThreshold,
+		KeepStrategy:      *keepStrategy,
+		DedupStatePath:    *dedupState,
+		MarkdownTitle:     *markdownTitle,
+		OutputFormat:      *outputFormat,
+		IncludeChunkIDs:   *includeChunkIDs,
+		ShowPages:         *showPages,
+		Frontmatter:       *frontmatter,
+		FrontmatterDate:   *frontmatterDate,
+		Deterministic:     *deterministic,
+		Timestamp:         timestampAt,
+		TOC:               *toc,
+		ChunkHeadingLevel: *chunkHeading,
+		SeparatorRule:     *separatorRule,
+		CleanDisplay:      *cleanDisplay,
+		ChunkLabel:        *chunkLabel,
+		AppendSummary:     *appendSummary,
+		Append:            *appendResult,
+		RecordVersions:    *recordVersions,
+		SuggestChrome:     *suggestChrome,
+		DryRun:            *dryRun,
+		CommandLog:        *commandLogPath,
+		BinOverrides:      binOverrides,
+		ToolPath:          *toolPath,
+		Img2PDFCmd:        *img2pdfCmd,
+		PDFToTextMode:     *pdftotextMode,
+		MinExtractedChars: *minExtracted,
+		AllowEmpty:        *allowEmpty,
+		UseSidecar:        *useSidecar,
+		OCRPolicy:         string(ocrOpts.Policy),
+		PDFALevel:         ocrOpts.PDFALevel,
+		OptimizeLevel:     ocrOpts.OptimizeLevel,
+		JBIG2Lossy:        ocrOpts.JBIG2Lossy,
+		StageRetries:      *stageRetries,
+		Strict:            *strict,
+		ParallelStages:    *parallelStages,
+		OptimizePNGs:      *optimizePNGs,
+		AutoOrient:        *autoOrient,
+		MaxDimension:      *maxDimension,
+		Preprocess:        *preprocess,
+		CacheDir:          *cacheDir,
+		StripURLs:         *stripURLs,
+		StripPageNumbers:  *stripPageNumbers,
+		Dehyphenate:       *dehyphenate,
+		StripURLsText:     *stripURLsText,
+		UnicodeForm:       *unicodeForm,
+		FoldAccents:       *foldAccents,
+		NormalizeSteps:    *normalizeSteps,
+		PartialOnTimeout:  *partialOnTimeout,
+		Force:             *force,
+		InputTextGlob:     *inputTextGlob,
+		TextSeparator:     separator,
+		ReportFormat:      *reportFormat,
+		ExactFirstPreview: *exactPreview,
+		LogFormat:         *logFormat,
+		DumpConfig:        *dumpConfig,
+		DumpConfigExit:    *dumpConfigExit,
+	}
+	if *jsonEvents {
+		cfg.EventWriter = os.Stdout
+	}
+	logger, err := newLogger(cfg.LogFormat, os.Stderr)
+	if err != nil {
+		return runConfig{}, fmt.Errorf("invalid --log-format: %w", err)
+	}
+	cfg.logger = logger
+	cfg.Progress = pipeline.NewConsoleProgress(logger)
+	return cfg, nil
+}
+
+// runConfig holds the resolved settings for the run subcommand.
+type runConfig struct {
+	InputDir          string
+	OutputDir         string
+	KeepArtifacts     bool
+	Lang              string
+	LangMap           pipeline.LangMap // Per-page-range languages (empty uses Lang for every page)
+	Recursive         bool
+	Include           []string      // Globs an image path relative to InputDir must match (empty = all)
+	Exclude           []string      // Globs of image and directory paths relative to InputDir to skip
+	Images            []string      // Process exactly these images instead of listing InputDir (set by watch)
+	ChunkIDPrefix     string        // Prepended to chunk IDs, so watch batches do not share them (set by watch)
+	InputPDFs         []string      // OCR these PDFs, merged in order, instead of images (InputDir is unused)
+	Since             time.Duration // Only images modified within this long before the run (0 = all)
+	SinceTime         time.Time     // Only images modified at or after this time (zero = all)
+	SortMode          string        // Image order: "natural" (default), "lexical", "mtime", or "exifdate"
+	Reverse           bool          // Reverse the image order
+	OrderFile         string        // Base names of images in page order, replacing SortMode (empty = none)
+	MaxImages         int           // Fail if InputDir lists more images than this (0 = no limit)
+	MaxTotalBytes     int64         // Fail if the images listed total more bytes than this (0 = no limit)
+	PDFTimeout        time.Duration
+	OCRTimeout        time.Duration
+	ExtractTimeout    time.Duration
+	TotalTimeout      time.Duration // Deadline for the whole run, bounding every stage (0 = none)
+	MinChunkChars     int
+	MinWords          int     // Drop chunks with fewer words after chrome filtering (0 = off)
+	NoiseCharRatio    float64 // Drop chunks mostly made of one or two characters with chrome filtering (0 = off)
+	MaxBlankLines     int
+	EmitChunksJSONL   bool
+	ChunksJSONLPath   string // Overrides <out>/chunks_raw.jsonl when set
+	EmitAlignmentTSV  bool   // Write <out>/alignment.tsv for kept chunks
+	EmitKeptJSONL     bool   // Write <out>/kept_chunks.jsonl with dedup provenance
+	DebugFiltered     bool   // Write <out>/filtered_out.jsonl with the chunks each stage removed
+	DistanceHistogram bool   // Write <out>/distance_histogram.json of nearest-neighbor SimHash distances
+	ChromePatterns    []string
+	SimHashK          int
+	ShortChunkLength  int
+	ShortChunkRatio   float64
+	SimHashThreshold  int
+	Window            int
+	DedupeMethod      string
+	ParallelBoth      bool // Run the exact and SimHash passes of --dedupe both concurrently
+	ShingleK          int
+	MinHashNumHashes  int
+	MinHashBands      int
+	MinHashThreshold  float64
+	JaccardThreshold  float64
+	KeepStrategy      string
+	DedupStatePath    string // Cross-run signature store (empty disables)
+	MarkdownTitle     string
+	IncludeChunkIDs   bool
+	ShowPages         bool              // Prefix each Markdown chunk with its source page number
+	Frontmatter       bool              // Start Markdown with YAML frontmatter
+	FrontmatterDate   string            // Go time layout for the frontmatter date; empty means RFC3339
+	Deterministic     bool              // Record a fixed time instead of the current one (see Timestamp)
+	Timestamp         time.Time         // Report timestamp and frontmatter date (zero = now)
+	TOC               bool              // Add a Markdown table of contents
+	ChunkHeadingLevel int               // Markdown heading level before each chunk; 0 means none
+	SeparatorRule     bool              // Separate Markdown chunks with a horizontal rule
+	CleanDisplay      bool              // Collapse whitespace in Markdown chunk text (text.NormalizeForDisplay)
+	ChunkLabel        string            // Chunk heading template; empty means "Chunk <id>"
+	AppendSummary     bool              // Append a Processing Summary table to result.md
+	Append            bool              // Append to an existing result.md instead of replacing it
+	RecordVersions    bool              // Query tool versions at startup and record them in the report
+	ToolVersions      map[string]string // Set by runCommand when RecordVersions is true
+	SuggestChrome     bool              // Write frequent short chunks to chrome_suggestions.txt
+	OutputFormat      string            // Result formats: "md" (default), "json", "txt", or "all"
+	PDFToTextMode     string            // pdftotext mode: "layout" (default), "raw", "bbox", or "htmlmeta"
+	MinExtractedChars int               // Minimum extracted text length (trimmed)
+	AllowEmpty        bool              // Warn instead of failing when extracted text is below MinExtractedChars
+	UseSidecar        bool              // Take the extracted text from ocrmypdf --sidecar, skipping pdftotext
+	OCRPolicy         string            // Pages with text: "skip" (default), "force" or "redo"
+	PDFALevel         string            // PDF/A part of the OCR PDF: "1", "2", "3" or "none" (empty = ocrmypdf default)
+	OptimizeLevel     string            // ocrmypdf --optimize level "0" to "3" (empty = ocrmypdf default)
+	JBIG2Lossy        bool              // Pass --jbig2-lossy to ocrmypdf
+	DryRun            bool              // Log external commands instead of running them; stops before chunking
+	CommandLog        string            // JSONL file appended with every external command run (empty disables)
+	BinOverrides      map[string]string // External tool name -> path run instead (nil = none)
+	ToolPath          string            // PATH for finding and running external tools (empty = current PATH)
+	Img2PDFCmd        string            // Python interpreter or img2pdf executable (see pipeline.ParseImg2PDFCommand)
+	OptimizePNGs      bool              // Re-encode staged PNGs at maximum compression before BuildPDF
+	AutoOrient        bool              // Rotate staged JPEGs per their EXIF orientation while staging
+	MaxDimension      int               // Longest edge of staged images in pixels (0 disables downscaling)
+	Preprocess        string            // Staged image preprocessing: "none" (default), "grayscale", or "threshold"
+	StageRetries      int               // Retries per image for transient staging copy errors
+	Strict            bool              // Fail on an invalid input image instead of skipping it
+	// SkippedImages is set by runCommand to the input images that failed validation
+	SkippedImages     []report.SkippedImage
+	SourceFiles       []string          // Set by runCommand to the original image of each page
+	ParallelStages    int               // Images processed concurrently in per-image OCR mode (0 or 1 uses one combined PDF)
+	CacheDir          string            // OCR cache directory (empty disables caching)
+	StripURLs         bool              // Remove URLs from Norm before filtering and dedup
+	StripPageNumbers  bool              // Remove page-number-only lines before chunking
+	Dehyphenate       bool              // Join words hyphenated across line breaks before chunking
+	StripURLsText     bool              // Also remove URLs from rendered Text
+	UnicodeForm       string            // Unicode normalization form for Norm: "nfc" (default) or "nfkc"
+	FoldAccents       bool              // Strip diacritics from Norm
+	NormalizeSteps    string            // Comma-separated normalization steps (empty uses the defaults)
+	EventWriter       io.Writer         // Destination for NDJSON progress events (nil disables events)
+	Progress          pipeline.Progress // Receives stage progress (nil disables progress reporting)
+	PartialOnTimeout  bool              // Write run_summary.json and keep completed artifacts when a stage times out
+	Force             bool              // Rerun OCR stages even if their artifacts are up to date
+	InputTextGlob     string            // Re-dedup mode: read matching text files instead of OCRing images
+	TextSeparator     string            // Joins text files in re-dedup mode (default: form feed)
+	ReportFormat      string            // Comma-separated report formats: json (default), csv, html, or both (json,csv)
+	ExactFirstPreview bool              // Write result_exact.md after the exact-hash pass
+	LogFormat         string            // "text" (default) or "json"
+	DumpConfig        bool              // Write <out>/resolved_config.json before running
+	DumpConfigExit    bool              // Print the resolved configuration to stdout instead of running
+
+	logger    *slog.Logger       // Logger of LogFormat, nil for text logs (set by parseRunConfig)
+	stages    pipelineStages     // Stages of this run with its exec options (set by runPipeline)
+	normalize text.NormalizeOpts // Normalization of chunk hashing text (set by runPipeline)
+}
+
+// resolvedConfigJSON renders cfg as indented JSON keyed by runConfig field names.
+// Durations are written as strings (e.g. "5m0s"), the event writer is replaced
+// by a JSONEvents flag and the progress reporter is omitted, so the output reads like
+// the flags that produced it.
+func resolvedConfigJSON(cfg runConfig) ([]byte, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	fields["PDFTimeout"] = cfg.PDFTimeout.String()
+	fields["OCRTimeout"] = cfg.OCRTimeout.String()
+	fields["ExtractTimeout"] = cfg.ExtractTimeout.String()
+	fields["TotalTimeout"] = cfg.TotalTimeout.String()
+	fields["Since"] = cfg.Since.String()
+	delete(fields, "EventWriter")
+	delete(fields, "Progress")
+	delete(fields, "Images")
+	fields["JSONEvents"] = cfg.EventWriter != nil
+
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+const (
+	chromeMaxLength      = 100 // Only chunks shorter than this (normalized) are chrome candidates
+	maxChromeSuggestions = 20  // Number of candidates written by --suggest-chrome
+
+	stageRetryBackoff = 100 * time.Millisecond // Wait before the first staging retry; doubles after
+)
+
+// markdownOptions returns the Markdown rendering options selected in cfg.
+// inputCount is recorded as the source image count in frontmatter.
+func markdownOptions(cfg runConfig, inputCount int) text.MarkdownOptions {
+	var label *template.Template
+	if cfg.ChunkLabel != "" {
+		label, _ = text.ParseChunkLabel(cfg.ChunkLabel) // validated in parseRunConfig
+	}
+	return text.MarkdownOptions{
+		IncludeChunkIDs:    cfg.IncludeChunkIDs,
+		ShowPages:          cfg.ShowPages,
+		IncludeFrontmatter: cfg.Frontmatter,
+		IncludeTOC:         cfg.TOC,
+		ChunkHeadingLevel:  cfg.ChunkHeadingLevel,
+		SeparatorRule:      cfg.SeparatorRule,
+		CleanDisplay:       cfg.CleanDisplay,
+		ChunkLabel:         label,
+		SourceImages:       inputCount,
+		Date:               cfg.Timestamp,
+		DateFormat:         cfg.FrontmatterDate,
+	}
+}
+
+// dedupeDiscards returns the chunks dropped by dedup as --debug-filtered records,
+// with their full text and page looked up in chunks, the dedup input.
+func dedupeDiscards(chunks []text.Chunk, result dedupe.DedupeResult) []text.FilteredChunk {
+	byID := make(map[string]text.Chunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+	discards := make([]text.FilteredChunk, 0, len(result.Dropped))
+	for _, d := range result.Dropped {
+		stage := text.StageNear
+		switch d.Reason {
+		case "exact_duplicate":
+			stage = text.StageExact
+		case "cross_run_duplicate":
+			stage = text.StageCrossRun
+		}
+		reason := fmt.Sprintf("%s of %s", d.Reason, d.MatchedChunkID)
+		if d.Distance > 0 {
+			reason += fmt.Sprintf(" (distance %d)", d.Distance)
+		} else if d.Similarity > 0 {
+			reason += fmt.Sprintf(" (similarity %.2f)", d.Similarity)
+		}
+		discards = append(discards, text.FilteredChunk{
+			Stage:  stage,
+			Reason: reason,
+			ID:     d.ChunkID,
+			Page:   byID[d.ChunkID].Page,
+			Text:   byID[d.ChunkID].Text,
+		})
+	}
+	return discards
+}
+
+// summaryRows returns the run statistics and settings for the --append-summary table.
+func summaryRows(cfg runConfig, inputCount int, filterStats report.FilterStats, stats dedupe.Stats, dedupeConfig dedupe.Config) []text.SummaryRow {
+	lang := cfg.Lang
+	if len(cfg.LangMap) > 0 {
+		lang = ocrLang(cfg, inputCount)
+	}
+	return []text.SummaryRow{
+		{Name: "Images processed", Value: strconv.Itoa(inputCount)},
+		{Name: "Raw chunks", Value: strconv.Itoa(filterStats.RawChunks)},
+		{Name: "Chunks kept", Value: strconv.Itoa(stats.KeptCount)},
+		{Name: "Chunks dropped", Value: fmt.Sprintf("%d (%d exact, %d near-duplicate, %d cross-run)", stats.DroppedCount, stats.ExactDups, stats.NearDups, stats.CrossRunDups)},
+		{Name: "OCR language", Value: lang},
+		{Name: "Dedupe method", Value: dedupeConfig.Method},
+		{Name: "SimHash threshold", Value: strconv.Itoa(dedupeConfig.SimHashThreshold)},
+		{Name: "Min chunk chars", Value: strconv.Itoa(cfg.MinChunkChars)},
+	}
+}
+
+// stringListFlag is a flag.Value that collects every occurrence of a repeated flag.
+type stringListFlag []string
+
+func (l *stringListFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringListFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseSinceTime parses a --since-time value: an RFC3339 timestamp or a local date (YYYY-MM-DD).
+func parseSinceTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	return t, nil
+}
+
+// parseOutputFormat parses an --output-format value into the set of result formats to write.
+// An empty value means md.
+func parseOutputFormat(value string) (map[string]bool, error) {
+	switch value {
+	case "", "md":
+		return map[string]bool{"md": true}, nil
+	case "json", "txt":
+		return map[string]bool{value: true}, nil
+	case "all":
+		return map[string]bool{"md": true, "json": true, "txt": true}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q: must be md, json, txt, or all", value)
+	}
+}
+
+// parseReportFormats parses a comma-separated --report-format value into a set of formats.
+// "both" is shorthand for json and csv; an empty value means json.
+func parseReportFormats(value string) (map[string]bool, error) {
+	formats := make(map[string]bool)
+	if value == "" {
+		value = "json"
+	}
+	for _, f := range strings.Split(value, ",") {
+		switch f = strings.TrimSpace(f); f {
+		case "json", "csv", "html":
+			formats[f] = true
+		case "both":
+			formats["json"] = true
+			formats["csv"] = true
+		default:
+			return nil, fmt.Errorf("unknown format %q: must be json, csv, html, or both", f)
+		}
+	}
+	return formats, nil
+}
+
+// ocrStages lists the external-tool stages in run order.
+var ocrStages = []string{"pdf", "ocr", "extract"}
+
+// stageArtifacts maps each external-tool stage to the file it writes in the output directory.
+var stageArtifacts = map[string]string{
+	"pdf":     "combined.pdf",
+	"ocr":     "combined_ocr.pdf",
+	"extract": "extracted.txt",
+}
+
+// stageError records which pipeline stage failed, and for how long it ran.
+type stageError struct {
+	stage   string
+	timeout time.Duration // Timeout the stage ran with (0 if unknown)
+	elapsed time.Duration // Time the stage ran before failing (0 if unknown)
+	err     error
+}
+
+func (e *stageError) Error() string {
+	if e.timeout == 0 && e.elapsed == 0 {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%s stage failed after %v (timeout %v): %v", e.stage, e.elapsed.Round(time.Millisecond), e.timeout, e.err)
+}
+
+func (e *stageError) Unwrap() error { return e.err }
+
+// newStageError records that stage failed with err after running since start with
+// the given timeout.
+func newStageError(stage string, timeout time.Duration, start time.Time, err error) *stageError {
+	return &stageError{stage: stage, timeout: timeout, elapsed: time.Since(start), err: err}
+}
+
+// stageTimeout returns the timeout for a stage that is about to start: its own
+// timeout, shortened to the time left before ctx's deadline (see --total-timeout).
+// It fails without running the stage if ctx is already done.
+func stageTimeout(ctx context.Context, stage string, timeout time.Duration) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, &stageError{stage: stage, err: fmt.Errorf("%s stage not started: %w", stage, err)}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+	return timeout, nil
+}
+
+// runCommand runs the pipeline for cfg within cfg.TotalTimeout, if set. Cancelling
+// ctx stops the run, killing any external command in progress.
+func runCommand(ctx context.Context, cfg runConfig) error {
+	if cfg.TotalTimeout <= 0 {
+		return runPipeline(ctx, cfg)
 	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.TotalTimeout)
+	defer cancel()
+	err := runPipeline(ctx, cfg)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("total timeout %v exceeded: %w", cfg.TotalTimeout, err)
+	}
+	return err
+}
+
+// runPipeline runs every stage of the pipeline for cfg.
+func runPipeline(ctx context.Context, cfg runConfig) error {
+	inputDir, outputDir := cfg.InputDir, cfg.OutputDir
+	events := newEventEmitter(cfg.EventWriter, cfg.Progress)
+	runStart := time.Now()
+
+	// Validate input directory (unused when re-deduplicating text files or OCRing PDFs)
+	if cfg.InputTextGlob == "" && len(cfg.InputPDFs) == 0 {
+		if _, err := os.Stat(inputDir); os.IsNotExist(err) {
+			return fmt.Errorf("input directory does not exist: %s", inputDir)
+		}
+	}
+
+	if _, err := parseReportFormats(cfg.ReportFormat); err != nil {
+		return fmt.Errorf("invalid --report-format: %w", err)
+	}
+	if _, err := parseOutputFormat(cfg.OutputFormat); err != nil {
+		return fmt.Errorf("invalid --output-format: %w", err)
+	}
+
+	toolRunner := withRunnerOverrides(versionRunner, cfg.BinOverrides, toolEnv(cfg.ToolPath))
+	lang := cfg.Lang
+	if usesAutoLang(cfg) {
+		lang = pipeline.AutoLang
+		// Without pdftoppm detection would quietly fall back to pipeline.FallbackLang
+		if _, err := toolRunner.LookPath("pdftoppm"); err != nil && !cfg.DryRun {
+			return fmt.Errorf("--lang auto needs pdftoppm: %w", err)
+		}
+	}
+	if cfg.RecordVersions {
+		cfg.ToolVersions = recordToolVersions(ctx, toolRunner, lang, cfg.logger)
+		logInfo(cfg.logger, "Recorded tool versions: %v", cfg.ToolVersions)
+	}
+
+	// Configure Unicode normalization for chunk hashing
+	form := text.FormNFC
+	if cfg.UnicodeForm != "" {
+		parsed, err := text.ParseUnicodeForm(cfg.UnicodeForm)
+		if err != nil {
+			return fmt.Errorf("invalid --unicode-form: %w", err)
+		}
+		form = parsed
+	}
+	steps, err := text.ParseNormalizeSteps(cfg.NormalizeSteps)
+	if err != nil {
+		return fmt.Errorf("invalid --normalize-steps: %w", err)
+	}
+	if len(steps) > 0 && cfg.FoldAccents {
+		return fmt.Errorf("--fold-accents cannot be combined with --normalize-steps; add accents to the steps instead")
+	}
+	cfg.normalize = text.NormalizeOpts{Form: form, FoldAccents: cfg.FoldAccents, Steps: steps}
+	preprocessMode, err := ingest.ParsePreprocessMode(cfg.Preprocess)
+	if err != nil {
+		return fmt.Errorf("invalid --preprocess: %w", err)
+	}
+	sortMode, err := ingest.ParseSortMode(cfg.SortMode)
+	if err != nil {
+		return fmt.Errorf("invalid --sort-mode: %w", err)
+	}
+	pdftotextMode, err := pipeline.ParsePDFToTextMode(cfg.PDFToTextMode)
+	if err != nil {
+		return fmt.Errorf("invalid --pdftotext-mode: %w", err)
+	}
+	cfg.PDFToTextMode = string(pdftotextMode)
 
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	execOpts := pipeline.ExecOptions{
+		DryRun:      cfg.DryRun,
+		BinOverride: cfg.BinOverrides,
+		Env:         toolEnv(cfg.ToolPath),
+		Img2PDF:     pipeline.ParseImg2PDFCommand(cfg.Img2PDFCmd),
+		Logger:      cfg.logger,
+	}
+	if cfg.CommandLog != "" {
+		commandLog, err := openCommandLog(cfg.CommandLog, cfg.logger)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = commandLog.Close() }()
+		execOpts.OnResult = commandLog.record
+	}
+	cfg.stages = stagesWithExec(pipelineStagesImpl, execOpts)
+
+	if cfg.DumpConfig {
+		data, err := resolvedConfigJSON(cfg)
+		if err != nil {
+			return err
+		}
+		if err := fsutil.WriteFileAtomic(filepath.Join(outputDir, "resolved_config.json"), data, 0644); err != nil {
+			return fmt.Errorf("failed to write resolved config: %w", err)
+		}
+	}
+
 	// Resolve absolute paths for logging
 	absInput, err := filepath.Abs(inputDir)
 	if err != nil {
@@ -134,152 +978,978 @@ func runCommand(inputDir, outputDir string, keepArtifacts bool, lang string, rec
 		absOutput = outputDir
 	}
 
+	// Re-dedup mode: skip images and OCR, feeding existing text files to stages 4-6
+	if cfg.InputTextGlob != "" {
+		files, err := ingest.ListTextFiles(cfg.InputTextGlob)
+		if err != nil {
+			return fmt.Errorf("failed to list text files: %w", err)
+		}
+		logInfo(cfg.logger, "input text glob: %s", cfg.InputTextGlob)
+		logInfo(cfg.logger, "output directory: %s", absOutput)
+		logInfo(cfg.logger, "text files found: %d", len(files))
+
+		separator := cfg.TextSeparator
+		if separator == "" {
+			separator = "\f" // Page break, so each file starts its own chunk and page
+		}
+		textPath := filepath.Join(outputDir, "extracted.txt")
+		if err := ingest.ConcatTextFiles(files, separator, textPath); err != nil {
+			return err
+		}
+		return runTextStages(cfg, textPath, len(files), events, runStart)
+	}
+
+	// PDF input mode: skip images, OCRing the given PDFs directly
+	if len(cfg.InputPDFs) > 0 {
+		return runPDFInput(ctx, cfg, absOutput, events, runStart)
+	}
+
 	// Enumerate images
-	images, err := ingest.ListImages(inputDir, recursive)
-	if err != nil {
-		return fmt.Errorf("failed to list images: %w", err)
+	listOpts := ingest.ListOptions{
+		Recursive:     cfg.Recursive,
+		Since:         cfg.SinceTime,
+		Include:       cfg.Include,
+		Exclude:       cfg.Exclude,
+		MaxImages:     cfg.MaxImages,
+		MaxTotalBytes: cfg.MaxTotalBytes,
+		Sort:          sortMode,
+		Reverse:       cfg.Reverse,
+	}
+	if cfg.OrderFile != "" {
+		listOpts.Order, err = ingest.ReadOrderFile(cfg.OrderFile)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Since > 0 {
+		listOpts.Since = runStart.Add(-cfg.Since)
+	}
+	images := cfg.Images
+	if images == nil {
+		images, err = ingest.ListImagesWithOptions(inputDir, listOpts)
+		var limitErr *ingest.LimitError
+		if errors.As(err, &limitErr) {
+			return fmt.Errorf("input limit exceeded: %w (raise --max-images or --max-total-bytes, or narrow the input with --include/--exclude)", err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list images: %w", err)
+		}
 	}
 
-	log.Printf("input directory: %s", absInput)
-	log.Printf("output directory: %s", absOutput)
-	log.Printf("images found: %d", len(images))
-	log.Printf("recursive: %v", recursive)
-	log.Printf("keep artifacts: %v", keepArtifacts)
-	log.Printf("language: %s", lang)
+	logInfo(cfg.logger, "input directory: %s", absInput)
+	logInfo(cfg.logger, "output directory: %s", absOutput)
+	logInfo(cfg.logger, "images found: %d", len(images))
+	logInfo(cfg.logger, "recursive: %v", cfg.Recursive)
+	if cfg.OrderFile != "" {
+		logInfo(cfg.logger, "order file: %s (reverse: %v)", cfg.OrderFile, cfg.Reverse)
+	} else {
+		logInfo(cfg.logger, "sort mode: %s (reverse: %v)", sortMode, cfg.Reverse)
+	}
+	if len(cfg.Include) > 0 || len(cfg.Exclude) > 0 {
+		logInfo(cfg.logger, "include: %v, exclude: %v", cfg.Include, cfg.Exclude)
+	}
+	if !listOpts.Since.IsZero() {
+		logInfo(cfg.logger, "modified since: %s", listOpts.Since.Format(time.RFC3339))
+	}
+	logInfo(cfg.logger, "keep artifacts: %v", cfg.KeepArtifacts)
+	logInfo(cfg.logger, "language: %s", cfg.Lang)
+
+	images, cfg.SkippedImages, err = validateImages(images, cfg.Strict, cfg.logger)
+	if err != nil {
+		return err
+	}
 
 	if len(images) == 0 {
-		log.Println("warning: no images found in input directory")
+		logWarn(cfg.logger, "no images found in input directory")
 		return nil
 	}
 
-	// Stage images to preprocessed directory
-	staged, err := ingest.StageImages(images, outputDir)
-	if err != nil {
-		return fmt.Errorf("failed to stage images: %w", err)
+	stageOpts := ingest.StageOptions{
+		Retries:      cfg.StageRetries,
+		RetryBackoff: stageRetryBackoff,
+		AutoOrient:   cfg.AutoOrient,
+		MaxDimension: cfg.MaxDimension,
+		Preprocess:   preprocessMode,
 	}
 
-	log.Printf("staged %d images to preprocessed/", len(staged))
+	// Per-image mode: images flow through staging, OCR and extraction concurrently
+	if cfg.ParallelStages > 1 {
+		textPath, staged, err := runParallelStages(ctx, cfg, images, stageOpts, events)
+		if err != nil {
+			return err
+		}
+		cfg.SourceFiles, err = writeManifest(cfg, images, staged)
+		if err != nil {
+			return err
+		}
+		if cfg.DryRun {
+			logInfo(cfg.logger, "dry run: skipping chunking, deduplication and output")
+			return nil
+		}
+		return runTextStages(cfg, textPath, len(images), events, runStart)
+	}
 
-	// Pipeline stage 1: Build PDF from staged images
-	preprocessedDir := filepath.Join(outputDir, "preprocessed")
-	log.Printf("Building PDF from %d images...", len(staged))
-	start := time.Now()
-	pdfPath, err := pipelineStagesImpl.BuildPDF(preprocessedDir, outputDir, pdfTimeout)
+	// Stage images to preprocessed directory
+	start := events.stageStartTotal("stage", len(images))
+	stageOpts.OnStaged = func(done int) { events.stageProgress("stage", done) }
+	staged, err := ingest.StageImagesWithOptions(images, outputDir, stageOpts)
 	if err != nil {
-		return fmt.Errorf("PDF synthesis failed: %w", err)
+		events.stageFailed("stage", err)
+		return fmt.Errorf("failed to stage images: %w", err)
 	}
-	log.Printf("PDF built: %s (took %v)", pdfPath, time.Since(start))
+	events.stageDone("stage", start, map[string]int{"images": len(staged)})
 
-	// Pipeline stage 2: Run OCR on PDF
-	log.Printf("Running OCR (language: %s)...", lang)
-	start = time.Now()
-	ocrPath, err := pipelineStagesImpl.OCRPDF(pdfPath, outputDir, lang, ocrTimeout)
+	logInfo(cfg.logger, "staged %d images to preprocessed/", len(staged))
+	cfg.SourceFiles, err = writeManifest(cfg, images, staged)
 	if err != nil {
-		return fmt.Errorf("OCR failed: %w", err)
+		return err
 	}
-	log.Printf("OCR completed: %s (took %v)", ocrPath, time.Since(start))
 
-	// Cleanup combined.pdf if not keeping artifacts
-	if !keepArtifacts {
-		if err := pipelineStagesImpl.CleanupArtifact(pdfPath); err != nil {
-			log.Printf("warning: failed to cleanup combined.pdf: %v", err)
-		} else {
-			log.Printf("cleaned up combined.pdf")
+	// Look up OCR text for every staged image in the cache
+	var ocrCache *cache.Cache
+	var cacheKeys []string
+	var textPath string
+	if cfg.CacheDir != "" {
+		ocrCache, err = cache.New(cfg.CacheDir)
+		if err != nil {
+			return fmt.Errorf("failed to open OCR cache: %w", err)
+		}
+		cacheKeys, err = imageCacheKeys(staged, ocrLang(cfg, len(staged)))
+		if err != nil {
+			return fmt.Errorf("failed to hash staged images: %w", err)
+		}
+		textPath, err = loadCachedText(ocrCache, cacheKeys, outputDir)
+		if err != nil {
+			logWarn(cfg.logger, "OCR cache lookup failed: %v", err)
 		}
 	}
 
-	// Pipeline stage 3: Extract text from OCR PDF
-	log.Printf("Extracting text from OCR PDF...")
-	start = time.Now()
-	textPath, err := pipelineStagesImpl.ExtractText(ocrPath, outputDir, extractTimeout)
-	if err != nil {
-		return fmt.Errorf("text extraction failed: %w", err)
+	if textPath != "" && cfg.DryRun {
+		logInfo(cfg.logger, "dry run: OCR cache hit for all %d images, no commands would run", len(staged))
+		return nil
 	}
-	log.Printf("Text extracted: %s (took %v)", textPath, time.Since(start))
 
-	// Get file size for logging
-	if info, err := os.Stat(textPath); err == nil {
-		log.Printf("extracted text size: %d bytes", info.Size())
+	if textPath != "" {
+		logInfo(cfg.logger, "OCR cache hit for all %d images, skipping PDF synthesis, OCR and extraction", len(staged))
+		for _, stage := range []string{"pdf", "ocr", "extract"} {
+			events.stageSkipped(stage)
+		}
+	} else {
+		if cfg.OptimizePNGs {
+			optimizePNGs(staged, cfg.logger)
+		}
+		textPath, err = runOCRStages(ctx, cfg, images, events)
+		if err != nil {
+			var se *stageError
+			if cfg.PartialOnTimeout && errors.Is(err, context.DeadlineExceeded) && errors.As(err, &se) {
+				writePartialSummary(cfg, se, len(images))
+			}
+			return err
+		}
+		if cfg.DryRun {
+			logInfo(cfg.logger, "dry run: skipping OCR cache update, chunking, deduplication and output")
+			return nil
+		}
+		if ocrCache != nil {
+			if err := storeCachedText(ocrCache, cacheKeys, textPath); err != nil {
+				logWarn(cfg.logger, "failed to populate OCR cache: %v", err)
+			} else {
+				logInfo(cfg.logger, "OCR cache updated: %s", ocrCache.Dir())
+			}
+		}
 	}
 
-	// Cleanup combined_ocr.pdf if not keeping artifacts
-	if !keepArtifacts {
-		if err := pipelineStagesImpl.CleanupArtifact(ocrPath); err != nil {
-			log.Printf("warning: failed to cleanup combined_ocr.pdf: %v", err)
-		} else {
-			log.Printf("cleaned up combined_ocr.pdf")
-		}
+	return runTextStages(cfg, textPath, len(images), events, runStart)
+}
+
+// runTextStages chunks, filters, deduplicates and renders the text at textPath.
+// inputCount is the number of source documents, recorded in the report.
+func runTextStages(cfg runConfig, textPath string, inputCount int, events *eventEmitter, runStart time.Time) error {
+	outputDir := cfg.OutputDir
+
+	// Get file size for logging
+	if info, err := os.Stat(textPath); err == nil {
+		logInfo(cfg.logger, "extracted text size: %d bytes", info.Size())
 	}
 
 	// Pipeline stage 4: Chunk extracted text
-	log.Printf("Chunking extracted text...")
-	start = time.Now()
+	logInfo(cfg.logger, "Chunking extracted text...")
+	start := events.stageStart("chunk")
 	extractedText, err := os.ReadFile(textPath)
 	if err != nil {
+		events.stageFailed("chunk", err)
 		return fmt.Errorf("failed to read extracted text: %w", err)
 	}
 
-	rawChunks := text.ChunkText(string(extractedText), minChunkChars)
-	log.Printf("Found %d chunks (raw)", len(rawChunks))
+	textContent := string(extractedText)
+	if cfg.StripPageNumbers {
+		textContent = text.StripPageNumbers(textContent)
+		logInfo(cfg.logger, "Stripped page-number lines before chunking")
+	}
+	if cfg.Dehyphenate {
+		textContent = text.DehyphenateText(textContent)
+		logInfo(cfg.logger, "Joined words hyphenated across line breaks")
+	}
+
+	// Only reachable with short text under --allow-empty, or when text did not come from pdftotext
+	var warnings []string
+	if n := len(strings.TrimSpace(textContent)); n < cfg.MinExtractedChars {
+		warnings = append(warnings, (&pipeline.TextTooShortError{Chars: n, MinChars: cfg.MinExtractedChars}).Error())
+	}
+
+	paragraphCount := text.CountParagraphs(textContent, cfg.MaxBlankLines)
+	rawChunks, discards := text.ChunkTextWithDiscards(textContent, cfg.MinChunkChars, cfg.MaxBlankLines, cfg.normalize)
+	logInfo(cfg.logger, "Found %d chunks (raw)", len(rawChunks))
+
+	// Strip URLs so tracking links don't dominate hashing
+	if cfg.StripURLs {
+		rawChunks = text.StripChunkURLs(rawChunks, cfg.StripURLsText, cfg.normalize)
+		logInfo(cfg.logger, "Stripped URLs from chunks (text: %v)", cfg.StripURLsText)
+	}
+	if len(cfg.SourceFiles) > 0 {
+		rawChunks = text.SetSourceFiles(rawChunks, cfg.SourceFiles)
+	}
+	if cfg.ChunkIDPrefix != "" {
+		rawChunks = text.PrefixChunkIDs(rawChunks, cfg.ChunkIDPrefix)
+	}
 
 	// Apply chrome filtering
-	filteredChunks := text.FilterChrome(rawChunks, chromePatterns, 100) // 100 chars max for chrome filtering
-	log.Printf("Filtered to %d chunks (chrome)", len(filteredChunks))
+	chromeRegexps, err := text.CompileChromePatterns(cfg.ChromePatterns)
+	if err != nil {
+		return fmt.Errorf("invalid --chrome-regex: %w", err)
+	}
+	filteredChunks, chromeDiscards := text.FilterChromeWithDiscards(rawChunks, chromeRegexps, chromeMaxLength)
+	discards = append(discards, chromeDiscards...)
+	if cfg.NoiseCharRatio > 0 {
+		var noiseDiscards []text.FilteredChunk
+		filteredChunks, noiseDiscards = text.FilterNoiseWithDiscards(filteredChunks, cfg.NoiseCharRatio)
+		discards = append(discards, noiseDiscards...)
+		logInfo(cfg.logger, "Dropped %d chunks of repeated-character noise", len(noiseDiscards))
+	}
+	logInfo(cfg.logger, "Filtered to %d chunks (chrome)", len(filteredChunks))
+
+	// Suggest chrome patterns from short chunks the current patterns let through
+	if cfg.SuggestChrome {
+		suggestions := text.SuggestChrome(filteredChunks, chromeMaxLength, maxChromeSuggestions)
+		suggestionsPath := filepath.Join(outputDir, "chrome_suggestions.txt")
+		if err := text.WriteChromeSuggestions(suggestions, suggestionsPath); err != nil {
+			logWarn(cfg.logger, "%v", err)
+		} else {
+			logInfo(cfg.logger, "Chrome suggestions written: %s (%d candidates)", suggestionsPath, len(suggestions))
+		}
+	}
+
+	// Drop chunks with too few words to be real text
+	afterChrome := len(filteredChunks)
+	if cfg.MinWords > 0 {
+		var wordDiscards []text.FilteredChunk
+		filteredChunks, wordDiscards = text.FilterMinWordsWithDiscards(filteredChunks, cfg.MinWords)
+		discards = append(discards, wordDiscards...)
+		logInfo(cfg.logger, "Filtered to %d chunks (min words)", len(filteredChunks))
+	}
 
 	// Write JSONL debug output if enabled
-	if emitChunksJSONL {
-		chunksJSONLPath := filepath.Join(outputDir, "chunks_raw.jsonl")
+	if cfg.EmitChunksJSONL {
+		chunksJSONLPath := cfg.ChunksJSONLPath
+		if chunksJSONLPath == "" {
+			chunksJSONLPath = filepath.Join(outputDir, "chunks_raw.jsonl")
+		} else if err := os.MkdirAll(filepath.Dir(chunksJSONLPath), 0755); err != nil {
+			events.stageFailed("chunk", err)
+			return fmt.Errorf("failed to create chunks JSONL directory: %w", err)
+		}
 		if err := text.WriteChunksJSONL(filteredChunks, chunksJSONLPath); err != nil {
+			events.stageFailed("chunk", err)
 			return fmt.Errorf("failed to write chunks JSONL: %w", err)
 		}
-		log.Printf("Writing chunks to chunks_raw.jsonl")
+		logInfo(cfg.logger, "Writing chunks to %s", chunksJSONLPath)
 	}
 
-	log.Printf("Chunking completed: %d chunks ready for deduplication (took %v)", len(filteredChunks), time.Since(start))
+	logStageDone(cfg.logger, "chunk", start, fmt.Sprintf("Chunking completed: %d chunks ready for deduplication", len(filteredChunks)), "chunks", len(filteredChunks))
+	events.stageDone("chunk", start, map[string]int{"raw": len(rawChunks), "filtered": len(filteredChunks)})
 
 	// Pipeline stage 5: Deduplicate chunks
-	log.Printf("Deduplicating chunks...")
-	start = time.Now()
+	logInfo(cfg.logger, "Deduplicating chunks...")
+	start = events.stageStart("dedupe")
 
 	// Create deduplication config
 	dedupeConfig := dedupe.Config{
-		Method:           dedupeMethod,
-		SimHashK:         simhashK,
-		SimHashThreshold: simhashThreshold,
-		Window:           window,
+		Method:           cfg.DedupeMethod,
+		SimHashK:         cfg.SimHashK,
+		ShortChunkLength: cfg.ShortChunkLength,
+		ShortChunkRatio:  cfg.ShortChunkRatio,
+		SimHashThreshold: cfg.SimHashThreshold,
+		Window:           cfg.Window,
+		ShingleK:         cfg.ShingleK,
+		MinHashNumHashes: cfg.MinHashNumHashes,
+		MinHashBands:     cfg.MinHashBands,
+		MinHashThreshold: cfg.MinHashThreshold,
+		JaccardThreshold: cfg.JaccardThreshold,
+		KeepStrategy:     cfg.KeepStrategy,
+
+		DistanceHistogram: cfg.DistanceHistogram,
+		ParallelBoth:      cfg.ParallelBoth,
 	}
 	dedupeConfig.Validate()
+	if cfg.DistanceHistogram && dedupeConfig.Method != "simhash" && dedupeConfig.Method != "both" {
+		logWarn(cfg.logger, "--distance-histogram needs --dedupe simhash or both; histogram will be empty")
+	}
 
-	dedupeResult := dedupe.Dedupe(filteredChunks, dedupeConfig)
-	log.Printf("Input: %d chunks", dedupeResult.Stats.InputCount)
-	log.Printf("Kept: %d chunks", dedupeResult.Stats.KeptCount)
-	log.Printf("Dropped: %d chunks (%d exact, %d near-duplicates)", dedupeResult.Stats.DroppedCount, dedupeResult.Stats.ExactDups, dedupeResult.Stats.NearDups)
+	// Write a quick preview as soon as the exact-hash pass finishes
+	if cfg.ExactFirstPreview {
+		previewPath := filepath.Join(outputDir, "result_exact.md")
+		dedupeConfig.OnExactPass = func(kept []text.Chunk) {
+			content := text.RenderMarkdownWithOptions(cfg.MarkdownTitle, kept, markdownOptions(cfg, inputCount))
+			if err := text.WriteMarkdown(content, previewPath); err != nil {
+				logWarn(cfg.logger, "failed to write exact-dedup preview: %v", err)
+				return
+			}
+			logInfo(cfg.logger, "Exact-dedup preview written: %s (%d chunks)", previewPath, len(kept))
+		}
+	}
+
+	// Load signatures from previous runs when a state file is configured
+	var dedupState *dedupe.State
+	if cfg.DedupStatePath != "" {
+		dedupState, err = dedupe.LoadState(cfg.DedupStatePath, dedupeConfig)
+		if err != nil {
+			logWarn(cfg.logger, "%v; starting with empty dedup state", err)
+		}
+		logInfo(cfg.logger, "Dedup state: %s (%d stored signatures)", cfg.DedupStatePath, len(dedupState.SimHash))
+	}
+
+	dedupeResult := dedupe.DedupeWithState(filteredChunks, dedupeConfig, dedupState)
+	logInfo(cfg.logger, "Input: %d chunks", dedupeResult.Stats.InputCount)
+	logInfo(cfg.logger, "Kept: %d chunks", dedupeResult.Stats.KeptCount)
+	logInfo(cfg.logger, "Dropped: %d chunks (%d exact, %d near-duplicates, %d cross-run)", dedupeResult.Stats.DroppedCount, dedupeResult.Stats.ExactDups, dedupeResult.Stats.NearDups, dedupeResult.Stats.CrossRunDups)
+
+	filterStats := report.NewFilterStats(paragraphCount, len(rawChunks), afterChrome, len(filteredChunks), len(dedupeResult.KeptChunks))
+	logInfo(cfg.logger, "Filter impact: %d raw -> %d after min-chars (-%d) -> %d after chrome (-%d) -> %d after min-words (-%d) -> %d after dedup (-%d)",
+		filterStats.RawChunks, filterStats.AfterMinChars, filterStats.RemovedMinChars,
+		filterStats.AfterChrome, filterStats.RemovedChrome, len(filteredChunks), filterStats.RemovedMinWords,
+		filterStats.AfterDedupe, filterStats.RemovedDedupe)
+
+	if dedupState != nil {
+		if err := dedupState.Save(cfg.DedupStatePath); err != nil {
+			logWarn(cfg.logger, "failed to save dedup state: %v", err)
+		}
+	}
 
 	// Write deduplication report
-	reportPath := filepath.Join(outputDir, "dedupe_report.json")
-	if err := report.WriteReport(dedupeResult, len(images), dedupeConfig, reportPath); err != nil {
-		log.Printf("warning: failed to write deduplication report: %v", err)
+	reportFormats, _ := parseReportFormats(cfg.ReportFormat) // validated in runCommand
+	if reportFormats["json"] {
+		reportPath := filepath.Join(outputDir, "dedupe_report.json")
+		if err := report.WriteReportWithMetadata(dedupeResult, inputCount, dedupeConfig, report.Metadata{
+			ToolVersions:  cfg.ToolVersions,
+			Warnings:      warnings,
+			FilterStats:   &filterStats,
+			SkippedImages: cfg.SkippedImages,
+			SourceFiles:   cfg.SourceFiles,
+			InputBytes:    report.ChunkBytes(filteredChunks),
+			Timestamp:     cfg.Timestamp,
+		}, reportPath); err != nil {
+			logWarn(cfg.logger, "failed to write deduplication report: %v", err)
+		} else {
+			logInfo(cfg.logger, "Deduplication report written: %s", reportPath)
+		}
+	}
+	if reportFormats["csv"] {
+		reportPath := filepath.Join(outputDir, "dedupe_report.csv")
+		summaryPath := filepath.Join(outputDir, "dedupe_summary.csv")
+		if err := report.WriteReportCSV(dedupeResult, reportPath); err != nil {
+			logWarn(cfg.logger, "failed to write CSV deduplication report: %v", err)
+		} else if err := report.WriteSummaryCSV(dedupeResult, inputCount, dedupeConfig, summaryPath); err != nil {
+			logWarn(cfg.logger, "failed to write CSV deduplication summary: %v", err)
+		} else {
+			logInfo(cfg.logger, "Deduplication report written: %s (summary: %s)", reportPath, summaryPath)
+		}
+	}
+	if reportFormats["html"] {
+		reportPath := filepath.Join(outputDir, "dedupe_report.html")
+		if err := report.WriteReportHTML(dedupeResult, inputCount, dedupeConfig, reportPath); err != nil {
+			logWarn(cfg.logger, "failed to write HTML deduplication report: %v", err)
+		} else {
+			logInfo(cfg.logger, "Deduplication report written: %s", reportPath)
+		}
+	}
+
+	if cfg.DistanceHistogram {
+		histPath := filepath.Join(outputDir, "distance_histogram.json")
+		if err := report.WriteDistanceHistogram(dedupeResult.Stats.DistanceHistogram, histPath); err != nil {
+			logWarn(cfg.logger, "%v", err)
+		} else {
+			logInfo(cfg.logger, "Distance histogram written: %s", histPath)
+		}
+	}
+
+	// Write page alignment of kept chunks if enabled
+	if cfg.EmitAlignmentTSV {
+		alignmentPath := filepath.Join(outputDir, "alignment.tsv")
+		if err := text.WriteAlignmentTSV(dedupeResult.KeptChunks, alignmentPath); err != nil {
+			events.stageFailed("dedupe", err)
+			return err
+		}
+		logInfo(cfg.logger, "Alignment written: %s", alignmentPath)
+	}
+	if cfg.EmitKeptJSONL {
+		keptPath := filepath.Join(outputDir, "kept_chunks.jsonl")
+		if err := dedupe.WriteKeptChunksJSONL(dedupeResult, keptPath); err != nil {
+			events.stageFailed("dedupe", err)
+			return err
+		}
+		logInfo(cfg.logger, "Kept chunks written: %s", keptPath)
+	}
+	if cfg.DebugFiltered {
+		filteredPath := filepath.Join(outputDir, "filtered_out.jsonl")
+		discards = append(discards, dedupeDiscards(filteredChunks, dedupeResult)...)
+		if err := text.WriteFilteredJSONL(discards, filteredPath); err != nil {
+			events.stageFailed("dedupe", err)
+			return err
+		}
+		logInfo(cfg.logger, "Filtered chunks written: %s (%d chunks)", filteredPath, len(discards))
+	}
+
+	logStageDone(cfg.logger, "dedupe", start, "Deduplication completed", "kept", dedupeResult.Stats.KeptCount, "dropped", dedupeResult.Stats.DroppedCount)
+	events.stageDone("dedupe", start, map[string]int{
+		"input":   dedupeResult.Stats.InputCount,
+		"kept":    dedupeResult.Stats.KeptCount,
+		"dropped": dedupeResult.Stats.DroppedCount,
+	})
+
+	// Pipeline stage 6: Generate result outputs
+	logInfo(cfg.logger, "Generating result output...")
+	start = events.stageStart("markdown")
+	outputFormats, _ := parseOutputFormat(cfg.OutputFormat) // validated in runCommand
+	kept := dedupeResult.KeptChunks
+	var outputPaths []string
+
+	if outputFormats["md"] {
+		mdOpts := markdownOptions(cfg, inputCount)
+		if cfg.AppendSummary {
+			mdOpts.Summary = summaryRows(cfg, inputCount, filterStats, dedupeResult.Stats, dedupeConfig)
+		}
+		markdownPath := filepath.Join(outputDir, "result.md")
+		write := text.WriteMarkdown
+		if cfg.Append {
+			write = text.AppendMarkdown
+			if _, err := os.Stat(markdownPath); err == nil {
+				mdOpts.IncludeTOC = false // The existing file's contents cannot link to appended chunks
+			}
+		}
+		markdownContent := text.RenderMarkdownWithOptions(cfg.MarkdownTitle, kept, mdOpts)
+		if err := write(markdownContent, markdownPath); err != nil {
+			events.stageFailed("markdown", err)
+			return fmt.Errorf("failed to write Markdown file: %w", err)
+		}
+		logInfo(cfg.logger, "Markdown written: %s (%d chunks)", markdownPath, len(kept))
+		outputPaths = append(outputPaths, markdownPath)
+	}
+	if outputFormats["json"] {
+		jsonPath := filepath.Join(outputDir, "result.json")
+		data, err := text.RenderJSON(kept)
+		if err == nil {
+			err = fsutil.WriteFileAtomic(jsonPath, data, 0644)
+		}
+		if err != nil {
+			events.stageFailed("markdown", err)
+			return fmt.Errorf("failed to write JSON result: %w", err)
+		}
+		logInfo(cfg.logger, "JSON written: %s (%d chunks)", jsonPath, len(kept))
+		outputPaths = append(outputPaths, jsonPath)
+	}
+	if outputFormats["txt"] {
+		txtPath := filepath.Join(outputDir, "result.txt")
+		if err := fsutil.WriteFileAtomic(txtPath, []byte(text.RenderPlainText(kept)), 0644); err != nil {
+			events.stageFailed("markdown", err)
+			return fmt.Errorf("failed to write plain text result: %w", err)
+		}
+		logInfo(cfg.logger, "Plain text written: %s (%d chunks)", txtPath, len(kept))
+		outputPaths = append(outputPaths, txtPath)
+	}
+
+	logStageDone(cfg.logger, "markdown", start, "Result output completed", "chunks", len(kept))
+	events.stageDone("markdown", start, map[string]int{"chunks": len(kept)})
+
+	logInfo(cfg.logger, "Pipeline completed successfully. Final output: %s", strings.Join(outputPaths, ", "))
+	events.runDone(runStart)
+	return nil
+}
+
+// validateImages returns the images that pass ingest.ValidateImage. Invalid images
+// are skipped with a warning to logger and returned for the report, or fail the run
+// if strict.
+func validateImages(images []string, strict bool, logger *slog.Logger) ([]string, []report.SkippedImage, error) {
+	valid := make([]string, 0, len(images))
+	var skipped []report.SkippedImage
+	for _, path := range images {
+		if err := ingest.ValidateImage(path); err != nil {
+			if strict {
+				return nil, nil, fmt.Errorf("invalid image %s: %w", path, err)
+			}
+			logWarn(logger, "skipping invalid image %s: %v", path, err)
+			skipped = append(skipped, report.SkippedImage{Path: path, Reason: err.Error()})
+			continue
+		}
+		valid = append(valid, path)
+	}
+	return valid, skipped, nil
+}
+
+// writeManifest records the original of each staged image in <out>/manifest.json and
+// returns the original image of each page, relative to the input directory where
+// possible, for chunk and report metadata.
+func writeManifest(cfg runConfig, images, staged []string) ([]string, error) {
+	entries, err := ingest.NewManifest(cfg.OutputDir, images, staged)
+	if err != nil {
+		return nil, err
+	}
+	if err := ingest.WriteManifest(cfg.OutputDir, entries); err != nil {
+		return nil, err
+	}
+
+	absInput, err := filepath.Abs(cfg.InputDir)
+	if err != nil {
+		absInput = cfg.InputDir
+	}
+	sources := make([]string, len(entries))
+	for i, entry := range entries {
+		sources[i] = entry.Original
+		if rel, err := filepath.Rel(absInput, entry.Original); err == nil && !strings.HasPrefix(rel, "..") {
+			sources[i] = filepath.ToSlash(rel)
+		}
+	}
+	return sources, nil
+}
+
+// optimizePNGs re-encodes staged PNGs at maximum compression before PDF synthesis.
+// Failures are logged to logger and leave the original file in place.
+func optimizePNGs(staged []string, logger *slog.Logger) {
+	var saved int64
+	for _, path := range staged {
+		n, err := ingest.OptimizePNG(path)
+		if err != nil {
+			logWarn(logger, "failed to optimize %s: %v", filepath.Base(path), err)
+			continue
+		}
+		saved += n
+	}
+	logInfo(logger, "Optimized staged PNGs (saved %d bytes)", saved)
+}
+
+// runOCRStages runs PDF synthesis, OCR and text extraction over the staged copies of images.
+// With cfg.InputPDFs, images are those PDFs, which are merged instead (or used as they
+// are if there is only one). Returns the path to the extracted text file.
+func runOCRStages(ctx context.Context, cfg runConfig, images []string, events *eventEmitter) (string, error) {
+	outputDir := cfg.OutputDir
+	stagedCount := len(images)
+
+	// Reuse artifacts from an earlier run that are still up to date (see resumeStages)
+	resume, err := resumeStages(cfg, images)
+	if err != nil {
+		logWarn(cfg.logger, "cannot resume from earlier artifacts: %v", err)
+		resume = map[string]bool{}
+	}
+
+	// Pipeline stage 1: Build PDF from staged images, or merge input PDFs
+	pdfPath := filepath.Join(outputDir, stageArtifacts["pdf"])
+	switch {
+	case len(cfg.InputPDFs) == 1:
+		// A single input PDF is OCRed as it is
+		pdfPath = cfg.InputPDFs[0]
+		events.stageSkipped("pdf")
+	case resume["pdf"]:
+		events.stageSkipped("pdf")
+	case len(cfg.InputPDFs) > 1:
+		logInfo(cfg.logger, "Merging %d PDFs...", len(cfg.InputPDFs))
+		start := events.stageStart("pdf")
+		timeout, err := stageTimeout(ctx, "pdf", cfg.PDFTimeout)
+		if err != nil {
+			events.stageFailed("pdf", err)
+			return "", err
+		}
+		pdfPath, err = cfg.stages.MergePDFs(ctx, cfg.InputPDFs, outputDir, timeout)
+		if err != nil {
+			events.stageFailed("pdf", err)
+			return "", newStageError("pdf", timeout, start, fmt.Errorf("PDF merge failed: %w", err))
+		}
+		logStageDone(cfg.logger, "pdf", start, "PDFs merged: "+pdfPath, "path", pdfPath)
+		events.stageDone("pdf", start, map[string]int{"pdfs": len(cfg.InputPDFs)})
+	default:
+		preprocessedDir := filepath.Join(outputDir, "preprocessed")
+		logInfo(cfg.logger, "Building PDF from %d images...", stagedCount)
+		start := events.stageStart("pdf")
+		timeout, err := stageTimeout(ctx, "pdf", cfg.PDFTimeout)
+		if err != nil {
+			events.stageFailed("pdf", err)
+			return "", err
+		}
+		pdfPath, err = cfg.stages.BuildPDF(ctx, preprocessedDir, outputDir, timeout)
+		if err != nil {
+			events.stageFailed("pdf", err)
+			return "", newStageError("pdf", timeout, start, fmt.Errorf("PDF synthesis failed: %w", err))
+		}
+		logStageDone(cfg.logger, "pdf", start, "PDF built: "+pdfPath, "path", pdfPath)
+		events.stageDone("pdf", start, map[string]int{"images": stagedCount})
+	}
+
+	// Pipeline stage 2: Run OCR on PDF
+	ocrPath := filepath.Join(outputDir, stageArtifacts["ocr"])
+	if resume["ocr"] {
+		events.stageSkipped("ocr")
 	} else {
-		log.Printf("Deduplication report written: %s", reportPath)
+		if cfg.Lang == pipeline.AutoLang {
+			cfg.Lang = detectOCRLang(ctx, cfg, pdfPath)
+		}
+		lang := ocrLang(cfg, stagedCount)
+		logInfo(cfg.logger, "Running OCR (language: %s)...", lang)
+		start := events.stageStart("ocr")
+		timeout, err := stageTimeout(ctx, "ocr", cfg.OCRTimeout)
+		if err != nil {
+			events.stageFailed("ocr", err)
+			return "", err
+		}
+		if cfg.UseSidecar {
+			return runSidecarOCR(ctx, cfg, pdfPath, lang, start, timeout, events)
+		}
+		ocrPath, err = cfg.stages.OCRPDF(ctx, pdfPath, outputDir, lang, ocrOptions(cfg), timeout)
+		if err != nil {
+			events.stageFailed("ocr", err)
+			return "", newStageError("ocr", timeout, start, fmt.Errorf("OCR failed: %w", err))
+		}
+		logStageDone(cfg.logger, "ocr", start, "OCR completed: "+ocrPath, "path", ocrPath)
+		events.stageDone("ocr", start, nil)
+
+		// Cleanup combined.pdf if not keeping artifacts; an input PDF is never removed
+		if !cfg.KeepArtifacts && !slices.Contains(cfg.InputPDFs, pdfPath) {
+			if err := cfg.stages.CleanupArtifact(pdfPath); err != nil {
+				logWarn(cfg.logger, "failed to cleanup combined.pdf: %v", err)
+			} else {
+				logInfo(cfg.logger, "cleaned up combined.pdf")
+			}
+		}
+	}
+
+	// Pipeline stage 3: Extract text from OCR PDF
+	textPath := filepath.Join(outputDir, stageArtifacts["extract"])
+	if resume["extract"] {
+		events.stageSkipped("extract")
+		return textPath, nil
+	}
+	logInfo(cfg.logger, "Extracting text from OCR PDF...")
+	start := events.stageStart("extract")
+	timeout, err := stageTimeout(ctx, "extract", cfg.ExtractTimeout)
+	if err != nil {
+		events.stageFailed("extract", err)
+		return "", err
+	}
+	textPath, err = cfg.stages.ExtractText(ctx, ocrPath, outputDir, pipeline.PDFToTextMode(cfg.PDFToTextMode), cfg.MinExtractedChars, timeout)
+	var tooShort *pipeline.TextTooShortError
+	if cfg.AllowEmpty && errors.As(err, &tooShort) {
+		logWarn(cfg.logger, "%v; continuing (--allow-empty)", err)
+		err = nil
+	}
+	if err != nil {
+		events.stageFailed("extract", err)
+		return "", newStageError("extract", timeout, start, fmt.Errorf("text extraction failed: %w", err))
+	}
+	logStageDone(cfg.logger, "extract", start, "Text extracted: "+textPath, "path", textPath)
+	events.stageDone("extract", start, nil)
+
+	// Cleanup combined_ocr.pdf if not keeping artifacts
+	if !cfg.KeepArtifacts {
+		if err := cfg.stages.CleanupArtifact(ocrPath); err != nil {
+			logWarn(cfg.logger, "failed to cleanup combined_ocr.pdf: %v", err)
+		} else {
+			logInfo(cfg.logger, "cleaned up combined_ocr.pdf")
+		}
+	}
+
+	return textPath, nil
+}
+
+// ocrOptions returns the ocrmypdf output options of cfg.
+func ocrOptions(cfg runConfig) pipeline.OCROptions {
+	return pipeline.OCROptions{
+		Policy:        pipeline.OCRPolicy(cfg.OCRPolicy),
+		PDFALevel:     cfg.PDFALevel,
+		OptimizeLevel: cfg.OptimizeLevel,
+		JBIG2Lossy:    cfg.JBIG2Lossy,
 	}
+}
 
-	log.Printf("Deduplication completed (took %v)", time.Since(start))
+// runSidecarOCR runs the OCR stage with --use-sidecar: ocrmypdf writes the text
+// alongside the OCR PDF, so the extract stage is skipped. Text below the minimum
+// length fails the extract stage as pdftotext output would. Returns the path to the
+// extracted text file.
+func runSidecarOCR(ctx context.Context, cfg runConfig, pdfPath, lang string, start time.Time, timeout time.Duration, events *eventEmitter) (string, error) {
+	ocrPath, textPath, err := cfg.stages.OCRPDFWithSidecar(ctx, pdfPath, cfg.OutputDir, lang, ocrOptions(cfg), cfg.MinExtractedChars, timeout)
+	var tooShort *pipeline.TextTooShortError
+	if err != nil && !errors.As(err, &tooShort) {
+		events.stageFailed("ocr", err)
+		return "", newStageError("ocr", timeout, start, fmt.Errorf("OCR failed: %w", err))
+	}
+	logStageDone(cfg.logger, "ocr", start, "OCR completed: "+ocrPath, "path", ocrPath)
+	events.stageDone("ocr", start, nil)
+
+	if tooShort != nil {
+		if !cfg.AllowEmpty {
+			events.stageFailed("extract", err)
+			return "", newStageError("extract", timeout, start, fmt.Errorf("text extraction failed: %w", err))
+		}
+		logWarn(cfg.logger, "%v; continuing (--allow-empty)", err)
+	}
+	logInfo(cfg.logger, "Text taken from OCR sidecar: %s", textPath)
+	events.stageSkipped("extract")
 
-	// Pipeline stage 6: Generate Markdown output
-	log.Printf("Generating Markdown output...")
-	start = time.Now()
+	// Neither PDF is read again once the text is written
+	if !cfg.KeepArtifacts {
+		for _, path := range []string{pdfPath, ocrPath} {
+			if slices.Contains(cfg.InputPDFs, path) {
+				continue
+			}
+			if err := cfg.stages.CleanupArtifact(path); err != nil {
+				logWarn(cfg.logger, "failed to cleanup %s: %v", filepath.Base(path), err)
+			} else {
+				logInfo(cfg.logger, "cleaned up %s", filepath.Base(path))
+			}
+		}
+	}
+	return textPath, nil
+}
 
-	// Render Markdown from kept chunks
-	markdownContent := text.RenderMarkdown(markdownTitle, dedupeResult.KeptChunks, includeChunkIDs)
+// ocrInputsFile records the OCR language, options and input images of the run that
+// produced the OCR artifacts in the output directory, with the staging and extraction
+// options that change them; see resumeStages.
+const ocrInputsFile = ".ocr_inputs"
 
-	// Write Markdown file
-	markdownPath := filepath.Join(outputDir, "result.md")
-	if err := text.WriteMarkdown(markdownContent, markdownPath); err != nil {
-		return fmt.Errorf("failed to write Markdown file: %w", err)
+// resumeStages reports which OCR stages can be skipped because an earlier run in the
+// same output directory left their results, unless --force is set. An artifact is up
+// to date if it is newer than every input image, newer than the last change of OCR
+// language, options or input image list, and newer than the artifact of the stage
+// before it if that is still present. An out-of-date artifact also invalidates every artifact after
+// it. A stage is skipped if its own artifact or that of a later stage is up to date.
+func resumeStages(cfg runConfig, images []string) (map[string]bool, error) {
+	skip := map[string]bool{}
+	if cfg.Force {
+		return skip, nil
 	}
 
-	log.Printf("Markdown written: %s (%d chunks, took %v)", markdownPath, len(dedupeResult.KeptChunks), time.Since(start))
+	threshold, err := ocrInputsChanged(cfg, images)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range images {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(threshold) {
+			threshold = info.ModTime()
+		}
+	}
 
-	log.Printf("Pipeline completed successfully. Final output: %s", markdownPath)
+	var fresh []string
+	var prev os.FileInfo
+	for _, stage := range ocrStages {
+		info, err := os.Stat(filepath.Join(cfg.OutputDir, stageArtifacts[stage]))
+		if err != nil {
+			prev = nil
+			continue
+		}
+		if !info.ModTime().After(threshold) || (prev != nil && !info.ModTime().After(prev.ModTime())) {
+			// Stale: later artifacts were made from out-of-date input
+			break
+		}
+		fresh = append(fresh, stage)
+		prev = info
+	}
+
+	if len(fresh) == 0 {
+		return skip, nil
+	}
+	last := fresh[len(fresh)-1]
+	for _, stage := range ocrStages {
+		skip[stage] = true
+		if stage == last {
+			break
+		}
+	}
+	logInfo(cfg.logger, "Resuming: %s is up to date, skipping stages through %s (use --force to rerun)", stageArtifacts[last], last)
+	return skip, nil
+}
+
+// ocrInputsChanged returns when the OCR language, output options, input image list or
+// an option that changes the staged images or extracted text last changed, rewriting
+// ocrInputsFile if they differ from the recorded ones. In dry run nothing is written,
+// and a change is reported as the current time.
+func ocrInputsChanged(cfg runConfig, images []string) (time.Time, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lang=%s\n", ocrLang(cfg, len(images)))
+	// Default options are omitted, matching the records of older runs
+	if opts := ocrOptions(cfg); opts != (pipeline.OCROptions{}) && opts != (pipeline.OCROptions{Policy: pipeline.OCRPolicySkip}) {
+		fmt.Fprintf(&b, "options=%+v\n", opts)
+	}
+	if preprocess := strings.ToLower(cfg.Preprocess); preprocess != "" && preprocess != string(ingest.PreprocessNone) {
+		fmt.Fprintf(&b, "preprocess=%s\n", preprocess)
+	}
+	if cfg.MaxDimension > 0 {
+		fmt.Fprintf(&b, "max-dimension=%d\n", cfg.MaxDimension)
+	}
+	if cfg.AutoOrient {
+		b.WriteString("auto-orient\n")
+	}
+	if cfg.OptimizePNGs {
+		b.WriteString("optimize-pngs\n")
+	}
+	if mode := strings.ToLower(cfg.PDFToTextMode); mode != "" && mode != string(pipeline.PDFToTextLayout) {
+		fmt.Fprintf(&b, "pdftotext-mode=%s\n", mode)
+	}
+	if cfg.UseSidecar {
+		b.WriteString("use-sidecar\n")
+	}
+	for _, path := range images {
+		b.WriteString(path + "\n")
+	}
+
+	path := filepath.Join(cfg.OutputDir, ocrInputsFile)
+	if data, err := os.ReadFile(path); err == nil && string(data) == b.String() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+	if cfg.DryRun {
+		return time.Now(), nil
+	}
+	if err := fsutil.WriteFileAtomic(path, []byte(b.String()), 0644); err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// usesAutoLang reports whether a run of cfg detects the OCR language of any page: with
+// --lang auto, or a --lang-map range set to auto. Text input is not OCRed.
+func usesAutoLang(cfg runConfig) bool {
+	if cfg.InputTextGlob != "" {
+		return false
+	}
+	if cfg.Lang == pipeline.AutoLang {
+		return true
+	}
+	for _, r := range cfg.LangMap {
+		if r.Lang == pipeline.AutoLang {
+			return true
+		}
+	}
+	return false
+}
+
+// detectOCRLang detects the language of pdfPath for --lang auto, falling back to
+// pipeline.FallbackLang if detection fails.
+func detectOCRLang(ctx context.Context, cfg runConfig, pdfPath string) string {
+	logInfo(cfg.logger, "Detecting OCR language...")
+	lang, err := cfg.stages.DetectLanguage(ctx, pdfPath, cfg.OCRTimeout)
+	if err != nil {
+		logWarn(cfg.logger, "language detection failed: %v; using %s", err, pipeline.FallbackLang)
+		return pipeline.FallbackLang
+	}
+	return lang
+}
+
+// ocrLang returns the language for OCR of the combined PDF of pageCount pages. With
+// --lang-map the whole PDF is OCRed in one pass, so every language used by some page
+// is passed to the OCR engine together (e.g. "eng+fra").
+func ocrLang(cfg runConfig, pageCount int) string {
+	if len(cfg.LangMap) == 0 {
+		return cfg.Lang
+	}
+	return cfg.LangMap.Languages(pageCount, cfg.Lang)
+}
+
+// writePartialSummary records a run stopped by a stage timeout in run_summary.json.
+// Stages before the failed one are reported complete, along with whichever of their
+// artifacts are still in the output directory (cleanup may have removed some).
+func writePartialSummary(cfg runConfig, se *stageError, imageCount int) {
+	summary := report.RunSummary{
+		Status:          "partial",
+		FailedStage:     se.stage,
+		Error:           se.Error(),
+		CompletedStages: []string{"stage"},
+		InputImages:     imageCount,
+	}
+	for _, stage := range ocrStages {
+		if stage == se.stage {
+			break
+		}
+		summary.CompletedStages = append(summary.CompletedStages, stage)
+		name := stageArtifacts[stage]
+		if _, err := os.Stat(filepath.Join(cfg.OutputDir, name)); err == nil {
+			summary.Artifacts = append(summary.Artifacts, name)
+		}
+	}
+
+	summaryPath := filepath.Join(cfg.OutputDir, "run_summary.json")
+	if err := report.WriteRunSummary(summary, summaryPath); err != nil {
+		logWarn(cfg.logger, "failed to write partial run summary: %v", err)
+		return
+	}
+	logInfo(cfg.logger, "Partial run summary written: %s (timed out in %s)", summaryPath, se.stage)
+}
+
+// imageCacheKeys computes an OCR cache key for each staged image, in page order.
+func imageCacheKeys(staged []string, lang string) ([]string, error) {
+	keys := make([]string, 0, len(staged))
+	for _, path := range staged {
+		hash, err := cache.HashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, cache.Key(hash, lang))
+	}
+	return keys, nil
+}
+
+// loadCachedText reassembles extracted.txt from the cache when every image has an entry.
+// OCR runs over one combined PDF, so a single miss means the whole set is re-OCR'd.
+// Returns an empty path on a miss.
+func loadCachedText(c *cache.Cache, keys []string, outputDir string) (string, error) {
+	pages := make([]string, 0, len(keys))
+	for _, key := range keys {
+		page, ok, err := c.Get(key)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", nil
+		}
+		pages = append(pages, page)
+	}
+
+	textPath := filepath.Join(outputDir, "extracted.txt")
+	if err := fsutil.WriteFileAtomic(textPath, []byte(cache.JoinPages(pages)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write cached text: %w", err)
+	}
+	return textPath, nil
+}
+
+// storeCachedText splits extracted text into pages and stores one entry per image.
+func storeCachedText(c *cache.Cache, keys []string, textPath string) error {
+	content, err := os.ReadFile(textPath)
+	if err != nil {
+		return fmt.Errorf("failed to read extracted text: %w", err)
+	}
+	pages, ok := cache.SplitPages(string(content), len(keys))
+	if !ok {
+		return fmt.Errorf("extracted text page count does not match %d images", len(keys))
+	}
+	for i, key := range keys {
+		if err := c.Put(key, pages[i]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
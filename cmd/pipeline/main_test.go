@@ -1,16 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+	"github.com/jonkmatsumo/bulk-ocr/internal/ingest"
+	"github.com/jonkmatsumo/bulk-ocr/internal/pipeline"
+	"github.com/jonkmatsumo/bulk-ocr/internal/report"
 	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
 )
 
 func getRepoRoot(t *testing.T) string {
@@ -95,10 +110,7 @@ func TestMain_Run_WithImages(t *testing.T) {
 	// Create test images
 	testFiles := []string{"image1.jpg", "image2.png", "image3.jpeg"}
 	for _, f := range testFiles {
-		path := filepath.Join(tmpInput, f)
-		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
-			t.Fatalf("failed to create test file: %v", err)
-		}
+		createMockImage(t, tmpInput, f)
 	}
 
 	cmd := exec.Command("go", "run", "./cmd/pipeline", "run",
@@ -201,7 +213,7 @@ func TestDoctorCommand_AllToolsPresent(t *testing.T) {
 
 	// Test that function runs without error when all tools are present
 	// Note: We can't easily test os.Exit behavior, so we just verify the function completes
-	err := doctorCommandWithRunner([]string{}, mockR)
+	err := doctorCommandWithRunner([]string{}, mockR, io.Discard)
 	// Function may return nil even if it calls os.Exit(1), so we just check it doesn't panic
 	if err != nil && !strings.Contains(err.Error(), "failed to parse flags") {
 		t.Logf("doctorCommand returned error (may be expected): %v", err)
@@ -225,7 +237,7 @@ func TestDoctorCommand_MissingTools(t *testing.T) {
 
 	// Test that function handles missing tools
 	// With mocked runner, it should return error instead of calling os.Exit
-	err := doctorCommandWithRunner([]string{}, mockR)
+	err := doctorCommandWithRunner([]string{}, mockR, io.Discard)
 	if err == nil {
 		t.Error("expected error when tools are missing")
 	}
@@ -247,11 +259,454 @@ func TestDoctorCommand_VersionExtractionFailure(t *testing.T) {
 	}
 
 	// Test that function handles version extraction failures
-	err := doctorCommandWithRunner([]string{}, mockR)
+	err := doctorCommandWithRunner([]string{}, mockR, io.Discard)
 	// Function may return nil even if it calls os.Exit(1)
 	_ = err
 }
 
+// captureStderr runs fn with os.Stderr and the standard logger, and so the doctor's
+// log output, redirected to a temp file, and returns what was written.
+func captureStderr(t *testing.T, fn func()) *bytes.Buffer {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	orig, origLog := os.Stderr, log.Writer()
+	os.Stderr = f
+	log.SetOutput(f)
+	defer func() {
+		os.Stderr = orig
+		log.SetOutput(origLog)
+	}()
+	fn()
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("failed to read captured stderr: %v", err)
+	}
+	return bytes.NewBuffer(data)
+}
+
+func TestDoctorCommand_OutdatedTool(t *testing.T) {
+	var err error
+	mockR := &mockRunner{}
+	mockR.runFunc = func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+		versions := map[string]string{
+			"python3":   "Python 3.11.4",
+			"ocrmypdf":  "12.7.2",
+			"tesseract": "tesseract 5.3.0",
+			"pdftotext": "pdftotext version 22.02.0",
+			"gs":        "10.02.1",
+		}
+		if bin == "tesseract" && args[0] == "--list-langs" {
+			return runner.Result{Stdout: "eng\n"}, nil
+		}
+		return runner.Result{Stdout: versions[bin]}, nil
+	}
+
+	logs := captureStderr(t, func() {
+		err = doctorCommandWithRunner([]string{}, mockR, io.Discard)
+	})
+	if err == nil || !strings.Contains(err.Error(), "doctor found errors") {
+		t.Fatalf("expected doctor to fail for an outdated tool, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "- ocrmypdf: OUTDATED (found 12.7.2, need ≥13)") {
+		t.Errorf("expected ocrmypdf to be reported as outdated, got:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "- tesseract: OK (tesseract 5.3.0)") {
+		t.Errorf("expected tesseract to be OK, got:\n%s", logs.String())
+	}
+}
+
+// doctorJSON runs doctor --json with tools found at /usr/bin and the given version
+// output, and decodes the report.
+func doctorJSON(t *testing.T, args []string, versions map[string]string) (doctorReport, map[string]any, error) {
+	t.Helper()
+	mockR := &mockRunner{
+		lookPathFunc: func(bin string) (string, error) {
+			if _, ok := versions[bin]; !ok {
+				return "", fmt.Errorf("not found: %s", bin)
+			}
+			return "/usr/bin/" + bin, nil
+		},
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin == "tesseract" && args[0] == "--list-langs" {
+				return runner.Result{Stdout: "eng\nosd\n"}, nil
+			}
+			return runner.Result{Stdout: versions[bin]}, nil
+		},
+	}
+
+	var out bytes.Buffer
+	err := doctorCommandWithRunner(append([]string{"--json"}, args...), mockR, &out)
+	var rep doctorReport
+	if jerr := json.Unmarshal(out.Bytes(), &rep); jerr != nil {
+		t.Fatalf("doctor --json wrote invalid JSON: %v\n%s", jerr, out.String())
+	}
+	var raw map[string]any
+	if jerr := json.Unmarshal(out.Bytes(), &raw); jerr != nil {
+		t.Fatalf("doctor --json wrote invalid JSON: %v", jerr)
+	}
+	return rep, raw, err
+}
+
+var doctorTestVersions = map[string]string{
+	"python3":   "Python 3.11.4",
+	"ocrmypdf":  "16.0.4",
+	"tesseract": "tesseract 5.3.0",
+	"pdftotext": "pdftotext version 22.02.0",
+	"pdftoppm":  "pdftoppm version 22.02.0",
+	"jbig2":     "jbig2enc 0.29",
+	"pngquant":  "2.17.0 (July 2021)",
+	"qpdf":      "qpdf version 11.3.0",
+	"gs":        "10.02.1",
+}
+
+func TestDoctorCommand_LangAutoRequiresPdftoppm(t *testing.T) {
+	versions := make(map[string]string, len(doctorTestVersions))
+	for bin, version := range doctorTestVersions {
+		if bin != "pdftoppm" {
+			versions[bin] = version
+		}
+	}
+
+	rep, _, err := doctorJSON(t, nil, versions)
+	if err != nil || !rep.OK {
+		t.Errorf("expected pdftoppm to be optional by default, got ok=%v err=%v", rep.OK, err)
+	}
+
+	rep, _, err = doctorJSON(t, []string{"--lang", "auto"}, versions)
+	if err == nil || rep.OK {
+		t.Error("expected doctor --lang auto to fail without pdftoppm")
+	}
+	for _, tool := range rep.Tools {
+		if tool.Name == "pdftoppm" && (!tool.Required || tool.Status != toolMissing) {
+			t.Errorf("expected pdftoppm to be a missing required tool, got %+v", tool)
+		}
+	}
+}
+
+func TestDoctorCommand_JSONAllPresent(t *testing.T) {
+	rep, raw, err := doctorJSON(t, []string{"--smoke"}, doctorTestVersions)
+	if err != nil {
+		t.Fatalf("doctor --json failed: %v", err)
+	}
+	if !rep.OK {
+		t.Error("expected ok to be true")
+	}
+	if len(rep.Tools) != 10 {
+		t.Fatalf("expected 10 tools, got %+v", rep.Tools)
+	}
+	for _, tool := range rep.Tools {
+		if !tool.Present || tool.Status != toolOK || tool.Path == "" || tool.Version == "" {
+			t.Errorf("unexpected tool entry: %+v", tool)
+		}
+	}
+	if rep.Tools[1].Name != "ocrmypdf" || rep.Tools[1].Version != "16.0.4" || rep.Tools[1].Path != "/usr/bin/ocrmypdf" {
+		t.Errorf("unexpected ocrmypdf entry: %+v", rep.Tools[1])
+	}
+	if rep.Smoke == nil || rep.Smoke.Status != "skipped" {
+		t.Errorf("expected skipped smoke result with a mocked runner, got %+v", rep.Smoke)
+	}
+
+	// Field names are part of the CI contract
+	tool := raw["tools"].([]any)[0].(map[string]any)
+	for _, key := range []string{"name", "present", "path", "version", "status"} {
+		if _, ok := tool[key]; !ok {
+			t.Errorf("tool entry has no %q field: %v", key, tool)
+		}
+	}
+	if _, ok := raw["ok"].(bool); !ok {
+		t.Errorf("expected boolean ok field, got %v", raw["ok"])
+	}
+}
+
+func TestDoctorCommand_Img2PDFCmd(t *testing.T) {
+	versions := map[string]string{"img2pdf": "0.5.1"}
+	for bin, v := range doctorTestVersions {
+		versions[bin] = v
+	}
+	img2pdfEntry := func(rep doctorReport) toolStatus {
+		t.Helper()
+		for _, tool := range rep.Tools {
+			if tool.Name == "img2pdf" {
+				return tool
+			}
+		}
+		t.Fatalf("expected an img2pdf entry, got %+v", rep.Tools)
+		return toolStatus{}
+	}
+
+	rep, _, err := doctorJSON(t, []string{"--img2pdf-cmd", "img2pdf"}, versions)
+	if err != nil {
+		t.Fatalf("doctor --json failed: %v", err)
+	}
+	if tool := img2pdfEntry(rep); tool.Status != toolOK || tool.Path != "/usr/bin/img2pdf" || tool.Version != "0.5.1" || !tool.Required {
+		t.Errorf("expected the img2pdf binary to be checked, got %+v", tool)
+	}
+
+	// The module form checks the interpreter running img2pdf
+	rep, _, err = doctorJSON(t, nil, versions)
+	if err != nil {
+		t.Fatalf("doctor --json failed: %v", err)
+	}
+	if tool := img2pdfEntry(rep); tool.Status != toolOK || tool.Path != "/usr/bin/python3" {
+		t.Errorf("expected python3 -m img2pdf to be checked, got %+v", tool)
+	}
+
+	delete(versions, "img2pdf")
+	rep, _, err = doctorJSON(t, []string{"--img2pdf-cmd", "img2pdf"}, versions)
+	if err == nil || rep.OK {
+		t.Errorf("expected doctor to fail when the img2pdf binary is missing, got %v", err)
+	}
+	if tool := img2pdfEntry(rep); tool.Status != toolMissing {
+		t.Errorf("expected a missing img2pdf entry, got %+v", tool)
+	}
+}
+
+func TestParseRunConfig_Img2PDFCmd(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--img2pdf-cmd", "/opt/venv/bin/python"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if cfg.Img2PDFCmd != "/opt/venv/bin/python" {
+		t.Errorf("expected the img2pdf command to be kept, got %q", cfg.Img2PDFCmd)
+	}
+}
+
+func TestDoctorCommand_JSONMissingTool(t *testing.T) {
+	versions := map[string]string{}
+	for bin, v := range doctorTestVersions {
+		if bin != "pdftotext" && bin != "gs" {
+			versions[bin] = v
+		}
+	}
+
+	rep, raw, err := doctorJSON(t, nil, versions)
+	if err == nil || !strings.Contains(err.Error(), "doctor found errors") {
+		t.Errorf("expected doctor to fail with a missing tool, got %v", err)
+	}
+	if rep.OK {
+		t.Error("expected ok to be false")
+	}
+	tools := map[string]toolStatus{}
+	for _, tool := range rep.Tools {
+		tools[tool.Name] = tool
+	}
+	if tool := tools["pdftotext"]; tool.Present || tool.Status != toolMissing || !tool.Required {
+		t.Errorf("expected missing required pdftotext entry, got %+v", tool)
+	}
+	if tool := tools["ghostscript"]; tool.Present || tool.Status != toolMissing || tool.Required {
+		t.Errorf("expected missing optional ghostscript entry, got %+v", tool)
+	}
+	if _, ok := raw["smoke"]; ok {
+		t.Error("expected no smoke result without --smoke")
+	}
+}
+
+func TestCheckTools_RequiredAndOptional(t *testing.T) {
+	tools := []pipeline.ToolCheck{
+		{Name: "needed", Bin: "needed", VersionArgs: []string{"--version"}, Required: true},
+		{Name: "extra", Bin: "extra", VersionArgs: []string{"--version"}},
+	}
+	tests := []struct {
+		name    string
+		present map[string]bool
+		wantOK  bool
+	}{
+		{"all present", map[string]bool{"needed": true, "extra": true}, true},
+		{"optional missing", map[string]bool{"needed": true}, true},
+		{"required missing", map[string]bool{"extra": true}, false},
+	}
+	for _, tt := range tests {
+		mockR := &mockRunner{
+			lookPathFunc: func(bin string) (string, error) {
+				if !tt.present[bin] {
+					return "", fmt.Errorf("not found: %s", bin)
+				}
+				return "/usr/bin/" + bin, nil
+			},
+			runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+				return runner.Result{Stdout: bin + " 1.0"}, nil
+			},
+		}
+		rep := checkTools(context.Background(), mockR, tools, nil)
+		if rep.OK != tt.wantOK {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.wantOK, rep.OK)
+		}
+		if len(rep.Tools) != 2 {
+			t.Errorf("%s: expected both tools to be reported, got %+v", tt.name, rep.Tools)
+		}
+	}
+}
+
+func TestCheckTools_RunnerOverrides(t *testing.T) {
+	venv := t.TempDir()
+	override := filepath.Join(venv, "ocrmypdf-venv")
+	if err := os.WriteFile(override, []byte("#!/bin/sh\necho 16.4.0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(venv, "pathtool-xyz123"), []byte("#!/bin/sh\necho 2.0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tools := []pipeline.ToolCheck{
+		{Name: "ocrmypdf", Bin: "ocrmypdf-xyz123", VersionArgs: []string{"--version"}, Required: true},
+		{Name: "pathtool", Bin: "pathtool-xyz123", VersionArgs: []string{"--version"}, Required: true},
+	}
+
+	bins, err := parseBinOverrides([]string{"ocrmypdf-xyz123=" + override})
+	if err != nil {
+		t.Fatalf("parseBinOverrides failed: %v", err)
+	}
+	shared := runner.New()
+	r := withRunnerOverrides(shared, bins, toolEnv(venv+":$PATH"))
+	rep := checkTools(context.Background(), r, tools, nil)
+	if !rep.OK {
+		t.Fatalf("expected both tools to be found through the overrides, got %+v", rep.Tools)
+	}
+	if rep.Tools[0].Path != override || rep.Tools[0].Version != "16.4.0" {
+		t.Errorf("expected the bin override to be checked, got %+v", rep.Tools[0])
+	}
+	if rep.Tools[1].Path != filepath.Join(venv, "pathtool-xyz123") {
+		t.Errorf("expected the tool to be found on --tool-path, got %+v", rep.Tools[1])
+	}
+
+	if rep := checkTools(context.Background(), shared, tools, nil); rep.OK {
+		t.Error("expected the tools to be missing without the overrides, and the runner they were applied to unchanged")
+	}
+}
+
+func TestParseRunConfig_BinOverride(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--bin-override", "ocrmypdf=/opt/venv/bin/ocrmypdf", "--bin-override", "pdftotext = /opt/poppler/pdftotext", "--tool-path", "/opt/venv/bin:$PATH"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	want := map[string]string{"ocrmypdf": "/opt/venv/bin/ocrmypdf", "pdftotext": "/opt/poppler/pdftotext"}
+	if !reflect.DeepEqual(cfg.BinOverrides, want) {
+		t.Errorf("expected overrides %v, got %v", want, cfg.BinOverrides)
+	}
+	if cfg.ToolPath != "/opt/venv/bin:$PATH" {
+		t.Errorf("expected the tool path to be kept unexpanded, got %q", cfg.ToolPath)
+	}
+	for _, value := range []string{"ocrmypdf", "=/opt/venv/bin/ocrmypdf", "ocrmypdf="} {
+		if _, err := parseRunConfig([]string{"--bin-override", value}); err == nil {
+			t.Errorf("expected error for --bin-override %q", value)
+		}
+	}
+}
+
+func TestDoctorCommand_OptionalToolFailureNotAnError(t *testing.T) {
+	versions := map[string]string{}
+	for bin, v := range doctorTestVersions {
+		versions[bin] = v
+	}
+	versions["gs"] = "9.27" // Outdated but optional
+
+	rep, _, err := doctorJSON(t, nil, versions)
+	if err != nil || !rep.OK {
+		t.Fatalf("expected an outdated optional tool to pass, got ok=%v err=%v", rep.OK, err)
+	}
+	last := rep.Tools[len(rep.Tools)-1]
+	if last.Name != "ghostscript" || last.Status != toolOutdated || last.Required {
+		t.Errorf("expected outdated optional ghostscript entry, got %+v", last)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []int
+	}{
+		{"3.9.0", []int{3, 9, 0}},
+		{"Python 3.11.4", []int{3, 11, 4}},
+		{"5.0.0-dev", []int{5, 0, 0}},
+		{"tesseract v5.0.0-alpha-20201231", []int{5, 0, 0}},
+		{"GPL Ghostscript 10.0.0", []int{10, 0, 0}},
+		{"13", []int{13}},
+		{"22.02.0.", []int{22, 2, 0}},
+	}
+	for _, tt := range tests {
+		got, err := parseVersion(tt.input)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseVersion(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "OK", "unknown build", "dev-snapshot"} {
+		if got, err := parseVersion(input); err == nil {
+			t.Errorf("parseVersion(%q) = %v, expected an error", input, got)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want int
+	}{
+		{[]int{13}, []int{13, 0, 0}, 0},
+		{[]int{12, 7, 2}, []int{13}, -1},
+		{[]int{10, 0, 0}, []int{9, 50}, 1},
+		{[]int{9, 5}, []int{9, 50}, -1},
+		{[]int{4, 1, 1}, []int{4, 1}, 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMinVersion(t *testing.T) {
+	tests := []struct {
+		name, found  string
+		wantOutdated bool
+	}{
+		{"ocrmypdf", "15.0.0", false},
+		{"ocrmypdf", "12.7.2", true},
+		{"tesseract", "5.0.0-dev", false},
+		{"tesseract", "4.0.0", true},
+		{"ghostscript", "GPL Ghostscript 10.0.0", false},
+		{"ghostscript", "9.27", true},
+		{"python3", "OK", false},   // Unparseable versions only warn
+		{"unlisted", "0.1", false}, // No minimum
+	}
+	for _, tt := range tests {
+		if _, outdated := checkMinVersion(tt.name, tt.found, nil); outdated != tt.wantOutdated {
+			t.Errorf("checkMinVersion(%q, %q) outdated = %v, want %v", tt.name, tt.found, outdated, tt.wantOutdated)
+		}
+	}
+}
+
+func TestTesseractLangs(t *testing.T) {
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin != "tesseract" || len(args) != 1 || args[0] != "--list-langs" {
+				t.Errorf("unexpected command: %s %v", bin, args)
+			}
+			return runner.Result{Stdout: "List of available languages in \"/usr/share/tessdata/\" (3):\nosd\nfra\neng\n"}, nil
+		},
+	}
+
+	langs, err := tesseractLangs(context.Background(), mockR)
+	if err != nil {
+		t.Fatalf("tesseractLangs() failed: %v", err)
+	}
+	if strings.Join(langs, ",") != "eng,fra,osd" {
+		t.Errorf("expected eng,fra,osd, got %v", langs)
+	}
+
+	mockR.runFunc = func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+		return runner.Result{}, nil
+	}
+	if _, err := tesseractLangs(context.Background(), mockR); err == nil {
+		t.Error("expected error when no languages are listed")
+	}
+}
+
 func TestDoctorCommand_WithSmokeTest(t *testing.T) {
 	// Smoke test requires real runner, so we skip it when using mock
 	// This test verifies the flag parsing works
@@ -266,7 +721,7 @@ func TestDoctorCommand_WithSmokeTest(t *testing.T) {
 	}
 
 	// With --smoke flag, but mocked runner will skip actual smoke test
-	err := doctorCommandWithRunner([]string{"--smoke"}, mockR)
+	err := doctorCommandWithRunner([]string{"--smoke"}, mockR, io.Discard)
 	// Function should complete (smoke test skipped with mock)
 	_ = err
 }
@@ -355,26 +810,48 @@ func TestMain_UnknownSubcommand(t *testing.T) {
 // mockPipelineStages implements pipelineStages interface
 type mockPipelineStages struct {
 	buildPDFFunc    func(string, string, time.Duration) (string, error)
+	mergePDFsFunc   func([]string, string, time.Duration) (string, error)
 	ocrPDFFunc      func(string, string, string, time.Duration) (string, error)
+	sidecarFunc     func(string, string, string, int, time.Duration) (string, string, error)
 	extractTextFunc func(string, string, time.Duration) (string, error)
+	detectLangFunc  func(string, time.Duration) (string, error)
 	cleanupFunc     func(string) error
 }
 
-func (m *mockPipelineStages) BuildPDF(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+func (m *mockPipelineStages) BuildPDF(_ context.Context, preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
 	if m.buildPDFFunc != nil {
 		return m.buildPDFFunc(preprocessedDir, outputDir, timeout)
 	}
 	return filepath.Join(outputDir, "combined.pdf"), nil
 }
 
-func (m *mockPipelineStages) OCRPDF(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+func (m *mockPipelineStages) MergePDFs(_ context.Context, pdfPaths []string, outputDir string, timeout time.Duration) (string, error) {
+	if m.mergePDFsFunc != nil {
+		return m.mergePDFsFunc(pdfPaths, outputDir, timeout)
+	}
+	return filepath.Join(outputDir, "combined.pdf"), nil
+}
+
+func (m *mockPipelineStages) OCRPDF(_ context.Context, pdfPath, outputDir, lang string, _ pipeline.OCROptions, timeout time.Duration) (string, error) {
 	if m.ocrPDFFunc != nil {
 		return m.ocrPDFFunc(pdfPath, outputDir, lang, timeout)
 	}
 	return filepath.Join(outputDir, "combined_ocr.pdf"), nil
 }
 
-func (m *mockPipelineStages) ExtractText(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+func (m *mockPipelineStages) OCRPDFWithSidecar(_ context.Context, pdfPath, outputDir, lang string, _ pipeline.OCROptions, minChars int, timeout time.Duration) (string, string, error) {
+	if m.sidecarFunc != nil {
+		return m.sidecarFunc(pdfPath, outputDir, lang, minChars, timeout)
+	}
+	textPath := filepath.Join(outputDir, "extracted.txt")
+	content := "This is test sidecar text written by ocrmypdf with more than 20 characters."
+	if err := os.WriteFile(textPath, []byte(content), 0644); err != nil {
+		return "", "", err
+	}
+	return filepath.Join(outputDir, "combined_ocr.pdf"), textPath, nil
+}
+
+func (m *mockPipelineStages) ExtractText(_ context.Context, pdfPath, outputDir string, mode pipeline.PDFToTextMode, minChars int, timeout time.Duration) (string, error) {
 	if m.extractTextFunc != nil {
 		return m.extractTextFunc(pdfPath, outputDir, timeout)
 	}
@@ -387,6 +864,13 @@ func (m *mockPipelineStages) ExtractText(pdfPath, outputDir string, timeout time
 	return textPath, nil
 }
 
+func (m *mockPipelineStages) DetectLanguage(_ context.Context, pdfPath string, timeout time.Duration) (string, error) {
+	if m.detectLangFunc != nil {
+		return m.detectLangFunc(pdfPath, timeout)
+	}
+	return "eng", nil
+}
+
 func (m *mockPipelineStages) CleanupArtifact(path string) error {
 	if m.cleanupFunc != nil {
 		return m.cleanupFunc(path)
@@ -428,6 +912,30 @@ func setupTestDirs(t *testing.T) (inputDir, outputDir string) {
 	return inputDir, outputDir
 }
 
+// newTestRunConfig returns a runConfig with the CLI defaults used across runCommand tests.
+func newTestRunConfig(inputDir, outputDir string) runConfig {
+	return runConfig{
+		InputDir:         inputDir,
+		OutputDir:        outputDir,
+		KeepArtifacts:    true,
+		Lang:             "eng",
+		Recursive:        false,
+		PDFTimeout:       5 * time.Minute,
+		OCRTimeout:       10 * time.Minute,
+		ExtractTimeout:   2 * time.Minute,
+		MinChunkChars:    60,
+		MaxBlankLines:    1,
+		EmitChunksJSONL:  false,
+		ChromePatterns:   []string{},
+		SimHashK:         5,
+		SimHashThreshold: 6,
+		Window:           250,
+		DedupeMethod:     "simhash",
+		MarkdownTitle:    "Title",
+		IncludeChunkIDs:  false,
+	}
+}
+
 func createMockImage(t *testing.T, dir, name string) {
 	path := filepath.Join(dir, name)
 	// Create a minimal valid PNG (1x1 white pixel)
@@ -563,7 +1071,7 @@ func TestGenerateTestImage_PythonFailure(t *testing.T) {
 }
 
 // Test runSmokeTest()
-// Note: runSmokeTest requires *runner.Runner, not an interface, so we can't easily mock it
+// Note: runSmokeTest still generates its test image with a real runner
 // These tests verify the error handling paths, but may require actual tools
 func TestRunSmokeTest_Success(t *testing.T) {
 	// This test requires actual external tools (python3, img2pdf, ocrmypdf, pdftotext)
@@ -571,6 +1079,33 @@ func TestRunSmokeTest_Success(t *testing.T) {
 	t.Skip("runSmokeTest requires actual external tools, skipping unit test")
 }
 
+func TestRunSmokeTest_TmpDir(t *testing.T) {
+	tmpRoot := t.TempDir()
+	var dirs []string
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			dirs = append(dirs, opts.Dir)
+			return runner.Result{Stdout: "TEST"}, nil
+		},
+	}
+
+	if err := runSmokeTest(context.Background(), mockR, pipeline.DefaultImg2PDFCommand, tmpRoot, nil); err != nil {
+		t.Fatalf("runSmokeTest() failed: %v", err)
+	}
+	if len(dirs) != 3 {
+		t.Fatalf("expected 3 smoke test commands, got %d", len(dirs))
+	}
+	for _, dir := range dirs {
+		if filepath.Dir(dir) != tmpRoot || !strings.HasPrefix(filepath.Base(dir), "doctor-smoke-") {
+			t.Errorf("expected smoke test dir under %s, got %s", tmpRoot, dir)
+		}
+	}
+	// The temp directory is removed afterwards
+	if entries, err := os.ReadDir(tmpRoot); err != nil || len(entries) != 0 {
+		t.Errorf("expected %s to be empty after the smoke test, got %v (%v)", tmpRoot, entries, err)
+	}
+}
+
 func TestRunSmokeTest_ImageGenerationFailure(t *testing.T) {
 	// This would require refactoring generateTestImage to accept a mock runner
 	// For now, we test generateTestImage separately
@@ -650,25 +1185,26 @@ func TestRunCommand_HappyPath(t *testing.T) {
 	pipelineStagesImpl = mockStages
 
 	// Run command
-	err := runCommand(
-		inputDir, outputDir,
-		true,           // keepArtifacts
-		"eng",          // lang
-		false,          // recursive
-		5*time.Minute,  // pdfTimeout
-		10*time.Minute, // ocrTimeout
-		2*time.Minute,  // extractTimeout
-		60,             // minChunkChars
-		2,              // maxBlankLines
-		false,          // emitChunksJSONL
-		[]string{},     // chromePatterns
-		5,              // simhashK
-		6,              // simhashThreshold
-		250,            // window
-		"simhash",      // dedupeMethod
-		"Test Title",   // markdownTitle
-		false,          // includeChunkIDs
-	)
+	err := runCommand(context.Background(), runConfig{
+		InputDir:         inputDir,
+		OutputDir:        outputDir,
+		KeepArtifacts:    true,
+		Lang:             "eng",
+		Recursive:        false,
+		PDFTimeout:       5 * time.Minute,
+		OCRTimeout:       10 * time.Minute,
+		ExtractTimeout:   2 * time.Minute,
+		MinChunkChars:    60,
+		MaxBlankLines:    1,
+		EmitChunksJSONL:  false,
+		ChromePatterns:   []string{},
+		SimHashK:         5,
+		SimHashThreshold: 6,
+		Window:           250,
+		DedupeMethod:     "simhash",
+		MarkdownTitle:    "Test Title",
+		IncludeChunkIDs:  false,
+	})
 
 	if err != nil {
 		t.Fatalf("runCommand() failed: %v", err)
@@ -689,14 +1225,8 @@ func TestRunCommand_HappyPath(t *testing.T) {
 func TestRunCommand_InvalidInputDirectory(t *testing.T) {
 	outputDir := t.TempDir()
 
-	err := runCommand(
-		"/nonexistent/directory",
-		outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	cfg := newTestRunConfig("/nonexistent/directory", outputDir)
+	err := runCommand(context.Background(), cfg)
 
 	if err == nil {
 		t.Error("expected error for invalid input directory")
@@ -710,13 +1240,7 @@ func TestRunCommand_NoImagesFound(t *testing.T) {
 	inputDir, outputDir := setupTestDirs(t)
 
 	// Empty input directory
-	err := runCommand(
-		inputDir, outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir))
 
 	// Should return nil (graceful exit)
 	if err != nil {
@@ -738,13 +1262,7 @@ func TestRunCommand_BuildPDFFailure(t *testing.T) {
 
 	pipelineStagesImpl = mockStages
 
-	err := runCommand(
-		inputDir, outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir))
 
 	if err == nil {
 		t.Error("expected error from BuildPDF failure")
@@ -778,13 +1296,7 @@ func TestRunCommand_OCRPDFFailure(t *testing.T) {
 
 	pipelineStagesImpl = mockStages
 
-	err := runCommand(
-		inputDir, outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir))
 
 	if err == nil {
 		t.Error("expected error from OCRPDF failure")
@@ -827,13 +1339,7 @@ func TestRunCommand_ExtractTextFailure(t *testing.T) {
 
 	pipelineStagesImpl = mockStages
 
-	err := runCommand(
-		inputDir, outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir))
 
 	if err == nil {
 		t.Error("expected error from ExtractText failure")
@@ -889,14 +1395,9 @@ func TestRunCommand_ArtifactCleanup(t *testing.T) {
 	pipelineStagesImpl = mockStages
 
 	// Test with keepArtifacts=false
-	err := runCommand(
-		inputDir, outputDir,
-		false, // keepArtifacts = false
-		"eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.KeepArtifacts = false
+	err := runCommand(context.Background(), cfg)
 
 	if err != nil {
 		t.Fatalf("runCommand() failed: %v", err)
@@ -912,14 +1413,8 @@ func TestRunCommand_ArtifactCleanup(t *testing.T) {
 
 	// Reset and test with keepArtifacts=true
 	cleanupCalled = make(map[string]bool)
-	err = runCommand(
-		inputDir, outputDir,
-		true, // keepArtifacts = true
-		"eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	cfg.KeepArtifacts = true
+	err = runCommand(context.Background(), cfg)
 
 	if err != nil {
 		t.Fatalf("runCommand() failed: %v", err)
@@ -966,13 +1461,7 @@ func TestRunCommand_ReadExtractedTextFailure(t *testing.T) {
 
 	pipelineStagesImpl = mockStages
 
-	err := runCommand(
-		inputDir, outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, false, []string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir))
 
 	if err == nil {
 		t.Error("expected error from ReadFile failure")
@@ -1035,14 +1524,9 @@ func TestRunCommand_WriteChunksJSONLFailure(t *testing.T) {
 	}
 
 	// Test with emitChunksJSONL=true to trigger WriteChunksJSONL
-	err := runCommand(
-		inputDir, outputDir,
-		true, "eng", false,
-		5*time.Minute, 10*time.Minute, 2*time.Minute,
-		60, 2, true, // emitChunksJSONL = true
-		[]string{},
-		5, 6, 250, "simhash", "Title", false,
-	)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.EmitChunksJSONL = true
+	err := runCommand(context.Background(), cfg)
 
 	// May or may not fail depending on system permissions
 	// If it fails, verify it's the expected error
@@ -1051,12 +1535,3370 @@ func TestRunCommand_WriteChunksJSONLFailure(t *testing.T) {
 	}
 }
 
-func TestDoctorCommand_Wrapper(t *testing.T) {
-	// Test the wrapper function doctorCommand (not doctorCommandWithRunner)
-	// This is a simple wrapper that calls runner.New() and doctorCommandWithRunner
-	// Since it may call os.Exit(1) if tools are missing, we can't easily test it
-	// without potentially terminating the test process
-	// The wrapper is trivial (just calls runner.New()), so we skip this test
-	// and rely on testing doctorCommandWithRunner directly
-	t.Skip("doctorCommand wrapper may call os.Exit, skipping to avoid test termination")
+func TestRunCommand_ResumeSkipsUpToDateStages(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.png")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	buildCalls, ocrCalls := 0, 0
+	ocrErr := fmt.Errorf("ocrmypdf failed")
+	mockStages := &mockPipelineStages{}
+	mockStages.buildPDFFunc = func(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+		buildCalls++
+		pdfPath := filepath.Join(outputDir, "combined.pdf")
+		return pdfPath, os.WriteFile(pdfPath, []byte("%PDF-1.4"), 0644)
+	}
+	mockStages.ocrPDFFunc = func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+		ocrCalls++
+		return filepath.Join(outputDir, "combined_ocr.pdf"), ocrErr
+	}
+	pipelineStagesImpl = mockStages
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+
+	// First run fails in OCR, leaving combined.pdf behind
+	if err := runCommand(context.Background(), cfg); err == nil {
+		t.Fatal("expected first run to fail in OCR")
+	}
+	// Move the artifact clearly past the run's start to avoid coarse mtime ties
+	pdfPath := filepath.Join(outputDir, "combined.pdf")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(pdfPath, future, future); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	// Second run reuses combined.pdf and only reruns OCR
+	ocrErr = nil
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("second runCommand() failed: %v", err)
+	}
+	if buildCalls != 1 || ocrCalls != 2 {
+		t.Errorf("expected PDF build to be skipped, got build=%d ocr=%d", buildCalls, ocrCalls)
+	}
+
+	// --force reruns every stage
+	cfg.Force = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("forced runCommand() failed: %v", err)
+	}
+	if buildCalls != 2 {
+		t.Errorf("expected --force to rebuild the PDF, got %d builds", buildCalls)
+	}
+}
+
+func TestResumeStages(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.png")
+	images := []string{filepath.Join(inputDir, "image1.png")}
+	cfg := newTestRunConfig(inputDir, outputDir)
+
+	base := time.Now().Add(time.Hour)
+	touch := func(name string, offset time.Duration) {
+		t.Helper()
+		path := filepath.Join(outputDir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", name, err)
+			}
+		}
+		mtime := base.Add(offset)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("failed to set mtime: %v", err)
+		}
+	}
+	resume := func() map[string]bool {
+		t.Helper()
+		skip, err := resumeStages(cfg, images)
+		if err != nil {
+			t.Fatalf("resumeStages() failed: %v", err)
+		}
+		return skip
+	}
+
+	// Nothing to resume from
+	if skip := resume(); len(skip) != 0 {
+		t.Errorf("expected no stages skipped, got %v", skip)
+	}
+
+	// OCR output newer than the PDF skips both; extraction is stale
+	touch("combined.pdf", 0)
+	touch("combined_ocr.pdf", time.Minute)
+	touch("extracted.txt", -time.Minute)
+	if skip := resume(); !skip["pdf"] || !skip["ocr"] || skip["extract"] {
+		t.Errorf("expected pdf and ocr skipped, got %v", skip)
+	}
+
+	// A cleaned-up PDF does not invalidate the OCR output after it
+	if err := os.Remove(filepath.Join(outputDir, "combined.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	touch("extracted.txt", 2*time.Minute)
+	if skip := resume(); !skip["pdf"] || !skip["ocr"] || !skip["extract"] {
+		t.Errorf("expected every stage skipped, got %v", skip)
+	}
+
+	// An input image newer than every artifact reruns everything
+	imageTime := base.Add(time.Hour)
+	if err := os.Chtimes(images[0], imageTime, imageTime); err != nil {
+		t.Fatal(err)
+	}
+	if skip := resume(); len(skip) != 0 {
+		t.Errorf("expected no stages skipped after input change, got %v", skip)
+	}
+
+	// So does a different OCR language, even with artifacts newer than the inputs
+	base = time.Now().Add(-time.Hour)
+	for _, path := range []string{images[0], filepath.Join(outputDir, ocrInputsFile)} {
+		if err := os.Chtimes(path, base, base); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch("combined_ocr.pdf", time.Minute)
+	touch("extracted.txt", 2*time.Minute)
+	if skip := resume(); !skip["extract"] {
+		t.Fatalf("expected extract skipped, got %v", skip)
+	}
+	cfg.Lang = "fra"
+	if skip := resume(); len(skip) != 0 {
+		t.Errorf("expected no stages skipped after language change, got %v", skip)
+	}
+}
+
+func TestResumeStages_OptionChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *runConfig)
+	}{
+		{"pdftotext mode", func(cfg *runConfig) { cfg.PDFToTextMode = "raw" }},
+		{"preprocess", func(cfg *runConfig) { cfg.Preprocess = "threshold" }},
+		{"max dimension", func(cfg *runConfig) { cfg.MaxDimension = 1000 }},
+		{"auto orient", func(cfg *runConfig) { cfg.AutoOrient = true }},
+		{"optimize pngs", func(cfg *runConfig) { cfg.OptimizePNGs = true }},
+		{"use sidecar", func(cfg *runConfig) { cfg.UseSidecar = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputDir, outputDir := setupTestDirs(t)
+			createMockImage(t, inputDir, "image1.png")
+			images := []string{filepath.Join(inputDir, "image1.png")}
+			cfg := newTestRunConfig(inputDir, outputDir)
+
+			// Record the inputs, then make every artifact newer than them
+			if _, err := resumeStages(cfg, images); err != nil {
+				t.Fatalf("resumeStages() failed: %v", err)
+			}
+			base := time.Now().Add(-time.Hour)
+			for _, path := range []string{images[0], filepath.Join(outputDir, ocrInputsFile)} {
+				if err := os.Chtimes(path, base, base); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, name := range []string{"combined.pdf", "combined_ocr.pdf", "extracted.txt"} {
+				path := filepath.Join(outputDir, name)
+				if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				mtime := base.Add(time.Duration(i+1) * time.Minute)
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			skip, err := resumeStages(cfg, images)
+			if err != nil {
+				t.Fatalf("resumeStages() failed: %v", err)
+			}
+			if !skip["pdf"] || !skip["ocr"] || !skip["extract"] {
+				t.Fatalf("expected every stage skipped before the change, got %v", skip)
+			}
+
+			tt.change(&cfg)
+			skip, err = resumeStages(cfg, images)
+			if err != nil {
+				t.Fatalf("resumeStages() failed: %v", err)
+			}
+			if len(skip) != 0 {
+				t.Errorf("expected no stages skipped after the change, got %v", skip)
+			}
+		})
+	}
+}
+
+func TestRunCommand_OCRCacheSkipsOCR(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	cacheDir := filepath.Join(t.TempDir(), "ocr-cache")
+	createMockImage(t, inputDir, "image1.png")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	buildCalls, ocrCalls, extractCalls := 0, 0, 0
+	mockStages := &mockPipelineStages{}
+	mockStages.buildPDFFunc = func(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+		buildCalls++
+		return filepath.Join(outputDir, "combined.pdf"), nil
+	}
+	mockStages.ocrPDFFunc = func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+		ocrCalls++
+		return filepath.Join(outputDir, "combined_ocr.pdf"), nil
+	}
+	mockStages.extractTextFunc = func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+		extractCalls++
+		textPath := filepath.Join(outputDir, "extracted.txt")
+		content := "This page was recognized by OCR and is long enough to become a chunk of text.\f"
+		if err := os.WriteFile(textPath, []byte(content), 0644); err != nil {
+			return "", err
+		}
+		return textPath, nil
+	}
+	pipelineStagesImpl = mockStages
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.CacheDir = cacheDir
+
+	// First run populates the cache
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("first runCommand() failed: %v", err)
+	}
+	if ocrCalls != 1 {
+		t.Fatalf("expected 1 OCR call after cold run, got %d", ocrCalls)
+	}
+	firstResult, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+
+	// Second run with a warm cache skips every OCR stage
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("second runCommand() failed: %v", err)
+	}
+	if buildCalls != 1 || ocrCalls != 1 || extractCalls != 1 {
+		t.Errorf("expected stages to run once total, got build=%d ocr=%d extract=%d", buildCalls, ocrCalls, extractCalls)
+	}
+	secondResult, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+	if string(firstResult) != string(secondResult) {
+		t.Errorf("cached run produced different output:\nfirst: %q\nsecond: %q", firstResult, secondResult)
+	}
+
+	// A different language is a cache miss
+	cfg.Lang = "fra"
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("third runCommand() failed: %v", err)
+	}
+	if ocrCalls != 2 {
+		t.Errorf("expected OCR to run for a new language, got %d calls", ocrCalls)
+	}
+}
+
+func TestRunCommand_CustomChunksJSONLPath(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	customPath := filepath.Join(outputDir, "debug", "nested", "my_chunks.jsonl")
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.EmitChunksJSONL = true
+	cfg.ChunksJSONLPath = customPath
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(customPath)
+	if err != nil {
+		t.Fatalf("expected chunks JSONL at custom path: %v", err)
+	}
+	if !strings.Contains(string(content), `"id":"c0001"`) {
+		t.Errorf("expected chunk c0001 in custom JSONL, got: %s", content)
+	}
+
+	// Default location must not be written when overridden
+	if _, err := os.Stat(filepath.Join(outputDir, "chunks_raw.jsonl")); !os.IsNotExist(err) {
+		t.Error("chunks_raw.jsonl should not be written when --chunks-jsonl-path is set")
+	}
+}
+
+func TestRunCommand_DefaultChunksJSONLPath(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.EmitChunksJSONL = true
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "chunks_raw.jsonl")); err != nil {
+		t.Errorf("expected chunks_raw.jsonl in output directory: %v", err)
+	}
+}
+
+func TestRunCommand_PartialOnTimeout(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		buildPDFFunc: func(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+			pdfPath := filepath.Join(outputDir, "combined.pdf")
+			return pdfPath, os.WriteFile(pdfPath, []byte("%PDF-1.4"), 0644)
+		},
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			return "", fmt.Errorf("ocrmypdf failed: %w", &runner.TimeoutError{Timeout: timeout, Cause: fmt.Errorf("signal: killed")})
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.KeepArtifacts = false
+	cfg.PartialOnTimeout = true
+
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "OCR failed") {
+		t.Fatalf("expected OCR failure, got: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "combined.pdf")); err != nil {
+		t.Errorf("expected combined.pdf to remain after OCR timeout: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "run_summary.json"))
+	if err != nil {
+		t.Fatalf("expected run_summary.json: %v", err)
+	}
+	var summary report.RunSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("invalid run summary: %v", err)
+	}
+	if summary.Status != "partial" || summary.FailedStage != "ocr" {
+		t.Errorf("expected partial run failing in ocr, got %+v", summary)
+	}
+	if !reflect.DeepEqual(summary.CompletedStages, []string{"stage", "pdf"}) {
+		t.Errorf("expected completed stages [stage pdf], got %v", summary.CompletedStages)
+	}
+	if !reflect.DeepEqual(summary.Artifacts, []string{"combined.pdf"}) {
+		t.Errorf("expected artifacts [combined.pdf], got %v", summary.Artifacts)
+	}
+}
+
+func TestRunCommand_TimeoutWithoutPartialMode(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			return "", &runner.TimeoutError{Timeout: timeout, Cause: fmt.Errorf("signal: killed")}
+		},
+	}
+
+	if err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir)); err == nil {
+		t.Fatal("expected OCR failure")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "run_summary.json")); !os.IsNotExist(err) {
+		t.Error("run_summary.json should only be written with --partial-on-timeout")
+	}
+}
+
+func TestRunCommand_DedupStateAcrossRuns(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.DedupStatePath = filepath.Join(t.TempDir(), "state.json")
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	if _, err := os.Stat(cfg.DedupStatePath); err != nil {
+		t.Fatalf("expected dedup state to be saved: %v", err)
+	}
+
+	// The second run extracts the same text, so its only chunk was seen before
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if rep.KeptChunks != 0 || rep.CrossRunDups != 1 {
+		t.Errorf("expected the chunk dropped as a cross-run duplicate, got kept=%d cross_run=%d", rep.KeptChunks, rep.CrossRunDups)
+	}
+	if len(rep.Dropped) != 1 || rep.Dropped[0].Reason != "cross_run_duplicate" {
+		t.Errorf("expected one cross_run_duplicate entry, got %+v", rep.Dropped)
+	}
+}
+
+func TestRunCommand_InputTextGlob(t *testing.T) {
+	textDir := t.TempDir()
+	outputDir := t.TempDir()
+	shared := "This paragraph appears in both documents and should be deduplicated away."
+	files := map[string]string{
+		"doc1.txt": "First document opening paragraph with plenty of characters to keep.\n\n" + shared + "\n",
+		"doc2.txt": shared + "\n\nSecond document closing paragraph that is also long enough to keep.\n",
+		"notes.md": "This file does not match the glob and must not be read by the pipeline.",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(textDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		buildPDFFunc: func(string, string, time.Duration) (string, error) {
+			t.Error("BuildPDF should not run in --input-text-glob mode")
+			return "", fmt.Errorf("unexpected")
+		},
+	}
+
+	cfg := newTestRunConfig(filepath.Join(textDir, "missing-input-dir"), outputDir)
+	cfg.InputTextGlob = filepath.Join(textDir, "*.txt")
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+	result := string(content)
+	for _, want := range []string{"First document opening", "Second document closing", shared} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected result.md to contain %q", want)
+		}
+	}
+	if strings.Count(result, shared) != 1 {
+		t.Errorf("expected shared paragraph once after dedup, got %d", strings.Count(result, shared))
+	}
+	if strings.Contains(result, "does not match the glob") {
+		t.Error("non-matching file was included")
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+	if rep.InputImages != 2 || rep.InputChunks != 4 || rep.ExactDuplicates != 1 {
+		t.Errorf("expected 2 inputs, 4 chunks, 1 exact duplicate; got %d, %d, %d", rep.InputImages, rep.InputChunks, rep.ExactDuplicates)
+	}
+}
+
+func TestRunCommand_InputTextGlobNoMatches(t *testing.T) {
+	cfg := newTestRunConfig(t.TempDir(), t.TempDir())
+	cfg.InputTextGlob = filepath.Join(t.TempDir(), "*.txt")
+
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "no text files match") {
+		t.Errorf("expected no-match error, got: %v", err)
+	}
+}
+
+func TestRunCommand_ReportFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		wantJSON bool
+		wantCSV  bool
+	}{
+		{"json", true, false},
+		{"csv", false, true},
+		{"both", true, true},
+		{"json,html", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			inputDir, outputDir := setupTestDirs(t)
+			createMockImage(t, inputDir, "image1.jpg")
+
+			originalImpl := pipelineStagesImpl
+			defer func() { pipelineStagesImpl = originalImpl }()
+			pipelineStagesImpl = &mockPipelineStages{}
+
+			cfg := newTestRunConfig(inputDir, outputDir)
+			cfg.ReportFormat = tt.format
+			if err := runCommand(context.Background(), cfg); err != nil {
+				t.Fatalf("runCommand() failed: %v", err)
+			}
+
+			for name, want := range map[string]bool{
+				"dedupe_report.html": strings.Contains(tt.format, "html"),
+				"dedupe_report.json": tt.wantJSON,
+				"dedupe_report.csv":  tt.wantCSV,
+				"dedupe_summary.csv": tt.wantCSV,
+			} {
+				_, err := os.Stat(filepath.Join(outputDir, name))
+				if got := err == nil; got != want {
+					t.Errorf("%s exists = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCommand_OutputFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"md", []string{"result.md"}},
+		{"json", []string{"result.json"}},
+		{"txt", []string{"result.txt"}},
+		{"all", []string{"result.md", "result.json", "result.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			inputDir, outputDir := setupTestDirs(t)
+			createMockImage(t, inputDir, "image1.jpg")
+
+			originalImpl := pipelineStagesImpl
+			defer func() { pipelineStagesImpl = originalImpl }()
+			pipelineStagesImpl = &mockPipelineStages{}
+
+			cfg := newTestRunConfig(inputDir, outputDir)
+			cfg.OutputFormat = tt.format
+			if err := runCommand(context.Background(), cfg); err != nil {
+				t.Fatalf("runCommand() failed: %v", err)
+			}
+
+			for _, name := range []string{"result.md", "result.json", "result.txt"} {
+				_, err := os.Stat(filepath.Join(outputDir, name))
+				want := false
+				for _, w := range tt.want {
+					want = want || w == name
+				}
+				if got := err == nil; got != want {
+					t.Errorf("%s exists = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCommand_InvalidOutputFormat(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.OutputFormat = "pdf"
+
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "invalid --output-format") {
+		t.Errorf("expected invalid output format error, got: %v", err)
+	}
+}
+
+func TestRunCommand_InvalidNormalizeSteps(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.NormalizeSteps = "lowercase,digits"
+	if err := runCommand(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "invalid --normalize-steps") {
+		t.Errorf("expected invalid normalize steps error, got: %v", err)
+	}
+
+	cfg.NormalizeSteps = "unicode,lowercase"
+	cfg.FoldAccents = true
+	if err := runCommand(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "--fold-accents") {
+		t.Errorf("expected --fold-accents conflict error, got: %v", err)
+	}
+}
+
+func TestRunCommand_FoldAccentsPerRun(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := "El n\u00famero de p\u00e1gina aparece al pie de cada hoja escaneada del cuaderno.\n\n" +
+				"El numero de pagina aparece al pie de cada hoja escaneada del cuaderno.\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	exactDups := func(foldAccents bool) int {
+		cfg := newTestRunConfig(inputDir, outputDir)
+		cfg.DedupeMethod = "exact"
+		cfg.FoldAccents = foldAccents
+		cfg.Force = true
+		if err := runCommand(context.Background(), cfg); err != nil {
+			t.Fatalf("runCommand failed: %v", err)
+		}
+		rep, err := report.ReadReport(filepath.Join(outputDir, "dedupe_report.json"))
+		if err != nil {
+			t.Fatalf("failed to read report: %v", err)
+		}
+		return rep.ExactDuplicates
+	}
+
+	if got := exactDups(true); got != 1 {
+		t.Errorf("expected --fold-accents to match the accented copy, got %d exact duplicates", got)
+	}
+	// A later run without the flag is not affected by the earlier one
+	if got := exactDups(false); got != 0 {
+		t.Errorf("expected accents to be kept without --fold-accents, got %d exact duplicates", got)
+	}
+}
+
+func TestRunCommand_InvalidPreprocess(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.Preprocess = "sepia"
+
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "invalid --preprocess") {
+		t.Errorf("expected invalid preprocess error, got: %v", err)
+	}
+}
+
+func TestRunCommand_InvalidPDFToTextMode(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.PDFToTextMode = "xml"
+
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "invalid --pdftotext-mode") {
+		t.Errorf("expected invalid pdftotext mode error, got: %v", err)
+	}
+}
+
+func TestRunCommand_InvalidReportFormat(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.ReportFormat = "xml"
+
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "invalid --report-format") {
+		t.Errorf("expected invalid report format error, got: %v", err)
+	}
+}
+
+func TestRunCommand_RecordVersions(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	originalRunner := versionRunner
+	defer func() {
+		pipelineStagesImpl = originalImpl
+		versionRunner = originalRunner
+	}()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	outputs := map[string]string{
+		"python3":   "Python 3.11.2",
+		"ocrmypdf":  "ocrmypdf version 16.0.4",
+		"tesseract": "tesseract Version 5.3.0",
+		"pdftotext": "pdftotext version 22.12.0",
+	}
+	versionRunner = &mockRunner{
+		lookPathFunc: func(bin string) (string, error) { return "/usr/bin/" + bin, nil },
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin == "pdftotext" {
+				return runner.Result{Stderr: outputs[bin]}, nil
+			}
+			return runner.Result{Stdout: outputs[bin]}, nil
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.RecordVersions = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	want := map[string]string{
+		"python3":   "Python 3.11.2",
+		"ocrmypdf":  "16.0.4",
+		"tesseract": "5.3.0",
+		"pdftotext": "22.12.0",
+	}
+	if !reflect.DeepEqual(rep.ToolVersions, want) {
+		t.Errorf("tool_versions = %v, want %v", rep.ToolVersions, want)
+	}
+}
+
+func TestRunCommand_ExactFirstPreview(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	original := "The quarterly report shows revenue growth across all regions this year."
+	nearCopy := "The quarterly report shows revenue growth across all regions this year too."
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			// An exact repeat, then a near copy that only SimHash can drop
+			content := original + "\n\n" + original + "\n\n" + nearCopy + "\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.ExactFirstPreview = true
+	cfg.SimHashThreshold = 20
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	preview, err := os.ReadFile(filepath.Join(outputDir, "result_exact.md"))
+	if err != nil {
+		t.Fatalf("expected result_exact.md: %v", err)
+	}
+	final, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("expected result.md: %v", err)
+	}
+
+	// Preview drops only the exact repeat; the final output also drops the near copy
+	if got := strings.Count(string(preview), "quarterly report"); got != 2 {
+		t.Errorf("expected 2 paragraphs in exact preview, got %d", got)
+	}
+	if got := strings.Count(string(final), "quarterly report"); got != 1 {
+		t.Errorf("expected 1 paragraph in final result, got %d", got)
+	}
+}
+
+func TestRunCommand_EmitAlignmentTSV(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+	createMockImage(t, inputDir, "image2.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			// Two pages separated by a form feed, as pdftotext emits
+			content := "First page paragraph with enough characters to survive chunking filters.\n\f" +
+				"Second page paragraph that is long enough to be kept as its own chunk.\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.EmitAlignmentTSV = true
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "alignment.tsv"))
+	if err != nil {
+		t.Fatalf("expected alignment.tsv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if lines[0] != "page\tchunk_id\tchar_count" {
+		t.Errorf("unexpected header: %q", lines[0])
+	}
+	want := []string{"1\tc0001\t72", "2\tc0002\t70"}
+	if !reflect.DeepEqual(lines[1:], want) {
+		t.Errorf("expected rows %q, got %q", want, lines[1:])
+	}
+}
+
+func TestRunCommand_EmitKeptJSONL(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := "A paragraph repeated on every page of the scanned notebook.\n\n" +
+				"A paragraph that appears only once in the scanned notebook.\n\n" +
+				"A paragraph repeated on every page of the scanned notebook.\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinChunkChars = 10
+	cfg.EmitKeptJSONL = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "kept_chunks.jsonl"))
+	if err != nil {
+		t.Fatalf("expected kept_chunks.jsonl: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 kept chunks, got:\n%s", content)
+	}
+	if !strings.Contains(lines[0], `"id":"c0001"`) || !strings.Contains(lines[0], `"dropped_refs":["c0003"]`) {
+		t.Errorf("expected c0001 to list c0003 as dropped into it, got %s", lines[0])
+	}
+	if strings.Contains(lines[1], "dropped_refs") {
+		t.Errorf("expected no dropped_refs for a unique chunk, got %s", lines[1])
+	}
+}
+
+func TestRunCommand_DebugFiltered(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := "A paragraph repeated on every page of the scanned notebook.\n\n" +
+				"Tiny\n\n" +
+				"Battery 85%\n\n" +
+				"A paragraph repeated on every page of the scanned notebook.\n\n" +
+				"A paragraph repeated on every page of the scanned notebooks.\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinChunkChars = 10
+	cfg.ChromePatterns = text.DefaultChromePatterns()
+	cfg.DebugFiltered = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, "filtered_out.jsonl"))
+	if err != nil {
+		t.Fatalf("expected filtered_out.jsonl: %v", err)
+	}
+	var stages []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var f text.FilteredChunk
+		if err := json.Unmarshal([]byte(line), &f); err != nil {
+			t.Fatalf("invalid filtered_out.jsonl line %q: %v", line, err)
+		}
+		stages = append(stages, f.Stage)
+		switch f.Stage {
+		case text.StageMinChars:
+			if f.Text != "Tiny" {
+				t.Errorf("expected the short paragraph under min_chars, got %+v", f)
+			}
+		case text.StageChrome:
+			if f.Text != "Battery 85%" || !strings.Contains(f.Reason, "battery") || f.Match != "battery" {
+				t.Errorf("expected the battery line under chrome with its pattern and match, got %+v", f)
+			}
+		case text.StageExact, text.StageNear:
+			if !strings.Contains(f.Reason, "of c0001") {
+				t.Errorf("expected the duplicate to name c0001, got %+v", f)
+			}
+		}
+	}
+	want := []string{text.StageMinChars, text.StageChrome, text.StageExact, text.StageNear}
+	if !reflect.DeepEqual(stages, want) {
+		t.Errorf("expected stages %v, got %v:\n%s", want, stages, content)
+	}
+}
+
+func TestRunCommand_ParallelStagesPreservesPageOrder(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	const pages = 8
+	for i := 1; i <= pages; i++ {
+		createMockImage(t, inputDir, fmt.Sprintf("page%02d.png", i))
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	// Earlier pages take longer to OCR, so pages finish in roughly reverse order
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outDir, lang string, timeout time.Duration) (string, error) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			page, _ := strconv.Atoi(filepath.Base(outDir))
+			time.Sleep(time.Duration(pages-page) * 5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return filepath.Join(outDir, "combined_ocr.pdf"), nil
+		},
+		extractTextFunc: func(pdfPath, outDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outDir, "extracted.txt")
+			content := fmt.Sprintf("text of page %s\f", filepath.Base(outDir))
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.ParallelStages = 4
+	cfg.AllowEmpty = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "extracted.txt"))
+	if err != nil {
+		t.Fatalf("failed to read extracted.txt: %v", err)
+	}
+	got := strings.Split(string(data), "\f")
+	if len(got) != pages {
+		t.Fatalf("expected %d pages, got %d: %q", pages, len(got), data)
+	}
+	for i, text := range got {
+		if want := fmt.Sprintf("text of page %04d", i+1); text != want {
+			t.Errorf("page %d: expected %q, got %q", i+1, want, text)
+		}
+	}
+	if maxRunning < 2 {
+		t.Errorf("expected pages to be OCRed concurrently, at most %d ran at once", maxRunning)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "pages", "0001", "preprocessed", "0001.png")); err != nil {
+		t.Errorf("expected page staged in its own directory: %v", err)
+	}
+	manifest, err := ingest.ReadManifest(filepath.Join(outputDir, ingest.ManifestFile))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	if len(manifest) != pages || manifest[7].Staged != "pages/0008/preprocessed/0001.png" || filepath.Base(manifest[7].Original) != "page08.png" {
+		t.Errorf("expected manifest to map page directories to originals, got %+v", manifest)
+	}
+}
+
+func TestRunCommand_ParallelStagesCancelsOnError(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	const pages = 20
+	for i := 1; i <= pages; i++ {
+		createMockImage(t, inputDir, fmt.Sprintf("page%02d.png", i))
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	var mu sync.Mutex
+	ocrCalls := 0
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outDir, lang string, timeout time.Duration) (string, error) {
+			mu.Lock()
+			ocrCalls++
+			mu.Unlock()
+			if filepath.Base(outDir) == "0002" {
+				return "", errors.New("ocrmypdf crashed")
+			}
+			time.Sleep(10 * time.Millisecond)
+			return filepath.Join(outDir, "combined_ocr.pdf"), nil
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.ParallelStages = 2
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "OCR failed for page 2") {
+		t.Fatalf("expected OCR failure for page 2, got %v", err)
+	}
+	var se *stageError
+	if !errors.As(err, &se) || se.stage != "ocr" {
+		t.Errorf("expected ocr stageError, got %#v", err)
+	}
+	if ocrCalls >= pages {
+		t.Errorf("expected remaining pages to be cancelled, OCR ran %d times", ocrCalls)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "result.md")); !os.IsNotExist(err) {
+		t.Errorf("expected no result.md after a failed run, stat error: %v", err)
+	}
+}
+
+func TestRunCommand_ParallelStagesStopsWhenCancelled(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	for i := 1; i <= 10; i++ {
+		createMockImage(t, inputDir, fmt.Sprintf("page%02d.png", i))
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	// The caller cancels (as on SIGINT) while the first page is being OCRed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outDir, lang string, timeout time.Duration) (string, error) {
+			cancel()
+			return filepath.Join(outDir, "combined_ocr.pdf"), nil
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.ParallelStages = 2
+	if err := runCommand(ctx, cfg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "extracted.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no extracted.txt after cancellation, stat error: %v", err)
+	}
+}
+
+func TestParseRunConfig_ParallelStages(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--parallel-stages", "3"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if cfg.ParallelStages != 3 {
+		t.Errorf("expected ParallelStages 3, got %d", cfg.ParallelStages)
+	}
+	for _, args := range [][]string{
+		{"--parallel-stages", "-1"},
+		{"--parallel-stages", "2", "--cache-dir", t.TempDir()},
+		{"--parallel-stages", "2", "--partial-on-timeout"},
+	} {
+		if _, err := parseRunConfig(args); err == nil {
+			t.Errorf("parseRunConfig(%v) expected error", args)
+		}
+	}
+}
+
+func TestRunCommand_TotalTimeoutAbortsLaterStage(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	// PDF synthesis uses up the whole budget; OCR's own 10m timeout must not matter
+	ocrCalled := false
+	pipelineStagesImpl = &mockPipelineStages{
+		buildPDFFunc: func(preprocessedDir, outDir string, timeout time.Duration) (string, error) {
+			time.Sleep(100 * time.Millisecond)
+			return filepath.Join(outDir, "combined.pdf"), nil
+		},
+		ocrPDFFunc: func(pdfPath, outDir, lang string, timeout time.Duration) (string, error) {
+			ocrCalled = true
+			return filepath.Join(outDir, "combined_ocr.pdf"), nil
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.TotalTimeout = 50 * time.Millisecond
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "total timeout 50ms exceeded") {
+		t.Fatalf("expected total timeout error, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	var se *stageError
+	if !errors.As(err, &se) || se.stage != "ocr" {
+		t.Errorf("expected ocr stageError, got %#v", err)
+	}
+	if ocrCalled {
+		t.Error("expected OCR not to start after the total timeout")
+	}
+}
+
+func TestRunCommand_StageTimeoutCappedByTotal(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	var ocrTimeout, extractTimeout time.Duration
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outDir, lang string, timeout time.Duration) (string, error) {
+			ocrTimeout = timeout
+			return filepath.Join(outDir, "combined_ocr.pdf"), nil
+		},
+		extractTextFunc: func(pdfPath, outDir string, timeout time.Duration) (string, error) {
+			extractTimeout = timeout
+			textPath := filepath.Join(outDir, "extracted.txt")
+			return textPath, os.WriteFile(textPath, []byte("Enough extracted text to pass the minimum length check."), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.TotalTimeout = 2 * time.Minute
+	cfg.OCRTimeout = 10 * time.Minute
+	cfg.ExtractTimeout = 30 * time.Second
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	if ocrTimeout <= time.Minute || ocrTimeout > 2*time.Minute {
+		t.Errorf("expected OCR timeout capped to the remaining 2m budget, got %v", ocrTimeout)
+	}
+	if extractTimeout != 30*time.Second {
+		t.Errorf("expected extract timeout 30s within the budget, got %v", extractTimeout)
+	}
+}
+
+func TestRunCommand_StageErrorReportsTimeoutAndElapsed(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outDir, lang string, timeout time.Duration) (string, error) {
+			time.Sleep(20 * time.Millisecond)
+			return "", fmt.Errorf("ocrmypdf failed: %w", context.DeadlineExceeded)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.OCRTimeout = 20 * time.Millisecond
+	err := runCommand(context.Background(), cfg)
+	var se *stageError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected stageError, got %v", err)
+	}
+	if se.timeout != 20*time.Millisecond || se.elapsed < 20*time.Millisecond {
+		t.Errorf("expected timeout 20ms and elapsed >= 20ms, got %v and %v", se.timeout, se.elapsed)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "ocr stage failed after ") || !strings.Contains(msg, "(timeout 20ms): OCR failed") {
+		t.Errorf("unexpected error message: %s", msg)
+	}
+}
+
+func TestRunCommand_JSONEvents(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	var stdout strings.Builder
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.EventWriter = &stdout
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	done := make(map[string]event)
+	var sawRunDone bool
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var ev event
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("malformed event line %q: %v", line, err)
+		}
+		switch ev.Event {
+		case "stage_done":
+			if ev.MS == nil {
+				t.Errorf("stage_done for %s missing ms", ev.Stage)
+			}
+			done[ev.Stage] = ev
+		case "run_done":
+			sawRunDone = true
+		}
+	}
+
+	for _, stage := range []string{"stage", "pdf", "ocr", "extract", "chunk", "dedupe", "markdown"} {
+		if _, ok := done[stage]; !ok {
+			t.Errorf("expected stage_done event for %s, got: %s", stage, stdout.String())
+		}
+	}
+	if !sawRunDone {
+		t.Error("expected run_done event")
+	}
+	if got := done["dedupe"].Counts["kept"]; got != 1 {
+		t.Errorf("expected dedupe kept count 1, got %d", got)
+	}
+}
+
+func TestRunCommand_JSONEventsStageFailed(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			return "", fmt.Errorf("tesseract crashed")
+		},
+	}
+
+	var stdout strings.Builder
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.EventWriter = &stdout
+
+	if err := runCommand(context.Background(), cfg); err == nil {
+		t.Fatal("expected runCommand to fail")
+	}
+	if !strings.Contains(stdout.String(), `{"event":"stage_failed","stage":"ocr","error":"tesseract crashed"}`) {
+		t.Errorf("expected stage_failed event for ocr, got: %s", stdout.String())
+	}
+}
+
+func TestRunCommand_AllowEmpty(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "receipt.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			if err := os.WriteFile(textPath, []byte("TOTAL $5\n"), 0644); err != nil {
+				return "", err
+			}
+			return textPath, &pipeline.TextTooShortError{Chars: 8, MinChars: 20}
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinExtractedChars = 20
+	if err := runCommand(context.Background(), cfg); err == nil {
+		t.Fatal("expected short extracted text to fail without --allow-empty")
+	}
+
+	cfg.AllowEmpty = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("expected --allow-empty to continue, got: %v", err)
+	}
+
+	reportData, err := os.ReadFile(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("expected dedupe_report.json: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(reportData, &rep); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if len(rep.Warnings) != 1 || !strings.Contains(rep.Warnings[0], "8 chars, minimum 20") {
+		t.Errorf("expected a below-threshold warning in the report, got %q", rep.Warnings)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "result.md")); err != nil {
+		t.Errorf("expected result.md to be written: %v", err)
+	}
+}
+
+func TestRunCommand_UseSidecar(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "receipt.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	mockStages := &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			t.Error("expected OCR to run with the sidecar variant")
+			return "", nil
+		},
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			t.Error("expected the extract stage to be skipped")
+			return "", nil
+		},
+	}
+	pipelineStagesImpl = mockStages
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.UseSidecar = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand failed: %v", err)
+	}
+	result, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("expected result.md: %v", err)
+	}
+	if !strings.Contains(string(result), "sidecar text written by ocrmypdf") {
+		t.Errorf("expected the sidecar text in result.md, got:\n%s", result)
+	}
+
+	// The sidecar is held to the same minimum length as pdftotext output
+	var gotMinChars int
+	mockStages.sidecarFunc = func(pdfPath, outputDir, lang string, minChars int, timeout time.Duration) (string, string, error) {
+		gotMinChars = minChars
+		textPath := filepath.Join(outputDir, "extracted.txt")
+		if err := os.WriteFile(textPath, []byte("TOTAL $5\n"), 0644); err != nil {
+			return "", "", err
+		}
+		return filepath.Join(outputDir, "combined_ocr.pdf"), textPath, &pipeline.TextTooShortError{Chars: 8, MinChars: minChars}
+	}
+	cfg.MinExtractedChars = 20
+	cfg.Force = true
+	err = runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "text extraction failed") {
+		t.Errorf("expected short sidecar text to fail the run, got: %v", err)
+	}
+	if gotMinChars != 20 {
+		t.Errorf("expected --min-extracted-chars to be passed on, got %d", gotMinChars)
+	}
+	cfg.AllowEmpty = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Errorf("expected --allow-empty to accept short sidecar text, got: %v", err)
+	}
+}
+
+func TestParseRunConfig_UseSidecar(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--use-sidecar"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !cfg.UseSidecar {
+		t.Error("expected UseSidecar to be set")
+	}
+	for _, args := range [][]string{
+		{"--use-sidecar", "--parallel-stages", "2"},
+		{"--use-sidecar", "--pdftotext-mode", "bbox"},
+		{"--use-sidecar", "--pdftotext-mode", "HTMLMeta"},
+	} {
+		if _, err := parseRunConfig(args); err == nil {
+			t.Errorf("parseRunConfig(%v) expected error", args)
+		}
+	}
+}
+
+func TestParseRunConfig_ChunkHeadings(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--chunk-heading-level", "2", "--separator-rule", "--chunk-label", "Page {{.Page}}"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	opts := markdownOptions(cfg, 1)
+	if opts.ChunkHeadingLevel != 2 || !opts.SeparatorRule || opts.ChunkLabel == nil {
+		t.Errorf("expected heading level 2, separator rule and label, got %+v", opts)
+	}
+	chunks := []text.Chunk{{ID: "c0001", Text: "First", Page: 4}, {ID: "c0002", Text: "Second"}}
+	want := "# Title\n\n## Page 4\n\nFirst\n\n---\n\n## Chunk c0002\n\nSecond\n\n"
+	if got := text.RenderMarkdownWithOptions("Title", chunks, opts); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	for _, args := range [][]string{
+		{"--chunk-heading-level", "7"},
+		{"--chunk-heading-level", "-1"},
+		{"--chunk-label", "Page {{.Page}}"},
+		{"--chunk-heading-level", "2", "--chunk-label", "Page {{.Page"},
+	} {
+		if _, err := parseRunConfig(args); err == nil {
+			t.Errorf("parseRunConfig(%v) expected error", args)
+		}
+	}
+}
+
+func TestParseRunConfig_StripURLs(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--strip-urls", "--strip-urls-text"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !cfg.StripURLs || !cfg.StripURLsText {
+		t.Errorf("expected StripURLs and StripURLsText to be set, got %v and %v", cfg.StripURLs, cfg.StripURLsText)
+	}
+	if _, err := parseRunConfig([]string{"--strip-urls-text"}); err == nil {
+		t.Error("expected error for --strip-urls-text without --strip-urls")
+	}
+}
+
+func TestParseRunConfig_MaxBlankLines(t *testing.T) {
+	cfg, err := parseRunConfig(nil)
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if cfg.MaxBlankLines != 1 {
+		t.Errorf("expected chunks to split on single blank lines by default, got %d", cfg.MaxBlankLines)
+	}
+	if _, err := parseRunConfig([]string{"--max-blank-lines", "0"}); err == nil {
+		t.Error("expected error for --max-blank-lines 0")
+	}
+}
+
+func TestParseRunConfig_NoiseCharRatio(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--noise-char-ratio", "0.7"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if cfg.NoiseCharRatio != 0.7 {
+		t.Errorf("expected noise ratio 0.7, got %v", cfg.NoiseCharRatio)
+	}
+	for _, value := range []string{"-0.1", "1", "1.5"} {
+		if _, err := parseRunConfig([]string{"--noise-char-ratio", value}); err == nil {
+			t.Errorf("expected error for --noise-char-ratio %s", value)
+		}
+	}
+}
+
+func TestParseRunConfig_OCROutputOptions(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--ocr-policy", "Redo", "--pdfa-level", "2", "--optimize-level", "3", "--jbig2-lossy"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	want := pipeline.OCROptions{Policy: pipeline.OCRPolicyRedo, PDFALevel: "2", OptimizeLevel: "3", JBIG2Lossy: true}
+	if got := ocrOptions(cfg); got != want {
+		t.Errorf("expected OCR options %+v, got %+v", want, got)
+	}
+
+	cfg, err = parseRunConfig(nil)
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if got := ocrOptions(cfg); got != (pipeline.OCROptions{Policy: pipeline.OCRPolicySkip}) {
+		t.Errorf("expected only the skip policy by default, got %+v", got)
+	}
+
+	for _, args := range [][]string{
+		{"--ocr-policy", "force,skip"},
+		{"--ocr-policy", "ignore"},
+		{"--pdfa-level", "4"},
+		{"--optimize-level", "high"},
+		{"--optimize-level", "0", "--jbig2-lossy"},
+	} {
+		if _, err := parseRunConfig(args); err == nil {
+			t.Errorf("parseRunConfig(%v) expected error", args)
+		}
+	}
+}
+
+func TestRunCommand_InputPDF(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	scan := filepath.Join(inputDir, "scan.pdf")
+	if err := os.WriteFile(scan, []byte("%PDF-1.4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	var ocrInput string
+	var cleaned []string
+	pipelineStagesImpl = &mockPipelineStages{
+		buildPDFFunc: func(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+			t.Error("expected no PDF to be built from images")
+			return "", nil
+		},
+		mergePDFsFunc: func(pdfPaths []string, outputDir string, timeout time.Duration) (string, error) {
+			t.Error("expected a single PDF not to be merged")
+			return "", nil
+		},
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			ocrInput = pdfPath
+			return filepath.Join(outputDir, "combined_ocr.pdf"), nil
+		},
+		cleanupFunc: func(path string) error {
+			cleaned = append(cleaned, path)
+			return nil
+		},
+	}
+
+	cfg := newTestRunConfig(filepath.Join(inputDir, "no-images-here"), outputDir)
+	cfg.InputPDFs = []string{scan}
+	cfg.KeepArtifacts = false
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand failed: %v", err)
+	}
+	if ocrInput != scan {
+		t.Errorf("expected the input PDF to be OCRed directly, got %q", ocrInput)
+	}
+	if slices.Contains(cleaned, scan) {
+		t.Errorf("expected the input PDF not to be cleaned up, got %v", cleaned)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "result.md")); err != nil {
+		t.Errorf("expected result.md to be written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "preprocessed")); !os.IsNotExist(err) {
+		t.Error("expected no images to be staged")
+	}
+
+	cfg.InputPDFs = []string{filepath.Join(inputDir, "missing.pdf")}
+	if err := runCommand(context.Background(), cfg); err == nil {
+		t.Error("expected error for a missing input PDF")
+	}
+}
+
+func TestRunCommand_InputPDFsMerged(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	var pdfs []string
+	for _, name := range []string{"part2.pdf", "part1.PDF"} {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte("%PDF-1.4\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pdfs = append(pdfs, path)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	var merged []string
+	var ocrInput string
+	pipelineStagesImpl = &mockPipelineStages{
+		mergePDFsFunc: func(pdfPaths []string, outputDir string, timeout time.Duration) (string, error) {
+			merged = pdfPaths
+			return filepath.Join(outputDir, "combined.pdf"), nil
+		},
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			ocrInput = pdfPath
+			return filepath.Join(outputDir, "combined_ocr.pdf"), nil
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.InputPDFs = pdfs
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand failed: %v", err)
+	}
+	// Merged in the order given, not sorted
+	if !reflect.DeepEqual(merged, pdfs) {
+		t.Errorf("expected %v to be merged, got %v", pdfs, merged)
+	}
+	if ocrInput != filepath.Join(outputDir, "combined.pdf") {
+		t.Errorf("expected the merged PDF to be OCRed, got %q", ocrInput)
+	}
+}
+
+func TestParseRunConfig_InputPDF(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--input-pdf", "a.pdf", "--input-pdf", "b.pdf"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.InputPDFs, []string{"a.pdf", "b.pdf"}) {
+		t.Errorf("expected both input PDFs, got %v", cfg.InputPDFs)
+	}
+	for _, args := range [][]string{
+		{"--input-pdf", "a.pdf", "--parallel-stages", "2"},
+		{"--input-pdf", "a.pdf", "--input-text-glob", "*.txt"},
+		{"--input-pdf", "a.pdf", "--cache-dir", t.TempDir()},
+		{"--input-pdf", "a.pdf", "--lang-map", "1-2:eng"},
+	} {
+		if _, err := parseRunConfig(args); err == nil {
+			t.Errorf("parseRunConfig(%v) expected error", args)
+		}
+	}
+}
+
+// recordingProgress records progress calls as "start name total", "progress name done" and "done name".
+type recordingProgress struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *recordingProgress) record(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, fmt.Sprintf(format, args...))
+}
+
+func (p *recordingProgress) StageStart(name string, total int) {
+	p.record("start %s %d", name, total)
+}
+
+func (p *recordingProgress) StageProgress(name string, done int) {
+	p.record("progress %s %d", name, done)
+}
+
+func (p *recordingProgress) StageDone(name string) {
+	p.record("done %s", name)
+}
+
+func TestRunCommand_Progress(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+	createMockImage(t, inputDir, "image2.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	progress := &recordingProgress{}
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.Progress = progress
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	want := []string{
+		"start stage 2", "progress stage 1", "progress stage 2", "done stage",
+		"start pdf 0", "done pdf",
+		"start ocr 0", "done ocr",
+		"start extract 0", "done extract",
+		"start chunk 0", "done chunk",
+		"start dedupe 0", "done dedupe",
+		"start markdown 0", "done markdown",
+	}
+	if !reflect.DeepEqual(progress.calls, want) {
+		t.Errorf("unexpected progress calls:\n got %q\nwant %q", progress.calls, want)
+	}
+}
+
+func TestRunCommand_FilterStats(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := strings.Join([]string{
+				"tiny",                 // below min-chars
+				"Battery charging now", // chrome
+				"A paragraph long enough to be kept by every filter.",
+				"A paragraph long enough to be kept by every filter.", // exact duplicate
+				"Another distinct paragraph about something else entirely.",
+			}, "\n\n")
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinChunkChars = 10
+	cfg.ChromePatterns = text.DefaultChromePatterns()
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	reportData, err := os.ReadFile(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("expected dedupe_report.json: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(reportData, &rep); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	stats := rep.FilterStats
+	if stats == nil {
+		t.Fatal("expected filter_stats in report")
+	}
+
+	want := report.FilterStats{
+		RawChunks: 5, AfterMinChars: 4, AfterChrome: 3, AfterDedupe: 2,
+		RemovedMinChars: 1, RemovedChrome: 1, RemovedDedupe: 1,
+	}
+	if *stats != want {
+		t.Errorf("expected %+v, got %+v", want, *stats)
+	}
+	if stats.AfterMinChars > stats.RawChunks || stats.AfterChrome > stats.AfterMinChars || stats.AfterDedupe > stats.AfterChrome {
+		t.Errorf("expected each stage to keep at most the previous count, got %+v", *stats)
+	}
+	if stats.RawChunks-stats.RemovedMinChars-stats.RemovedChrome-stats.RemovedMinWords-stats.RemovedDedupe != stats.AfterDedupe {
+		t.Errorf("expected removals to account for every dropped chunk, got %+v", *stats)
+	}
+	if stats.AfterDedupe != rep.KeptChunks {
+		t.Errorf("expected after_dedupe %d to equal kept_chunks %d", stats.AfterDedupe, rep.KeptChunks)
+	}
+	if rep.CompressionRatio != 2.0/3 || rep.BytesKept == 0 || rep.BytesSaved <= 0 || rep.BytesInput != rep.BytesKept+rep.BytesSaved {
+		t.Errorf("expected 2 of 3 chunks and their bytes kept, got ratio %v, bytes %d in, %d kept, %d saved",
+			rep.CompressionRatio, rep.BytesInput, rep.BytesKept, rep.BytesSaved)
+	}
+}
+
+func TestRunCommand_MinWords(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := "A paragraph of real text that the scanner picked up from the page.\n\n" +
+				"lIl1lIIl|l1IlIl|IIl1lIl1|lIIl1lIlI|lIl1IIlI|l1lIIlIl|1lIlIIl|lIlI\n\n" +
+				"日本語の段落はスペースなしで書かれていますが本物の文章です。\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinChunkChars = 10
+	cfg.MinWords = 4
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	result, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("expected result.md: %v", err)
+	}
+	if strings.Contains(string(result), "lIl1") {
+		t.Errorf("expected the noise chunk to be dropped, got:\n%s", result)
+	}
+	if !strings.Contains(string(result), "real text") || !strings.Contains(string(result), "日本語") {
+		t.Errorf("expected the English and Japanese paragraphs to be kept, got:\n%s", result)
+	}
+
+	reportData, err := os.ReadFile(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("expected dedupe_report.json: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(reportData, &rep); err != nil {
+		t.Fatalf("failed to parse report: %v", err)
+	}
+	if rep.FilterStats == nil || rep.FilterStats.RemovedMinWords != 1 || rep.FilterStats.RemovedDedupe != 0 {
+		t.Errorf("expected one chunk removed by min-words and none by dedup, got %+v", rep.FilterStats)
+	}
+
+	if _, err := parseRunConfig([]string{"--min-words", "-1"}); err == nil {
+		t.Error("expected error for negative --min-words")
+	}
+}
+
+func TestRunCommand_AppendSummary(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+	createMockImage(t, inputDir, "image2.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := strings.Join([]string{
+				"A paragraph long enough to be kept by every filter.",
+				"A paragraph long enough to be kept by every filter.", // exact duplicate
+				"Another distinct paragraph about something else entirely.",
+			}, "\n\n")
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinChunkChars = 10
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+	if strings.Contains(string(data), "Processing Summary") {
+		t.Errorf("expected no summary without --append-summary, got:\n%s", data)
+	}
+
+	cfg.AppendSummary = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	data, err = os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+	result := string(data)
+	summaryAt := strings.Index(result, "## Processing Summary")
+	if summaryAt < 0 || summaryAt < strings.LastIndex(result, "Another distinct paragraph") {
+		t.Fatalf("expected summary after the chunks, got:\n%s", result)
+	}
+	for _, want := range []string{
+		"| Images processed | 2 |",
+		"| Raw chunks | 3 |",
+		"| Chunks kept | 2 |",
+		"| Chunks dropped | 1 (1 exact, 0 near-duplicate, 0 cross-run) |",
+		"| OCR language | eng |",
+		"| Dedupe method | simhash |",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in summary, got:\n%s", want, result[summaryAt:])
+		}
+	}
+}
+
+func TestRunCommand_Append(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	paragraph := "A first batch paragraph long enough to be kept."
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			return textPath, os.WriteFile(textPath, []byte(paragraph), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.MinChunkChars = 10
+	cfg.Append = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	paragraph = "A second batch paragraph long enough to be kept."
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+	want := "# Title\n\nA first batch paragraph long enough to be kept.\n\nA second batch paragraph long enough to be kept.\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+}
+
+func TestRunCommand_SkipsInvalidImages(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "page1.png")
+	createMockImage(t, inputDir, "page2.png")
+	// Truncate page2 inside its header, as an interrupted copy would
+	truncated := filepath.Join(inputDir, "page2.png")
+	if err := os.Truncate(truncated, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.ReportFormat = "json"
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	staged, err := os.ReadDir(filepath.Join(outputDir, "preprocessed"))
+	if err != nil {
+		t.Fatalf("failed to read preprocessed directory: %v", err)
+	}
+	if len(staged) != 1 {
+		t.Errorf("expected only the valid image to be staged, got %d files", len(staged))
+	}
+	rep, err := report.ReadReport(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.InputImages != 1 {
+		t.Errorf("expected 1 input image in the report, got %d", rep.InputImages)
+	}
+	if len(rep.SkippedImages) != 1 || rep.SkippedImages[0].Path != truncated || rep.SkippedImages[0].Reason == "" {
+		t.Errorf("expected %s recorded as skipped with a reason, got %+v", truncated, rep.SkippedImages)
+	}
+}
+
+func TestRunCommand_StrictFailsOnInvalidImage(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "page1.png")
+	if err := os.WriteFile(filepath.Join(inputDir, "page2.png"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.Strict = true
+	err := runCommand(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "invalid image") || !strings.Contains(err.Error(), "page2.png") {
+		t.Fatalf("expected invalid image error for page2.png, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "preprocessed")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing staged under --strict, stat error: %v", err)
+	}
+}
+
+func TestRunCommand_OptimizePNGsKeepsUndecodableFiles(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	// The mock image has a valid header, so it passes validation, but corrupt pixel data
+	createMockImage(t, inputDir, "broken.png")
+	original, err := os.ReadFile(filepath.Join(inputDir, "broken.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.OptimizePNGs = true
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("expected a PNG that fails to optimize to be staged as-is, got: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "preprocessed", "0001.png"))
+	if err != nil || !bytes.Equal(data, original) {
+		t.Errorf("expected staged file to be unchanged, got %q (err %v)", data, err)
+	}
+}
+
+// newJSONTestLogger returns a JSON logger writing to the returned buffer.
+func newJSONTestLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := newLogger("json", &buf)
+	if err != nil {
+		t.Fatalf("newLogger() failed: %v", err)
+	}
+	return logger, &buf
+}
+
+// captureStdLog redirects the standard logger to a buffer until the test ends.
+func captureStdLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+// parseJSONLogLines decodes each line of buf, failing the test on invalid JSON.
+func parseJSONLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for i, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %d is not valid JSON: %v\n%s", i+1, err, line)
+		}
+		for _, key := range []string{"time", "level", "msg"} {
+			if _, ok := record[key]; !ok {
+				t.Errorf("log line %d has no %q field: %s", i+1, key, line)
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRunCommand_JSONLogs(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	stdLog := captureStdLog(t)
+	cfg := newTestRunConfig(inputDir, outputDir)
+	var buf *bytes.Buffer
+	cfg.logger, buf = newJSONTestLogger(t)
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	if stdLog.Len() != 0 {
+		t.Errorf("expected every line through the run's JSON logger, got standard log lines:\n%s", stdLog)
+	}
+
+	records := parseJSONLogLines(t, buf)
+	timed := map[string]bool{}
+	for _, record := range records {
+		stage, ok := record["stage"].(string)
+		if !ok {
+			continue
+		}
+		if _, ok := record["duration_ms"].(float64); !ok {
+			t.Errorf("expected numeric duration_ms for stage %s, got %v", stage, record["duration_ms"])
+		}
+		timed[stage] = true
+	}
+	for _, stage := range []string{"pdf", "ocr", "extract", "chunk", "dedupe", "markdown"} {
+		if !timed[stage] {
+			t.Errorf("expected a timed log record for stage %s", stage)
+		}
+	}
+}
+
+func TestLogWarn_JSONLevel(t *testing.T) {
+	logger, buf := newJSONTestLogger(t)
+	logWarn(logger, "failed to write %s", "report.json")
+
+	records := parseJSONLogLines(t, buf)
+	if len(records) != 1 || records[0]["level"] != "WARN" || records[0]["msg"] != "failed to write report.json" {
+		t.Errorf("unexpected warning record: %v", records)
+	}
+}
+
+func TestNewLogger_Text(t *testing.T) {
+	buf := captureStdLog(t)
+	logger, err := newLogger("text", io.Discard)
+	if err != nil || logger != nil {
+		t.Fatalf("expected no logger for text logs, got %v (err %v)", logger, err)
+	}
+
+	logWarn(logger, "disk %s", "full")
+	logStageDone(logger, "ocr", time.Now(), "OCR completed: out.pdf", "path", "out.pdf")
+	out := buf.String()
+	if !strings.Contains(out, "warning: disk full") || !strings.Contains(out, "OCR completed: out.pdf (took ") {
+		t.Errorf("unexpected text log output: %q", out)
+	}
+
+	if _, err := newLogger("xml", io.Discard); err == nil {
+		t.Error("expected error for unknown log format")
+	}
+}
+
+func TestRunCommand_Since(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "old.jpg")
+	createMockImage(t, inputDir, "new.jpg")
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(inputDir, "old.jpg"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg, err := parseRunConfig([]string{"--input", inputDir, "--out", outputDir, "--since", "1h"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	staged, err := filepath.Glob(filepath.Join(outputDir, "preprocessed", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 1 {
+		t.Errorf("expected only the recently modified image to be staged, got %v", staged)
+	}
+}
+
+func TestRunCommand_RecordsSourceFiles(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	if err := os.Mkdir(filepath.Join(inputDir, "2023"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createMockImage(t, inputDir, "invoice_acme_2023.jpg")
+	createMockImage(t, filepath.Join(inputDir, "2023"), "receipt_10.png")
+	createMockImage(t, filepath.Join(inputDir, "2023"), "receipt_9.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outDir, "extracted.txt")
+			var pages []string
+			for _, name := range []string{"acme invoice", "receipt nine", "receipt ten"} {
+				pages = append(pages, "This page holds the "+name+" with enough text to form a chunk.")
+			}
+			return textPath, os.WriteFile(textPath, []byte(strings.Join(pages, "\f")), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.Recursive = true
+	cfg.OutputFormat = "json"
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	manifest, err := ingest.ReadManifest(filepath.Join(outputDir, ingest.ManifestFile))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	wantManifest := []ingest.ManifestEntry{
+		{Page: 1, Staged: "preprocessed/0001.jpg", Original: filepath.Join(inputDir, "invoice_acme_2023.jpg")},
+		{Page: 2, Staged: "preprocessed/0002.jpg", Original: filepath.Join(inputDir, "2023", "receipt_9.jpg")},
+		{Page: 3, Staged: "preprocessed/0003.png", Original: filepath.Join(inputDir, "2023", "receipt_10.png")},
+	}
+	if !reflect.DeepEqual(manifest, wantManifest) {
+		t.Errorf("expected manifest %+v, got %+v", wantManifest, manifest)
+	}
+
+	wantSources := []string{"invoice_acme_2023.jpg", "2023/receipt_9.jpg", "2023/receipt_10.png"}
+	data, err := os.ReadFile(filepath.Join(outputDir, "result.json"))
+	if err != nil {
+		t.Fatalf("failed to read result.json: %v", err)
+	}
+	var chunks []text.Chunk
+	if err := json.Unmarshal(data, &chunks); err != nil {
+		t.Fatalf("failed to parse result.json: %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.SourceFile != wantSources[i] {
+			t.Errorf("chunk %s: expected source file %q, got %q", chunk.ID, wantSources[i], chunk.SourceFile)
+		}
+	}
+
+	rep, err := report.ReadReport(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	if !reflect.DeepEqual(rep.SourceFiles, wantSources) {
+		t.Errorf("expected report source files %q, got %q", wantSources, rep.SourceFiles)
+	}
+}
+
+func TestRunCommand_SortModeMTime(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"scan_3.jpg", "scan_1.jpg", "scan_2.jpg"} {
+		createMockImage(t, inputDir, name)
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filepath.Join(inputDir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg, err := parseRunConfig([]string{"--input", inputDir, "--out", outputDir, "--sort-mode", "mtime"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	manifest, err := ingest.ReadManifest(filepath.Join(outputDir, ingest.ManifestFile))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var order []string
+	for _, entry := range manifest {
+		order = append(order, filepath.Base(entry.Original))
+	}
+	if want := []string{"scan_3.jpg", "scan_1.jpg", "scan_2.jpg"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("expected pages in modification order %v, got %v", want, order)
+	}
+
+	cfg.SortMode = "size"
+	if err := runCommand(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "invalid --sort-mode") {
+		t.Errorf("expected invalid --sort-mode error, got %v", err)
+	}
+}
+
+func TestRunCommand_OrderFileAndReverse(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	for _, name := range []string{"scan_1.jpg", "scan_2.jpg", "cover.jpg"} {
+		createMockImage(t, inputDir, name)
+	}
+	orderPath := filepath.Join(t.TempDir(), "order.txt")
+	if err := os.WriteFile(orderPath, []byte("cover.jpg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	pageOrder := func(args ...string) []string {
+		t.Helper()
+		cfg, err := parseRunConfig(append([]string{"--input", inputDir, "--out", outputDir}, args...))
+		if err != nil {
+			t.Fatalf("parseRunConfig() failed: %v", err)
+		}
+		if err := runCommand(context.Background(), cfg); err != nil {
+			t.Fatalf("runCommand() failed: %v", err)
+		}
+		manifest, err := ingest.ReadManifest(filepath.Join(outputDir, ingest.ManifestFile))
+		if err != nil {
+			t.Fatalf("failed to read manifest: %v", err)
+		}
+		var order []string
+		for _, entry := range manifest {
+			order = append(order, filepath.Base(entry.Original))
+		}
+		return order
+	}
+	if got, want := pageOrder("--order-file", orderPath), []string{"cover.jpg", "scan_1.jpg", "scan_2.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("--order-file: expected %v, got %v", want, got)
+	}
+	if got, want := pageOrder("--reverse"), []string{"scan_2.jpg", "scan_1.jpg", "cover.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("--reverse: expected %v, got %v", want, got)
+	}
+
+	if err := os.WriteFile(orderPath, []byte("cover.jpg\nback.jpg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseRunConfig([]string{"--input", inputDir, "--out", outputDir, "--order-file", orderPath})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if err := runCommand(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "not found among the images: back.jpg") {
+		t.Errorf("expected error naming the missing image, got %v", err)
+	}
+	if _, err := parseRunConfig([]string{"--order-file", orderPath, "--sort-mode", "mtime"}); err == nil {
+		t.Error("expected error combining --order-file with --sort-mode")
+	}
+}
+
+func TestRunCommand_IncludeExclude(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "scan_1.jpg")
+	createMockImage(t, inputDir, "photo.jpg")
+	if err := os.Mkdir(filepath.Join(inputDir, "thumbnails"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	createMockImage(t, filepath.Join(inputDir, "thumbnails"), "scan_2.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg, err := parseRunConfig([]string{"--input", inputDir, "--out", outputDir, "--include", "scan_*", "--exclude", "thumbnails"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	staged, err := filepath.Glob(filepath.Join(outputDir, "preprocessed", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) != 1 {
+		t.Errorf("expected only scan_1.jpg to be staged, got %v", staged)
+	}
+}
+
+func TestRunCommand_InputLimits(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+	createMockImage(t, inputDir, "image2.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		buildPDFFunc: func(preprocessedDir, outDir string, timeout time.Duration) (string, error) {
+			t.Error("BuildPDF should not run when an input limit is exceeded")
+			return "", nil
+		},
+	}
+
+	for _, limit := range [][]string{{"--max-images", "1"}, {"--max-total-bytes", "10"}} {
+		cfg, err := parseRunConfig(append([]string{"--input", inputDir, "--out", outputDir}, limit...))
+		if err != nil {
+			t.Fatalf("parseRunConfig() failed: %v", err)
+		}
+		err = runCommand(context.Background(), cfg)
+		if err == nil || !strings.Contains(err.Error(), "input limit exceeded: found 2 images") {
+			t.Errorf("%v: expected input limit error, got %v", limit, err)
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, "preprocessed")); !os.IsNotExist(err) {
+			t.Errorf("%v: expected nothing to be staged", limit)
+		}
+	}
+
+	if _, err := parseRunConfig([]string{"--max-images", "-1"}); err == nil {
+		t.Error("expected error for negative --max-images")
+	}
+}
+
+func TestParseRunConfig_IncludeExclude(t *testing.T) {
+	path := writeConfigFile(t, `
+exclude:
+  - thumbnails
+  - "*_small.*"
+include: scan_*
+`)
+	cfg, err := parseRunConfig([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Exclude, []string{"thumbnails", "*_small.*"}) || !reflect.DeepEqual(cfg.Include, []string{"scan_*"}) {
+		t.Errorf("expected patterns from the config file, got include=%q exclude=%q", cfg.Include, cfg.Exclude)
+	}
+
+	cfg, err = parseRunConfig([]string{"--config", path, "--exclude", "drafts", "--exclude", "old"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Exclude, []string{"drafts", "old"}) {
+		t.Errorf("expected command-line excludes to replace the file's, got %q", cfg.Exclude)
+	}
+
+	if _, err := parseRunConfig([]string{"--include", "[scan"}); err == nil || !strings.Contains(err.Error(), "invalid --include") {
+		t.Errorf("expected invalid --include error, got %v", err)
+	}
+}
+
+func TestParseRunConfig_Since(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--since-time", "2024-03-01"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local); !cfg.SinceTime.Equal(want) {
+		t.Errorf("expected since-time %v, got %v", want, cfg.SinceTime)
+	}
+
+	cfg, err = parseRunConfig([]string{"--since-time", "2024-03-01T12:00:00Z"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if want := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC); !cfg.SinceTime.Equal(want) {
+		t.Errorf("expected since-time %v, got %v", want, cfg.SinceTime)
+	}
+
+	for _, args := range [][]string{
+		{"--since", "1h", "--since-time", "2024-03-01"},
+		{"--since", "-1h"},
+		{"--since-time", "yesterday"},
+	} {
+		if _, err := parseRunConfig(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestRunCommand_DryRun(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	// Stages that create no files, as in a real dry run
+	pipelineStagesImpl = &mockPipelineStages{
+		buildPDFFunc: func(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+			return filepath.Join(outputDir, "combined.pdf"), nil
+		},
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			return filepath.Join(outputDir, "combined_ocr.pdf"), nil
+		},
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			return filepath.Join(outputDir, "extracted.txt"), nil
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.DryRun = true
+
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	for _, name := range []string{"result.md", "dedupe_report.json"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be written in dry run", name)
+		}
+	}
+}
+
+func TestStagesWithExec(t *testing.T) {
+	var hookCalls int
+	execOpts := pipeline.ExecOptions{
+		DryRun:      true,
+		OnResult:    func(runner.Result, error) { hookCalls++ },
+		BinOverride: map[string]string{"ocrmypdf": "/opt/venv/bin/ocrmypdf"},
+		Env:         map[string]string{"PATH": "/opt/venv/bin:$PATH"},
+		Img2PDF:     pipeline.ParseImg2PDFCommand("/opt/venv/bin/python"),
+	}
+	real := &realPipelineStages{}
+	stages, ok := stagesWithExec(real, execOpts).(*realPipelineStages)
+	if !ok || stages == real {
+		t.Fatalf("expected new real stages, got %#v", stages)
+	}
+	// Funcs never compare equal, so the hook is checked by calling it
+	got, want := stages.exec, execOpts
+	got.OnResult, want.OnResult = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the run's exec options %+v, got %+v", want, got)
+	}
+	if stages.exec.OnResult == nil {
+		t.Error("expected the run's command hook")
+	} else if stages.exec.OnResult(runner.Result{}, nil); hookCalls != 1 {
+		t.Errorf("expected the run's command hook, got %d calls", hookCalls)
+	}
+	if !reflect.DeepEqual(*real, realPipelineStages{}) {
+		t.Errorf("expected shared stages to be left unchanged, got %+v", real.exec)
+	}
+
+	mock := &mockPipelineStages{}
+	if got := stagesWithExec(mock, execOpts); got != mock {
+		t.Errorf("expected mock stages to be used as they are, got %#v", got)
+	}
+}
+
+func TestParseRunConfig_FlagOverridesDefault(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--simhash-threshold", "3", "--global-dedup"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if cfg.SimHashThreshold != 3 {
+		t.Errorf("expected SimHashThreshold 3 from flag, got %d", cfg.SimHashThreshold)
+	}
+	if cfg.Window != dedupe.GlobalWindow {
+		t.Errorf("expected --global-dedup to resolve Window to %d, got %d", dedupe.GlobalWindow, cfg.Window)
+	}
+	if cfg.SimHashK != 5 || cfg.DedupeMethod != "simhash" || cfg.OCRTimeout != 10*time.Minute {
+		t.Errorf("expected unset flags to keep defaults, got k=%d method=%q ocr-timeout=%v",
+			cfg.SimHashK, cfg.DedupeMethod, cfg.OCRTimeout)
+	}
+	if cfg.TextSeparator != "\f" {
+		t.Errorf("expected default text separator to be unescaped to form feed, got %q", cfg.TextSeparator)
+	}
+	if cfg.StageRetries != 0 {
+		t.Errorf("expected staging copies not to be retried by default, got %d retries", cfg.StageRetries)
+	}
+}
+
+// writeConfigFile writes content to a config file in a temp directory and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pipeline.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestParseRunConfig_ConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+input: scans
+out: results
+lang: spa
+simhash-threshold: 4
+dedupe: both
+minhash-threshold: 0.8
+keep-artifacts: false
+ocr-timeout: 90s
+chrome-regex:
+  - "^menu$"
+  - "^share$"
+`)
+
+	cfg, err := parseRunConfig([]string{"--config", path, "--simhash-threshold", "2", "--out", "cli-out"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+
+	// Command-line flags override the file
+	if cfg.SimHashThreshold != 2 || cfg.OutputDir != "cli-out" {
+		t.Errorf("expected CLI values to win, got threshold=%d out=%q", cfg.SimHashThreshold, cfg.OutputDir)
+	}
+	// File values override defaults
+	if cfg.InputDir != "scans" || cfg.Lang != "spa" || cfg.DedupeMethod != "both" ||
+		cfg.MinHashThreshold != 0.8 || cfg.KeepArtifacts || cfg.OCRTimeout != 90*time.Second {
+		t.Errorf("expected file values to be applied, got %+v", cfg)
+	}
+	// Unset keys keep defaults
+	if cfg.SimHashK != 5 || cfg.PDFTimeout != 5*time.Minute {
+		t.Errorf("expected defaults for keys in neither, got k=%d pdf-timeout=%v", cfg.SimHashK, cfg.PDFTimeout)
+	}
+	want := append(text.DefaultChromePatterns(), "^menu$", "^share$")
+	if !reflect.DeepEqual(cfg.ChromePatterns, want) {
+		t.Errorf("expected chrome patterns %q, got %q", want, cfg.ChromePatterns)
+	}
+
+	// A chrome pattern on the command line replaces the file's list
+	cfg, err = parseRunConfig([]string{"--config", path, "--chrome-regex", "^footer$"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	want = append(text.DefaultChromePatterns(), "^footer$")
+	if !reflect.DeepEqual(cfg.ChromePatterns, want) {
+		t.Errorf("expected chrome patterns %q, got %q", want, cfg.ChromePatterns)
+	}
+}
+
+func TestParseRunConfig_ConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown keys", "lang: eng\nsimhash-treshold: 3\nfoo: bar\n", "unknown keys: foo, simhash-treshold"},
+		{"bad value", "simhash-threshold: many\n", `config key "simhash-threshold"`},
+		{"list for scalar", "lang: [eng, spa]\n", "expected a single value"},
+		{"nested config", "config: other.yaml\n", "unknown keys: config"},
+		{"invalid yaml", "lang: [eng\n", "failed to parse config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRunConfig([]string{"--config", writeConfigFile(t, tt.content)})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := parseRunConfig([]string{"--config", "pipeline.toml"}); err == nil || !strings.Contains(err.Error(), "TOML") {
+		t.Errorf("expected TOML to be rejected, got: %v", err)
+	}
+}
+
+func TestParseRunConfig_EmptyConfigFile(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--config", writeConfigFile(t, "# nothing set\n")})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if cfg.SimHashThreshold != 6 {
+		t.Errorf("expected defaults with an empty config file, got threshold %d", cfg.SimHashThreshold)
+	}
+}
+
+func TestParseRunConfig_InvalidTextSeparator(t *testing.T) {
+	if _, err := parseRunConfig([]string{"--text-separator", `\q`}); err == nil {
+		t.Error("expected error for invalid --text-separator")
+	}
+}
+
+func TestParseRunConfig_ChromeRegex(t *testing.T) {
+	cfg, err := parseRunConfig([]string{"--chrome-regex", "^menu$", "--chrome-regex", `^\d+ likes$`})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	want := append(text.DefaultChromePatterns(), "^menu$", `^\d+ likes$`)
+	if !reflect.DeepEqual(cfg.ChromePatterns, want) {
+		t.Errorf("expected chrome patterns %q, got %q", want, cfg.ChromePatterns)
+	}
+
+	// --no-default-chrome replaces the built-in patterns
+	cfg, err = parseRunConfig([]string{"--no-default-chrome", "--chrome-regex", "^menu$"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if want := []string{"^menu$"}; !reflect.DeepEqual(cfg.ChromePatterns, want) {
+		t.Errorf("expected chrome patterns %q, got %q", want, cfg.ChromePatterns)
+	}
+
+	// Invalid patterns fail at startup
+	_, err = parseRunConfig([]string{"--chrome-regex", "^menu$", "--chrome-regex", "(unclosed"})
+	if err == nil || !strings.Contains(err.Error(), "(unclosed") {
+		t.Errorf("expected error naming the invalid pattern, got %v", err)
+	}
+}
+
+func TestRunCommand_LangMap(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	for _, name := range []string{"image1.jpg", "image2.jpg", "image3.jpg"} {
+		createMockImage(t, inputDir, name)
+	}
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	var ocrLang string
+	pipelineStagesImpl = &mockPipelineStages{
+		ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+			ocrLang = lang
+			return "", fmt.Errorf("stop after OCR")
+		},
+	}
+
+	cfg, err := parseRunConfig([]string{"--input", inputDir, "--out", outputDir, "--lang", "spa", "--lang-map", "1-2:fra"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	runCommand(context.Background(), cfg)
+	// Page 3 is not mapped, so --lang is included
+	if ocrLang != "fra+spa" {
+		t.Errorf("expected OCR language fra+spa, got %q", ocrLang)
+	}
+
+	if _, err := parseRunConfig([]string{"--lang-map", "1-2"}); err == nil {
+		t.Error("expected error for invalid --lang-map")
+	}
+}
+
+func TestRunCommand_LangAuto(t *testing.T) {
+	tests := []struct {
+		detected  string
+		detectErr error
+		want      string
+	}{
+		{"eng+fra", nil, "eng+fra"},
+		{"", fmt.Errorf("pdftoppm failed"), "eng"},
+	}
+	originalRunner := versionRunner
+	defer func() { versionRunner = originalRunner }()
+	versionRunner = &mockRunner{}
+	for _, tt := range tests {
+		inputDir, outputDir := setupTestDirs(t)
+		createMockImage(t, inputDir, "image1.jpg")
+
+		originalImpl := pipelineStagesImpl
+		var ocrLang, detectedPDF string
+		pipelineStagesImpl = &mockPipelineStages{
+			detectLangFunc: func(pdfPath string, timeout time.Duration) (string, error) {
+				detectedPDF = pdfPath
+				return tt.detected, tt.detectErr
+			},
+			ocrPDFFunc: func(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+				ocrLang = lang
+				return "", fmt.Errorf("stop after OCR")
+			},
+		}
+
+		cfg := newTestRunConfig(inputDir, outputDir)
+		cfg.Lang = "auto"
+		_ = runCommand(context.Background(), cfg)
+		pipelineStagesImpl = originalImpl
+
+		if detectedPDF != filepath.Join(outputDir, "combined.pdf") {
+			t.Errorf("expected detection on combined.pdf, got %q", detectedPDF)
+		}
+		if ocrLang != tt.want {
+			t.Errorf("expected OCR language %q, got %q", tt.want, ocrLang)
+		}
+	}
+}
+
+func TestRunCommand_LangAutoNeedsPdftoppm(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	originalRunner := versionRunner
+	defer func() {
+		pipelineStagesImpl = originalImpl
+		versionRunner = originalRunner
+	}()
+	detected := false
+	pipelineStagesImpl = &mockPipelineStages{
+		detectLangFunc: func(pdfPath string, timeout time.Duration) (string, error) {
+			detected = true
+			return "eng", nil
+		},
+	}
+	versionRunner = &mockRunner{
+		lookPathFunc: func(bin string) (string, error) {
+			if bin == "pdftoppm" {
+				return "", fmt.Errorf("not found: %s", bin)
+			}
+			return "/usr/bin/" + bin, nil
+		},
+	}
+
+	for _, mutate := range []func(*runConfig){
+		func(cfg *runConfig) { cfg.Lang = "auto" },
+		func(cfg *runConfig) { cfg.LangMap = pipeline.LangMap{{First: 1, Last: 1, Lang: "auto"}} },
+	} {
+		cfg := newTestRunConfig(inputDir, outputDir)
+		mutate(&cfg)
+		err := runCommand(context.Background(), cfg)
+		if err == nil || !strings.Contains(err.Error(), "--lang auto needs pdftoppm") {
+			t.Errorf("expected missing pdftoppm error, got: %v", err)
+		}
+	}
+	if detected {
+		t.Error("expected the run to stop before language detection")
+	}
+
+	// Runs that do not detect the language do not need it
+	if err := runCommand(context.Background(), newTestRunConfig(inputDir, outputDir)); err != nil {
+		t.Errorf("expected a run with --lang eng to succeed without pdftoppm: %v", err)
+	}
+}
+
+func TestRunCommand_DumpConfig(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{}
+
+	cfg, err := parseRunConfig([]string{
+		"--input", inputDir, "--out", outputDir,
+		"--simhash-threshold", "3", "--ocr-timeout", "90s", "--dump-config",
+	})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "resolved_config.json"))
+	if err != nil {
+		t.Fatalf("expected resolved_config.json: %v", err)
+	}
+	var dumped map[string]any
+	if err := json.Unmarshal(data, &dumped); err != nil {
+		t.Fatalf("resolved_config.json is not valid JSON: %v", err)
+	}
+	if dumped["SimHashThreshold"] != float64(3) {
+		t.Errorf("expected SimHashThreshold 3, got %v", dumped["SimHashThreshold"])
+	}
+	if dumped["SimHashK"] != float64(5) {
+		t.Errorf("expected default SimHashK 5, got %v", dumped["SimHashK"])
+	}
+	if dumped["OCRTimeout"] != "1m30s" || dumped["PDFTimeout"] != "5m0s" {
+		t.Errorf("expected duration strings, got OCRTimeout=%v PDFTimeout=%v", dumped["OCRTimeout"], dumped["PDFTimeout"])
+	}
+	if dumped["JSONEvents"] != false {
+		t.Errorf("expected JSONEvents false, got %v", dumped["JSONEvents"])
+	}
+	if _, ok := dumped["EventWriter"]; ok {
+		t.Error("expected EventWriter to be omitted")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "result.md")); err != nil {
+		t.Errorf("expected run to continue after dumping config: %v", err)
+	}
+}
+
+func TestFindDuplicatesCommand_ReportsGroup(t *testing.T) {
+	inputDir := t.TempDir()
+	createMockImage(t, inputDir, "scan1.png")
+	createMockImage(t, inputDir, "scan2.png") // Same bytes as scan1
+	if err := os.WriteFile(filepath.Join(inputDir, "other.jpg"), []byte("distinct"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := findDuplicatesCommand([]string{"--input", inputDir}, &out); err != nil {
+		t.Fatalf("findDuplicatesCommand failed: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "duplicate group 1") {
+		t.Errorf("expected a duplicate group, got: %s", output)
+	}
+	if !strings.Contains(output, "scan1.png") || !strings.Contains(output, "scan2.png") {
+		t.Errorf("expected both identical images in the group, got: %s", output)
+	}
+	if strings.Contains(output, "other.jpg") {
+		t.Errorf("distinct image should not be reported, got: %s", output)
+	}
+	if !strings.Contains(output, "images scanned: 3, duplicate groups: 1, redundant images: 1") {
+		t.Errorf("expected summary line, got: %s", output)
+	}
+}
+
+func TestFindDuplicatesCommand_UnknownHash(t *testing.T) {
+	var out strings.Builder
+	err := findDuplicatesCommand([]string{"--input", t.TempDir(), "--hash", "md5"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "unknown hash method") {
+		t.Errorf("expected unknown hash method error, got: %v", err)
+	}
+}
+
+// writeFakeOutputTree creates the files of a finished run, plus an unrelated user file.
+func writeFakeOutputTree(t *testing.T, outputDir string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(outputDir, "preprocessed"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"preprocessed/0001.png", "combined.pdf", "combined_ocr.pdf", "extracted.txt",
+		"chunks_raw.jsonl", ".ocr_inputs", "result.md", "dedupe_report.json", "notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(outputDir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCleanCommand(t *testing.T) {
+	outputDir := t.TempDir()
+	writeFakeOutputTree(t, outputDir)
+
+	var out strings.Builder
+	if err := cleanCommand([]string{"--out", outputDir}, &out); err != nil {
+		t.Fatalf("cleanCommand failed: %v", err)
+	}
+
+	for _, name := range []string{"preprocessed", "combined.pdf", "combined_ocr.pdf", "extracted.txt", "chunks_raw.jsonl", ".ocr_inputs"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	for _, name := range []string{"result.md", "dedupe_report.json", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+	if !strings.Contains(out.String(), "6 artifacts removed") {
+		t.Errorf("expected summary line, got: %s", out.String())
+	}
+
+	// --all also removes final outputs, but never unknown files
+	out.Reset()
+	if err := cleanCommand([]string{"--out", outputDir, "--all"}, &out); err != nil {
+		t.Fatalf("cleanCommand --all failed: %v", err)
+	}
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "notes.txt" {
+		t.Errorf("expected only notes.txt to remain, got %v", entries)
+	}
+}
+
+func TestCleanCommand_DryRun(t *testing.T) {
+	outputDir := t.TempDir()
+	writeFakeOutputTree(t, outputDir)
+
+	var out strings.Builder
+	if err := cleanCommand([]string{"--out", outputDir, "--dry-run", "--all"}, &out); err != nil {
+		t.Fatalf("cleanCommand failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "would remove "+filepath.Join(outputDir, "combined.pdf")) ||
+		!strings.Contains(out.String(), "8 artifacts would be removed") {
+		t.Errorf("expected dry-run listing, got: %s", out.String())
+	}
+	for _, name := range []string{"preprocessed/0001.png", "combined.pdf", "result.md"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("expected dry run to keep %s: %v", name, err)
+		}
+	}
+
+	if err := cleanCommand([]string{"--out", filepath.Join(outputDir, "missing")}, &out); err == nil {
+		t.Error("expected error for missing output directory")
+	}
+}
+
+func TestDoctorCommand_Wrapper(t *testing.T) {
+	// Test the wrapper function doctorCommand (not doctorCommandWithRunner)
+	// This is a simple wrapper that calls runner.New() and doctorCommandWithRunner
+	// Since it may call os.Exit(1) if tools are missing, we can't easily test it
+	// without potentially terminating the test process
+	// The wrapper is trivial (just calls runner.New()), so we skip this test
+	// and rely on testing doctorCommandWithRunner directly
+	t.Skip("doctorCommand wrapper may call os.Exit, skipping to avoid test termination")
+}
+
+// selftestStages fakes the external stages for selftest: extraction writes the given
+// pages, joined with form feeds, as if OCR had read them back.
+func selftestStages(t *testing.T, pages []string) *mockPipelineStages {
+	t.Helper()
+	return &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			if err := os.WriteFile(textPath, []byte(strings.Join(pages, "\f")), 0644); err != nil {
+				return "", err
+			}
+			return textPath, nil
+		},
+	}
+}
+
+// selftestRenderer fakes the page renderer by writing a placeholder PNG.
+func selftestRenderer(t *testing.T) *mockRunner {
+	return &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin != "python3" {
+				t.Fatalf("unexpected command %s", bin)
+			}
+			path := args[2]
+			createMockImage(t, filepath.Dir(path), filepath.Base(path))
+			return runner.Result{}, nil
+		},
+	}
+}
+
+func TestSelftestCommand_Pass(t *testing.T) {
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	var pages []string
+	for _, paragraphs := range selftestPages {
+		pages = append(pages, strings.Join(paragraphs, "\n\n"))
+	}
+	pipelineStagesImpl = selftestStages(t, pages)
+
+	var out bytes.Buffer
+	if err := selftestCommandWithRunner([]string{"--tmp-dir", t.TempDir()}, &out, selftestRenderer(t)); err != nil {
+		t.Fatalf("selftest failed: %v\n%s", err, out.String())
+	}
+	for _, stage := range []string{"generate", "run", "extract", "dedupe", "render"} {
+		if !strings.Contains(out.String(), "selftest "+stage+": PASS") {
+			t.Errorf("expected %s to pass, got:\n%s", stage, out.String())
+		}
+	}
+}
+
+func TestSelftestCommand_ReportsFailedStage(t *testing.T) {
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	// OCR misses the repeated paragraph on the second page, so nothing is deduplicated
+	pipelineStagesImpl = selftestStages(t, []string{
+		strings.Join(selftestPages[0], "\n\n"),
+		selftestPages[1][1],
+	})
+
+	tmpRoot := t.TempDir()
+	var out bytes.Buffer
+	err := selftestCommandWithRunner([]string{"--tmp-dir", tmpRoot}, &out, selftestRenderer(t))
+	if err == nil || !strings.Contains(err.Error(), "dedupe: expected 3 kept and 1 dropped chunk, got 3 kept and 0 dropped") {
+		t.Fatalf("expected dedupe failure, got %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "selftest extract: PASS") || !strings.Contains(out.String(), "selftest dedupe: FAIL") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	// The work directory is removed without --keep
+	entries, _ := os.ReadDir(tmpRoot)
+	if len(entries) != 0 {
+		t.Errorf("expected selftest directory to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestSelftestCommand_RenderFailure(t *testing.T) {
+	r := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			return runner.Result{ExitCode: 1, Stderr: "No module named 'PIL'"}, errors.New("exit status 1")
+		},
+	}
+	var out bytes.Buffer
+	err := selftestCommandWithRunner([]string{"--tmp-dir", t.TempDir()}, &out, r)
+	if err == nil || !strings.Contains(err.Error(), "generate:") || !strings.Contains(err.Error(), "Pillow") {
+		t.Errorf("expected generate failure mentioning Pillow, got %v", err)
+	}
+	if strings.Contains(out.String(), "selftest run:") {
+		t.Errorf("expected selftest to stop after generate, got:\n%s", out.String())
+	}
+}
+
+func TestSplitWatchArgs(t *testing.T) {
+	watchArgs, runArgs := splitWatchArgs([]string{"--input", "in", "--debounce", "2s", "-settle=100ms", "--out", "out", "--dedupe=exact"})
+	if !reflect.DeepEqual(watchArgs, []string{"--debounce", "2s", "-settle=100ms"}) {
+		t.Errorf("unexpected watch args: %v", watchArgs)
+	}
+	if !reflect.DeepEqual(runArgs, []string{"--input", "in", "--out", "out", "--dedupe=exact"}) {
+		t.Errorf("unexpected run args: %v", runArgs)
+	}
+}
+
+// startTestWatcher runs w until the test ends, sending each processed batch to the
+// returned channel.
+func startTestWatcher(t *testing.T, w *imageWatcher) <-chan []string {
+	t.Helper()
+	batches := make(chan []string, 10)
+	w.process = func(_ context.Context, images []string) error {
+		batches <- images
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watch failed: %v", err)
+		}
+	})
+	return batches
+}
+
+func TestImageWatcher_ProcessesNewImagesAfterDebounce(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "existing.png")
+	debounce := 200 * time.Millisecond
+	w, err := newImageWatcher(newTestRunConfig(inputDir, outputDir), debounce, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("newImageWatcher failed: %v", err)
+	}
+	batches := startTestWatcher(t, w)
+
+	// Images already present form the first batch
+	select {
+	case batch := <-batches:
+		if len(batch) != 1 || filepath.Base(batch[0]) != "existing.png" {
+			t.Fatalf("expected existing image in first batch, got %v", batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the existing image to be processed")
+	}
+
+	start := time.Now()
+	createMockImage(t, inputDir, "scan2.png")
+	if err := os.WriteFile(filepath.Join(inputDir, "notes.txt"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	createMockImage(t, inputDir, "scan10.png")
+
+	select {
+	case batch := <-batches:
+		if elapsed := time.Since(start); elapsed < debounce {
+			t.Errorf("expected processing after the %v debounce, got %v", debounce, elapsed)
+		}
+		var names []string
+		for _, path := range batch {
+			names = append(names, filepath.Base(path))
+		}
+		if !reflect.DeepEqual(names, []string{"scan2.png", "scan10.png"}) {
+			t.Errorf("expected both new images in natural order and no other files, got %v", names)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for new images to be processed")
+	}
+
+	// The batch is recorded right after it is processed
+	var data []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if data, err = os.ReadFile(filepath.Join(outputDir, watchProcessedFile)); strings.Count(string(data), "\n") == 3 {
+			break
+		}
+	}
+	if strings.Count(string(data), "\n") != 3 {
+		t.Errorf("expected 3 processed images recorded, got %q (err %v)", data, err)
+	}
+
+	// A restarted watcher skips processed images
+	w2, err := newImageWatcher(newTestRunConfig(inputDir, outputDir), debounce, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("newImageWatcher failed: %v", err)
+	}
+	if len(w2.processed) != 3 {
+		t.Errorf("expected 3 processed images loaded, got %d", len(w2.processed))
+	}
+}
+
+func TestImageWatcher_WaitsForPartialWrites(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	w, err := newImageWatcher(newTestRunConfig(inputDir, outputDir), time.Second, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("newImageWatcher failed: %v", err)
+	}
+
+	empty := filepath.Join(inputDir, "empty.png")
+	growing := filepath.Join(inputDir, "growing.png")
+	createMockImage(t, inputDir, "done.png")
+	done := filepath.Join(inputDir, "done.png")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.WriteFile(growing, []byte("part"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	w.pending = map[string]bool{empty: true, growing: true, done: true}
+
+	// Keep writing to growing.png during the settle interval
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f, err := os.OpenFile(growing, os.O_APPEND|os.O_WRONLY, 0644)
+		if err == nil {
+			_, _ = f.WriteString("more")
+			_ = f.Close()
+		}
+	}()
+
+	ready := w.settledImages()
+	if !reflect.DeepEqual(ready, []string{done}) {
+		t.Errorf("expected only the finished image to be ready, got %v", ready)
+	}
+	if !w.pending[empty] || !w.pending[growing] || w.pending[done] {
+		t.Errorf("expected empty and growing images to stay pending, got %v", w.pending)
+	}
+}
+
+func TestImageWatcher_ProcessBatchAppendsResults(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+
+	repeated := "This paragraph is printed on every page that the scanner drops into the folder."
+	pages := []string{
+		repeated + "\n\nThe first batch also has a paragraph of its own that should appear in the result.",
+		repeated + "\n\nThe second batch adds another distinct paragraph which must be appended to it.",
+	}
+	batch := 0
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			err := os.WriteFile(textPath, []byte(pages[batch]), 0644)
+			batch++
+			return textPath, err
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.Frontmatter = true
+	w, err := newImageWatcher(cfg, time.Second, 0)
+	if err != nil {
+		t.Fatalf("newImageWatcher failed: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		name := fmt.Sprintf("scan%d.png", i)
+		createMockImage(t, inputDir, name)
+		if err := w.process(context.Background(), []string{filepath.Join(inputDir, name)}); err != nil {
+			t.Fatalf("batch %d failed: %v", i, err)
+		}
+	}
+
+	md, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err != nil {
+		t.Fatalf("failed to read result.md: %v", err)
+	}
+	content := string(md)
+	if strings.Count(content, "# Title") != 1 || strings.Count(content, "---\n") != 2 {
+		t.Errorf("expected one title and frontmatter block, got:\n%s", content)
+	}
+	if strings.Count(content, repeated) != 1 {
+		t.Errorf("expected the repeated paragraph once (cross-run dedup), got:\n%s", content)
+	}
+	if !strings.Contains(content, "of its own that should appear in the result.\n\nThe second batch") {
+		t.Errorf("expected the second batch appended after a blank line, got:\n%s", content)
+	}
+
+	rep, err := report.ReadReport(filepath.Join(outputDir, "dedupe_report.json"))
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	if rep.InputImages != 2 || rep.KeptChunks != 3 || rep.DroppedChunks != 1 || rep.CrossRunDups != 1 {
+		t.Errorf("unexpected cumulative report: %+v", rep)
+	}
+	if len(rep.Dropped) != 1 || rep.Dropped[0].ChunkID != "b2-c0001" || rep.Dropped[0].MatchedChunkID != "run1/b1-c0001" {
+		t.Errorf("expected batch-numbered chunk IDs, got %+v", rep.Dropped)
+	}
+	if data, err := os.ReadFile(filepath.Join(outputDir, watchBatchesFile)); err != nil || string(data) != "2\n" {
+		t.Errorf("expected 2 batches recorded, got %q (err %v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, watchStateFile)); err != nil {
+		t.Errorf("expected dedup state in the output directory: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(outputDir, ".watch-batch-*")); len(matches) != 0 {
+		t.Errorf("expected batch directories to be removed, found %v", matches)
+	}
+}
+
+func TestImageWatcher_FailedBatchKeepsState(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			return textPath, os.WriteFile(textPath, []byte("A paragraph that only the retried batch contains, long enough to keep."), 0644)
+		},
+	}
+
+	w, err := newImageWatcher(newTestRunConfig(inputDir, outputDir), time.Second, 0)
+	if err != nil {
+		t.Fatalf("newImageWatcher failed: %v", err)
+	}
+	createMockImage(t, inputDir, "scan1.png")
+	images := []string{filepath.Join(inputDir, "scan1.png")}
+
+	// An unreadable cumulative report makes the merge fail after the run succeeded
+	reportPath := filepath.Join(outputDir, "dedupe_report.json")
+	if err := os.WriteFile(reportPath, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.process(context.Background(), images); err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, watchStateFile)); !os.IsNotExist(err) {
+		t.Errorf("expected no dedup state saved for a failed batch, got %v", err)
+	}
+	if w.batches != 0 {
+		t.Errorf("expected the failed batch not to be counted, got %d", w.batches)
+	}
+
+	// The retry keeps the batch's chunks instead of dropping them as cross-run duplicates
+	if err := os.Remove(reportPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.process(context.Background(), images); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	rep, err := report.ReadReport(reportPath)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	if rep.KeptChunks != 1 || rep.CrossRunDups != 0 {
+		t.Errorf("expected the retried chunk kept, got %+v", rep)
+	}
+}
+
+func TestParseRunConfig_Timestamp(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	cfg, err := parseRunConfig(nil)
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !cfg.Timestamp.IsZero() {
+		t.Errorf("expected no fixed timestamp by default, got %v", cfg.Timestamp)
+	}
+
+	cfg, err = parseRunConfig([]string{"--deterministic"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !cfg.Timestamp.Equal(time.Unix(0, 0)) {
+		t.Errorf("expected the Unix epoch without SOURCE_DATE_EPOCH, got %v", cfg.Timestamp)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	cfg, err = parseRunConfig([]string{"--deterministic"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !cfg.Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("expected the SOURCE_DATE_EPOCH time, got %v", cfg.Timestamp)
+	}
+
+	// --timestamp takes precedence over SOURCE_DATE_EPOCH
+	cfg, err = parseRunConfig([]string{"--deterministic", "--timestamp", "2024-05-01T12:00:00Z"})
+	if err != nil {
+		t.Fatalf("parseRunConfig() failed: %v", err)
+	}
+	if !cfg.Timestamp.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the --timestamp time, got %v", cfg.Timestamp)
+	}
+
+	if _, err := parseRunConfig([]string{"--timestamp", "2024-05-01"}); err == nil {
+		t.Error("expected error for a --timestamp that is not RFC3339")
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := parseRunConfig([]string{"--deterministic"}); err == nil {
+		t.Error("expected error for an invalid SOURCE_DATE_EPOCH")
+	}
+}
+
+func TestRunCommand_DeterministicOutputs(t *testing.T) {
+	inputDir := t.TempDir()
+	createMockImage(t, inputDir, "image1.jpg")
+	createMockImage(t, inputDir, "image2.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			content := "A paragraph repeated on every page of the scanned notebook.\n\n" +
+				"Another paragraph that only appears once in the whole notebook.\n\n" +
+				"A paragraph repeated on every page of the scanned notebook.\n\n" +
+				"A paragraph repeated on every page of the scanned notebooks.\n"
+			return textPath, os.WriteFile(textPath, []byte(content), 0644)
+		},
+	}
+
+	files := []string{"result.md", "dedupe_report.json", "kept_chunks.jsonl", "filtered_out.jsonl"}
+	run := func() map[string]string {
+		t.Helper()
+		cfg := newTestRunConfig(inputDir, t.TempDir())
+		cfg.MinChunkChars = 10
+		cfg.DedupeMethod = "both"
+		cfg.Frontmatter = true
+		cfg.EmitKeptJSONL = true
+		cfg.DebugFiltered = true
+		cfg.Deterministic = true
+		cfg.Timestamp = time.Unix(0, 0).UTC()
+		if err := runCommand(context.Background(), cfg); err != nil {
+			t.Fatalf("runCommand() failed: %v", err)
+		}
+		outputs := map[string]string{}
+		for _, name := range files {
+			content, err := os.ReadFile(filepath.Join(cfg.OutputDir, name))
+			if err != nil {
+				t.Fatalf("expected %s: %v", name, err)
+			}
+			outputs[name] = string(content)
+		}
+		return outputs
+	}
+
+	first := run()
+	time.Sleep(1100 * time.Millisecond) // A timestamp taken from the clock would now differ
+	second := run()
+	for _, name := range files {
+		if first[name] != second[name] {
+			t.Errorf("%s differs between runs:\n%s\n---\n%s", name, first[name], second[name])
+		}
+	}
+	if !strings.Contains(first["dedupe_report.json"], `"timestamp": "1970-01-01T00:00:00Z"`) {
+		t.Errorf("expected the fixed report timestamp, got:\n%s", first["dedupe_report.json"])
+	}
+	if !strings.Contains(first["result.md"], `date: "1970-01-01T00:00:00Z"`) {
+		t.Errorf("expected the fixed frontmatter date, got:\n%s", first["result.md"])
+	}
+}
+
+func TestCommandLog_RecordsSuccessAndFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	run := func(script string) {
+		t.Helper()
+		commandLog, err := openCommandLog(path, nil)
+		if err != nil {
+			t.Fatalf("openCommandLog failed: %v", err)
+		}
+		defer func() { _ = commandLog.Close() }()
+		r := runner.New()
+		r.OnResult = commandLog.record
+		_, _ = r.Run(context.Background(), "sh", []string{"-c", script}, runner.RunOpts{StdoutMode: runner.Capture, StderrMode: runner.Capture})
+	}
+	run("echo converted")
+	var failing strings.Builder
+	for i := 1; i <= commandLogStderrLines+5; i++ {
+		fmt.Fprintf(&failing, "echo line %d >&2; ", i)
+	}
+	failing.WriteString("exit 2")
+	// A second open appends to the entries already there
+	run(failing.String())
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected the command log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %d:\n%s", len(lines), content)
+	}
+	var entries []commandLogEntry
+	for _, line := range lines {
+		var entry commandLogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid command log line %q: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339, entry.Time); err != nil {
+			t.Errorf("expected an RFC3339 time, got %q", entry.Time)
+		}
+		entries = append(entries, entry)
+	}
+
+	if ok := entries[0]; ok.Cmd != `sh -c "echo converted"` || ok.ExitCode != 0 || ok.Error != "" || ok.StderrTail != "" {
+		t.Errorf("expected a successful entry, got %+v", ok)
+	}
+	failed := entries[1]
+	if failed.ExitCode != 2 || !strings.Contains(failed.Error, "exit code 2") {
+		t.Errorf("expected the failed command's exit code and error, got %+v", failed)
+	}
+	tail := strings.Split(failed.StderrTail, "\n")
+	if len(tail) != commandLogStderrLines || tail[0] != "line 6" || tail[len(tail)-1] != "line 25" {
+		t.Errorf("expected the last %d stderr lines, got %q", commandLogStderrLines, failed.StderrTail)
+	}
+}
+
+func TestRunCommand_CommandLogHook(t *testing.T) {
+	inputDir, outputDir := setupTestDirs(t)
+	createMockImage(t, inputDir, "image1.jpg")
+
+	originalImpl := pipelineStagesImpl
+	defer func() { pipelineStagesImpl = originalImpl }()
+	pipelineStagesImpl = &mockPipelineStages{
+		extractTextFunc: func(pdfPath, outputDir string, timeout time.Duration) (string, error) {
+			textPath := filepath.Join(outputDir, "extracted.txt")
+			return textPath, os.WriteFile(textPath, []byte("A paragraph long enough to be kept as a chunk of the result.\n"), 0644)
+		},
+	}
+
+	cfg := newTestRunConfig(inputDir, outputDir)
+	cfg.CommandLog = filepath.Join(outputDir, "commands.jsonl")
+	if err := runCommand(context.Background(), cfg); err != nil {
+		t.Fatalf("runCommand() failed: %v", err)
+	}
+	if _, err := os.Stat(cfg.CommandLog); err != nil {
+		t.Errorf("expected the command log to be created: %v", err)
+	}
 }
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+	"github.com/jonkmatsumo/bulk-ocr/internal/ingest"
+	"github.com/jonkmatsumo/bulk-ocr/internal/pipeline"
+)
+
+// pagesDir holds one subdirectory per image in per-image OCR mode (--parallel-stages).
+const pagesDir = "pages"
+
+// pageJob is one image moving through the per-image OCR pipeline.
+type pageJob struct {
+	index int    // Position of the image in the run, from 0
+	dir   string // Working directory of the page, <out>/pages/0001 etc.
+	path  string // Path of the current artifact: staged image, OCR PDF, or text
+}
+
+// stageCounter counts finished items of a stage shared by several workers.
+type stageCounter struct {
+	mu     sync.Mutex
+	done   int
+	stage  string
+	events *eventEmitter
+}
+
+func (c *stageCounter) add() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done++
+	c.events.stageProgress(c.stage, c.done)
+}
+
+// runParallelStages runs staging, PDF synthesis, OCR and text extraction separately
+// for each image, so that different images can be in different stages at once: a
+// single goroutine stages images ahead of cfg.ParallelStages OCR workers, which hand
+// their PDFs to as many extraction workers. Page texts are joined in input order with
+// form feeds into <out>/extracted.txt, so the result does not depend on scheduling.
+// The staged copy of each image is returned with the text path, in input order. The
+// first failure cancels the remaining work and is returned.
+func runParallelStages(ctx context.Context, cfg runConfig, images []string, stageOpts ingest.StageOptions, events *eventEmitter) (string, []string, error) {
+	outputDir := cfg.OutputDir
+	workers := cfg.ParallelStages
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		failOnce sync.Once
+		failErr  error
+	)
+	fail := func(err error) {
+		failOnce.Do(func() {
+			failErr = err
+			cancel()
+		})
+	}
+	// send passes job to the next stage unless the pipeline was cancelled.
+	send := func(ch chan<- pageJob, job pageJob) bool {
+		select {
+		case ch <- job:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	logInfo(cfg.logger, "Processing %d images with %d parallel stage workers...", len(images), workers)
+	starts := map[string]time.Time{}
+	for _, stage := range append([]string{"stage"}, ocrStages...) {
+		starts[stage] = events.stageStartTotal(stage, len(images))
+	}
+
+	// Stage: copy each image into its own page directory, a few ahead of OCR
+	stagedCh := make(chan pageJob, workers)
+	stagedPaths := make([]string, len(images)) // Read only after every worker has finished
+	go func() {
+		defer close(stagedCh)
+		counter := &stageCounter{stage: "stage", events: events}
+		for i, image := range images {
+			if ctx.Err() != nil {
+				return
+			}
+			dir := filepath.Join(outputDir, pagesDir, fmt.Sprintf("%04d", i+1))
+			staged, err := ingest.StageImagesWithOptions([]string{image}, dir, stageOpts)
+			if err != nil {
+				events.stageFailed("stage", err)
+				fail(fmt.Errorf("failed to stage images: %w", err))
+				return
+			}
+			if cfg.OptimizePNGs {
+				optimizePNGs(staged, cfg.logger)
+			}
+			stagedPaths[i] = staged[0]
+			counter.add()
+			if !send(stagedCh, pageJob{index: i, dir: dir, path: staged[0]}) {
+				return
+			}
+		}
+		events.stageDone("stage", starts["stage"], map[string]int{"images": len(images)})
+	}()
+
+	// PDF synthesis and OCR of single pages
+	ocrCh := make(chan pageJob, workers)
+	pdfCounter := &stageCounter{stage: "pdf", events: events}
+	ocrCounter := &stageCounter{stage: "ocr", events: events}
+	var ocrWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		ocrWG.Add(1)
+		go func() {
+			defer ocrWG.Done()
+			for job := range stagedCh {
+				if ctx.Err() != nil {
+					continue // Drain so the stager is never left blocked
+				}
+				ocrPath, err := ocrPage(ctx, cfg, job, pdfCounter, ocrCounter, events)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				job.path = ocrPath
+				send(ocrCh, job)
+			}
+		}()
+	}
+	go func() {
+		ocrWG.Wait()
+		close(ocrCh)
+	}()
+
+	// Text extraction; each worker writes only its own page's slot
+	texts := make([]string, len(images))
+	extractCounter := &stageCounter{stage: "extract", events: events}
+	var extractWG sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		extractWG.Add(1)
+		go func() {
+			defer extractWG.Done()
+			for job := range ocrCh {
+				if ctx.Err() != nil {
+					continue
+				}
+				text, err := extractPage(ctx, cfg, job)
+				if err != nil {
+					events.stageFailed("extract", err)
+					fail(err)
+					continue
+				}
+				texts[job.index] = text
+				extractCounter.add()
+			}
+		}()
+	}
+	extractWG.Wait()
+
+	if failErr != nil {
+		return "", nil, failErr
+	}
+	if err := ctx.Err(); err != nil {
+		return "", nil, err // Cancelled by the caller
+	}
+	for _, stage := range ocrStages {
+		events.stageDone(stage, starts[stage], nil)
+	}
+	logInfo(cfg.logger, "Processed %d pages", len(images))
+	if cfg.DryRun {
+		return "", stagedPaths, nil
+	}
+
+	joined := strings.Join(texts, "\f")
+	textPath := filepath.Join(outputDir, stageArtifacts["extract"])
+	if err := fsutil.WriteFileAtomic(textPath, []byte(joined), 0644); err != nil {
+		return "", nil, fmt.Errorf("failed to write extracted text: %w", err)
+	}
+
+	// Apply the minimum length to the whole document, as the combined path does
+	if chars := len(strings.TrimSpace(joined)); chars < cfg.MinExtractedChars {
+		err := &pipeline.TextTooShortError{Chars: chars, MinChars: cfg.MinExtractedChars}
+		if !cfg.AllowEmpty {
+			return "", nil, &stageError{stage: "extract", err: fmt.Errorf("text extraction failed: %w", err)}
+		}
+		logWarn(cfg.logger, "%v; continuing (--allow-empty)", err)
+	}
+	return textPath, stagedPaths, nil
+}
+
+// ocrPage builds a single-page PDF from a staged image and OCRs it, returning the
+// path of the OCR PDF in the page directory.
+func ocrPage(ctx context.Context, cfg runConfig, job pageJob, pdfCounter, ocrCounter *stageCounter, events *eventEmitter) (string, error) {
+	start := time.Now()
+	timeout, err := stageTimeout(ctx, "pdf", cfg.PDFTimeout)
+	if err != nil {
+		events.stageFailed("pdf", err)
+		return "", err
+	}
+	pdfPath, err := cfg.stages.BuildPDF(ctx, filepath.Dir(job.path), job.dir, timeout)
+	if err != nil {
+		events.stageFailed("pdf", err)
+		return "", newStageError("pdf", timeout, start, fmt.Errorf("PDF synthesis failed for page %d: %w", job.index+1, err))
+	}
+	pdfCounter.add()
+
+	// Each page is OCRed alone, so it only needs its own language
+	lang := cfg.LangMap.LangForPage(job.index+1, cfg.Lang)
+	if lang == pipeline.AutoLang {
+		lang = detectOCRLang(ctx, cfg, pdfPath)
+	}
+	start = time.Now()
+	timeout, err = stageTimeout(ctx, "ocr", cfg.OCRTimeout)
+	if err != nil {
+		events.stageFailed("ocr", err)
+		return "", err
+	}
+	ocrPath, err := cfg.stages.OCRPDF(ctx, pdfPath, job.dir, lang, ocrOptions(cfg), timeout)
+	if err != nil {
+		events.stageFailed("ocr", err)
+		return "", newStageError("ocr", timeout, start, fmt.Errorf("OCR failed for page %d: %w", job.index+1, err))
+	}
+	ocrCounter.add()
+	if !cfg.KeepArtifacts {
+		if err := cfg.stages.CleanupArtifact(pdfPath); err != nil {
+			logWarn(cfg.logger, "failed to cleanup %s: %v", pdfPath, err)
+		}
+	}
+	return ocrPath, nil
+}
+
+// extractPage extracts the text of a page's OCR PDF. The minimum length is checked
+// on the joined document instead, since a blank page is not an OCR failure.
+func extractPage(ctx context.Context, cfg runConfig, job pageJob) (string, error) {
+	start := time.Now()
+	timeout, err := stageTimeout(ctx, "extract", cfg.ExtractTimeout)
+	if err != nil {
+		return "", err
+	}
+	textPath, err := cfg.stages.ExtractText(ctx, job.path, job.dir, pipeline.PDFToTextMode(cfg.PDFToTextMode), 0, timeout)
+	var tooShort *pipeline.TextTooShortError
+	if errors.As(err, &tooShort) {
+		err = nil
+	}
+	if err != nil {
+		return "", newStageError("extract", timeout, start, fmt.Errorf("text extraction failed for page %d: %w", job.index+1, err))
+	}
+	if !cfg.KeepArtifacts {
+		if err := cfg.stages.CleanupArtifact(job.path); err != nil {
+			logWarn(cfg.logger, "failed to cleanup %s: %v", job.path, err)
+		}
+	}
+	if cfg.DryRun {
+		return "", nil
+	}
+	data, err := os.ReadFile(textPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read extracted text: %w", err)
+	}
+	return strings.TrimRight(string(data), "\f"), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runPDFInput runs the pipeline on the PDFs of --input-pdf instead of images. Listing,
+// staging and PDF synthesis are skipped: several PDFs are merged into combined.pdf,
+// and a single one is OCRed as it is. The text stages then run as for images.
+func runPDFInput(ctx context.Context, cfg runConfig, absOutput string, events *eventEmitter, runStart time.Time) error {
+	for _, path := range cfg.InputPDFs {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read input PDF: %w", err)
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".pdf") {
+			return fmt.Errorf("input PDF %s is not a .pdf file", path)
+		}
+	}
+
+	logInfo(cfg.logger, "input PDFs: %s", strings.Join(cfg.InputPDFs, ", "))
+	logInfo(cfg.logger, "output directory: %s", absOutput)
+	logInfo(cfg.logger, "keep artifacts: %v", cfg.KeepArtifacts)
+	logInfo(cfg.logger, "language: %s", cfg.Lang)
+
+	textPath, err := runOCRStages(ctx, cfg, cfg.InputPDFs, events)
+	if err != nil {
+		return err
+	}
+	if cfg.DryRun {
+		logInfo(cfg.logger, "dry run: skipping chunking, deduplication and output")
+		return nil
+	}
+	return runTextStages(cfg, textPath, len(cfg.InputPDFs), events, runStart)
+}
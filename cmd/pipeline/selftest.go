@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/report"
+	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+)
+
+// selftestRepeated appears on both synthetic pages, so deduplication should drop it once.
+const selftestRepeated = "The quick brown fox jumps over the lazy dog while walking along the quiet riverbank."
+
+// selftestPages are the paragraphs drawn on each synthetic page.
+var selftestPages = [][]string{
+	{selftestRepeated, "Pack my box with five dozen liquor jugs before the early morning train leaves town."},
+	{selftestRepeated, "Sphinx of black quartz, judge my vow while the old clock in the hall strikes nine."},
+}
+
+// selftestMarkers are distinctive words, one per distinct paragraph, that result.md
+// should contain exactly once each.
+var selftestMarkers = []string{"riverbank", "liquor", "quartz"}
+
+// selftestScript draws paragraphs (a JSON list, argv[2]) on a white page saved to argv[1].
+const selftestScript = `
+import json, sys
+from PIL import Image, ImageDraw, ImageFont
+img = Image.new('RGB', (2000, 1000), color='white')
+draw = ImageDraw.Draw(img)
+try:
+    font = ImageFont.truetype('/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf', 32)
+except Exception:
+    try:
+        font = ImageFont.load_default(size=32)
+    except TypeError:
+        font = ImageFont.load_default()
+for i, paragraph in enumerate(json.loads(sys.argv[2])):
+    draw.text((60, 100 + 300 * i), paragraph, fill='black', font=font)
+img.save(sys.argv[1], dpi=(300, 300))
+`
+
+// selftestCheck is the outcome of one stage's expectation.
+type selftestCheck struct {
+	stage  string
+	err    error
+	detail string
+}
+
+// selftestCommand runs the selftest subcommand.
+func selftestCommand(args []string, w io.Writer) error {
+	return selftestCommandWithRunner(args, w, runner.New())
+}
+
+// selftestCommandWithRunner runs the full pipeline on synthetic pages with known
+// repeated text and checks each stage's output. r renders the pages.
+func selftestCommandWithRunner(args []string, w io.Writer, r runnerInterface) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	tmpRoot := fs.String("tmp-dir", "", "Directory for the selftest's input and output (default: system temp directory)")
+	keep := fs.Bool("keep", false, "Keep the selftest directory for inspection")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp(*tmpRoot, fmt.Sprintf("selftest-%d-*", os.Getpid()))
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	if *keep {
+		_, _ = fmt.Fprintf(w, "selftest directory: %s\n", workDir)
+	} else {
+		defer func() {
+			if err := os.RemoveAll(workDir); err != nil {
+				logWarn(nil, "failed to clean up selftest directory %s: %v", workDir, err)
+			}
+		}()
+	}
+	inputDir := filepath.Join(workDir, "input")
+	outputDir := filepath.Join(workDir, "output")
+
+	checks := runSelftest(context.Background(), r, inputDir, outputDir)
+	var failed []string
+	for _, c := range checks {
+		if c.err != nil {
+			_, _ = fmt.Fprintf(w, "selftest %s: FAIL (%v)\n", c.stage, c.err)
+			failed = append(failed, fmt.Sprintf("%s: %v", c.stage, c.err))
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "selftest %s: PASS (%s)\n", c.stage, c.detail)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("selftest failed: %s", strings.Join(failed, "; "))
+	}
+	_, _ = fmt.Fprintln(w, "selftest: PASSED")
+	return nil
+}
+
+// runSelftest renders the synthetic pages into inputDir, runs the pipeline into
+// outputDir, and checks extraction, deduplication and rendering. It stops after a
+// failed page render or run, since later checks would only repeat that failure.
+func runSelftest(ctx context.Context, r runnerInterface, inputDir, outputDir string) []selftestCheck {
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		return []selftestCheck{{stage: "generate", err: err}}
+	}
+	for i, paragraphs := range selftestPages {
+		path := filepath.Join(inputDir, fmt.Sprintf("page%d.png", i+1))
+		if err := renderSelftestPage(ctx, r, path, paragraphs); err != nil {
+			return []selftestCheck{{stage: "generate", err: err}}
+		}
+	}
+	checks := []selftestCheck{{stage: "generate", detail: fmt.Sprintf("%d synthetic pages", len(selftestPages))}}
+
+	cfg, err := parseRunConfig([]string{"--input", inputDir, "--out", outputDir, "--lang", "eng"})
+	if err == nil {
+		err = runCommand(ctx, cfg)
+	}
+	if err != nil {
+		return append(checks, selftestCheck{stage: "run", err: err})
+	}
+	checks = append(checks, selftestCheck{stage: "run", detail: "pipeline completed"})
+
+	// Extraction: every paragraph made it through OCR
+	extracted, err := os.ReadFile(filepath.Join(outputDir, "extracted.txt"))
+	if err == nil {
+		err = expectMarkers(string(extracted), 1, -1)
+	}
+	checks = append(checks, selftestCheck{stage: "extract", err: err, detail: "all paragraphs recognized"})
+
+	// Deduplication: only the repeated paragraph was dropped
+	checks = append(checks, checkSelftestReport(filepath.Join(outputDir, "dedupe_report.json")))
+
+	// Rendering: each paragraph appears exactly once in result.md
+	result, err := os.ReadFile(filepath.Join(outputDir, "result.md"))
+	if err == nil {
+		err = expectMarkers(string(result), 1, 1)
+	}
+	checks = append(checks, selftestCheck{stage: "render", err: err, detail: "each paragraph once in result.md"})
+	return checks
+}
+
+// renderSelftestPage draws paragraphs on a synthetic page image at path using Pillow.
+func renderSelftestPage(ctx context.Context, r runnerInterface, path string, paragraphs []string) error {
+	data, err := json.Marshal(paragraphs)
+	if err != nil {
+		return err
+	}
+	opts := runner.RunOpts{
+		Timeout:    30 * time.Second,
+		StdoutMode: runner.Capture,
+		StderrMode: runner.Capture,
+	}
+	result, err := r.Run(ctx, "python3", []string{"-c", selftestScript, path, string(data)}, opts)
+	if err != nil {
+		return fmt.Errorf("failed to render %s (python3 with Pillow is required): %w (stderr: %s)", filepath.Base(path), err, result.Stderr)
+	}
+	return nil
+}
+
+// checkSelftestReport checks that deduplication kept one chunk per distinct paragraph
+// and dropped the repeated one.
+func checkSelftestReport(path string) selftestCheck {
+	check := selftestCheck{stage: "dedupe"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		check.err = err
+		return check
+	}
+	var rep report.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		check.err = fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+		return check
+	}
+	if rep.KeptChunks != len(selftestMarkers) || rep.DroppedChunks != 1 {
+		check.err = fmt.Errorf("expected %d kept and 1 dropped chunk, got %d kept and %d dropped",
+			len(selftestMarkers), rep.KeptChunks, rep.DroppedChunks)
+		return check
+	}
+	check.detail = fmt.Sprintf("%d kept, 1 dropped", rep.KeptChunks)
+	return check
+}
+
+// expectMarkers checks that text contains each of selftestMarkers, ignoring case, at
+// least min times and, if max is not negative, at most max times.
+func expectMarkers(text string, min, max int) error {
+	text = strings.ToLower(text)
+	var problems []string
+	for _, marker := range selftestMarkers {
+		n := strings.Count(text, marker)
+		if n < min || (max >= 0 && n > max) {
+			problems = append(problems, fmt.Sprintf("%q found %d times", marker, n))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unexpected paragraph counts: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+	"github.com/jonkmatsumo/bulk-ocr/internal/ingest"
+	"github.com/jonkmatsumo/bulk-ocr/internal/report"
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+// watchProcessedFile lists the images watch has already processed, one absolute path
+// per line, so a restarted watch only processes new ones.
+const watchProcessedFile = ".watch_processed"
+
+// watchBatchesFile holds the number of batches watch has processed, which numbers the
+// chunk IDs of the next batch.
+const watchBatchesFile = ".watch_batches"
+
+// watchStateFile is the cross-run dedup state watch uses when --dedup-state is not set.
+const watchStateFile = "dedup_state.json"
+
+// watchFlags are the flags of the watch subcommand that are not run flags.
+var watchFlags = []string{"debounce", "settle"}
+
+// watchCommand runs the watch subcommand: it accepts the run flags, plus --debounce
+// and --settle, and processes images added to the input directory until interrupted.
+func watchCommand(args []string) error {
+	watchArgs, runArgs := splitWatchArgs(args)
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	debounce := fs.Duration("debounce", 5*time.Second, "Quiet period after the last new image before processing the batch")
+	settle := fs.Duration("settle", time.Second, "Interval between size checks; an image is processed once its size stops changing")
+	if err := fs.Parse(watchArgs); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	cfg, err := parseRunConfig(runArgs)
+	if err != nil {
+		return err
+	}
+	w, err := newImageWatcher(cfg, *debounce, *settle)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return w.run(ctx)
+}
+
+// splitWatchArgs separates the watch-only flags in args (-name value, -name=value,
+// with one or two dashes) from the run flags.
+func splitWatchArgs(args []string) (watchArgs, runArgs []string) {
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		if !strings.HasPrefix(args[i], "-") || !isWatchFlag(name) {
+			runArgs = append(runArgs, args[i])
+			continue
+		}
+		watchArgs = append(watchArgs, args[i])
+		if !hasValue && i+1 < len(args) {
+			i++
+			watchArgs = append(watchArgs, args[i])
+		}
+	}
+	return watchArgs, runArgs
+}
+
+func isWatchFlag(name string) bool {
+	for _, f := range watchFlags {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+// imageWatcher processes images as they are added to a directory. New images are
+// collected until no image has arrived for the debounce period, then every image whose
+// size has stopped changing is processed as one batch. Each batch's kept chunks are
+// appended to result.md and its counts added to dedupe_report.json, with a persistent
+// dedup state dropping chunks seen in earlier batches. Chunk IDs restart in every
+// batch, so they are prefixed with the batch number (b3-c0001).
+type imageWatcher struct {
+	cfg       runConfig
+	inputDir  string // Absolute input directory that --include and --exclude are relative to
+	sortMode  ingest.SortMode
+	debounce  time.Duration
+	settle    time.Duration
+	process   func(ctx context.Context, images []string) error // Runs a batch; swapped in tests
+	processed map[string]bool
+	pending   map[string]bool
+	batches   int // Batches processed so far, by this and earlier watches
+}
+
+// newImageWatcher returns a watcher for cfg.InputDir, loading the images processed by
+// an earlier watch of the same output directory.
+func newImageWatcher(cfg runConfig, debounce, settle time.Duration) (*imageWatcher, error) {
+	if cfg.DryRun {
+		return nil, fmt.Errorf("--dry-run is not supported by watch")
+	}
+	if cfg.InputTextGlob != "" {
+		return nil, fmt.Errorf("--input-text-glob is not supported by watch")
+	}
+	if cfg.OrderFile != "" {
+		return nil, fmt.Errorf("--order-file is not supported by watch")
+	}
+	if len(cfg.InputPDFs) > 0 {
+		return nil, fmt.Errorf("--input-pdf is not supported by watch")
+	}
+	if cfg.DedupStatePath == "" {
+		cfg.DedupStatePath = filepath.Join(cfg.OutputDir, watchStateFile)
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	inputDir, err := filepath.Abs(cfg.InputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve input directory: %w", err)
+	}
+	sortMode, err := ingest.ParseSortMode(cfg.SortMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --sort-mode: %w", err)
+	}
+
+	w := &imageWatcher{
+		cfg:       cfg,
+		inputDir:  inputDir,
+		sortMode:  sortMode,
+		debounce:  debounce,
+		settle:    settle,
+		processed: map[string]bool{},
+		pending:   map[string]bool{},
+	}
+	w.process = w.processBatch
+	data, err := os.ReadFile(filepath.Join(cfg.OutputDir, watchProcessedFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read processed image list: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			w.processed[line] = true
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(cfg.OutputDir, watchBatchesFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read batch count: %w", err)
+	}
+	if len(data) > 0 {
+		if w.batches, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil || w.batches < 0 {
+			return nil, fmt.Errorf("invalid batch count %q in %s", strings.TrimSpace(string(data)), watchBatchesFile)
+		}
+	}
+	return w, nil
+}
+
+// run watches the input directory until ctx is done. Images already in the directory
+// that no earlier watch processed form the first batch.
+func (w *imageWatcher) run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer func() { _ = fsw.Close() }()
+
+	if err := w.addDir(fsw, w.inputDir); err != nil {
+		return err
+	}
+	logInfo(w.cfg.logger, "watching %s for new images (debounce %v)", w.inputDir, w.debounce)
+
+	timer := time.NewTimer(w.debounce)
+	if len(w.pending) == 0 {
+		timer.Stop()
+	}
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo(w.cfg.logger, "watch stopped")
+			return nil
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			logWarn(w.cfg.logger, "watch error: %v", err)
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if w.handleEvent(fsw, event) {
+				timer.Reset(w.debounce)
+			}
+		case <-timer.C:
+			if batch := w.settledImages(); len(batch) > 0 {
+				w.runBatch(ctx, batch)
+			}
+			if len(w.pending) > 0 {
+				timer.Reset(w.debounce)
+			}
+		}
+	}
+}
+
+// handleEvent updates the pending images for a filesystem event and reports whether
+// the quiet period should restart.
+func (w *imageWatcher) handleEvent(fsw *fsnotify.Watcher, event fsnotify.Event) bool {
+	path := event.Name
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		delete(w.pending, path)
+		return false
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		if !w.cfg.Recursive || !event.Has(fsnotify.Create) || !w.matches(path, true) {
+			return false
+		}
+		before := len(w.pending)
+		if err := w.addDir(fsw, path); err != nil {
+			logWarn(w.cfg.logger, "%v", err)
+		}
+		return len(w.pending) > before
+	}
+	if !ingest.IsImage(path) || w.processed[path] || !w.matches(path, false) {
+		return false
+	}
+	w.pending[path] = true
+	return true
+}
+
+// matches reports whether path passes --include and --exclude, as in ListImagesWithOptions.
+func (w *imageWatcher) matches(path string, isDir bool) bool {
+	rel, err := filepath.Rel(w.inputDir, path)
+	if err != nil {
+		return false
+	}
+	opts := ingest.ListOptions{Include: w.cfg.Include, Exclude: w.cfg.Exclude}
+	return opts.Matches(filepath.ToSlash(rel), isDir)
+}
+
+// addDir watches dir, and its subdirectories with --recursive, and queues the
+// unprocessed images already in them.
+func (w *imageWatcher) addDir(fsw *fsnotify.Watcher, dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (!w.cfg.Recursive || !w.matches(path, true)) {
+				return filepath.SkipDir
+			}
+			if err := fsw.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			return nil
+		}
+		if ingest.IsImage(path) && !w.processed[path] && w.matches(path, false) {
+			w.pending[path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	return nil
+}
+
+// settledImages removes and returns, in --sort-mode and --reverse order, the pending
+// images whose size is non-zero and unchanged over the settle interval. Images still
+// being written stay pending; images that disappeared are dropped.
+func (w *imageWatcher) settledImages() []string {
+	sizes := make(map[string]int64, len(w.pending))
+	for path := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		sizes[path] = info.Size()
+	}
+	time.Sleep(w.settle)
+
+	var ready []string
+	for path, size := range sizes {
+		info, err := os.Stat(path)
+		if err == nil && size > 0 && info.Size() == size {
+			ready = append(ready, path)
+			delete(w.pending, path)
+		}
+	}
+	sorted, err := ingest.SortImages(ready, w.sortMode)
+	if err != nil {
+		logWarn(w.cfg.logger, "failed to sort images by %s, using natural order: %v", w.sortMode, err)
+		sorted = ingest.NaturalSort(ready)
+	}
+	if w.cfg.Reverse {
+		slices.Reverse(sorted)
+	}
+	return sorted
+}
+
+// runBatch processes a batch and records its images as processed. A failed batch is
+// logged and its images are left unrecorded, so the next watch retries them.
+func (w *imageWatcher) runBatch(ctx context.Context, images []string) {
+	logInfo(w.cfg.logger, "processing %d new images", len(images))
+	if err := w.process(ctx, images); err != nil {
+		logWarn(w.cfg.logger, "failed to process batch of %d images: %v", len(images), err)
+		return
+	}
+	for _, path := range images {
+		w.processed[path] = true
+	}
+	if err := w.saveProcessed(); err != nil {
+		logWarn(w.cfg.logger, "%v", err)
+	}
+}
+
+// saveProcessed writes the processed image list, sorted.
+func (w *imageWatcher) saveProcessed() error {
+	paths := make([]string, 0, len(w.processed))
+	for path := range w.processed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	data := strings.Join(paths, "\n") + "\n"
+	if err := fsutil.WriteFileAtomic(filepath.Join(w.cfg.OutputDir, watchProcessedFile), []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to write processed image list: %w", err)
+	}
+	return nil
+}
+
+// processBatch runs the pipeline on images in a temporary directory inside the output
+// directory, then appends the kept chunks to result.md and merges the batch's report
+// into dedupe_report.json. The run updates a copy of the dedup state, which replaces
+// the watch's state only once the results are recorded, so a failed batch is not
+// dropped as a duplicate of itself when retried. The temporary directory is kept if
+// the batch fails.
+func (w *imageWatcher) processBatch(ctx context.Context, images []string) error {
+	batchDir, err := os.MkdirTemp(w.cfg.OutputDir, ".watch-batch-*")
+	if err != nil {
+		return fmt.Errorf("failed to create batch directory: %w", err)
+	}
+	batchState := filepath.Join(batchDir, watchStateFile)
+	state, err := os.ReadFile(w.cfg.DedupStatePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read dedup state: %w", err)
+	}
+	if err == nil {
+		if err := os.WriteFile(batchState, state, 0644); err != nil {
+			return fmt.Errorf("failed to copy dedup state: %w", err)
+		}
+	}
+
+	cfg := w.cfg
+	cfg.Images = images
+	cfg.OutputDir = batchDir
+	cfg.DedupStatePath = batchState
+	cfg.ChunkIDPrefix = fmt.Sprintf("b%d-", w.batches+1)
+	cfg.OutputFormat = "json"
+	cfg.ReportFormat = "json"
+	cfg.AppendSummary = false
+	cfg.ExactFirstPreview = false
+	cfg.DumpConfig = false
+	if err := runCommand(ctx, cfg); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(batchDir, "result.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read batch result: %w", err)
+	}
+	var kept []text.Chunk
+	if err := json.Unmarshal(data, &kept); err != nil {
+		return fmt.Errorf("failed to parse batch result: %w", err)
+	}
+	state, err = os.ReadFile(batchState)
+	if err != nil {
+		return fmt.Errorf("failed to read batch dedup state: %w", err)
+	}
+	markdownPath := filepath.Join(w.cfg.OutputDir, "result.md")
+	if err := appendResultMarkdown(w.cfg, kept, len(images), markdownPath); err != nil {
+		return err
+	}
+
+	reportPath := filepath.Join(w.cfg.OutputDir, "dedupe_report.json")
+	if err := mergeBatchReport(filepath.Join(batchDir, "dedupe_report.json"), reportPath); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(w.cfg.DedupStatePath, state, 0644); err != nil {
+		return fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	w.batches++
+	if err := fsutil.WriteFileAtomic(filepath.Join(w.cfg.OutputDir, watchBatchesFile), []byte(strconv.Itoa(w.batches)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write batch count: %w", err)
+	}
+	logInfo(w.cfg.logger, "appended %d chunks to %s", len(kept), markdownPath)
+
+	if err := os.RemoveAll(batchDir); err != nil {
+		logWarn(w.cfg.logger, "failed to remove %s: %v", batchDir, err)
+	}
+	return nil
+}
+
+// appendResultMarkdown appends chunks to the Markdown file at path, after a blank
+// line and without repeating the title, frontmatter or table of contents. A missing
+// file is written in full, as by run.
+func appendResultMarkdown(cfg runConfig, chunks []text.Chunk, imageCount int, path string) error {
+	opts := markdownOptions(cfg, imageCount)
+	if _, err := os.Stat(path); err == nil {
+		if len(chunks) == 0 {
+			return nil
+		}
+		opts.IncludeTOC = false
+	}
+	return text.AppendMarkdown(text.RenderMarkdownWithOptions(cfg.MarkdownTitle, chunks, opts), path)
+}
+
+// mergeBatchReport adds the report at batchPath to the report at totalPath, which is
+// created if missing.
+func mergeBatchReport(batchPath, totalPath string) error {
+	batch, err := report.ReadReport(batchPath)
+	if err != nil {
+		return err
+	}
+	total := batch
+	if _, err := os.Stat(totalPath); err == nil {
+		prev, err := report.ReadReport(totalPath)
+		if err != nil {
+			return err
+		}
+		total = report.MergeReports(prev, batch)
+	}
+	return report.WriteReportJSON(total, totalPath)
+}
@@ -1,3 +1,12 @@
 module github.com/jonkmatsumo/bulk-ocr
 
 go 1.23
+
+require golang.org/x/text v0.21.0
+
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// Cache is a file-based store of OCR text keyed by image content hash.
+// Each entry is a plain text file named after the key inside the cache directory.
+type Cache struct {
+	dir string
+}
+
+// New creates a Cache rooted at dir, creating the directory if needed.
+func New(dir string) (*Cache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("cache directory must not be empty")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the cache directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// HashFile returns the hex-encoded SHA-256 of a file's contents.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for hashing: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Key builds a cache key from an image content hash and OCR language.
+// The language is part of the key because the same image OCRs differently per language.
+func Key(contentHash, lang string) string {
+	return contentHash + "-" + strings.ReplaceAll(lang, string(filepath.Separator), "_")
+}
+
+// Get returns the cached text for key. The bool is false on a cache miss.
+func (c *Cache) Get(key string) (string, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read cache entry %s: %w", key, err)
+	}
+	return string(data), true, nil
+}
+
+// Put stores text under key, replacing any existing entry.
+func (c *Cache) Put(key, text string) error {
+	if err := fsutil.WriteFileAtomic(c.path(key), []byte(text), 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry %s: %w", key, err)
+	}
+	return nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".txt")
+}
+
+// SplitPages splits pdftotext output into per-page text using form feeds.
+// pdftotext terminates every page with a form feed, so a trailing empty segment is dropped.
+// Returns false if the page count does not match n.
+func SplitPages(text string, n int) ([]string, bool) {
+	pages := strings.Split(text, "\f")
+	if len(pages) == n+1 && strings.TrimSpace(pages[n]) == "" {
+		pages = pages[:n]
+	}
+	if len(pages) != n {
+		return nil, false
+	}
+	return pages, true
+}
+
+// JoinPages reassembles per-page text into pdftotext's form-feed separated layout.
+func JoinPages(pages []string) string {
+	if len(pages) == 0 {
+		return ""
+	}
+	return strings.Join(pages, "\f") + "\f"
+}
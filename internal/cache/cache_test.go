@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNew_CreatesDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested", "cache")
+	c, err := New(dir)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if c.Dir() != dir {
+		t.Errorf("expected dir %s, got %s", dir, c.Dir())
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("cache directory was not created: %v", err)
+	}
+}
+
+func TestNew_EmptyDir(t *testing.T) {
+	if _, err := New(""); err == nil {
+		t.Error("expected error for empty cache directory")
+	}
+}
+
+func TestHashFile_SameContentSameHash(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.png")
+	b := filepath.Join(dir, "b.png")
+	c := filepath.Join(dir, "c.png")
+	if err := os.WriteFile(a, []byte("image bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("image bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c, []byte("other bytes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashA, err := HashFile(a)
+	if err != nil {
+		t.Fatalf("HashFile failed: %v", err)
+	}
+	hashB, _ := HashFile(b)
+	hashC, _ := HashFile(c)
+
+	if len(hashA) != 64 {
+		t.Errorf("expected 64-char SHA-256 hex, got %d chars", len(hashA))
+	}
+	if hashA != hashB {
+		t.Error("identical content should produce identical hashes")
+	}
+	if hashA == hashC {
+		t.Error("different content should produce different hashes")
+	}
+}
+
+func TestHashFile_Missing(t *testing.T) {
+	if _, err := HashFile(filepath.Join(t.TempDir(), "missing.png")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestCache_GetPut(t *testing.T) {
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key("abc123", "eng")
+
+	if _, ok, err := c.Get(key); err != nil || ok {
+		t.Fatalf("expected miss on empty cache, got ok=%v err=%v", ok, err)
+	}
+
+	if err := c.Put(key, "page text"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	got, ok, err := c.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("expected hit, got ok=%v err=%v", ok, err)
+	}
+	if got != "page text" {
+		t.Errorf("expected 'page text', got %q", got)
+	}
+
+	// Entry is stored under the hash as filename
+	if _, err := os.Stat(filepath.Join(c.Dir(), key+".txt")); err != nil {
+		t.Errorf("expected cache file named after key: %v", err)
+	}
+}
+
+func TestKey_IncludesLanguage(t *testing.T) {
+	if Key("abc", "eng") == Key("abc", "fra") {
+		t.Error("keys for different languages should differ")
+	}
+}
+
+func TestSplitPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		n     int
+		want  []string
+		match bool
+	}{
+		{"TrailingFormFeed", "one\ftwo\f", 2, []string{"one", "two"}, true},
+		{"NoTrailingFormFeed", "one\ftwo", 2, []string{"one", "two"}, true},
+		{"SinglePageNoFormFeed", "only page", 1, []string{"only page"}, true},
+		{"CountMismatch", "one\ftwo\fthree\f", 2, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SplitPages(tt.text, tt.n)
+			if ok != tt.match {
+				t.Fatalf("expected ok=%v, got %v", tt.match, ok)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestJoinPages_RoundTrip(t *testing.T) {
+	text := "first page\fsecond page\f"
+	pages, ok := SplitPages(text, 2)
+	if !ok {
+		t.Fatal("SplitPages failed")
+	}
+	if got := JoinPages(pages); got != text {
+		t.Errorf("expected %q, got %q", text, got)
+	}
+	if JoinPages(nil) != "" {
+		t.Error("expected empty string for no pages")
+	}
+}
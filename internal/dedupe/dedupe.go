@@ -1,44 +1,96 @@
 package dedupe
 
 import (
+	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"math/bits"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
 
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
 	"github.com/jonkmatsumo/bulk-ocr/internal/text"
 )
 
 // DedupeResult contains the deduplicated chunks and metadata.
 type DedupeResult struct {
 	KeptChunks []text.Chunk
-	Dropped    []DroppedChunk
+	Dropped    []DroppedChunk // In input order, whatever the method, so reports diff cleanly
 	Stats      Stats
+
+	// DroppedRefs maps the ID of each kept chunk that absorbed duplicates to the IDs
+	// of the dropped chunks collapsed into it, in the order of Dropped. Cross-run
+	// duplicates, which match no kept chunk, are left out.
+	DroppedRefs map[string][]string
 }
 
 // DroppedChunk represents a chunk that was removed during deduplication.
 type DroppedChunk struct {
-	ChunkID        string // Original chunk ID (e.g., "c0005")
-	Reason         string // "exact_duplicate" or "near_duplicate"
-	MatchedChunkID string // ID of chunk it matched (if near-duplicate)
-	Distance       int    // Hamming distance (if near-duplicate, 0 if exact)
-	Preview        string // Truncated text preview (200 chars max)
+	ChunkID        string  // Original chunk ID (e.g., "c0005")
+	Reason         string  // "exact_duplicate" or "near_duplicate"
+	MatchedChunkID string  // ID of the kept chunk it collapsed into (a "run<N>/<ID>" reference to an earlier run, for cross-run duplicates)
+	Distance       int     // Hamming distance (if near-duplicate, 0 if exact)
+	Similarity     float64 `json:"Similarity,omitempty"` // Jaccard similarity (minhash, estimated, and jaccard), or Levenshtein ratio (short chunks)
+	Preview        string  // Truncated text preview (200 chars max)
+	SourceFile     string  `json:"SourceFile,omitempty"` // Original image of the chunk's page, when known
 }
 
-// Stats contains deduplication statistics.
+// Stats contains deduplication statistics. Every input chunk is either kept or
+// dropped once, so KeptCount + DroppedCount == InputCount, and each dropped chunk is
+// counted under exactly one of ExactDups, NearDups and CrossRunDups.
 type Stats struct {
 	InputCount   int
 	KeptCount    int
 	DroppedCount int
 	ExactDups    int
 	NearDups     int
+	CrossRunDups int // Dropped because they matched a previous run (see DedupeWithState)
+
+	// DistanceHistogram counts chunks by Hamming distance to their nearest kept chunk in
+	// the SimHash window, when Config.DistanceHistogram is set (simhash and both methods).
+	// Exact duplicates count as distance 0; -1 counts chunks with no kept chunk to compare,
+	// and chunks below Config.ShortChunkLength, which are not compared by SimHash.
+	DistanceHistogram map[int]int
 }
 
 // Config holds deduplication configuration.
 type Config struct {
-	Method           string // "exact", "simhash", or "both" (default: "simhash")
-	SimHashK         int    // Character k-gram size (default: 5)
-	SimHashThreshold int    // Hamming distance threshold (default: 6)
-	Window           int    // Sliding window size (default: 250)
+	Method           string  // "exact", "simhash", "both", "minhash", or "jaccard" (default: "simhash")
+	SimHashK         int     // Character k-gram size (default: 5)
+	SimHashThreshold int     // Hamming distance threshold (default: 6)
+	Window           int     // Sliding window size (default: 250, 0 = compare all, -1 = indexed global)
+	ShingleK         int     // Character shingle size for MinHash and Jaccard (default: 5)
+	MinHashNumHashes int     // Number of MinHash functions (default: 128)
+	MinHashBands     int     // LSH bands; must divide MinHashNumHashes (default: 16)
+	MinHashThreshold float64 // Minimum estimated Jaccard similarity to drop (default: 0.7)
+	JaccardThreshold float64 // Jaccard similarity above which the jaccard method drops, 0 to 1 (default: 0.8)
+	ExactHash        string  // Exact-match hash: "sha1", "sha256", or "fnv" (default: "sha1")
+	KeepStrategy     string  // Duplicate group representative: "first" or "longest" (default: "first")
+
+	// ShortChunkLength is the Norm length in runes below which SimHash compares chunks by
+	// Levenshtein ratio instead: text shorter than SimHashK has no k-grams, so all such
+	// chunks would share one signature (default, and minimum: SimHashK).
+	ShortChunkLength int
+	// ShortChunkRatio is the minimum Levenshtein ratio (1 - edits / longer length) at
+	// which a short chunk is dropped as a near-duplicate, 0 to 1 (default: 0.8).
+	ShortChunkRatio float64
+
+	// DistanceHistogram records each chunk's nearest-neighbor SimHash distance in
+	// Stats.DistanceHistogram. With GlobalWindow this scans every kept signature.
+	DistanceHistogram bool
+
+	// OnExactPass, if set, is called by Dedupe with the chunks kept by the exact-hash
+	// pass, before any near-duplicate pass runs. Useful for quick previews. With
+	// ParallelBoth it is called from its own goroutine while the SimHash pass runs.
+	OnExactPass func(kept []text.Chunk)
+
+	// ParallelBoth runs the exact and SimHash passes of the "both" method concurrently.
+	// The result is identical to running them one after the other.
+	ParallelBoth bool
 }
 
 // DefaultConfig returns a Config with default values.
@@ -48,6 +100,15 @@ func DefaultConfig() Config {
 		SimHashK:         5,
 		SimHashThreshold: 6,
 		Window:           250,
+		ShingleK:         5,
+		MinHashNumHashes: 128,
+		MinHashBands:     16,
+		MinHashThreshold: 0.7,
+		JaccardThreshold: 0.8,
+		ExactHash:        "sha1",
+		KeepStrategy:     "first",
+		ShortChunkLength: 5,
+		ShortChunkRatio:  0.8,
 	}
 }
 
@@ -62,69 +123,192 @@ func (c *Config) Validate() {
 	if c.SimHashThreshold > 64 {
 		c.SimHashThreshold = 64
 	}
-	if c.Window < 0 {
+	if c.Window < GlobalWindow {
 		c.Window = 250
 	}
-	if c.Method != "exact" && c.Method != "simhash" && c.Method != "both" {
+	if c.Method != "exact" && c.Method != "simhash" && c.Method != "both" && c.Method != "minhash" && c.Method != "jaccard" {
 		c.Method = "simhash"
 	}
+	if c.ShingleK <= 0 {
+		c.ShingleK = 5
+	}
+	if c.MinHashNumHashes <= 0 {
+		c.MinHashNumHashes = 128
+	}
+	if c.MinHashBands <= 0 || c.MinHashBands > c.MinHashNumHashes || c.MinHashNumHashes%c.MinHashBands != 0 {
+		// Fall back to the largest divisor of the hash count not exceeding the default
+		c.MinHashBands = 1
+		for b := 16; b > 1; b-- {
+			if b <= c.MinHashNumHashes && c.MinHashNumHashes%b == 0 {
+				c.MinHashBands = b
+				break
+			}
+		}
+	}
+	if c.MinHashThreshold <= 0 || c.MinHashThreshold > 1 {
+		c.MinHashThreshold = 0.7
+	}
+	if c.ShortChunkLength < c.SimHashK {
+		c.ShortChunkLength = c.SimHashK
+	}
+	if c.ShortChunkRatio <= 0 || c.ShortChunkRatio > 1 {
+		c.ShortChunkRatio = 0.8
+	}
+	if c.JaccardThreshold < 0 || c.JaccardThreshold > 1 {
+		c.JaccardThreshold = 0.8
+	}
+	if c.ExactHash != "sha1" && c.ExactHash != "sha256" && c.ExactHash != "fnv" {
+		c.ExactHash = "sha1"
+	}
+	if c.KeepStrategy != "first" && c.KeepStrategy != "longest" {
+		c.KeepStrategy = "first"
+	}
+}
+
+// exactHashKey returns the map key for normalized text under the given hash algorithm.
+func exactHashKey(norm string, algo string) string {
+	switch algo {
+	case "sha256":
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(norm)))
+	case "fnv":
+		return strconv.FormatUint(fnv1a64([]byte(norm)), 16)
+	default:
+		return fmt.Sprintf("%x", sha1.Sum([]byte(norm)))
+	}
 }
 
-// exactHashDedupe removes exact duplicates using SHA1 hash of normalized text.
-func exactHashDedupe(chunks []text.Chunk) ([]text.Chunk, []DroppedChunk) {
+// exactHashDedupe removes exact duplicates using a hash of normalized text (see Config.ExactHash).
+func exactHashDedupe(chunks []text.Chunk, config Config) ([]text.Chunk, []DroppedChunk) {
 	if len(chunks) == 0 {
 		return []text.Chunk{}, []DroppedChunk{}
 	}
 
-	seen := make(map[string]string) // hash -> chunk ID
+	m := newExactMatcher(config)
 	var kept []text.Chunk
 	var dropped []DroppedChunk
 
 	for _, chunk := range chunks {
-		// Handle empty normalized text
-		if chunk.Norm == "" {
-			// Keep empty chunks (edge case, shouldn't happen after normalization)
+		if d, dup := m.check(chunk); dup {
+			dropped = append(dropped, d)
+		} else {
+			m.commit()
 			kept = append(kept, chunk)
+		}
+	}
+
+	if config.KeepStrategy == "longest" {
+		kept, dropped = keepLongest(chunks, kept, dropped, func(_, _ int) int { return 0 })
+	}
+
+	return kept, dropped
+}
+
+// keepLongest re-elects the representative of each duplicate group as its longest chunk.
+// Groups are formed by the first-occurrence pass: a kept chunk plus every dropped chunk
+// matched to it. The kept slice stays in document order, and every other group member is
+// dropped against the new representative, with distance recomputed by distance(i, j)
+// over indexes into chunks. Ties keep the earliest chunk.
+func keepLongest(chunks []text.Chunk, kept []text.Chunk, dropped []DroppedChunk, distance func(i, j int) int) ([]text.Chunk, []DroppedChunk) {
+	if len(dropped) == 0 {
+		return kept, dropped
+	}
+
+	position := make(map[string]int, len(chunks)) // chunk ID -> index in chunks
+	for i, chunk := range chunks {
+		position[chunk.ID] = i
+	}
+
+	// Elect the longest member of each group, keyed by the first-occurrence ID
+	representative := make(map[string]int, len(kept))
+	for _, chunk := range kept {
+		representative[chunk.ID] = position[chunk.ID]
+	}
+	reasons := make(map[int]DroppedChunk, len(dropped)) // chunk index -> original drop record
+	for _, d := range dropped {
+		i := position[d.ChunkID]
+		reasons[i] = d
+		best, ok := representative[d.MatchedChunkID]
+		if !ok {
 			continue
 		}
+		if utf8.RuneCountInString(chunks[i].Text) > utf8.RuneCountInString(chunks[best].Text) {
+			representative[d.MatchedChunkID] = i
+		}
+	}
 
-		// Compute SHA1 hash of normalized text
-		hash := sha1.Sum([]byte(chunk.Norm))
-		hashStr := fmt.Sprintf("%x", hash)
+	// groupOf maps every member to its group's first-occurrence ID
+	groupOf := make(map[int]string, len(chunks))
+	for _, chunk := range kept {
+		groupOf[position[chunk.ID]] = chunk.ID
+	}
+	for i, d := range reasons {
+		if _, ok := representative[d.MatchedChunkID]; ok {
+			groupOf[i] = d.MatchedChunkID
+		}
+	}
 
-		// Check if we've seen this hash before
-		if existingID, exists := seen[hashStr]; exists {
-			// This is an exact duplicate
-			preview := chunk.Text
-			if len(preview) > 200 {
-				preview = preview[:200] + "..."
+	// Rebuild both slices in document order
+	var newKept []text.Chunk
+	var newDropped []DroppedChunk
+	for i, chunk := range chunks {
+		group, inGroup := groupOf[i]
+		if !inGroup {
+			if d, ok := reasons[i]; ok {
+				newDropped = append(newDropped, d) // matched outside this pass; leave as is
 			}
-			dropped = append(dropped, DroppedChunk{
-				ChunkID:        chunk.ID,
-				Reason:         "exact_duplicate",
-				MatchedChunkID: existingID,
-				Distance:       0,
-				Preview:        preview,
-			})
-		} else {
-			// First occurrence, keep it
-			seen[hashStr] = chunk.ID
-			kept = append(kept, chunk)
+			continue
+		}
+		rep := representative[group]
+		if i == rep {
+			newKept = append(newKept, chunk)
+			continue
+		}
+		reason := "exact_duplicate"
+		if d, ok := reasons[i]; ok {
+			reason = d.Reason
+		} else if d, ok := reasons[rep]; ok {
+			// The displaced first occurrence inherits the reason its replacement was dropped for
+			reason = d.Reason
 		}
+		preview := chunk.Text
+		if len(preview) > 200 {
+			preview = preview[:200] + "..."
+		}
+		newDropped = append(newDropped, DroppedChunk{
+			ChunkID:        chunk.ID,
+			Reason:         reason,
+			MatchedChunkID: chunks[rep].ID,
+			Distance:       distance(i, rep),
+			Preview:        preview,
+			SourceFile:     chunk.SourceFile,
+		})
 	}
 
-	return kept, dropped
+	return newKept, newDropped
 }
 
-// generateKgrams generates character k-grams from text.
+// generateKgrams generates the contiguous k-grams of text, each k runes long, so
+// multi-byte UTF-8 such as accented letters or CJK is never split mid-rune. Text of
+// n runes gives n-k+1 k-grams, or none if n < k.
 func generateKgrams(text string, k int) []string {
 	if k <= 0 || len(text) < k {
 		return []string{}
 	}
 
-	var kgrams []string
-	for i := 0; i <= len(text)-k; i++ {
-		kgrams = append(kgrams, text[i:i+k])
+	// Byte offset of each rune start, and of the end of text
+	offsets := make([]int, 0, len(text)+1)
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	runes := len(offsets)
+	if runes < k {
+		return []string{}
+	}
+	offsets = append(offsets, len(text))
+
+	kgrams := make([]string, 0, runes-k+1)
+	for i := 0; i+k <= runes; i++ {
+		kgrams = append(kgrams, text[offsets[i]:offsets[i+k]])
 	}
 
 	return kgrams
@@ -146,7 +330,8 @@ func fnv1a64(data []byte) uint64 {
 	return hash
 }
 
-// simhash64 computes SimHash signature for text using k-grams.
+// simhash64 computes SimHash signature for text using k-grams of k runes. Text
+// shorter than k runes has no k-grams and signs as 0.
 func simhash64(text string, k int) uint64 {
 	if text == "" || k <= 0 {
 		return 0
@@ -191,68 +376,42 @@ func hammingDistance(a, b uint64) int {
 
 // simhashDedupe removes near-duplicates using SimHash with sliding window.
 func simhashDedupe(chunks []text.Chunk, config Config) ([]text.Chunk, []DroppedChunk) {
+	return simhashDedupeHistogram(chunks, config, nil)
+}
+
+// simhashDedupeHistogram is simhashDedupe that also counts each chunk's nearest
+// kept-chunk distance in hist, if hist is non-nil.
+func simhashDedupeHistogram(chunks []text.Chunk, config Config, hist map[int]int) ([]text.Chunk, []DroppedChunk) {
 	if len(chunks) == 0 {
 		return []text.Chunk{}, []DroppedChunk{}
 	}
 
-	// Pre-compute SimHash signatures for all chunks
+	m := newSimhashMatcher(config)
+	m.trackNearest = hist != nil
 	signatures := make([]uint64, len(chunks))
-	for i, chunk := range chunks {
-		signatures[i] = simhash64(chunk.Norm, config.SimHashK)
-	}
-
 	var kept []text.Chunk
-	var keptSignatures []uint64 // Parallel array for signatures
 	var dropped []DroppedChunk
 
-	// Sliding window: maintain last N kept chunks
-	windowSize := config.Window
-	if windowSize == 0 {
-		windowSize = len(chunks) // Compare against all if window is 0
-	}
-
 	for i, chunk := range chunks {
-		sig := signatures[i]
-		matched := false
-		var matchedChunkID string
-		minDistance := 65 // Larger than max possible (64)
-
-		// Compare with chunks in sliding window
-		windowStart := 0
-		if len(kept) > windowSize {
-			windowStart = len(kept) - windowSize
-		}
-
-		for j := windowStart; j < len(kept); j++ {
-			dist := hammingDistance(sig, keptSignatures[j])
-			if dist <= config.SimHashThreshold && dist < minDistance {
-				matched = true
-				matchedChunkID = kept[j].ID
-				minDistance = dist
-			}
+		sig, d, dup := m.check(chunk)
+		signatures[i] = sig
+		if hist != nil {
+			hist[m.nearest]++
 		}
-
-		if matched {
-			// Near-duplicate found
-			preview := chunk.Text
-			if len(preview) > 200 {
-				preview = preview[:200] + "..."
-			}
-			dropped = append(dropped, DroppedChunk{
-				ChunkID:        chunk.ID,
-				Reason:         "near_duplicate",
-				MatchedChunkID: matchedChunkID,
-				Distance:       minDistance,
-				Preview:        preview,
-			})
+		if dup {
+			dropped = append(dropped, d)
 		} else {
-			// Keep this chunk
+			m.commit()
 			kept = append(kept, chunk)
-			keptSignatures = append(keptSignatures, sig)
-			// Window size is maintained by adjusting windowStart in the comparison loop above
 		}
 	}
 
+	if config.KeepStrategy == "longest" {
+		kept, dropped = keepLongest(chunks, kept, dropped, func(i, j int) int {
+			return hammingDistance(signatures[i], signatures[j])
+		})
+	}
+
 	return kept, dropped
 }
 
@@ -276,22 +435,65 @@ func Dedupe(chunks []text.Chunk, config Config) DedupeResult {
 
 	var kept []text.Chunk
 	var dropped []DroppedChunk
+	var hist map[int]int
+	if config.DistanceHistogram && (config.Method == "simhash" || config.Method == "both") {
+		hist = make(map[int]int)
+	}
+
+	// exactPass runs the exact-hash pass and reports its result before any slower pass
+	exactPass := func() ([]text.Chunk, []DroppedChunk) {
+		exactKept, exactDropped := exactHashDedupe(chunks, config)
+		if config.OnExactPass != nil {
+			config.OnExactPass(exactKept)
+		}
+		return exactKept, exactDropped
+	}
 
 	switch config.Method {
 	case "exact":
-		kept, dropped = exactHashDedupe(chunks)
+		kept, dropped = exactPass()
 	case "simhash":
 		// Run exact hash pre-check first (fast path)
-		exactKept, exactDropped := exactHashDedupe(chunks)
+		exactKept, exactDropped := exactPass()
 		// Then run SimHash on remaining chunks
-		simhashKept, simhashDropped := simhashDedupe(exactKept, config)
+		if hist != nil && len(exactDropped) > 0 {
+			hist[0] += len(exactDropped)
+		}
+		simhashKept, simhashDropped := simhashDedupeHistogram(exactKept, config, hist)
 		kept = simhashKept
 		dropped = append(dropped, exactDropped...)
 		dropped = append(dropped, simhashDropped...)
+	case "minhash":
+		// Run exact hash pre-check first, then MinHash LSH on remaining chunks
+		exactKept, exactDropped := exactPass()
+		minhashKept, minhashDropped := minhashDedupe(exactKept, config)
+		kept = minhashKept
+		dropped = append(dropped, exactDropped...)
+		dropped = append(dropped, minhashDropped...)
+	case "jaccard":
+		// Run exact hash pre-check first, then exact Jaccard on remaining chunks
+		exactKept, exactDropped := exactPass()
+		jaccardKept, jaccardDropped := jaccardDedupe(exactKept, config)
+		kept = jaccardKept
+		dropped = append(dropped, exactDropped...)
+		dropped = append(dropped, jaccardDropped...)
 	case "both":
 		// Run both methods independently and combine
-		exactKept, exactDropped := exactHashDedupe(chunks)
-		simhashKept, simhashDropped := simhashDedupe(chunks, config)
+		var exactKept, simhashKept []text.Chunk
+		var exactDropped, simhashDropped []DroppedChunk
+		if config.ParallelBoth {
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				exactKept, exactDropped = exactPass()
+			}()
+			simhashKept, simhashDropped = simhashDedupeHistogram(chunks, config, hist)
+			wg.Wait()
+		} else {
+			exactKept, exactDropped = exactPass()
+			simhashKept, simhashDropped = simhashDedupeHistogram(chunks, config, hist)
+		}
 		// Combine: keep chunks that are kept by both methods
 		// This is more conservative - only keep if not duplicate by either method
 		exactKeptMap := make(map[string]bool)
@@ -309,30 +511,39 @@ func Dedupe(chunks []text.Chunk, config Config) DedupeResult {
 				bothKept = append(bothKept, chunk)
 			}
 		}
-		// Build dropped list from both methods
-		allDropped := append(exactDropped, simhashDropped...)
-		// Remove duplicates from dropped list (same chunk might be dropped by both)
-		droppedMap := make(map[string]DroppedChunk)
-		for _, d := range allDropped {
-			if existing, exists := droppedMap[d.ChunkID]; !exists || d.Distance < existing.Distance {
-				droppedMap[d.ChunkID] = d
-			}
+		// Build the dropped list from both methods. A chunk dropped by the exact pass is an
+		// exact duplicate, whether or not SimHash dropped it too, and keeps that record;
+		// otherwise it has the SimHash record of a near-duplicate. Either way it is counted
+		// once, so KeptCount + DroppedCount == InputCount.
+		droppedMap := make(map[string]DroppedChunk, len(exactDropped)+len(simhashDropped))
+		for _, d := range simhashDropped {
+			droppedMap[d.ChunkID] = d
+		}
+		for _, d := range exactDropped {
+			droppedMap[d.ChunkID] = d
 		}
+		// Emit in document order so the result does not depend on map iteration
 		var uniqueDropped []DroppedChunk
-		for _, d := range droppedMap {
-			uniqueDropped = append(uniqueDropped, d)
+		for _, chunk := range chunks {
+			if d, ok := droppedMap[chunk.ID]; ok {
+				uniqueDropped = append(uniqueDropped, d)
+				delete(droppedMap, chunk.ID)
+			}
 		}
 		kept = bothKept
 		dropped = uniqueDropped
 	default:
 		// Default to simhash
-		exactKept, exactDropped := exactHashDedupe(chunks)
+		exactKept, exactDropped := exactPass()
 		simhashKept, simhashDropped := simhashDedupe(exactKept, config)
 		kept = simhashKept
 		dropped = append(dropped, exactDropped...)
 		dropped = append(dropped, simhashDropped...)
 	}
 
+	dropped = resolveMatches(chunks, kept, dropped, config)
+	sortDropped(chunks, dropped)
+
 	// Count statistics
 	exactCount := 0
 	nearCount := 0
@@ -354,6 +565,147 @@ func Dedupe(chunks []text.Chunk, config Config) DedupeResult {
 			DroppedCount: len(dropped),
 			ExactDups:    exactCount,
 			NearDups:     nearCount,
+
+			DistanceHistogram: hist,
 		},
+		DroppedRefs: droppedRefs(kept, dropped),
+	}
+}
+
+// sortDropped sorts dropped into the order of their chunks in chunks, as passes that
+// run one after another report their drops pass by pass. Records of chunks not in
+// chunks go last, in their current order.
+func sortDropped(chunks []text.Chunk, dropped []DroppedChunk) {
+	position := make(map[string]int, len(chunks))
+	for i, chunk := range chunks {
+		position[chunk.ID] = i
+	}
+	pos := func(d DroppedChunk) int {
+		if i, ok := position[d.ChunkID]; ok {
+			return i
+		}
+		return len(chunks)
+	}
+	sort.SliceStable(dropped, func(i, j int) bool {
+		return pos(dropped[i]) < pos(dropped[j])
+	})
+}
+
+// droppedRefs returns the inverse of the MatchedChunkID links of dropped: for each
+// kept chunk, the dropped chunks matched to it. See DedupeResult.DroppedRefs.
+func droppedRefs(kept []text.Chunk, dropped []DroppedChunk) map[string][]string {
+	refs := make(map[string][]string)
+	keptIDs := make(map[string]bool, len(kept))
+	for _, chunk := range kept {
+		keptIDs[chunk.ID] = true
+	}
+	for _, d := range dropped {
+		if keptIDs[d.MatchedChunkID] {
+			refs[d.MatchedChunkID] = append(refs[d.MatchedChunkID], d.ChunkID)
+		}
+	}
+	return refs
+}
+
+// resolveMatches points the MatchedChunkID of each dropped chunk at a kept chunk. A
+// pass can match a chunk that a later pass drops, such as an exact duplicate of a
+// chunk SimHash then drops as a near-duplicate; such chains are followed to the kept
+// chunk at their end, and the record is recomputed against that chunk by rematch,
+// as its text may differ from the chunk matched directly. Records whose chain reaches
+// no kept chunk are left as they are.
+func resolveMatches(chunks, kept []text.Chunk, dropped []DroppedChunk, config Config) []DroppedChunk {
+	keptIDs := make(map[string]bool, len(kept))
+	for _, chunk := range kept {
+		keptIDs[chunk.ID] = true
+	}
+	byChunkID := make(map[string]text.Chunk, len(chunks))
+	for _, chunk := range chunks {
+		byChunkID[chunk.ID] = chunk
+	}
+	byID := make(map[string]DroppedChunk, len(dropped))
+	for _, d := range dropped {
+		byID[d.ChunkID] = d
+	}
+
+	resolved := make([]DroppedChunk, len(dropped))
+	for i, d := range dropped {
+		target := d.MatchedChunkID
+		// Bounded in case of a cycle
+		for steps := 0; !keptIDs[target] && steps < len(dropped); steps++ {
+			next, ok := byID[target]
+			if !ok {
+				break
+			}
+			target = next.MatchedChunkID
+		}
+		if keptIDs[target] && target != d.MatchedChunkID {
+			chunk, ok := byChunkID[d.ChunkID]
+			root, rootOK := byChunkID[target]
+			if ok && rootOK {
+				d = rematch(chunk, root, config)
+			} else {
+				d.MatchedChunkID = target
+			}
+		}
+		resolved[i] = d
+	}
+	return resolved
+}
+
+// CheckMatches verifies that the MatchedChunkID of every dropped chunk names a chunk
+// in KeptChunks, so that each dropped chunk can be traced to the text that replaced
+// it. Cross-run duplicates, which match chunks of earlier runs, are not checked.
+func (r DedupeResult) CheckMatches() error {
+	keptIDs := make(map[string]bool, len(r.KeptChunks))
+	for _, chunk := range r.KeptChunks {
+		keptIDs[chunk.ID] = true
+	}
+	for _, d := range r.Dropped {
+		if d.Reason == "cross_run_duplicate" {
+			continue
+		}
+		if d.MatchedChunkID == "" {
+			return fmt.Errorf("dropped chunk %s has no matched chunk", d.ChunkID)
+		}
+		if !keptIDs[d.MatchedChunkID] {
+			return fmt.Errorf("dropped chunk %s matches %s, which was not kept", d.ChunkID, d.MatchedChunkID)
+		}
+	}
+	return nil
+}
+
+// keptChunkEntry is one line of the kept chunks JSONL.
+type keptChunkEntry struct {
+	ID          string   `json:"id"`
+	Text        string   `json:"text"`
+	Norm        string   `json:"norm"`
+	Index       int      `json:"index"`
+	Page        int      `json:"page"`
+	DroppedRefs []string `json:"dropped_refs,omitempty"`
+}
+
+// WriteKeptChunksJSONL writes the kept chunks of result to a JSONL file, one object
+// per line with the chunk's id, text, norm, index and page, and the dropped_refs
+// collapsed into it (see DedupeResult.DroppedRefs) when there are any.
+func WriteKeptChunksJSONL(result DedupeResult, path string) error {
+	var b bytes.Buffer
+	for _, chunk := range result.KeptChunks {
+		data, err := json.Marshal(keptChunkEntry{
+			ID:          chunk.ID,
+			Text:        chunk.Text,
+			Norm:        chunk.Norm,
+			Index:       chunk.Index,
+			Page:        chunk.Page,
+			DroppedRefs: result.DroppedRefs[chunk.ID],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal chunk %s: %w", chunk.ID, err)
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	if err := fsutil.WriteFileAtomic(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write kept chunks JSONL: %w", err)
 	}
+	return nil
 }
@@ -1,14 +1,20 @@
 package dedupe
 
 import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/jonkmatsumo/bulk-ocr/internal/text"
 )
 
 func TestExactHashDedupe_EmptyInput(t *testing.T) {
-	kept, dropped := exactHashDedupe([]text.Chunk{})
+	kept, dropped := exactHashDedupe([]text.Chunk{}, DefaultConfig())
 	if len(kept) != 0 {
 		t.Errorf("expected 0 kept chunks, got %d", len(kept))
 	}
@@ -21,7 +27,7 @@ func TestExactHashDedupe_SingleChunk(t *testing.T) {
 	chunks := []text.Chunk{
 		{ID: "c0001", Text: "Test chunk", Norm: "test chunk", Index: 0},
 	}
-	kept, dropped := exactHashDedupe(chunks)
+	kept, dropped := exactHashDedupe(chunks, DefaultConfig())
 	if len(kept) != 1 {
 		t.Errorf("expected 1 kept chunk, got %d", len(kept))
 	}
@@ -39,7 +45,7 @@ func TestExactHashDedupe_AllIdentical(t *testing.T) {
 		{ID: "c0002", Text: "Test chunk", Norm: "test chunk", Index: 1},
 		{ID: "c0003", Text: "Test chunk", Norm: "test chunk", Index: 2},
 	}
-	kept, dropped := exactHashDedupe(chunks)
+	kept, dropped := exactHashDedupe(chunks, DefaultConfig())
 	if len(kept) != 1 {
 		t.Errorf("expected 1 kept chunk, got %d", len(kept))
 	}
@@ -54,13 +60,36 @@ func TestExactHashDedupe_AllIdentical(t *testing.T) {
 	}
 }
 
+func TestExactHashDedupe_FoldAccents(t *testing.T) {
+	accented, plain := "El número de teléfono", "El numero de telefono"
+	chunksWith := func(opts text.NormalizeOpts) []text.Chunk {
+		return []text.Chunk{
+			{ID: "c0001", Text: accented, Norm: text.NormalizeWithOpts(accented, opts), Index: 0},
+			{ID: "c0002", Text: plain, Norm: text.NormalizeWithOpts(plain, opts), Index: 1},
+		}
+	}
+
+	kept, dropped := exactHashDedupe(chunksWith(text.NormalizeOpts{Form: text.FormNFC}), DefaultConfig())
+	if len(kept) != 2 || len(dropped) != 0 {
+		t.Errorf("expected accented and plain chunks to stay distinct, got %d kept, %d dropped", len(kept), len(dropped))
+	}
+
+	kept, dropped = exactHashDedupe(chunksWith(text.NormalizeOpts{Form: text.FormNFC, FoldAccents: true}), DefaultConfig())
+	if len(kept) != 1 || len(dropped) != 1 {
+		t.Fatalf("expected folded chunks to be exact duplicates, got %d kept, %d dropped", len(kept), len(dropped))
+	}
+	if kept[0].Text != accented {
+		t.Errorf("expected kept chunk text to keep accents, got %q", kept[0].Text)
+	}
+}
+
 func TestExactHashDedupe_NoDuplicates(t *testing.T) {
 	chunks := []text.Chunk{
 		{ID: "c0001", Text: "First chunk", Norm: "first chunk", Index: 0},
 		{ID: "c0002", Text: "Second chunk", Norm: "second chunk", Index: 1},
 		{ID: "c0003", Text: "Third chunk", Norm: "third chunk", Index: 2},
 	}
-	kept, dropped := exactHashDedupe(chunks)
+	kept, dropped := exactHashDedupe(chunks, DefaultConfig())
 	if len(kept) != 3 {
 		t.Errorf("expected 3 kept chunks, got %d", len(kept))
 	}
@@ -77,7 +106,7 @@ func TestExactHashDedupe_MixedDuplicates(t *testing.T) {
 		{ID: "c0004", Text: "Duplicate", Norm: "duplicate", Index: 3},
 		{ID: "c0005", Text: "Unique three", Norm: "unique three", Index: 4},
 	}
-	kept, dropped := exactHashDedupe(chunks)
+	kept, dropped := exactHashDedupe(chunks, DefaultConfig())
 	if len(kept) != 4 {
 		t.Errorf("expected 4 kept chunks, got %d", len(kept))
 	}
@@ -94,13 +123,123 @@ func TestExactHashDedupe_EmptyNormalizedText(t *testing.T) {
 		{ID: "c0001", Text: "Test", Norm: "", Index: 0},
 		{ID: "c0002", Text: "Test", Norm: "", Index: 1},
 	}
-	kept, _ := exactHashDedupe(chunks)
+	kept, _ := exactHashDedupe(chunks, DefaultConfig())
 	// Empty normalized text should be kept (edge case handling)
 	if len(kept) != 2 {
 		t.Errorf("expected 2 kept chunks (empty norm kept), got %d", len(kept))
 	}
 }
 
+func TestExactHashDedupe_HashAlgorithms(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Alpha chunk", Norm: "alpha chunk", Index: 0},
+		{ID: "c0002", Text: "Beta chunk", Norm: "beta chunk", Index: 1},
+		{ID: "c0003", Text: "ALPHA chunk", Norm: "alpha chunk", Index: 2},
+	}
+	for _, algo := range []string{"sha1", "sha256", "fnv"} {
+		t.Run(algo, func(t *testing.T) {
+			config := DefaultConfig()
+			config.ExactHash = algo
+			kept, dropped := exactHashDedupe(chunks, config)
+			if len(kept) != 2 {
+				t.Errorf("expected 2 kept chunks, got %d", len(kept))
+			}
+			if len(dropped) != 1 {
+				t.Fatalf("expected 1 dropped chunk, got %d", len(dropped))
+			}
+			if dropped[0].ChunkID != "c0003" || dropped[0].MatchedChunkID != "c0001" {
+				t.Errorf("expected c0003 to match c0001, got %+v", dropped[0])
+			}
+		})
+	}
+}
+
+func TestConfigValidate_ExactHash(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "sha1"},
+		{"md5", "sha1"},
+		{"sha1", "sha1"},
+		{"sha256", "sha256"},
+		{"fnv", "fnv"},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.ExactHash = tt.in
+		config.Validate()
+		if config.ExactHash != tt.want {
+			t.Errorf("ExactHash %q: expected %q, got %q", tt.in, tt.want, config.ExactHash)
+		}
+	}
+}
+
+func benchmarkExactHashDedupe(b *testing.B, algo string) {
+	chunks := make([]text.Chunk, 10000)
+	for i := range chunks {
+		// Every other chunk repeats an earlier paragraph
+		norm := randomParagraph(uint64(i/2), 60)
+		chunks[i] = text.Chunk{ID: fmt.Sprintf("c%04d", i+1), Text: norm, Norm: norm, Index: i}
+	}
+	config := DefaultConfig()
+	config.ExactHash = algo
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		exactHashDedupe(chunks, config)
+	}
+}
+
+func BenchmarkExactHashDedupe_SHA1(b *testing.B)   { benchmarkExactHashDedupe(b, "sha1") }
+func BenchmarkExactHashDedupe_SHA256(b *testing.B) { benchmarkExactHashDedupe(b, "sha256") }
+func BenchmarkExactHashDedupe_FNV(b *testing.B)    { benchmarkExactHashDedupe(b, "fnv") }
+
+func TestExactHashDedupe_KeepLongest(t *testing.T) {
+	short := strings.Repeat("a", 50)
+	long := short + strings.Repeat(" ", 450) // Same normalized text, 500 chars
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: short, Norm: short, Index: 0},
+		{ID: "c0002", Text: "Unrelated chunk", Norm: "unrelated chunk", Index: 1},
+		{ID: "c0003", Text: long, Norm: short, Index: 2},
+		{ID: "c0004", Text: short, Norm: short, Index: 3},
+	}
+	config := DefaultConfig()
+	config.KeepStrategy = "longest"
+
+	kept, dropped := exactHashDedupe(chunks, config)
+
+	var keptIDs []string
+	for _, c := range kept {
+		keptIDs = append(keptIDs, c.ID)
+	}
+	if !reflect.DeepEqual(keptIDs, []string{"c0002", "c0003"}) {
+		t.Errorf("expected kept [c0002 c0003] in document order, got %v", keptIDs)
+	}
+	if len(dropped) != 2 {
+		t.Fatalf("expected 2 dropped chunks, got %d", len(dropped))
+	}
+	for i, wantID := range []string{"c0001", "c0004"} {
+		if dropped[i].ChunkID != wantID || dropped[i].MatchedChunkID != "c0003" {
+			t.Errorf("expected %s dropped against c0003, got %+v", wantID, dropped[i])
+		}
+		if dropped[i].Reason != "exact_duplicate" {
+			t.Errorf("expected exact_duplicate reason, got %s", dropped[i].Reason)
+		}
+	}
+}
+
+func TestExactHashDedupe_KeepFirstIsDefault(t *testing.T) {
+	short := strings.Repeat("a", 50)
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: short, Norm: short, Index: 0},
+		{ID: "c0002", Text: short + strings.Repeat(" ", 450), Norm: short, Index: 1},
+	}
+	kept, _ := exactHashDedupe(chunks, DefaultConfig())
+	if len(kept) != 1 || kept[0].ID != "c0001" {
+		t.Errorf("expected first occurrence c0001 to be kept, got %+v", kept)
+	}
+}
+
 func TestGenerateKgrams_EmptyString(t *testing.T) {
 	result := generateKgrams("", 3)
 	if len(result) != 0 {
@@ -148,10 +287,44 @@ func TestGenerateKgrams_Contiguous(t *testing.T) {
 }
 
 func TestGenerateKgrams_Unicode(t *testing.T) {
-	result := generateKgrams("café", 2)
-	// Should handle unicode correctly
-	if len(result) == 0 {
-		t.Error("expected k-grams for unicode string")
+	tests := []struct {
+		text string
+		k    int
+		want []string
+	}{
+		{"café", 2, []string{"ca", "af", "fé"}},
+		{"crème brûlée", 5, []string{"crème", "rème ", "ème b", "me br", "e brû", " brûl", "brûlé", "rûlée"}},
+		{"東京都の天気", 2, []string{"東京", "京都", "都の", "の天", "天気"}},
+		{"日本語", 3, []string{"日本語"}},
+		{"日本", 3, []string{}}, // 6 bytes, but only 2 runes
+	}
+	for _, tt := range tests {
+		got := generateKgrams(tt.text, tt.k)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("generateKgrams(%q, %d) = %q, want %q", tt.text, tt.k, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(tt.text); n >= tt.k && len(got) != n-tt.k+1 {
+			t.Errorf("generateKgrams(%q, %d): expected %d k-grams, got %d", tt.text, tt.k, n-tt.k+1, len(got))
+		}
+		for _, kg := range got {
+			if !utf8.ValidString(kg) || utf8.RuneCountInString(kg) != tt.k {
+				t.Errorf("generateKgrams(%q, %d): k-gram %q is not %d valid runes", tt.text, tt.k, kg, tt.k)
+			}
+		}
+	}
+}
+
+func TestSimhash64_UnicodeKgrams(t *testing.T) {
+	// ASCII signatures are unchanged by rune k-grams: one k-gram signs as its hash
+	if got, want := simhash64("abcde", 5), fnv1a64([]byte("abcde")); got != want {
+		t.Errorf("expected ASCII signature %x, got %x", want, got)
+	}
+	// Text of k runes but more than k bytes has one k-gram rather than split runes
+	if got, want := simhash64("東京都の天", 5), fnv1a64([]byte("東京都の天")); got != want {
+		t.Errorf("expected CJK signature %x, got %x", want, got)
+	}
+	if simhash64("東京", 5) != 0 {
+		t.Error("expected zero signature for CJK text shorter than k runes")
 	}
 }
 
@@ -299,6 +472,35 @@ func TestSimhashDedupe_SingleChunk(t *testing.T) {
 	}
 }
 
+func TestSimhashDedupe_ZeroSignaturesNotMatched(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "ab", Norm: "ab", Index: 0},
+		{ID: "c0002", Text: "cd", Norm: "cd", Index: 1},
+		{ID: "c0003", Text: "efg", Norm: "efg", Index: 2},
+		{ID: "c0004", Text: "h", Norm: "h", Index: 3},
+		{ID: "c0005", Text: "", Norm: "", Index: 4},
+	}
+	for _, window := range []int{250, 0, GlobalWindow} {
+		config := DefaultConfig()
+		config.Window = window
+		// Bypass the Levenshtein path so that every chunk reaches SimHash and signs as 0
+		config.ShortChunkLength = 0
+		kept, dropped := simhashDedupe(chunks, config)
+		if len(kept) != len(chunks) || len(dropped) != 0 {
+			t.Errorf("window %d: expected all %d short chunks kept, dropped %+v", window, len(chunks), dropped)
+		}
+	}
+
+	// Zero signatures are not recorded, so they are never a match target
+	m := newSimhashMatcher(DefaultConfig())
+	m.shortLength = 0
+	m.check(text.Chunk{ID: "c0001", Norm: "ab"})
+	m.commit()
+	if len(m.sigs) != 0 {
+		t.Errorf("expected zero signature not to be recorded, got %v", m.sigs)
+	}
+}
+
 func TestSimhashDedupe_NoNearDuplicates(t *testing.T) {
 	config := DefaultConfig()
 	config.SimHashThreshold = 3 // Lower threshold to avoid false positives
@@ -379,6 +581,47 @@ func TestSimhashDedupe_ThresholdBoundary(t *testing.T) {
 	}
 }
 
+func TestSimhashDedupe_KeepLongest(t *testing.T) {
+	base := "the quick brown fox jumps over the lazy dog near the river bank"
+	short := base[:50]
+	long := base + strings.Repeat(" and again the fox jumps", 18) // ~500 chars
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: short, Norm: short, Index: 0},
+		{ID: "c0002", Text: long, Norm: short + " ", Index: 1},
+	}
+	config := DefaultConfig()
+	config.KeepStrategy = "longest"
+	config.SimHashThreshold = 64 // Group everything so only the strategy decides
+
+	kept, dropped := simhashDedupe(chunks, config)
+	if len(kept) != 1 || kept[0].ID != "c0002" {
+		t.Fatalf("expected longer chunk c0002 to be kept, got %+v", kept)
+	}
+	if len(dropped) != 1 || dropped[0].ChunkID != "c0001" || dropped[0].MatchedChunkID != "c0002" {
+		t.Fatalf("expected c0001 dropped against c0002, got %+v", dropped)
+	}
+	if dropped[0].Reason != "near_duplicate" {
+		t.Errorf("expected near_duplicate reason, got %s", dropped[0].Reason)
+	}
+	want := hammingDistance(simhash64(chunks[0].Norm, config.SimHashK), simhash64(chunks[1].Norm, config.SimHashK))
+	if dropped[0].Distance != want {
+		t.Errorf("expected distance %d to the new representative, got %d", want, dropped[0].Distance)
+	}
+}
+
+func TestConfigValidate_KeepStrategy(t *testing.T) {
+	config := Config{KeepStrategy: "best"}
+	config.Validate()
+	if config.KeepStrategy != "first" {
+		t.Errorf("expected unknown strategy to fall back to first, got %s", config.KeepStrategy)
+	}
+	config.KeepStrategy = "longest"
+	config.Validate()
+	if config.KeepStrategy != "longest" {
+		t.Errorf("expected longest to be preserved, got %s", config.KeepStrategy)
+	}
+}
+
 func TestDedupe_EmptyInput(t *testing.T) {
 	config := DefaultConfig()
 	result := Dedupe([]text.Chunk{}, config)
@@ -406,6 +649,83 @@ func TestDedupe_MethodExact(t *testing.T) {
 	}
 }
 
+func TestDedupe_DistanceHistogram(t *testing.T) {
+	config := DefaultConfig()
+	config.DistanceHistogram = true
+
+	alpha := "the quick brown fox jumps over the lazy dog near the river bank"
+	beta := "completely different content about quarterly financial statements"
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: alpha, Norm: alpha},
+		{ID: "c0002", Text: alpha, Norm: alpha}, // exact duplicate
+		{ID: "c0003", Text: beta, Norm: beta},
+	}
+	result := Dedupe(chunks, config)
+	hist := result.Stats.DistanceHistogram
+
+	total := 0
+	for _, count := range hist {
+		total += count
+	}
+	if total != len(chunks) {
+		t.Errorf("expected histogram to sum to %d chunks, got %d: %v", len(chunks), total, hist)
+	}
+
+	betaDist := hammingDistance(simhash64(alpha, config.SimHashK), simhash64(beta, config.SimHashK))
+	want := map[int]int{-1: 1, 0: 1}
+	want[betaDist]++
+	if !reflect.DeepEqual(hist, want) {
+		t.Errorf("histogram = %v, want %v", hist, want)
+	}
+
+	config.DistanceHistogram = false
+	if got := Dedupe(chunks, config).Stats.DistanceHistogram; got != nil {
+		t.Errorf("expected no histogram when disabled, got %v", got)
+	}
+}
+
+func TestDedupe_DistanceHistogramWindow(t *testing.T) {
+	config := DefaultConfig()
+	config.DistanceHistogram = true
+	config.SimHashThreshold = 0
+	config.Window = 1
+
+	texts := []string{
+		"first distinct paragraph about apples and orchards",
+		"second distinct paragraph about submarine engineering",
+		"third distinct paragraph about medieval poetry forms",
+	}
+	var chunks []text.Chunk
+	for i, s := range texts {
+		chunks = append(chunks, text.Chunk{ID: fmt.Sprintf("c%04d", i+1), Text: s, Norm: s})
+	}
+	hist := Dedupe(chunks, config).Stats.DistanceHistogram
+
+	// With a window of 1, each chunk is compared only with the previous kept chunk
+	want := map[int]int{-1: 1}
+	for i := 1; i < len(texts); i++ {
+		want[hammingDistance(simhash64(texts[i], config.SimHashK), simhash64(texts[i-1], config.SimHashK))]++
+	}
+	if !reflect.DeepEqual(hist, want) {
+		t.Errorf("histogram = %v, want %v", hist, want)
+	}
+}
+
+func TestDedupe_KeptChunksRetainPage(t *testing.T) {
+	chunks := text.ChunkText("Alpha paragraph text\fAlpha paragraph text\n\nBeta paragraph text", 1, 1)
+	result := Dedupe(chunks, DefaultConfig())
+
+	want := map[string]int{"Alpha paragraph text": 1, "Beta paragraph text": 2}
+	if len(result.KeptChunks) != len(want) {
+		t.Fatalf("expected %d kept chunks, got %d", len(want), len(result.KeptChunks))
+	}
+	for _, chunk := range result.KeptChunks {
+		if chunk.Page != want[chunk.Text] {
+			t.Errorf("chunk %q: expected page %d, got %d", chunk.Text, want[chunk.Text], chunk.Page)
+		}
+	}
+}
+
 func TestDedupe_MethodSimhash(t *testing.T) {
 	config := DefaultConfig()
 	config.Method = "simhash"
@@ -438,7 +758,7 @@ func TestDedupe_InvalidConfigValues(t *testing.T) {
 		Method:           "simhash",
 		SimHashK:         -1, // Invalid
 		SimHashThreshold: -1, // Invalid
-		Window:           -1, // Invalid
+		Window:           -2, // Invalid
 	}
 	chunks := []text.Chunk{
 		{ID: "c0001", Text: "Test", Norm: "test", Index: 0},
@@ -493,6 +813,194 @@ func TestDedupe_DroppedChunksMetadata(t *testing.T) {
 	}
 }
 
+func TestDedupe_DroppedRefsExactGroup(t *testing.T) {
+	config := DefaultConfig()
+	config.Method = "exact"
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Same text", Norm: "same text", Index: 0, Page: 1},
+		{ID: "c0002", Text: "Other text", Norm: "other text", Index: 1, Page: 1},
+		{ID: "c0003", Text: "Same text!", Norm: "same text", Index: 2, Page: 2},
+		{ID: "c0004", Text: "SAME TEXT", Norm: "same text", Index: 3, Page: 3},
+	}
+	result := Dedupe(chunks, config)
+	want := map[string][]string{"c0001": {"c0003", "c0004"}}
+	if !reflect.DeepEqual(result.DroppedRefs, want) {
+		t.Errorf("expected dropped refs %v, got %v", want, result.DroppedRefs)
+	}
+
+	path := filepath.Join(t.TempDir(), "kept_chunks.jsonl")
+	if err := WriteKeptChunksJSONL(result, path); err != nil {
+		t.Fatalf("WriteKeptChunksJSONL failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read JSONL: %v", err)
+	}
+	wantJSONL := `{"id":"c0001","text":"Same text","norm":"same text","index":0,"page":1,"dropped_refs":["c0003","c0004"]}` + "\n" +
+		`{"id":"c0002","text":"Other text","norm":"other text","index":1,"page":1}` + "\n"
+	if string(data) != wantJSONL {
+		t.Errorf("expected JSONL:\n%s\ngot:\n%s", wantJSONL, data)
+	}
+}
+
+func TestResolveMatches_FollowsChains(t *testing.T) {
+	config := DefaultConfig()
+	chunks := matchChainChunks()
+	kept := []text.Chunk{chunks[0], chunks[3]}
+	dropped := []DroppedChunk{
+		newDroppedChunk(chunks[2], "exact_duplicate", "c0002", 0),
+		newDroppedChunk(chunks[1], "near_duplicate", "c0001", 3),
+		{ChunkID: "c0005", Reason: "cross_run_duplicate", MatchedChunkID: "r0009"},
+	}
+	// c0003 has the text of c0002, not of c0001, so it is recomputed as a near-duplicate
+	chained := newDroppedChunk(chunks[2], "near_duplicate", "c0001",
+		hammingDistance(simhash64(chunks[2].Norm, config.SimHashK), simhash64(chunks[0].Norm, config.SimHashK)))
+	want := []DroppedChunk{chained, dropped[1], dropped[2]}
+	if got := resolveMatches(chunks, kept, dropped, config); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDedupe_ChainedDropReason(t *testing.T) {
+	for _, method := range []string{"simhash", "both"} {
+		config := DefaultConfig()
+		config.Method = method
+		result := Dedupe(matchChainChunks(), config)
+		byID := make(map[string]DroppedChunk)
+		for _, d := range result.Dropped {
+			byID[d.ChunkID] = d
+		}
+		direct, chained := byID["c0002"], byID["c0003"]
+		if direct.Reason != "near_duplicate" || direct.MatchedChunkID != "c0001" || direct.Distance == 0 {
+			t.Fatalf("%s: expected c0002 to be a near-duplicate of c0001, got %+v", method, direct)
+		}
+		// c0003 copies c0002, so against c0001 it has the same reason and distance
+		if chained.Reason != direct.Reason || chained.MatchedChunkID != "c0001" || chained.Distance != direct.Distance {
+			t.Errorf("%s: expected c0003 to be dropped like c0002, got %+v", method, chained)
+		}
+	}
+}
+
+// matchChainChunks returns a chunk, a near-duplicate of it and an exact duplicate of
+// the near-duplicate, so that the exact pass matches c0003 to c0002, which SimHash
+// then drops against c0001.
+func matchChainChunks() []text.Chunk {
+	original := "the quick brown fox jumps over the lazy dog near the riverbank every single morning"
+	edited := "the quick brown fox jumps over the lazy dog near the riverbank every single mornings"
+	return []text.Chunk{
+		{ID: "c0001", Text: original, Norm: original, Index: 0},
+		{ID: "c0002", Text: edited, Norm: edited, Index: 1},
+		{ID: "c0003", Text: edited, Norm: edited, Index: 2},
+		{ID: "c0004", Text: "Something else entirely", Norm: "something else entirely", Index: 3},
+	}
+}
+
+func TestDedupe_MatchedChunksAreKept(t *testing.T) {
+	for _, method := range []string{"exact", "simhash", "both", "minhash", "jaccard"} {
+		for _, strategy := range []string{"first", "longest"} {
+			config := DefaultConfig()
+			config.Method = method
+			config.KeepStrategy = strategy
+			config.MinHashThreshold = 0.5
+			result := Dedupe(matchChainChunks(), config)
+			if len(result.Dropped) == 0 {
+				t.Errorf("%s/%s: expected dropped chunks", method, strategy)
+			}
+			if err := result.CheckMatches(); err != nil {
+				t.Errorf("%s/%s: %v", method, strategy, err)
+			}
+		}
+	}
+
+	// The exact duplicate of a near-duplicate collapses into the chunk both matched
+	for _, method := range []string{"simhash", "both"} {
+		config := DefaultConfig()
+		config.Method = method
+		result := Dedupe(matchChainChunks(), config)
+		want := map[string][]string{"c0001": {"c0002", "c0003"}}
+		if !reflect.DeepEqual(result.DroppedRefs, want) {
+			t.Errorf("%s: expected dropped refs %v, got %v", method, want, result.DroppedRefs)
+		}
+	}
+}
+
+func TestDedupe_DroppedInInputOrder(t *testing.T) {
+	repeated := "this paragraph repeats word for word across the scanned pages"
+	edited := "this paragraph repeats word for word across the scanned page"
+	var chunks []text.Chunk
+	for i, norm := range []string{repeated, edited, repeated, "unrelated text about something else", edited, repeated, edited} {
+		chunks = append(chunks, text.Chunk{ID: fmt.Sprintf("c%04d", i+1), Text: norm, Norm: norm, Index: i})
+	}
+	want := []string{"c0002", "c0003", "c0005", "c0006", "c0007"}
+
+	for _, method := range []string{"exact", "simhash", "both", "minhash", "jaccard"} {
+		config := DefaultConfig()
+		config.Method = method
+		config.MinHashThreshold = 0.5
+		config.JaccardThreshold = 0.5
+		var first []DroppedChunk
+		for run := 0; run < 10; run++ {
+			config.ParallelBoth = run%2 == 1
+			result := Dedupe(chunks, config)
+			if run == 0 {
+				first = result.Dropped
+				var ids []string
+				for _, d := range result.Dropped {
+					ids = append(ids, d.ChunkID)
+				}
+				if method != "exact" && !reflect.DeepEqual(ids, want) {
+					t.Errorf("%s: expected dropped %v in input order, got %v", method, want, ids)
+				}
+				for i := 1; i < len(ids); i++ {
+					if ids[i-1] > ids[i] {
+						t.Errorf("%s: expected dropped chunks in input order, got %v", method, ids)
+						break
+					}
+				}
+				continue
+			}
+			if !reflect.DeepEqual(result.Dropped, first) {
+				t.Errorf("%s: run %d dropped %+v, run 0 dropped %+v", method, run, result.Dropped, first)
+			}
+		}
+	}
+
+	// Cross-run duplicates are merged into input order too
+	state := NewState(DefaultConfig())
+	DedupeWithState(chunks[3:4], DefaultConfig(), state)
+	result := DedupeWithState(chunks, DefaultConfig(), state)
+	if result.Stats.CrossRunDups != 1 {
+		t.Fatalf("expected c0004 dropped as a cross-run duplicate, got %+v", result.Dropped)
+	}
+	for i := 1; i < len(result.Dropped); i++ {
+		if result.Dropped[i-1].ChunkID > result.Dropped[i].ChunkID {
+			t.Errorf("expected cross-run and in-run drops in input order, got %+v", result.Dropped)
+			break
+		}
+	}
+}
+
+func TestDedupeResult_CheckMatches(t *testing.T) {
+	result := DedupeResult{
+		KeptChunks: []text.Chunk{{ID: "c0001"}},
+		Dropped: []DroppedChunk{
+			{ChunkID: "c0002", Reason: "exact_duplicate", MatchedChunkID: "c0001"},
+			{ChunkID: "c0003", Reason: "cross_run_duplicate", MatchedChunkID: "c0042"},
+		},
+	}
+	if err := result.CheckMatches(); err != nil {
+		t.Errorf("expected valid matches, got %v", err)
+	}
+	result.Dropped = append(result.Dropped, DroppedChunk{ChunkID: "c0004", Reason: "near_duplicate", MatchedChunkID: "c0002"})
+	if err := result.CheckMatches(); err == nil {
+		t.Error("expected error for a match that was not kept")
+	}
+	result.Dropped[2].MatchedChunkID = ""
+	if err := result.CheckMatches(); err == nil {
+		t.Error("expected error for a missing match")
+	}
+}
+
 func TestDedupe_PreservesOrder(t *testing.T) {
 	config := DefaultConfig()
 	chunks := []text.Chunk{
@@ -534,6 +1042,38 @@ func TestDedupe_MethodBoth(t *testing.T) {
 	}
 }
 
+// TestDedupe_MethodBoth_Stats tests that chunks dropped by both passes count once, as
+// exact duplicates unless their match resolves to a chunk with other text
+func TestDedupe_MethodBoth_Stats(t *testing.T) {
+	config := DefaultConfig()
+	config.Method = "both"
+	chunks := append(matchChainChunks(), text.Chunk{
+		ID: "c0005", Text: "The quick brown fox jumps over the lazy dog near the riverbank, every single morning!", Norm: "the quick brown fox jumps over the lazy dog near the riverbank every single morning", Index: 4,
+	})
+	// c0002: near-duplicate of c0001 only; c0003 and c0005: dropped by both passes, but
+	// c0003 copies c0002, so it resolves to c0001 as a near-duplicate
+	result := Dedupe(chunks, config)
+
+	want := Stats{InputCount: 5, KeptCount: 2, DroppedCount: 3, ExactDups: 1, NearDups: 2}
+	if !reflect.DeepEqual(result.Stats, want) {
+		t.Errorf("expected stats %+v, got %+v", want, result.Stats)
+	}
+	if result.Stats.KeptCount+result.Stats.DroppedCount != result.Stats.InputCount {
+		t.Errorf("expected kept + dropped == input, got %+v", result.Stats)
+	}
+	reasons := make(map[string]string)
+	for _, d := range result.Dropped {
+		reasons[d.ChunkID] = d.Reason
+	}
+	wantReasons := map[string]string{"c0002": "near_duplicate", "c0003": "near_duplicate", "c0005": "exact_duplicate"}
+	if !reflect.DeepEqual(reasons, wantReasons) {
+		t.Errorf("expected reasons %v, got %v", wantReasons, reasons)
+	}
+	if err := result.CheckMatches(); err != nil {
+		t.Error(err)
+	}
+}
+
 // TestDedupe_MethodBoth_ExactDuplicate tests that exact duplicates are dropped in "both" method
 func TestDedupe_MethodBoth_ExactDuplicate(t *testing.T) {
 	config := DefaultConfig()
@@ -649,6 +1189,55 @@ func TestDedupe_MethodBoth_UniqueDroppedList(t *testing.T) {
 	}
 }
 
+// TestDedupe_MethodBoth_ParallelMatchesSequential tests that running the "both" passes
+// concurrently gives the same result as running them one after the other
+func TestDedupe_MethodBoth_ParallelMatchesSequential(t *testing.T) {
+	var chunks []text.Chunk
+	for i := 0; i < 60; i++ {
+		var body string
+		switch i % 4 {
+		case 0:
+			body = fmt.Sprintf("Chapter %d introduces the topic of optical character recognition", i/4)
+		case 1:
+			body = "Page header repeated on every scanned page"
+		case 2:
+			body = fmt.Sprintf("Chapter %d introduces the topic of optical character recognition!", i/4)
+		default:
+			body = fmt.Sprintf("Unique paragraph number %d about something else entirely", i)
+		}
+		chunks = append(chunks, text.Chunk{
+			ID:    fmt.Sprintf("c%04d", i+1),
+			Text:  body,
+			Norm:  strings.ToLower(body),
+			Index: i,
+		})
+	}
+
+	config := DefaultConfig()
+	config.Method = "both"
+	config.SimHashThreshold = 10
+	config.DistanceHistogram = true
+	sequential := Dedupe(chunks, config)
+
+	config.ParallelBoth = true
+	for run := 0; run < 5; run++ {
+		parallel := Dedupe(chunks, config)
+		if !reflect.DeepEqual(parallel, sequential) {
+			t.Fatalf("run %d: parallel result differs from sequential\nparallel:   %+v\nsequential: %+v", run, parallel, sequential)
+		}
+	}
+	if sequential.Stats.ExactDups == 0 {
+		t.Error("expected fixture to contain exact duplicates")
+	}
+
+	// Dropped chunks are listed in document order
+	for i := 1; i < len(sequential.Dropped); i++ {
+		if sequential.Dropped[i-1].ChunkID >= sequential.Dropped[i].ChunkID {
+			t.Fatalf("dropped not in document order: %s before %s", sequential.Dropped[i-1].ChunkID, sequential.Dropped[i].ChunkID)
+		}
+	}
+}
+
 // TestDedupe_SingleChunk tests edge case with single chunk
 func TestDedupe_SingleChunk(t *testing.T) {
 	config := DefaultConfig()
@@ -745,3 +1334,52 @@ func TestDedupe_MixedExactAndNearDuplicates(t *testing.T) {
 			result.Stats.ExactDups, result.Stats.NearDups, result.Stats.DroppedCount)
 	}
 }
+
+func TestDedupe_StripURLsMakesExactDuplicates(t *testing.T) {
+	rawChunks := text.ChunkText(
+		"Quarterly results are in and revenue grew steadily https://example.com/story?utm=aaa\n\n"+
+			"Quarterly results are in and revenue grew steadily https://example.com/story?utm=bbb", 20, 1)
+	if len(rawChunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(rawChunks))
+	}
+
+	config := DefaultConfig()
+	config.Method = "exact"
+
+	// Without stripping, the tracking URLs keep the chunks distinct
+	result := Dedupe(rawChunks, config)
+	if result.Stats.ExactDups != 0 {
+		t.Errorf("expected no exact duplicates without URL stripping, got %d", result.Stats.ExactDups)
+	}
+
+	// With stripping, they collapse into one
+	result = Dedupe(text.StripChunkURLs(rawChunks, false, text.NormalizeOpts{}), config)
+	if result.Stats.ExactDups != 1 {
+		t.Errorf("expected 1 exact duplicate with URL stripping, got %d", result.Stats.ExactDups)
+	}
+	if len(result.KeptChunks) != 1 || result.KeptChunks[0].ID != "c0001" {
+		t.Errorf("expected c0001 to be kept, got %+v", result.KeptChunks)
+	}
+}
+
+func TestExactHashDedupe_UnicodeNormalizationForms(t *testing.T) {
+	composed := "El caf\u00e9 est\u00e1 cerrado hoy"
+	decomposed := "El cafe\u0301 esta\u0301 cerrado hoy"
+
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: composed, Norm: text.Normalize(composed), Index: 0},
+		{ID: "c0002", Text: decomposed, Norm: text.Normalize(decomposed), Index: 1},
+	}
+
+	if sha1.Sum([]byte(chunks[0].Norm)) != sha1.Sum([]byte(chunks[1].Norm)) {
+		t.Fatalf("expected identical SHA-1 for composed and decomposed forms: %q vs %q", chunks[0].Norm, chunks[1].Norm)
+	}
+
+	kept, dropped := exactHashDedupe(chunks, DefaultConfig())
+	if len(kept) != 1 || len(dropped) != 1 {
+		t.Fatalf("expected 1 kept and 1 dropped, got %d kept and %d dropped", len(kept), len(dropped))
+	}
+	if dropped[0].ChunkID != "c0002" || dropped[0].MatchedChunkID != "c0001" {
+		t.Errorf("expected c0002 dropped as duplicate of c0001, got %+v", dropped[0])
+	}
+}
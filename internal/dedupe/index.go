@@ -0,0 +1,75 @@
+package dedupe
+
+import "sort"
+
+// GlobalWindow is the Config.Window value that enables indexed global SimHash dedup.
+const GlobalWindow = -1
+
+// simhashIndex finds kept SimHash signatures within a Hamming threshold without
+// comparing every pair. By the pigeonhole principle, two 64-bit signatures that
+// differ in at most t bits agree exactly on at least one of t+1 disjoint bit blocks,
+// so each signature is bucketed by every block value and only signatures sharing a
+// bucket are candidates.
+type simhashIndex struct {
+	shifts []uint
+	masks  []uint64
+	tables []map[uint64][]int
+	all    []int // used when the threshold is too large for blocking to help
+}
+
+// newSimhashIndex creates an index for the given Hamming threshold.
+func newSimhashIndex(threshold int) *simhashIndex {
+	x := &simhashIndex{}
+	blocks := threshold + 1
+	if blocks > 32 {
+		// Blocks narrower than 2 bits bucket almost everything together; scan instead
+		return x
+	}
+
+	// Split 64 bits into blocks of nearly equal width
+	start := uint(0)
+	for b := 0; b < blocks; b++ {
+		width := uint(64 / blocks)
+		if b < 64%blocks {
+			width++
+		}
+		x.shifts = append(x.shifts, start)
+		x.masks = append(x.masks, (uint64(1)<<width)-1)
+		x.tables = append(x.tables, make(map[uint64][]int))
+		start += width
+	}
+	return x
+}
+
+// add records a kept signature under its kept-slice index.
+func (x *simhashIndex) add(sig uint64, idx int) {
+	if len(x.tables) == 0 {
+		x.all = append(x.all, idx)
+		return
+	}
+	for b, table := range x.tables {
+		key := (sig >> x.shifts[b]) & x.masks[b]
+		table[key] = append(table[key], idx)
+	}
+}
+
+// candidates returns the kept indices that may be within the threshold of sig,
+// in ascending order so callers can break ties toward the earliest chunk.
+func (x *simhashIndex) candidates(sig uint64) []int {
+	if len(x.tables) == 0 {
+		return x.all
+	}
+	seen := make(map[int]bool)
+	var result []int
+	for b, table := range x.tables {
+		key := (sig >> x.shifts[b]) & x.masks[b]
+		for _, idx := range table[key] {
+			if !seen[idx] {
+				seen[idx] = true
+				result = append(result, idx)
+			}
+		}
+	}
+	sort.Ints(result)
+	return result
+}
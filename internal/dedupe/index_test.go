@@ -0,0 +1,127 @@
+package dedupe
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestSimhashIndex_FindsAllWithinThreshold(t *testing.T) {
+	for _, threshold := range []int{0, 3, 6, 12} {
+		index := newSimhashIndex(threshold)
+
+		var sigs []uint64
+		state := uint64(42)
+		for i := 0; i < 300; i++ {
+			state = splitmix64(state)
+			sig := state
+			if i%3 == 0 && len(sigs) > 0 {
+				// Derive a near neighbour of an earlier signature by flipping a few bits
+				sig = sigs[len(sigs)-1] ^ (1 << (state % 64)) ^ (1 << ((state >> 8) % 64))
+			}
+			sigs = append(sigs, sig)
+		}
+
+		for i, sig := range sigs {
+			candidates := make(map[int]bool)
+			for _, c := range index.candidates(sig) {
+				candidates[c] = true
+			}
+			// Every earlier signature within the threshold must be a candidate
+			for j := 0; j < i; j++ {
+				if hammingDistance(sig, sigs[j]) <= threshold && !candidates[j] {
+					t.Fatalf("threshold %d: signature %d missing candidate %d at distance %d",
+						threshold, i, j, hammingDistance(sig, sigs[j]))
+				}
+			}
+			index.add(sig, i)
+		}
+	}
+}
+
+func TestSimhashIndex_CandidatesAscending(t *testing.T) {
+	index := newSimhashIndex(2)
+	for i := 0; i < 5; i++ {
+		index.add(0xFFFF, i)
+	}
+	got := index.candidates(0xFFFF)
+	if !reflect.DeepEqual(got, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("expected ascending candidates, got %v", got)
+	}
+}
+
+func TestSimhashIndex_LargeThresholdScansAll(t *testing.T) {
+	index := newSimhashIndex(64)
+	index.add(0, 0)
+	index.add(^uint64(0), 1)
+	if got := index.candidates(0x1234); len(got) != 2 {
+		t.Errorf("expected all signatures as candidates, got %v", got)
+	}
+}
+
+func TestSimhashDedupe_GlobalMatchesCompareAll(t *testing.T) {
+	chunks := nearDupCorpus(10, 60)
+
+	allConfig := DefaultConfig()
+	allConfig.Window = 0 // Brute-force comparison against every kept chunk
+	wantKept, wantDropped := simhashDedupe(chunks, allConfig)
+
+	globalConfig := DefaultConfig()
+	globalConfig.Window = GlobalWindow
+	gotKept, gotDropped := simhashDedupe(chunks, globalConfig)
+
+	if !reflect.DeepEqual(wantKept, gotKept) {
+		t.Errorf("global kept chunks differ from compare-all: %d vs %d", len(gotKept), len(wantKept))
+	}
+	if !reflect.DeepEqual(wantDropped, gotDropped) {
+		t.Errorf("global dropped chunks differ from compare-all:\nwant %+v\ngot  %+v", wantDropped, gotDropped)
+	}
+}
+
+func TestSimhashDedupe_GlobalCatchesFarDuplicates(t *testing.T) {
+	const originals = 10
+	chunks := nearDupCorpus(originals, 60)
+
+	windowed := DefaultConfig()
+	windowed.Window = 5
+	_, windowedDropped := simhashDedupe(chunks, windowed)
+
+	global := DefaultConfig()
+	global.Window = GlobalWindow
+	_, globalDropped := simhashDedupe(chunks, global)
+
+	if len(globalDropped) <= len(windowedDropped) {
+		t.Errorf("expected global dedup to drop more than windowed (%d vs %d)", len(globalDropped), len(windowedDropped))
+	}
+}
+
+func TestSimhashDedupe_GlobalEarliestMatch(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "a", Norm: "repeated paragraph about the annual budget review", Index: 0},
+		{ID: "c0002", Text: "b", Norm: "an unrelated paragraph concerning office supplies", Index: 1},
+		{ID: "c0003", Text: "c", Norm: "repeated paragraph about the annual budget review", Index: 2},
+	}
+	config := DefaultConfig()
+	config.Window = GlobalWindow
+
+	_, dropped := simhashDedupe(chunks, config)
+	if len(dropped) != 1 || dropped[0].MatchedChunkID != "c0001" {
+		t.Errorf("expected c0003 to match c0001, got %+v", dropped)
+	}
+}
+
+func TestConfig_ValidateGlobalWindow(t *testing.T) {
+	config := DefaultConfig()
+	config.Window = GlobalWindow
+	config.Validate()
+	if config.Window != GlobalWindow {
+		t.Errorf("expected global window to be preserved, got %d", config.Window)
+	}
+
+	config.Window = -5
+	config.Validate()
+	if config.Window != 250 {
+		t.Errorf("expected invalid window to reset to 250, got %d", config.Window)
+	}
+}
@@ -0,0 +1,57 @@
+package dedupe
+
+import "github.com/jonkmatsumo/bulk-ocr/internal/text"
+
+// kgramSet returns the distinct character k-grams of text.
+func kgramSet(text string, k int) map[string]struct{} {
+	kgrams := generateKgrams(text, k)
+	set := make(map[string]struct{}, len(kgrams))
+	for _, kg := range kgrams {
+		set[kg] = struct{}{}
+	}
+	return set
+}
+
+// jaccardSimilarity returns |a ∩ b| / |a ∪ b|, or 0 if either set is empty.
+func jaccardSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	intersection := 0
+	for s := range a {
+		if _, ok := b[s]; ok {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// jaccardDedupe removes near-duplicates by the exact Jaccard similarity of their
+// character shingle sets (ShingleK-grams), compared against the kept chunks in the
+// sliding window. A chunk is dropped when its similarity to a kept chunk exceeds
+// JaccardThreshold; the most similar (then earliest) kept chunk is recorded as the
+// match. Every comparison walks both sets, so this suits smaller inputs where
+// accuracy matters more than the speed of simhashDedupe or minhashDedupe.
+func jaccardDedupe(chunks []text.Chunk, config Config) ([]text.Chunk, []DroppedChunk) {
+	if len(chunks) == 0 {
+		return []text.Chunk{}, []DroppedChunk{}
+	}
+
+	m := newJaccardMatcher(config)
+	var kept []text.Chunk
+	var dropped []DroppedChunk
+
+	for _, chunk := range chunks {
+		if d, dup := m.check(chunk); dup {
+			dropped = append(dropped, d)
+		} else {
+			m.commit()
+			kept = append(kept, chunk)
+		}
+	}
+
+	return kept, dropped
+}
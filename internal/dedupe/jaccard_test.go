@@ -0,0 +1,114 @@
+package dedupe
+
+import (
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestJaccardSimilarity(t *testing.T) {
+	a := kgramSet("abcdef", 3) // abc bcd cde def
+	b := kgramSet("bcdefg", 3) // bcd cde def efg
+	if got := jaccardSimilarity(a, b); got != 0.6 {
+		t.Errorf("expected 3/5 = 0.6, got %v", got)
+	}
+	if got := jaccardSimilarity(a, a); got != 1 {
+		t.Errorf("expected 1 for identical sets, got %v", got)
+	}
+	if got := jaccardSimilarity(a, kgramSet("xyz", 3)); got != 0 {
+		t.Errorf("expected 0 for disjoint sets, got %v", got)
+	}
+	// Text shorter than k has no shingles and never matches
+	if got := jaccardSimilarity(kgramSet("ab", 3), kgramSet("ab", 3)); got != 0 {
+		t.Errorf("expected 0 for empty sets, got %v", got)
+	}
+}
+
+// nearDupPairChunks returns chunks with a long near-duplicate pair, on which SimHash
+// and Jaccard agree, and a short pair differing by one letter, which SimHash places
+// within its default threshold but whose Jaccard similarity is only about 0.71.
+func nearDupPairChunks() []text.Chunk {
+	norms := []string{
+		"meeting notes for the quarterly planning session with the product team",
+		"meeting notes for the quarterly planning session with the product teams",
+		"completely unrelated paragraph about gardening tomatoes in the summer",
+		"the cat sat on the mat",
+		"the cat sat on the hat",
+	}
+	chunks := make([]text.Chunk, len(norms))
+	for i, norm := range norms {
+		chunks[i] = text.Chunk{ID: "c000" + string(rune('1'+i)), Text: norm, Norm: norm, Index: i}
+	}
+	return chunks
+}
+
+func TestDedupe_JaccardComparedToSimHash(t *testing.T) {
+	droppedIDs := func(result DedupeResult) map[string]string {
+		ids := make(map[string]string)
+		for _, d := range result.Dropped {
+			ids[d.ChunkID] = d.MatchedChunkID
+		}
+		return ids
+	}
+
+	config := DefaultConfig()
+	simhash := Dedupe(nearDupPairChunks(), config)
+	if got := droppedIDs(simhash); len(got) != 2 || got["c0002"] != "c0001" || got["c0005"] != "c0004" {
+		t.Errorf("simhash: expected c0002 and c0005 dropped, got %v", got)
+	}
+
+	config.Method = "jaccard"
+	jaccard := Dedupe(nearDupPairChunks(), config)
+	if got := droppedIDs(jaccard); len(got) != 1 || got["c0002"] != "c0001" {
+		t.Errorf("jaccard: expected only c0002 dropped, got %v", got)
+	}
+	if len(jaccard.Dropped) == 1 {
+		d := jaccard.Dropped[0]
+		if d.Reason != "near_duplicate" || d.Similarity <= config.JaccardThreshold || d.Similarity > 1 {
+			t.Errorf("expected a near-duplicate with similarity above %.2f, got %+v", config.JaccardThreshold, d)
+		}
+	}
+	if jaccard.Stats.NearDups != 1 || jaccard.Stats.KeptCount != 4 {
+		t.Errorf("unexpected stats %+v", jaccard.Stats)
+	}
+
+	// A lower threshold catches the short pair too
+	config.JaccardThreshold = 0.7
+	if got := droppedIDs(Dedupe(nearDupPairChunks(), config)); len(got) != 2 || got["c0005"] != "c0004" {
+		t.Errorf("jaccard 0.7: expected c0002 and c0005 dropped, got %v", got)
+	}
+}
+
+func TestJaccardDedupe_ThresholdAndWindow(t *testing.T) {
+	chunks := nearDupPairChunks()
+	config := DefaultConfig()
+	config.Method = "jaccard"
+
+	// Similarity must exceed the threshold, not just reach it
+	config.JaccardThreshold = jaccardSimilarity(kgramSet(chunks[3].Norm, 5), kgramSet(chunks[4].Norm, 5))
+	if _, dropped := jaccardDedupe(chunks[3:], config); len(dropped) != 0 {
+		t.Errorf("expected no drop at a similarity equal to the threshold, got %+v", dropped)
+	}
+
+	// With a window of 1, the near-duplicate of c0001 is compared only with c0003
+	config.JaccardThreshold = 0.8
+	config.Window = 1
+	reordered := []text.Chunk{chunks[0], chunks[2], chunks[1]}
+	if _, dropped := jaccardDedupe(reordered, config); len(dropped) != 0 {
+		t.Errorf("expected no drop outside the window, got %+v", dropped)
+	}
+	config.Window = 0
+	if _, dropped := jaccardDedupe(reordered, config); len(dropped) != 1 {
+		t.Errorf("expected a drop when comparing all kept chunks, got %+v", dropped)
+	}
+}
+
+func TestConfig_ValidateJaccard(t *testing.T) {
+	for _, threshold := range []float64{-0.1, 1.5} {
+		config := Config{Method: "jaccard", JaccardThreshold: threshold}
+		config.Validate()
+		if config.Method != "jaccard" || config.JaccardThreshold != 0.8 {
+			t.Errorf("threshold %v: expected jaccard with default threshold 0.8, got %+v", threshold, config)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package dedupe
+
+import "unicode/utf8"
+
+// levenshteinDistance returns the number of single-rune insertions, deletions and
+// substitutions needed to turn a into b.
+func levenshteinDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	// Two rows of the edit matrix, over the shorter string
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// levenshteinRatio returns 1 - distance / length of the longer string, from 0 for
+// strings with nothing in common to 1 for equal strings. Two empty strings give 0,
+// so empty text never matches.
+func levenshteinRatio(a, b string) float64 {
+	longest := max(utf8.RuneCountInString(a), utf8.RuneCountInString(b))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshteinDistance(a, b))/float64(longest)
+}
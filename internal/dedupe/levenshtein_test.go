@@ -0,0 +1,90 @@
+package dedupe
+
+import (
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestLevenshteinDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"café", "cafe", 1}, // Runes, not bytes
+		{"same", "same", 0},
+	}
+	for _, tt := range tests {
+		if got := levenshteinDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshteinDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshteinRatio(t *testing.T) {
+	if got := levenshteinRatio("abcd", "abce"); got != 0.75 {
+		t.Errorf("expected 0.75, got %v", got)
+	}
+	if got := levenshteinRatio("abc", "abc"); got != 1 {
+		t.Errorf("expected 1, got %v", got)
+	}
+	if got := levenshteinRatio("", ""); got != 0 {
+		t.Errorf("expected 0 for empty strings, got %v", got)
+	}
+}
+
+func TestDedupe_ShortChunksNotCollapsed(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Abc", Norm: "abc", Index: 0},
+		{ID: "c0002", Text: "Xyz", Norm: "xyz", Index: 1},
+		{ID: "c0003", Text: "Def", Norm: "def", Index: 2},
+	}
+	// With k=5 these have no k-grams and share the signature 0
+	if simhash64("abc", 5) != simhash64("xyz", 5) {
+		t.Fatal("expected short chunks to share a SimHash signature")
+	}
+	for _, method := range []string{"simhash", "both"} {
+		config := DefaultConfig()
+		config.Method = method
+		result := Dedupe(chunks, config)
+		if len(result.KeptChunks) != 3 {
+			t.Errorf("%s: expected distinct 3-character chunks to be kept, dropped %+v", method, result.Dropped)
+		}
+	}
+}
+
+func TestDedupe_ShortChunksLevenshteinRatio(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Page 12", Norm: "page 12", Index: 0},
+		{ID: "c0002", Text: "Page 13", Norm: "page 13", Index: 1}, // Ratio 6/7
+		{ID: "c0003", Text: "Abcd", Norm: "abcd", Index: 2},
+		{ID: "c0004", Text: "Abce", Norm: "abce", Index: 3}, // Ratio 0.75
+	}
+	config := DefaultConfig()
+	config.ShortChunkLength = 10
+	result := Dedupe(chunks, config)
+	if len(result.Dropped) != 1 || result.Dropped[0].ChunkID != "c0002" || result.Dropped[0].MatchedChunkID != "c0001" {
+		t.Fatalf("expected only c0002 dropped against c0001, got %+v", result.Dropped)
+	}
+	if d := result.Dropped[0]; d.Reason != "near_duplicate" || d.Similarity < 0.857 || d.Similarity > 0.858 {
+		t.Errorf("expected a near-duplicate with ratio 6/7, got %+v", d)
+	}
+
+	config.ShortChunkRatio = 0.75
+	if result := Dedupe(chunks, config); len(result.Dropped) != 2 {
+		t.Errorf("expected c0004 dropped too at ratio 0.75, got %+v", result.Dropped)
+	}
+
+	// By default only the 4-character chunks are short; "page 13" is left to SimHash
+	result = Dedupe(chunks, DefaultConfig())
+	if len(result.Dropped) != 1 || result.Dropped[0].ChunkID != "c0002" || result.Dropped[0].Similarity != 0 {
+		t.Errorf("expected only c0002 dropped by SimHash, got %+v", result.Dropped)
+	}
+}
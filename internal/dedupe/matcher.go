@@ -0,0 +1,401 @@
+package dedupe
+
+import (
+	"unicode/utf8"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+// Matchers hold the incremental state of one dedup pass. Each check call decides a
+// single chunk against the chunks kept so far without recording it; commit then
+// records the chunk last checked once the caller has decided to keep it. Splitting
+// the two lets DedupeStream run several passes on a chunk and record it only if every
+// pass keeps it, while the slice-based passes share the same implementation.
+
+// newDroppedChunk builds a drop record with a truncated text preview.
+func newDroppedChunk(chunk text.Chunk, reason, matchedID string, distance int) DroppedChunk {
+	preview := chunk.Text
+	if len(preview) > 200 {
+		preview = preview[:200] + "..."
+	}
+	return DroppedChunk{
+		ChunkID:        chunk.ID,
+		Reason:         reason,
+		MatchedChunkID: matchedID,
+		Distance:       distance,
+		Preview:        preview,
+		SourceFile:     chunk.SourceFile,
+	}
+}
+
+// exactMatcher tracks the hashes of kept normalized text.
+type exactMatcher struct {
+	algo string
+	seen map[string]DroppedChunk // hash -> record of an exact copy, less its chunk's own fields
+
+	pendingHash string // hash of the chunk last checked, "" if it had no text
+	pendingID   string
+}
+
+func newExactMatcher(config Config) *exactMatcher {
+	return &exactMatcher{algo: config.ExactHash, seen: make(map[string]DroppedChunk)}
+}
+
+// check reports whether chunk exactly duplicates a kept chunk.
+func (m *exactMatcher) check(chunk text.Chunk) (DroppedChunk, bool) {
+	m.pendingHash, m.pendingID = "", chunk.ID
+	// Keep empty chunks (edge case, shouldn't happen after normalization)
+	if chunk.Norm == "" {
+		return DroppedChunk{}, false
+	}
+
+	m.pendingHash = exactHashKey(chunk.Norm, m.algo)
+	if match, exists := m.seen[m.pendingHash]; exists {
+		d := newDroppedChunk(chunk, match.Reason, match.MatchedChunkID, match.Distance)
+		d.Similarity = match.Similarity
+		return d, true
+	}
+	return DroppedChunk{}, false
+}
+
+// commit records the chunk last checked as kept.
+func (m *exactMatcher) commit() {
+	if m.pendingHash != "" {
+		m.seen[m.pendingHash] = DroppedChunk{Reason: "exact_duplicate", MatchedChunkID: m.pendingID}
+	}
+}
+
+// commitDropped records that a later pass dropped the chunk last checked as d. Exact
+// copies of it are then dropped as d was, against d's kept chunk, which is what
+// resolveMatches makes of them: their text is the same, so rematch agrees with d.
+func (m *exactMatcher) commitDropped(d DroppedChunk) {
+	if m.pendingHash != "" {
+		m.seen[m.pendingHash] = d
+	}
+}
+
+// rematch returns the record of chunk dropped against root, as the pass of
+// config.Method that compares them reports it: an exact duplicate if their normalized
+// text is equal, otherwise a near-duplicate with that pass's distance or similarity.
+func rematch(chunk, root text.Chunk, config Config) DroppedChunk {
+	if chunk.Norm == root.Norm {
+		return newDroppedChunk(chunk, "exact_duplicate", root.ID, 0)
+	}
+	d := newDroppedChunk(chunk, "near_duplicate", root.ID, 0)
+	switch config.Method {
+	case "minhash":
+		salts := minhashSalts(config.MinHashNumHashes)
+		d.Similarity = estimateJaccard(
+			minhashSignature(shingleSet(chunk.Norm, config.ShingleK), salts),
+			minhashSignature(shingleSet(root.Norm, config.ShingleK), salts))
+	case "jaccard":
+		d.Similarity = jaccardSimilarity(kgramSet(chunk.Norm, config.ShingleK), kgramSet(root.Norm, config.ShingleK))
+	default:
+		if utf8.RuneCountInString(chunk.Norm) < config.ShortChunkLength {
+			d.Similarity = levenshteinRatio(chunk.Norm, root.Norm)
+		} else {
+			d.Distance = hammingDistance(simhash64(chunk.Norm, config.SimHashK), simhash64(root.Norm, config.SimHashK))
+		}
+	}
+	return d
+}
+
+// simhashMatcher tracks SimHash signatures of kept chunks. With a positive window
+// only the most recent window signatures are retained; window 0 and GlobalWindow
+// retain every kept signature. Chunks shorter than shortLength are kept apart and
+// compared by Levenshtein ratio, in a window of their own.
+type simhashMatcher struct {
+	k         int
+	threshold int
+	window    int
+	sigs      []uint64 // kept signatures, oldest first
+	ids       []string // parallel kept chunk IDs
+	index     *simhashIndex
+
+	shortLength int
+	shortRatio  float64
+	shortNorms  []string // kept short chunk text, oldest first
+	shortIDs    []string // parallel kept short chunk IDs
+
+	// With trackNearest set, nearest holds the distance from the last checked chunk to
+	// its closest kept chunk in the window (-1 if there was none), even above threshold.
+	trackNearest bool
+	nearest      int
+
+	pending    text.Chunk // chunk last checked
+	pendingSig uint64
+}
+
+func newSimhashMatcher(config Config) *simhashMatcher {
+	m := &simhashMatcher{
+		k:           config.SimHashK,
+		threshold:   config.SimHashThreshold,
+		window:      config.Window,
+		shortLength: config.ShortChunkLength,
+		shortRatio:  config.ShortChunkRatio,
+	}
+	if config.Window == GlobalWindow {
+		m.index = newSimhashIndex(config.SimHashThreshold)
+	}
+	return m
+}
+
+// check reports whether chunk is a near-duplicate of a kept chunk. The chunk's
+// signature is returned either way.
+func (m *simhashMatcher) check(chunk text.Chunk) (uint64, DroppedChunk, bool) {
+	sig := simhash64(chunk.Norm, m.k)
+	m.pending, m.pendingSig = chunk, sig
+	if m.isShort(chunk) {
+		m.nearest = -1
+		d, dup := m.checkShort(chunk)
+		return sig, d, dup
+	}
+	if sig == 0 {
+		// Text without k-grams signs as 0, which would match every other such chunk.
+		// A zero signature says nothing about the text, so it is kept unmatched and
+		// never recorded as a match target.
+		m.nearest = -1
+		return sig, DroppedChunk{}, false
+	}
+	matchedIdx := -1
+	minDistance := 65 // Larger than max possible (64)
+
+	if m.trackNearest {
+		m.nearest = -1
+		for j := m.windowStart(); j < len(m.sigs); j++ {
+			if dist := hammingDistance(sig, m.sigs[j]); m.nearest < 0 || dist < m.nearest {
+				m.nearest = dist
+			}
+		}
+	}
+
+	if m.index != nil {
+		// Candidates are ascending, so ties resolve to the earliest kept chunk
+		for _, j := range m.index.candidates(sig) {
+			dist := hammingDistance(sig, m.sigs[j])
+			if dist <= m.threshold && dist < minDistance {
+				matchedIdx = j
+				minDistance = dist
+			}
+		}
+	} else {
+		// Compare with chunks in sliding window
+		for j := m.windowStart(); j < len(m.sigs); j++ {
+			dist := hammingDistance(sig, m.sigs[j])
+			if dist <= m.threshold && dist < minDistance {
+				matchedIdx = j
+				minDistance = dist
+			}
+		}
+	}
+
+	if matchedIdx >= 0 {
+		return sig, newDroppedChunk(chunk, "near_duplicate", m.ids[matchedIdx], minDistance), true
+	}
+	return sig, DroppedChunk{}, false
+}
+
+// commit records the chunk last checked as kept. Zero signatures and empty short
+// text are never recorded, as they are never a match target.
+func (m *simhashMatcher) commit() {
+	chunk, sig := m.pending, m.pendingSig
+	if m.isShort(chunk) {
+		m.commitShort(chunk)
+		return
+	}
+	if sig == 0 {
+		return
+	}
+
+	if m.index != nil {
+		m.index.add(sig, len(m.sigs))
+	} else if m.window > 0 && len(m.sigs) >= 2*m.window {
+		// Discard signatures that have slid out of the window (amortized O(1))
+		m.sigs = append(m.sigs[:0], m.sigs[len(m.sigs)-m.window:]...)
+		m.ids = append(m.ids[:0], m.ids[len(m.ids)-m.window:]...)
+	}
+	m.sigs = append(m.sigs, sig)
+	m.ids = append(m.ids, chunk.ID)
+}
+
+// isShort reports whether chunk is compared by Levenshtein ratio rather than SimHash.
+func (m *simhashMatcher) isShort(chunk text.Chunk) bool {
+	return utf8.RuneCountInString(chunk.Norm) < m.shortLength
+}
+
+// checkShort reports whether a chunk below shortLength is a near-duplicate of a kept
+// short chunk by Levenshtein ratio. Empty text never matches.
+func (m *simhashMatcher) checkShort(chunk text.Chunk) (DroppedChunk, bool) {
+	if chunk.Norm == "" {
+		return DroppedChunk{}, false
+	}
+
+	start := 0
+	if m.window > 0 && len(m.shortNorms) > m.window {
+		start = len(m.shortNorms) - m.window
+	}
+	bestIdx := -1
+	bestRatio := 0.0
+	for j := start; j < len(m.shortNorms); j++ {
+		if ratio := levenshteinRatio(chunk.Norm, m.shortNorms[j]); ratio >= m.shortRatio && ratio > bestRatio {
+			bestIdx = j
+			bestRatio = ratio
+		}
+	}
+	if bestIdx >= 0 {
+		d := newDroppedChunk(chunk, "near_duplicate", m.shortIDs[bestIdx], 0)
+		d.Similarity = bestRatio
+		return d, true
+	}
+	return DroppedChunk{}, false
+}
+
+// commitShort records a kept chunk below shortLength.
+func (m *simhashMatcher) commitShort(chunk text.Chunk) {
+	if chunk.Norm == "" {
+		return
+	}
+	if m.window > 0 && len(m.shortNorms) >= 2*m.window {
+		m.shortNorms = append(m.shortNorms[:0], m.shortNorms[len(m.shortNorms)-m.window:]...)
+		m.shortIDs = append(m.shortIDs[:0], m.shortIDs[len(m.shortIDs)-m.window:]...)
+	}
+	m.shortNorms = append(m.shortNorms, chunk.Norm)
+	m.shortIDs = append(m.shortIDs, chunk.ID)
+}
+
+// windowStart returns the index of the oldest kept signature inside the window.
+func (m *simhashMatcher) windowStart() int {
+	if m.index == nil && m.window > 0 && len(m.sigs) > m.window {
+		return len(m.sigs) - m.window
+	}
+	return 0
+}
+
+// minhashMatcher tracks MinHash signatures of kept chunks in LSH band buckets.
+type minhashMatcher struct {
+	shingleK  int
+	bands     int
+	threshold float64
+	salts     []uint64
+	sigs      [][]uint64       // kept signatures
+	ids       []string         // parallel kept chunk IDs
+	buckets   map[uint64][]int // band key -> indices into sigs
+
+	pendingID   string   // chunk last checked
+	pendingSig  []uint64 // its signature, nil if it had no shingles
+	pendingKeys []uint64 // its band keys
+}
+
+func newMinhashMatcher(config Config) *minhashMatcher {
+	return &minhashMatcher{
+		shingleK:  config.ShingleK,
+		bands:     config.MinHashBands,
+		threshold: config.MinHashThreshold,
+		salts:     minhashSalts(config.MinHashNumHashes),
+		buckets:   make(map[uint64][]int),
+	}
+}
+
+// check reports whether chunk is a near-duplicate of a kept chunk.
+func (m *minhashMatcher) check(chunk text.Chunk) (DroppedChunk, bool) {
+	sig := minhashSignature(shingleSet(chunk.Norm, m.shingleK), m.salts)
+	m.pendingID, m.pendingSig, m.pendingKeys = chunk.ID, sig, nil
+	if sig == nil {
+		return DroppedChunk{}, false
+	}
+
+	keys := bandKeys(sig, m.bands)
+	m.pendingKeys = keys
+
+	bestIdx := -1
+	bestSim := 0.0
+	seen := make(map[int]bool)
+	for _, key := range keys {
+		for _, idx := range m.buckets[key] {
+			if seen[idx] {
+				continue
+			}
+			seen[idx] = true
+			sim := estimateJaccard(sig, m.sigs[idx])
+			if sim < m.threshold {
+				continue
+			}
+			if sim > bestSim || (sim == bestSim && idx < bestIdx) {
+				bestIdx = idx
+				bestSim = sim
+			}
+		}
+	}
+
+	if bestIdx >= 0 {
+		d := newDroppedChunk(chunk, "near_duplicate", m.ids[bestIdx], 0)
+		d.Similarity = bestSim
+		return d, true
+	}
+	return DroppedChunk{}, false
+}
+
+// commit records the chunk last checked as kept.
+func (m *minhashMatcher) commit() {
+	idx := len(m.sigs)
+	m.sigs = append(m.sigs, m.pendingSig)
+	m.ids = append(m.ids, m.pendingID)
+	for _, key := range m.pendingKeys {
+		m.buckets[key] = append(m.buckets[key], idx)
+	}
+}
+
+// jaccardMatcher tracks the shingle sets of kept chunks. Like simhashMatcher, a
+// positive window retains only the most recent window sets, and window 0 and
+// GlobalWindow retain every kept set.
+type jaccardMatcher struct {
+	shingleK  int
+	threshold float64
+	window    int
+	sets      []map[string]struct{} // kept shingle sets, oldest first
+	ids       []string              // parallel kept chunk IDs
+
+	pendingID  string              // chunk last checked
+	pendingSet map[string]struct{} // its shingle set
+}
+
+func newJaccardMatcher(config Config) *jaccardMatcher {
+	return &jaccardMatcher{shingleK: config.ShingleK, threshold: config.JaccardThreshold, window: config.Window}
+}
+
+// check reports whether chunk is a near-duplicate of a kept chunk.
+func (m *jaccardMatcher) check(chunk text.Chunk) (DroppedChunk, bool) {
+	set := kgramSet(chunk.Norm, m.shingleK)
+	m.pendingID, m.pendingSet = chunk.ID, set
+
+	start := 0
+	if m.window > 0 && len(m.sets) > m.window {
+		start = len(m.sets) - m.window
+	}
+	bestIdx := -1
+	bestSim := 0.0
+	for j := start; j < len(m.sets); j++ {
+		if sim := jaccardSimilarity(set, m.sets[j]); sim > m.threshold && sim > bestSim {
+			bestIdx = j
+			bestSim = sim
+		}
+	}
+
+	if bestIdx >= 0 {
+		d := newDroppedChunk(chunk, "near_duplicate", m.ids[bestIdx], 0)
+		d.Similarity = bestSim
+		return d, true
+	}
+	return DroppedChunk{}, false
+}
+
+// commit records the chunk last checked as kept.
+func (m *jaccardMatcher) commit() {
+	if m.window > 0 && len(m.sets) >= 2*m.window {
+		// Discard sets that have slid out of the window (amortized O(1))
+		m.sets = append(m.sets[:0], m.sets[len(m.sets)-m.window:]...)
+		m.ids = append(m.ids[:0], m.ids[len(m.ids)-m.window:]...)
+	}
+	m.sets = append(m.sets, m.pendingSet)
+	m.ids = append(m.ids, m.pendingID)
+}
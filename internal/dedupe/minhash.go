@@ -0,0 +1,124 @@
+package dedupe
+
+import (
+	"encoding/binary"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+// minhashSeed seeds the deterministic sequence of per-function hash salts.
+const minhashSeed uint64 = 0x9e3779b97f4a7c15
+
+// splitmix64 is a fast 64-bit mixing function used to derive independent hash functions.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// minhashSalts returns n deterministic salts, one per MinHash function.
+func minhashSalts(n int) []uint64 {
+	salts := make([]uint64, n)
+	state := minhashSeed
+	for i := range salts {
+		state = splitmix64(state)
+		salts[i] = state
+	}
+	return salts
+}
+
+// shingleSet returns the distinct k-gram hashes of text.
+func shingleSet(text string, k int) map[uint64]struct{} {
+	kgrams := generateKgrams(text, k)
+	set := make(map[uint64]struct{}, len(kgrams))
+	for _, kg := range kgrams {
+		set[fnv1a64([]byte(kg))] = struct{}{}
+	}
+	return set
+}
+
+// minhashSignature computes the MinHash signature of a shingle set.
+// Returns nil for an empty set (text shorter than k), which never matches anything.
+func minhashSignature(shingles map[uint64]struct{}, salts []uint64) []uint64 {
+	if len(shingles) == 0 {
+		return nil
+	}
+	sig := make([]uint64, len(salts))
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for s := range shingles {
+		for i, salt := range salts {
+			if h := splitmix64(s ^ salt); h < sig[i] {
+				sig[i] = h
+			}
+		}
+	}
+	return sig
+}
+
+// estimateJaccard returns the fraction of signature slots that agree.
+func estimateJaccard(a, b []uint64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// bandKeys hashes each band of rows signature slots into an LSH bucket key.
+// The band index is mixed in so identical rows in different bands don't collide.
+func bandKeys(sig []uint64, bands int) []uint64 {
+	rows := len(sig) / bands
+	keys := make([]uint64, bands)
+	buf := make([]byte, 8)
+	for b := 0; b < bands; b++ {
+		hash := fnvOffsetBasis64
+		binary.LittleEndian.PutUint64(buf, uint64(b))
+		for _, c := range buf {
+			hash ^= uint64(c)
+			hash *= fnvPrime64
+		}
+		for _, v := range sig[b*rows : (b+1)*rows] {
+			binary.LittleEndian.PutUint64(buf, v)
+			for _, c := range buf {
+				hash ^= uint64(c)
+				hash *= fnvPrime64
+			}
+		}
+		keys[b] = hash
+	}
+	return keys
+}
+
+// minhashDedupe removes near-duplicates using MinHash signatures with LSH banding.
+// Candidates are only those kept chunks sharing at least one band bucket, so the
+// comparison count is sub-quadratic and, unlike simhashDedupe, not limited by a window.
+// A candidate matches when its estimated Jaccard similarity reaches MinHashThreshold;
+// the most similar (then earliest) kept chunk is recorded as the match.
+func minhashDedupe(chunks []text.Chunk, config Config) ([]text.Chunk, []DroppedChunk) {
+	if len(chunks) == 0 {
+		return []text.Chunk{}, []DroppedChunk{}
+	}
+
+	m := newMinhashMatcher(config)
+	var kept []text.Chunk
+	var dropped []DroppedChunk
+
+	for _, chunk := range chunks {
+		if d, dup := m.check(chunk); dup {
+			dropped = append(dropped, d)
+		} else {
+			m.commit()
+			kept = append(kept, chunk)
+		}
+	}
+
+	return kept, dropped
+}
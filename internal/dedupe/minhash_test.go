@@ -0,0 +1,207 @@
+package dedupe
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestMinhashSignature_Deterministic(t *testing.T) {
+	salts := minhashSalts(64)
+	a := minhashSignature(shingleSet("the quick brown fox jumps over the lazy dog", 5), salts)
+	b := minhashSignature(shingleSet("the quick brown fox jumps over the lazy dog", 5), minhashSalts(64))
+
+	if len(a) != 64 {
+		t.Fatalf("expected 64 signature slots, got %d", len(a))
+	}
+	if estimateJaccard(a, b) != 1.0 {
+		t.Error("identical text should produce identical signatures")
+	}
+}
+
+func TestMinhashSignature_ShortText(t *testing.T) {
+	if sig := minhashSignature(shingleSet("abc", 5), minhashSalts(16)); sig != nil {
+		t.Errorf("expected nil signature for text shorter than k, got %v", sig)
+	}
+}
+
+func TestEstimateJaccard_ApproximatesTrueJaccard(t *testing.T) {
+	a := "the quick brown fox jumps over the lazy dog near the river bank"
+	b := "the quick brown fox jumps over the lazy cat near the river bank"
+
+	setA := shingleSet(a, 5)
+	setB := shingleSet(b, 5)
+	intersection := 0
+	for s := range setA {
+		if _, ok := setB[s]; ok {
+			intersection++
+		}
+	}
+	trueJaccard := float64(intersection) / float64(len(setA)+len(setB)-intersection)
+
+	salts := minhashSalts(256)
+	estimate := estimateJaccard(minhashSignature(setA, salts), minhashSignature(setB, salts))
+
+	if diff := estimate - trueJaccard; diff > 0.1 || diff < -0.1 {
+		t.Errorf("estimate %.3f too far from true Jaccard %.3f", estimate, trueJaccard)
+	}
+}
+
+func TestEstimateJaccard_MismatchedLengths(t *testing.T) {
+	if estimateJaccard([]uint64{1, 2}, []uint64{1}) != 0 {
+		t.Error("expected 0 for mismatched signature lengths")
+	}
+	if estimateJaccard(nil, nil) != 0 {
+		t.Error("expected 0 for nil signatures")
+	}
+}
+
+func TestMinhashDedupe_EmptyInput(t *testing.T) {
+	config := DefaultConfig()
+	kept, dropped := minhashDedupe([]text.Chunk{}, config)
+	if len(kept) != 0 || len(dropped) != 0 {
+		t.Errorf("expected empty results, got %d kept and %d dropped", len(kept), len(dropped))
+	}
+}
+
+func TestMinhashDedupe_NearDuplicate(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "x", Norm: "meeting notes for the quarterly planning session with the product team", Index: 0},
+		{ID: "c0002", Text: "x", Norm: "completely unrelated paragraph about gardening tomatoes in the summer", Index: 1},
+		{ID: "c0003", Text: "x", Norm: "meeting notes for the quarterly planning session with the product teams", Index: 2},
+	}
+	config := DefaultConfig()
+	config.Method = "minhash"
+	config.Validate()
+
+	kept, dropped := minhashDedupe(chunks, config)
+
+	if len(kept) != 2 {
+		t.Fatalf("expected 2 kept chunks, got %d", len(kept))
+	}
+	if len(dropped) != 1 {
+		t.Fatalf("expected 1 dropped chunk, got %d", len(dropped))
+	}
+	d := dropped[0]
+	if d.ChunkID != "c0003" || d.MatchedChunkID != "c0001" {
+		t.Errorf("expected c0003 dropped as near-duplicate of c0001, got %+v", d)
+	}
+	if d.Reason != "near_duplicate" {
+		t.Errorf("expected reason near_duplicate, got %s", d.Reason)
+	}
+	if d.Similarity < config.MinHashThreshold || d.Similarity > 1 {
+		t.Errorf("expected similarity in [%.2f, 1], got %.3f", config.MinHashThreshold, d.Similarity)
+	}
+	if d.Distance != 0 {
+		t.Errorf("expected Distance to be unused for minhash, got %d", d.Distance)
+	}
+}
+
+// randomParagraph returns a deterministic paragraph of pseudo-random words.
+func randomParagraph(seed uint64, words int) string {
+	letters := "abcdefghijklmnopqrstuvwxyz"
+	var b []byte
+	state := seed
+	for w := 0; w < words; w++ {
+		if w > 0 {
+			b = append(b, ' ')
+		}
+		state = splitmix64(state)
+		length := 3 + int(state%6)
+		for i := 0; i < length; i++ {
+			state = splitmix64(state)
+			b = append(b, letters[state%26])
+		}
+	}
+	return string(b)
+}
+
+// nearDupCorpus builds originals followed by many unrelated fillers and then
+// lightly edited copies of the originals, so the copies fall outside a small window.
+func nearDupCorpus(originals, fillers int) []text.Chunk {
+	var chunks []text.Chunk
+	add := func(norm string) {
+		idx := len(chunks)
+		chunks = append(chunks, text.Chunk{ID: fmt.Sprintf("c%04d", idx+1), Text: norm, Norm: norm, Index: idx})
+	}
+	for i := 0; i < originals; i++ {
+		add(randomParagraph(uint64(i+1), 30))
+	}
+	for i := 0; i < fillers; i++ {
+		add(randomParagraph(uint64(1000+i), 30))
+	}
+	for i := 0; i < originals; i++ {
+		add(randomParagraph(uint64(i+1), 30) + " end")
+	}
+	return chunks
+}
+
+func TestMinhashDedupe_RecallBeyondWindow(t *testing.T) {
+	const originals = 10
+	chunks := nearDupCorpus(originals, 50)
+
+	simConfig := DefaultConfig()
+	simConfig.Window = 10
+	simResult := Dedupe(chunks, simConfig)
+
+	minConfig := DefaultConfig()
+	minConfig.Method = "minhash"
+	minConfig.Window = 10 // Ignored by minhash
+	minResult := Dedupe(chunks, minConfig)
+
+	if minResult.Stats.NearDups != originals {
+		t.Errorf("expected minhash to find all %d near-duplicates, found %d", originals, minResult.Stats.NearDups)
+	}
+	if simResult.Stats.NearDups >= minResult.Stats.NearDups {
+		t.Errorf("expected minhash recall (%d) to exceed windowed simhash recall (%d)",
+			minResult.Stats.NearDups, simResult.Stats.NearDups)
+	}
+	for _, d := range minResult.Dropped {
+		var idx int
+		if _, err := fmt.Sscanf(d.ChunkID, "c%04d", &idx); err != nil {
+			t.Fatalf("unexpected chunk ID %s", d.ChunkID)
+		}
+		if idx <= originals+50 {
+			t.Errorf("unexpected drop of original or filler chunk %s", d.ChunkID)
+		}
+	}
+}
+
+func TestDedupe_MinhashMethod(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Exact text", Norm: "exact duplicate paragraph used in minhash mode", Index: 0},
+		{ID: "c0002", Text: "Exact text", Norm: "exact duplicate paragraph used in minhash mode", Index: 1},
+	}
+	config := DefaultConfig()
+	config.Method = "minhash"
+
+	result := Dedupe(chunks, config)
+	if result.Stats.ExactDups != 1 {
+		t.Errorf("expected exact pre-check to drop 1 chunk, got %d", result.Stats.ExactDups)
+	}
+	if result.Stats.KeptCount != 1 {
+		t.Errorf("expected 1 kept chunk, got %d", result.Stats.KeptCount)
+	}
+}
+
+func TestConfig_ValidateMinhash(t *testing.T) {
+	config := Config{Method: "minhash", MinHashNumHashes: 100, MinHashBands: 16, MinHashThreshold: 1.5}
+	config.Validate()
+
+	if config.Method != "minhash" {
+		t.Errorf("expected minhash method to be accepted, got %s", config.Method)
+	}
+	if config.MinHashNumHashes%config.MinHashBands != 0 {
+		t.Errorf("bands %d must divide hash count %d", config.MinHashBands, config.MinHashNumHashes)
+	}
+	if config.MinHashBands != 10 {
+		t.Errorf("expected bands to fall back to 10, got %d", config.MinHashBands)
+	}
+	if config.MinHashThreshold != 0.7 {
+		t.Errorf("expected threshold to default to 0.7, got %f", config.MinHashThreshold)
+	}
+	if config.ShingleK != 5 {
+		t.Errorf("expected shingle size to default to 5, got %d", config.ShingleK)
+	}
+}
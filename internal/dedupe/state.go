@@ -0,0 +1,214 @@
+package dedupe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+// stateVersion is bumped when the State file layout changes incompatibly.
+const stateVersion = 1
+
+// State is a persistent store of kept chunk signatures used to drop chunks already
+// seen in previous runs. Hashes and signatures are computed with the algorithm and
+// k-gram size recorded in the state, so later runs stay comparable even if their
+// Config differs.
+//
+// Chunk IDs restart at c0001 every run, so stored chunks are referenced as
+// "run<N>/<chunk ID>", where N counts the runs recorded in the state.
+type State struct {
+	Version   int               `json:"version"`
+	ExactHash string            `json:"exact_hash"` // Hash algorithm used for Exact keys
+	SimHashK  int               `json:"simhash_k"`  // k-gram size used for SimHash signatures
+	Runs      int               `json:"runs"`       // Number of runs recorded so far
+	Exact     map[string]string `json:"exact"`      // exact hash -> run-qualified chunk reference
+	SimHash   []StateSignature  `json:"simhash"`
+	index     *simhashIndex     // built on first use; not persisted
+	threshold int               // threshold the index was built for
+}
+
+// StateSignature is a stored SimHash signature with its run-qualified chunk reference.
+type StateSignature struct {
+	ChunkID   string `json:"chunk_id"`
+	Signature uint64 `json:"signature"`
+}
+
+// NewState returns an empty state that hashes with the given config's settings.
+func NewState(config Config) *State {
+	config.Validate()
+	return &State{
+		Version:   stateVersion,
+		ExactHash: config.ExactHash,
+		SimHashK:  config.SimHashK,
+		Exact:     make(map[string]string),
+		SimHash:   []StateSignature{},
+	}
+}
+
+// LoadState reads a state file. It always returns a usable state: a missing file
+// yields an empty state and a nil error, while an unreadable or corrupt file yields
+// an empty state and an error describing why, so callers can warn and start fresh.
+func LoadState(path string, config Config) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewState(config), nil
+	}
+	if err != nil {
+		return NewState(config), fmt.Errorf("failed to read dedup state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return NewState(config), fmt.Errorf("failed to parse dedup state %s: %w", path, err)
+	}
+	if state.Version != stateVersion {
+		return NewState(config), fmt.Errorf("unsupported dedup state version %d in %s", state.Version, path)
+	}
+	if state.ExactHash != "sha1" && state.ExactHash != "sha256" && state.ExactHash != "fnv" {
+		return NewState(config), fmt.Errorf("unknown exact_hash %q in dedup state %s", state.ExactHash, path)
+	}
+	if state.SimHashK <= 0 {
+		return NewState(config), fmt.Errorf("invalid simhash_k %d in dedup state %s", state.SimHashK, path)
+	}
+	if state.Exact == nil {
+		state.Exact = make(map[string]string)
+	}
+	if state.SimHash == nil {
+		state.SimHash = []StateSignature{}
+	}
+	// Entries saved before runs were numbered hold bare chunk IDs; mark them as
+	// coming from an unnumbered earlier run so they cannot pass for current IDs.
+	for key, id := range state.Exact {
+		state.Exact[key] = legacyRef(id)
+	}
+	for i := range state.SimHash {
+		state.SimHash[i].ChunkID = legacyRef(state.SimHash[i].ChunkID)
+	}
+	return &state, nil
+}
+
+// Save writes the state as JSON to path.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dedup state: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write dedup state: %w", err)
+	}
+	return nil
+}
+
+// legacyRef qualifies a bare chunk ID stored by earlier versions with run 0.
+func legacyRef(id string) string {
+	if strings.Contains(id, "/") {
+		return id
+	}
+	return "run0/" + id
+}
+
+// match reports whether chunk duplicates a chunk stored from a previous run.
+// SimHash signatures are only consulted for near-duplicate methods, and not for
+// chunks below Config.ShortChunkLength, which no signature describes reliably.
+func (s *State) match(chunk text.Chunk, config Config) (DroppedChunk, bool) {
+	if chunk.Norm == "" {
+		return DroppedChunk{}, false
+	}
+
+	if id, ok := s.Exact[exactHashKey(chunk.Norm, s.ExactHash)]; ok {
+		return newDroppedChunk(chunk, "cross_run_duplicate", id, 0), true
+	}
+	if config.Method == "exact" || utf8.RuneCountInString(chunk.Norm) < config.ShortChunkLength {
+		return DroppedChunk{}, false
+	}
+
+	if s.index == nil || s.threshold != config.SimHashThreshold {
+		s.index = newSimhashIndex(config.SimHashThreshold)
+		s.threshold = config.SimHashThreshold
+		for i, stored := range s.SimHash {
+			s.index.add(stored.Signature, i)
+		}
+	}
+
+	sig := simhash64(chunk.Norm, s.SimHashK)
+	if sig == 0 {
+		return DroppedChunk{}, false // See simhashMatcher.check
+	}
+	best, minDistance := -1, 65
+	for _, i := range s.index.candidates(sig) {
+		if s.SimHash[i].Signature == 0 {
+			continue // Stored by earlier versions for text too short to sign
+		}
+		dist := hammingDistance(sig, s.SimHash[i].Signature)
+		if dist <= config.SimHashThreshold && dist < minDistance {
+			best, minDistance = i, dist
+		}
+	}
+	if best >= 0 {
+		return newDroppedChunk(chunk, "cross_run_duplicate", s.SimHash[best].ChunkID, minDistance), true
+	}
+	return DroppedChunk{}, false
+}
+
+// add records the kept chunks of one run so later runs can match them. Chunks with
+// a zero SimHash signature, such as text shorter than SimHashK, are only recorded by
+// exact hash.
+func (s *State) add(chunks []text.Chunk) {
+	s.Runs++
+	for _, chunk := range chunks {
+		if chunk.Norm == "" {
+			continue
+		}
+		ref := fmt.Sprintf("run%d/%s", s.Runs, chunk.ID)
+		if key := exactHashKey(chunk.Norm, s.ExactHash); s.Exact[key] == "" {
+			s.Exact[key] = ref
+		}
+		sig := simhash64(chunk.Norm, s.SimHashK)
+		if sig == 0 {
+			continue
+		}
+		if s.index != nil {
+			s.index.add(sig, len(s.SimHash))
+		}
+		s.SimHash = append(s.SimHash, StateSignature{ChunkID: ref, Signature: sig})
+	}
+}
+
+// DedupeWithState runs Dedupe after dropping chunks that match the state with reason
+// "cross_run_duplicate", then appends the signatures of the kept chunks to the state.
+// The MatchedChunkID of a cross-run duplicate is the run-qualified reference of the
+// stored chunk, never an ID of the current run. A nil state behaves like Dedupe.
+func DedupeWithState(chunks []text.Chunk, config Config, state *State) DedupeResult {
+	if state == nil {
+		return Dedupe(chunks, config)
+	}
+	config.Validate()
+
+	var fresh []text.Chunk
+	var crossRun []DroppedChunk
+	for _, chunk := range chunks {
+		if d, dup := state.match(chunk, config); dup {
+			crossRun = append(crossRun, d)
+		} else {
+			fresh = append(fresh, chunk)
+		}
+	}
+
+	result := Dedupe(fresh, config)
+	if len(crossRun) > 0 {
+		result.Dropped = append(crossRun, result.Dropped...)
+		sortDropped(chunks, result.Dropped)
+		result.Stats.InputCount = len(chunks)
+		result.Stats.DroppedCount += len(crossRun)
+		result.Stats.CrossRunDups = len(crossRun)
+	}
+
+	state.add(result.KeptChunks)
+	return result
+}
@@ -0,0 +1,198 @@
+package dedupe
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestDedupeWithState_TwoRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	config := DefaultConfig()
+
+	shared := randomParagraph(1, 30)
+	firstRun := []text.Chunk{
+		{ID: "c0001", Text: shared, Norm: shared, Index: 0},
+		{ID: "c0002", Text: randomParagraph(2, 30), Norm: randomParagraph(2, 30), Index: 1},
+	}
+
+	state, err := LoadState(path, config)
+	if err != nil {
+		t.Fatalf("LoadState on missing file failed: %v", err)
+	}
+	first := DedupeWithState(firstRun, config, state)
+	if first.Stats.KeptCount != 2 || first.Stats.CrossRunDups != 0 {
+		t.Fatalf("first run: expected 2 kept and no cross-run drops, got %+v", first.Stats)
+	}
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Second run repeats c0001 verbatim, a near copy of c0002, and one new chunk
+	nearCopy := randomParagraph(2, 30) + " end"
+	fresh := randomParagraph(3, 30)
+	secondRun := []text.Chunk{
+		{ID: "c0001", Text: shared, Norm: shared, Index: 0},
+		{ID: "c0002", Text: nearCopy, Norm: nearCopy, Index: 1},
+		{ID: "c0003", Text: fresh, Norm: fresh, Index: 2},
+	}
+
+	state, err = LoadState(path, config)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	second := DedupeWithState(secondRun, config, state)
+
+	if second.Stats.InputCount != 3 || second.Stats.KeptCount != 1 || second.Stats.DroppedCount != 2 {
+		t.Errorf("second run: unexpected stats %+v", second.Stats)
+	}
+	if second.Stats.CrossRunDups != 2 {
+		t.Errorf("expected 2 cross-run duplicates, got %d", second.Stats.CrossRunDups)
+	}
+	if len(second.KeptChunks) != 1 || second.KeptChunks[0].ID != "c0003" {
+		t.Errorf("expected only c0003 kept, got %+v", second.KeptChunks)
+	}
+	for _, d := range second.Dropped {
+		if d.Reason != "cross_run_duplicate" {
+			t.Errorf("expected cross_run_duplicate reason, got %s", d.Reason)
+		}
+		if d.MatchedChunkID != "run1/"+d.ChunkID {
+			t.Errorf("expected %s to match its first-run chunk, got %s", d.ChunkID, d.MatchedChunkID)
+		}
+	}
+	if len(state.SimHash) != 3 {
+		t.Errorf("expected 3 stored signatures after second run, got %d", len(state.SimHash))
+	}
+}
+
+func TestDedupeWithState_ExactMethodIgnoresSimHash(t *testing.T) {
+	config := DefaultConfig()
+	config.Method = "exact"
+	state := NewState(config)
+
+	base := randomParagraph(1, 30)
+	DedupeWithState([]text.Chunk{{ID: "c0001", Text: base, Norm: base}}, config, state)
+
+	near := base + " end"
+	result := DedupeWithState([]text.Chunk{{ID: "c0001", Text: near, Norm: near}}, config, state)
+	if result.Stats.CrossRunDups != 0 || result.Stats.KeptCount != 1 {
+		t.Errorf("exact method should not drop near copies across runs, got %+v", result.Stats)
+	}
+}
+
+func TestDedupeWithState_ShortChunksAcrossRuns(t *testing.T) {
+	config := DefaultConfig()
+	state := NewState(config)
+	// An earlier version stored zero signatures for short text
+	state.SimHash = append(state.SimHash, StateSignature{ChunkID: "c0009", Signature: 0})
+
+	first := DedupeWithState([]text.Chunk{{ID: "c0001", Text: "ab", Norm: "ab"}}, config, state)
+	if first.Stats.KeptCount != 1 {
+		t.Fatalf("first run: expected the short chunk kept, got %+v", first.Stats)
+	}
+	if len(state.SimHash) != 1 {
+		t.Errorf("expected no signature stored for a short chunk, got %+v", state.SimHash)
+	}
+
+	// Distinct short chunks are kept; only an exact repeat is a cross-run duplicate
+	second := DedupeWithState([]text.Chunk{
+		{ID: "c0001", Text: "cd", Norm: "cd", Index: 0},
+		{ID: "c0002", Text: "ab", Norm: "ab", Index: 1},
+	}, config, state)
+	if second.Stats.KeptCount != 1 || second.Stats.CrossRunDups != 1 || second.Dropped[0].ChunkID != "c0002" {
+		t.Errorf("second run: expected only the repeat dropped, got %+v", second.Dropped)
+	}
+}
+
+func TestDedupeWithState_NilState(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Same", Norm: "same"},
+		{ID: "c0002", Text: "Same", Norm: "same"},
+	}
+	result := DedupeWithState(chunks, DefaultConfig(), nil)
+	if result.Stats.ExactDups != 1 {
+		t.Errorf("expected nil state to behave like Dedupe, got %+v", result.Stats)
+	}
+}
+
+func TestLoadState_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadState(path, DefaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "failed to parse dedup state") {
+		t.Errorf("expected parse error, got: %v", err)
+	}
+	if state == nil || len(state.Exact) != 0 || len(state.SimHash) != 0 {
+		t.Errorf("expected a fresh empty state, got %+v", state)
+	}
+}
+
+func TestLoadState_UsesStoredSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	config := DefaultConfig()
+	config.ExactHash = "fnv"
+	config.SimHashK = 3
+	if err := NewState(config).Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadState(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if state.ExactHash != "fnv" || state.SimHashK != 3 {
+		t.Errorf("expected stored settings fnv/3, got %s/%d", state.ExactHash, state.SimHashK)
+	}
+}
+
+func TestDedupeWithState_RunQualifiedMatches(t *testing.T) {
+	config := DefaultConfig()
+	state := NewState(config)
+	first := randomParagraph(5, 30)
+	second := randomParagraph(6, 30)
+
+	DedupeWithState([]text.Chunk{{ID: "c0001", Text: first, Norm: first}}, config, state)
+	DedupeWithState([]text.Chunk{{ID: "c0001", Text: second, Norm: second}}, config, state)
+
+	// The third run's c0001 repeats the second run's c0001, not its own
+	result := DedupeWithState([]text.Chunk{
+		{ID: "c0001", Text: "fresh text", Norm: "fresh text", Index: 0},
+		{ID: "c0002", Text: second, Norm: second, Index: 1},
+	}, config, state)
+	if len(result.Dropped) != 1 || result.Dropped[0].MatchedChunkID != "run2/c0001" {
+		t.Errorf("expected c0002 to match run2/c0001, got %+v", result.Dropped)
+	}
+	if state.Runs != 3 {
+		t.Errorf("expected 3 recorded runs, got %d", state.Runs)
+	}
+}
+
+func TestLoadState_QualifiesLegacyIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	config := DefaultConfig()
+	legacy := NewState(config)
+	base := randomParagraph(7, 30)
+	legacy.Exact[exactHashKey(base, legacy.ExactHash)] = "c0004"
+	legacy.SimHash = append(legacy.SimHash, StateSignature{ChunkID: "c0004", Signature: simhash64(base, legacy.SimHashK)})
+	if err := legacy.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadState(path, config)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	result := DedupeWithState([]text.Chunk{{ID: "c0004", Text: base, Norm: base}}, config, state)
+	if len(result.Dropped) != 1 || result.Dropped[0].MatchedChunkID != "run0/c0004" {
+		t.Errorf("expected the legacy entry reported as run0/c0004, got %+v", result.Dropped)
+	}
+	if state.SimHash[0].ChunkID != "run0/c0004" {
+		t.Errorf("expected the legacy signature qualified, got %s", state.SimHash[0].ChunkID)
+	}
+}
@@ -0,0 +1,94 @@
+package dedupe
+
+import "github.com/jonkmatsumo/bulk-ocr/internal/text"
+
+// DedupeStream is the streaming form of Dedupe. Each chunk received from in is decided
+// as soon as it arrives and sent to the kept or dropped channel; both channels are
+// closed once in is closed. Callers must receive from both channels until they close,
+// otherwise the stream blocks.
+//
+// Kept chunks are emitted in input order, and decisions match Dedupe for the same
+// input and config, except that the first occurrence is always kept (KeepStrategy
+// "longest" needs whole duplicate groups and is ignored here). For method "both" the
+// dropped channel carries one record per chunk, preferring the exact match. Only
+// chunks that are finally kept become match targets, so every dropped record names
+// a kept chunk; an exact copy of a near-duplicate matches the chunk it was dropped
+// against, as in Dedupe.
+//
+// Memory: the exact pass keeps one hash per distinct kept or near-duplicate text.
+// With a positive Window, SimHash and Jaccard retain at most 2*Window signatures or
+// shingle sets, so memory beyond the hash set is bounded. Window 0, GlobalWindow and
+// the minhash method retain one for every kept chunk.
+func DedupeStream(in <-chan text.Chunk, config Config) (<-chan text.Chunk, <-chan DroppedChunk) {
+	config.Validate()
+
+	keptCh := make(chan text.Chunk)
+	droppedCh := make(chan DroppedChunk)
+
+	exact := newExactMatcher(config)
+	var near nearMatcher
+	switch config.Method {
+	case "minhash":
+		near = newMinhashMatcher(config)
+	case "jaccard":
+		near = newJaccardMatcher(config)
+	case "exact":
+		// No near-duplicate pass
+	default:
+		near = simhashNear{newSimhashMatcher(config)}
+	}
+
+	go func() {
+		defer close(keptCh)
+		defer close(droppedCh)
+
+		for chunk := range in {
+			var d DroppedChunk
+			var dup bool
+			if config.Method == "both" {
+				// Both passes see every chunk independently, as in Dedupe
+				d, dup = exact.check(chunk)
+				if nd, ndup := near.check(chunk); ndup && !dup {
+					d, dup = nd, true
+					exact.commitDropped(nd)
+				}
+			} else {
+				d, dup = exact.check(chunk)
+				if !dup && near != nil {
+					if d, dup = near.check(chunk); dup {
+						exact.commitDropped(d)
+					}
+				}
+			}
+
+			if dup {
+				droppedCh <- d
+				continue
+			}
+			// Only kept chunks become match targets, so every drop names a kept chunk
+			exact.commit()
+			if near != nil {
+				near.commit()
+			}
+			keptCh <- chunk
+		}
+	}()
+
+	return keptCh, droppedCh
+}
+
+// nearMatcher is the near-duplicate pass of DedupeStream.
+type nearMatcher interface {
+	check(chunk text.Chunk) (DroppedChunk, bool)
+	commit()
+}
+
+// simhashNear adapts simhashMatcher, whose check also returns the signature, to nearMatcher.
+type simhashNear struct {
+	*simhashMatcher
+}
+
+func (n simhashNear) check(chunk text.Chunk) (DroppedChunk, bool) {
+	_, d, dup := n.simhashMatcher.check(chunk)
+	return d, dup
+}
@@ -0,0 +1,157 @@
+package dedupe
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+// collectStream feeds chunks through DedupeStream and gathers both outputs.
+func collectStream(chunks []text.Chunk, config Config) ([]text.Chunk, []DroppedChunk) {
+	in := make(chan text.Chunk)
+	keptCh, droppedCh := DedupeStream(in, config)
+
+	go func() {
+		defer close(in)
+		for _, c := range chunks {
+			in <- c
+		}
+	}()
+
+	var kept []text.Chunk
+	var dropped []DroppedChunk
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for d := range droppedCh {
+			dropped = append(dropped, d)
+		}
+	}()
+	for c := range keptCh {
+		kept = append(kept, c)
+	}
+	wg.Wait()
+	return kept, dropped
+}
+
+// streamCorpus mixes near-duplicates beyond small windows with exact repeats of every
+// chunk, near-duplicates included.
+func streamCorpus() []text.Chunk {
+	chunks := nearDupCorpus(10, 30)
+	n := len(chunks)
+	for i := 0; i < n; i++ {
+		c := chunks[i]
+		idx := len(chunks)
+		c.ID = fmt.Sprintf("c%04d", idx+1)
+		c.Index = idx
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+func TestDedupeStream_MatchesDedupe(t *testing.T) {
+	chunks := streamCorpus()
+
+	tests := []struct {
+		name   string
+		method string
+		window int
+	}{
+		{"exact", "exact", 250},
+		{"simhash small window", "simhash", 5},
+		{"simhash compare all", "simhash", 0},
+		{"simhash global", "simhash", GlobalWindow},
+		{"minhash", "minhash", 250},
+		{"jaccard small window", "jaccard", 5},
+		{"both", "both", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Method = tt.method
+			config.Window = tt.window
+			config.SimHashThreshold = 10
+
+			want := Dedupe(chunks, config)
+			kept, dropped := collectStream(chunks, config)
+
+			if !reflect.DeepEqual(kept, want.KeptChunks) {
+				t.Errorf("kept mismatch: stream %d chunks, Dedupe %d chunks", len(kept), len(want.KeptChunks))
+			}
+
+			wantDropped := append([]DroppedChunk(nil), want.Dropped...)
+			// Dedupe groups dropped records by pass (and "both" in map order); compare by chunk
+			byID := func(ds []DroppedChunk) {
+				sort.Slice(ds, func(i, j int) bool { return ds[i].ChunkID < ds[j].ChunkID })
+			}
+			byID(dropped)
+			byID(wantDropped)
+			if !reflect.DeepEqual(dropped, wantDropped) {
+				t.Errorf("dropped mismatch:\nstream: %+v\nDedupe: %+v", dropped, wantDropped)
+			}
+		})
+	}
+}
+
+func TestDedupeStream_MatchesAreKept(t *testing.T) {
+	chunks := streamCorpus()
+	for _, method := range []string{"exact", "simhash", "both", "minhash", "jaccard"} {
+		for _, window := range []int{5, 0, GlobalWindow} {
+			config := DefaultConfig()
+			config.Method = method
+			config.Window = window
+			config.SimHashThreshold = 10
+
+			kept, dropped := collectStream(chunks, config)
+			if len(kept)+len(dropped) != len(chunks) {
+				t.Errorf("%s window %d: expected %d decisions, got %d", method, window, len(chunks), len(kept)+len(dropped))
+			}
+			result := DedupeResult{KeptChunks: kept, Dropped: dropped}
+			if err := result.CheckMatches(); err != nil {
+				t.Errorf("%s window %d: %v", method, window, err)
+			}
+		}
+	}
+}
+
+func TestDedupeStream_KeptInInputOrder(t *testing.T) {
+	chunks := streamCorpus()
+	kept, dropped := collectStream(chunks, DefaultConfig())
+
+	if len(kept)+len(dropped) != len(chunks) {
+		t.Fatalf("expected %d decisions, got %d", len(chunks), len(kept)+len(dropped))
+	}
+	for i := 1; i < len(kept); i++ {
+		if kept[i].Index <= kept[i-1].Index {
+			t.Fatalf("kept chunks out of order at %d: %d after %d", i, kept[i].Index, kept[i-1].Index)
+		}
+	}
+}
+
+func TestDedupeStream_EmptyInput(t *testing.T) {
+	kept, dropped := collectStream(nil, DefaultConfig())
+	if len(kept) != 0 || len(dropped) != 0 {
+		t.Errorf("expected no output, got %d kept and %d dropped", len(kept), len(dropped))
+	}
+}
+
+func TestSimhashMatcher_WindowBounded(t *testing.T) {
+	config := DefaultConfig()
+	config.Window = 4
+	m := newSimhashMatcher(config)
+	for i := 0; i < 100; i++ {
+		norm := randomParagraph(uint64(i+1), 20)
+		if _, _, dup := m.check(text.Chunk{ID: fmt.Sprintf("c%04d", i+1), Norm: norm}); !dup {
+			m.commit()
+		}
+	}
+	if len(m.sigs) > 2*config.Window {
+		t.Errorf("expected at most %d retained signatures, got %d", 2*config.Window, len(m.sigs))
+	}
+}
@@ -0,0 +1,48 @@
+package fsutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TempPath returns a temp file path next to path. The name includes the process ID and a
+// random suffix, so concurrent writers targeting the same path never share a temp file.
+func TempPath(path string) (string, error) {
+	var suffix [6]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", fmt.Errorf("failed to generate temp file suffix: %w", err)
+	}
+	dir, base := filepath.Split(path)
+	return filepath.Join(dir, fmt.Sprintf(".%s.%d-%s.tmp", base, os.Getpid(), hex.EncodeToString(suffix[:]))), nil
+}
+
+// WriteFileAtomic writes data to a unique temp file beside path and renames it into place,
+// so readers and concurrent writers only ever see a complete file. The last rename wins.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath, err := TempPath(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file %s: %w", tmpPath, err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp file %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file to %s: %w", path, err)
+	}
+	return nil
+}
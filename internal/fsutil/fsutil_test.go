@@ -0,0 +1,83 @@
+package fsutil
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTempPath_Unique(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.md")
+	a, err := TempPath(path)
+	if err != nil {
+		t.Fatalf("TempPath failed: %v", err)
+	}
+	b, err := TempPath(path)
+	if err != nil {
+		t.Fatalf("TempPath failed: %v", err)
+	}
+	if a == b {
+		t.Errorf("expected unique temp paths, got %s twice", a)
+	}
+	if filepath.Dir(a) != filepath.Dir(path) {
+		t.Errorf("expected temp path beside %s, got %s", path, a)
+	}
+	if !strings.Contains(filepath.Base(a), "result.md") {
+		t.Errorf("expected temp name to include the final name, got %s", a)
+	}
+}
+
+func TestWriteFileAtomic_ConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+
+	// Large payloads make interleaved writes to a shared temp file detectable
+	payloads := [][]byte{
+		bytes.Repeat([]byte("a"), 1<<20),
+		bytes.Repeat([]byte("b"), 1<<20),
+	}
+
+	for round := 0; round < 10; round++ {
+		var wg sync.WaitGroup
+		errs := make([]error, len(payloads))
+		for i, data := range payloads {
+			wg.Add(1)
+			go func(i int, data []byte) {
+				defer wg.Done()
+				errs[i] = WriteFileAtomic(path, data, 0644)
+			}(i, data)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("WriteFileAtomic failed: %v", err)
+			}
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read result: %v", err)
+		}
+		if !bytes.Equal(got, payloads[0]) && !bytes.Equal(got, payloads[1]) {
+			t.Fatalf("round %d: file is corrupted (len %d), expected one writer's complete payload", round, len(got))
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the final file to remain, got %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomic_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "out.txt")
+	if err := WriteFileAtomic(path, []byte("x"), 0644); err == nil {
+		t.Error("expected error when the target directory does not exist")
+	}
+}
@@ -0,0 +1,209 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// DownscaleImage shrinks the JPEG or PNG at path so that its longest edge is at most
+// maxDimension pixels, keeping its aspect ratio and format. Resampling uses a
+// Catmull-Rom filter and is deterministic, so the same input always gives the same
+// bytes. Returns whether the file was changed: smaller images, other formats and a
+// maxDimension of 0 or less leave the file alone. JPEGs are re-encoded without EXIF
+// data, so one with an EXIF orientation tag is first turned upright as by
+// AutoOrientJPEG rather than losing its orientation.
+func DownscaleImage(path string, maxDimension int) (bool, error) {
+	if maxDimension <= 0 {
+		return false, nil
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	isJPEG := ext == ".jpg" || ext == ".jpeg"
+	if !isJPEG && ext != ".png" {
+		return false, nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if _, _, ok := fitDimensions(cfg.Width, cfg.Height, maxDimension); !ok {
+		return false, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if orientation := exifOrientation(original); isJPEG && orientation >= 2 && orientation <= 8 {
+		img = orient(img, orientation)
+	}
+	dw, dh, _ := fitDimensions(img.Bounds().Dx(), img.Bounds().Dy(), maxDimension)
+	scaled := resample(img, dw, dh)
+
+	var buf bytes.Buffer
+	if isJPEG {
+		err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: reencodedJPEGQuality})
+	} else {
+		err = png.Encode(&buf, scaled)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := fsutil.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return false, fmt.Errorf("failed to write downscaled image: %w", err)
+	}
+	return true, nil
+}
+
+// fitDimensions returns the size of a w x h image scaled so that its longest edge is
+// maxDimension, and false if it already fits.
+func fitDimensions(w, h, maxDimension int) (int, int, bool) {
+	longest := w
+	if h > longest {
+		longest = h
+	}
+	if longest <= maxDimension {
+		return w, h, false
+	}
+	scale := float64(maxDimension) / float64(longest)
+	dw := max(1, int(math.Round(float64(w)*scale)))
+	dh := max(1, int(math.Round(float64(h)*scale)))
+	return dw, dh, true
+}
+
+// filterTaps holds the source range and normalized filter weights for one output pixel.
+type filterTaps struct {
+	start   int
+	weights []float64
+}
+
+// catmullRom is the Catmull-Rom cubic kernel, with support [-2, 2].
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return (1.5*x-2.5)*x*x + 1
+	case x < 2:
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	default:
+		return 0
+	}
+}
+
+// computeTaps returns the filter taps for resampling srcLen pixels to dstLen pixels.
+// The kernel is widened by the scale factor so that every source pixel contributes.
+func computeTaps(srcLen, dstLen int) []filterTaps {
+	scale := float64(srcLen) / float64(dstLen)
+	support := 2 * scale
+	taps := make([]filterTaps, dstLen)
+	for i := range taps {
+		center := (float64(i)+0.5)*scale - 0.5
+		start := max(0, int(math.Ceil(center-support)))
+		end := min(srcLen-1, int(math.Floor(center+support)))
+
+		weights := make([]float64, end-start+1)
+		var sum float64
+		for j := range weights {
+			weights[j] = catmullRom((float64(start+j) - center) / scale)
+			sum += weights[j]
+		}
+		for j := range weights {
+			weights[j] /= sum
+		}
+		taps[i] = filterTaps{start: start, weights: weights}
+	}
+	return taps
+}
+
+// resample scales img to dw x dh, filtering rows then columns. Grayscale images stay
+// grayscale; everything else becomes RGBA.
+func resample(img image.Image, dw, dh int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	_, gray := img.(*image.Gray)
+	channels := 4
+	if gray {
+		channels = 1
+	}
+
+	// Premultiplied 16-bit samples of the source
+	src := make([]float64, sw*sh*channels)
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			i := (y*sw + x) * channels
+			if gray {
+				src[i] = float64(color.Gray16Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray16).Y)
+				continue
+			}
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			src[i], src[i+1], src[i+2], src[i+3] = float64(r), float64(g), float64(bl), float64(a)
+		}
+	}
+
+	// Horizontal pass: sw x sh -> dw x sh
+	xTaps := computeTaps(sw, dw)
+	rows := make([]float64, dw*sh*channels)
+	for y := 0; y < sh; y++ {
+		for x, tap := range xTaps {
+			out := (y*dw + x) * channels
+			for j, w := range tap.weights {
+				in := (y*sw + tap.start + j) * channels
+				for c := 0; c < channels; c++ {
+					rows[out+c] += src[in+c] * w
+				}
+			}
+		}
+	}
+
+	// Vertical pass: dw x sh -> dw x dh
+	yTaps := computeTaps(sh, dh)
+	dst := make([]float64, dw*dh*channels)
+	for y, tap := range yTaps {
+		for x := 0; x < dw; x++ {
+			out := (y*dw + x) * channels
+			for j, w := range tap.weights {
+				in := ((tap.start+j)*dw + x) * channels
+				for c := 0; c < channels; c++ {
+					dst[out+c] += rows[in+c] * w
+				}
+			}
+		}
+	}
+
+	// The filter can overshoot, so clamp to valid 8-bit values
+	to8 := func(v, limit float64) uint8 {
+		v = math.Round(math.Min(math.Max(v, 0), limit) / 257)
+		return uint8(v)
+	}
+	rect := image.Rect(0, 0, dw, dh)
+	if gray {
+		out := image.NewGray(rect)
+		for i, v := range dst {
+			out.Pix[i] = to8(v, 0xffff)
+		}
+		return out
+	}
+	out := image.NewRGBA(rect)
+	for i := 0; i < len(dst); i += 4 {
+		alpha := math.Min(math.Max(dst[i+3], 0), 0xffff)
+		out.Pix[i] = to8(dst[i], alpha)
+		out.Pix[i+1] = to8(dst[i+1], alpha)
+		out.Pix[i+2] = to8(dst[i+2], alpha)
+		out.Pix[i+3] = to8(alpha, 0xffff)
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGradientJPEG writes a w x h color JPEG with a diagonal gradient.
+func writeGradientJPEG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write JPEG: %v", err)
+	}
+}
+
+func imageConfig(t *testing.T, path string) (image.Config, string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", path, err)
+	}
+	return cfg, format
+}
+
+func TestDownscaleImage_ScalesToCap(t *testing.T) {
+	dir := t.TempDir()
+	jpgPath := filepath.Join(dir, "0001.jpg")
+	writeGradientJPEG(t, jpgPath, 400, 300)
+	pngPath := filepath.Join(dir, "0002.png")
+	writeSyntheticPNG(t, pngPath) // 200x120
+
+	tests := []struct {
+		path          string
+		format        string
+		width, height int
+	}{
+		{jpgPath, "jpeg", 100, 75},
+		{pngPath, "png", 100, 60},
+	}
+	for _, tt := range tests {
+		changed, err := DownscaleImage(tt.path, 100)
+		if err != nil {
+			t.Fatalf("DownscaleImage(%s) failed: %v", filepath.Base(tt.path), err)
+		}
+		if !changed {
+			t.Errorf("expected %s to be downscaled", filepath.Base(tt.path))
+		}
+		cfg, format := imageConfig(t, tt.path)
+		if format != tt.format {
+			t.Errorf("%s: expected format %s, got %s", filepath.Base(tt.path), tt.format, format)
+		}
+		if cfg.Width != tt.width || cfg.Height != tt.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", filepath.Base(tt.path), tt.width, tt.height, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func TestDownscaleImage_KeepsOrientation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeOrientedJPEG(t, path, 6, binary.LittleEndian) // 16x8, displayed rotated to 8x16
+
+	changed, err := DownscaleImage(path, 8)
+	if err != nil {
+		t.Fatalf("DownscaleImage failed: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected the JPEG to be downscaled")
+	}
+
+	// The dropped tag is applied to the pixels: the black left half ends up on top
+	img := decodeJPEGFile(t, path)
+	if b := img.Bounds(); b.Dx() != 4 || b.Dy() != 8 {
+		t.Fatalf("expected upright 4x8 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	if !isDark(img, 2, 1) || isDark(img, 2, 6) {
+		t.Error("expected the top half dark and the bottom half light")
+	}
+}
+
+func TestDownscaleImage_SmallImageUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.jpg")
+	writeGradientJPEG(t, path, 80, 60)
+	before, _ := os.ReadFile(path)
+
+	for _, maxDimension := range []int{0, 80, 100} {
+		changed, err := DownscaleImage(path, maxDimension)
+		if err != nil {
+			t.Fatalf("DownscaleImage failed: %v", err)
+		}
+		if changed {
+			t.Errorf("max dimension %d: expected image to be left alone", maxDimension)
+		}
+	}
+	after, _ := os.ReadFile(path)
+	if !bytes.Equal(before, after) {
+		t.Error("expected small image bytes to be unchanged")
+	}
+}
+
+func TestDownscaleImage_Deterministic(t *testing.T) {
+	dir := t.TempDir()
+	var outputs [][]byte
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		path := filepath.Join(dir, name)
+		writeGradientJPEG(t, path, 333, 211)
+		if _, err := DownscaleImage(path, 97); err != nil {
+			t.Fatalf("DownscaleImage failed: %v", err)
+		}
+		data, _ := os.ReadFile(path)
+		outputs = append(outputs, data)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("expected identical output bytes for identical input")
+	}
+}
+
+func TestResample_PreservesFlatColor(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 50, 30))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+	out := resample(src, 20, 12)
+	gray, ok := out.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected grayscale output, got %T", out)
+	}
+	for i, v := range gray.Pix {
+		if v != 200 {
+			t.Fatalf("pixel %d: expected 200, got %d", i, v)
+		}
+	}
+}
+
+func TestStageImagesWithOptions_MaxDimension(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+	src := filepath.Join(srcDir, "IMG_1.jpg")
+	writeGradientJPEG(t, src, 400, 300)
+	original, _ := os.ReadFile(src)
+
+	staged, err := StageImagesWithOptions([]string{src}, outDir, StageOptions{MaxDimension: 200})
+	if err != nil {
+		t.Fatalf("StageImagesWithOptions failed: %v", err)
+	}
+
+	if cfg, _ := imageConfig(t, staged[0]); cfg.Width != 200 || cfg.Height != 150 {
+		t.Errorf("expected staged image to be 200x150, got %dx%d", cfg.Width, cfg.Height)
+	}
+	if data, _ := os.ReadFile(src); !bytes.Equal(data, original) {
+		t.Error("expected original image to be untouched")
+	}
+}
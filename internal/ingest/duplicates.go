@@ -0,0 +1,56 @@
+package ingest
+
+import (
+	"fmt"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/cache"
+)
+
+// ImageHasher computes a grouping key for an image file.
+// Images producing equal keys are reported as duplicates, so a perceptual hasher
+// (one that maps visually similar images to the same key) can be plugged in here.
+type ImageHasher func(path string) (string, error)
+
+// ByteHash is an ImageHasher that keys images by the SHA-256 of their bytes.
+func ByteHash(path string) (string, error) {
+	return cache.HashFile(path)
+}
+
+// DuplicateGroup is a set of images that share the same hash.
+type DuplicateGroup struct {
+	Hash  string   `json:"hash"`
+	Paths []string `json:"paths"`
+}
+
+// FindDuplicates hashes each image and returns groups containing more than one image.
+// Groups are ordered by their first member's position in paths, and members keep input order.
+func FindDuplicates(paths []string, hasher ImageHasher) ([]DuplicateGroup, error) {
+	if hasher == nil {
+		hasher = ByteHash
+	}
+
+	groupIndex := make(map[string]int) // hash -> index into groups
+	var groups []DuplicateGroup
+
+	for _, path := range paths {
+		hash, err := hasher(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+		if idx, ok := groupIndex[hash]; ok {
+			groups[idx].Paths = append(groups[idx].Paths, path)
+			continue
+		}
+		groupIndex[hash] = len(groups)
+		groups = append(groups, DuplicateGroup{Hash: hash, Paths: []string{path}})
+	}
+
+	// Only report groups with actual duplicates
+	var duplicates []DuplicateGroup
+	for _, g := range groups {
+		if len(g.Paths) > 1 {
+			duplicates = append(duplicates, g)
+		}
+	}
+	return duplicates, nil
+}
@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates_IdenticalImages(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"a.png": "same bytes",
+		"b.png": "different bytes",
+		"c.jpg": "same bytes",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+
+	images, err := ListImages(tmpDir, false)
+	if err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+
+	groups, err := FindDuplicates(images, ByteHash)
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 duplicate group, got %d: %+v", len(groups), groups)
+	}
+	want := []string{filepath.Join(tmpDir, "a.png"), filepath.Join(tmpDir, "c.jpg")}
+	if !reflect.DeepEqual(groups[0].Paths, want) {
+		t.Errorf("expected group %v, got %v", want, groups[0].Paths)
+	}
+	if len(groups[0].Hash) != 64 {
+		t.Errorf("expected SHA-256 hex hash, got %q", groups[0].Hash)
+	}
+}
+
+func TestFindDuplicates_NoDuplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("img%d.png", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("content %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	groups, err := FindDuplicates(paths, nil)
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("expected no duplicate groups, got %+v", groups)
+	}
+}
+
+func TestFindDuplicates_CustomHasher(t *testing.T) {
+	// A hasher that groups by extension stands in for a perceptual hash
+	byExt := func(path string) (string, error) {
+		return filepath.Ext(path), nil
+	}
+	paths := []string{"/x/1.png", "/x/2.jpg", "/x/3.png", "/x/4.jpg", "/x/5.jpeg"}
+
+	groups, err := FindDuplicates(paths, byExt)
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if groups[0].Hash != ".png" || groups[1].Hash != ".jpg" {
+		t.Errorf("expected groups ordered by first occurrence, got %+v", groups)
+	}
+}
+
+func TestFindDuplicates_HashError(t *testing.T) {
+	_, err := FindDuplicates([]string{"/nonexistent/image.png"}, ByteHash)
+	if err == nil {
+		t.Error("expected error for unreadable image")
+	}
+}
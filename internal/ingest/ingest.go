@@ -1,21 +1,137 @@
 package ingest
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
+// ListOptions configures ListImagesWithOptions.
+//
+// Include and Exclude patterns use path.Match syntax and are matched against the
+// slash-separated path relative to the listed directory. A pattern without a slash
+// matches the base name at any depth, so "scan_*" matches "2024/scan_1.jpg" and
+// "thumbnails" prunes every directory of that name. A trailing slash restricts a
+// pattern to directories.
+type ListOptions struct {
+	// Recursive also scans subdirectories.
+	Recursive bool
+	// Since, if non-zero, skips images last modified before this time.
+	// Directories are walked regardless of their own modification time.
+	Since time.Time
+	// Include, if non-empty, lists only images matching at least one of these
+	// patterns. Directories are not filtered by Include.
+	Include []string
+	// Exclude skips images, and prunes directories, matching any of these patterns.
+	// Exclude wins over Include.
+	Exclude []string
+	// MaxImages, if positive, fails the listing with a *LimitError when more images
+	// are found.
+	MaxImages int
+	// MaxTotalBytes, if positive, fails the listing with a *LimitError when the images
+	// found are larger than this in total.
+	MaxTotalBytes int64
+	// Sort orders the result (see SortImages); empty is SortNatural.
+	Sort SortMode
+	// Order, if non-empty, lists base names to put first in this order, with the
+	// other images after them in natural order (see OrderByManifest). It replaces Sort.
+	Order []string
+	// Reverse reverses the final order, e.g. newest first with SortMTime.
+	Reverse bool
+}
+
+// LimitError reports a listing over ListOptions.MaxImages or MaxTotalBytes. The walk
+// still completes, so the count and size are those of every image found.
+type LimitError struct {
+	Images        int   // Number of images found
+	Bytes         int64 // Total size of the images found
+	MaxImages     int
+	MaxTotalBytes int64
+}
+
+func (e *LimitError) Error() string {
+	if e.MaxImages > 0 && e.Images > e.MaxImages {
+		return fmt.Sprintf("found %d images (%d bytes), more than the limit of %d images", e.Images, e.Bytes, e.MaxImages)
+	}
+	return fmt.Sprintf("found %d images totalling %d bytes, more than the limit of %d bytes", e.Images, e.Bytes, e.MaxTotalBytes)
+}
+
+// ValidatePatterns reports the first malformed pattern in patterns.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the Include and Exclude patterns keep rel, a slash-separated
+// path relative to the listed directory. Directories are kept unless excluded.
+func (o ListOptions) Matches(rel string, isDir bool) bool {
+	if matchesAny(o.Exclude, rel, isDir) {
+		return false
+	}
+	return isDir || len(o.Include) == 0 || matchesAny(o.Include, rel, false)
+}
+
+// matchesAny reports whether rel, a slash-separated relative path, matches any of
+// patterns as described for ListOptions.
+func matchesAny(patterns []string, rel string, isDir bool) bool {
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// imageExtensions are the supported image file extensions, lowercase.
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+}
+
+// IsImage reports whether path has a supported image extension (case-insensitive).
+func IsImage(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
 // ListImages walks a directory and returns all image file paths.
 // Supported extensions: .jpg, .jpeg, .png (case-insensitive).
 // If recursive is false, only scans the top-level directory.
 // Returns absolute paths for reliable copying.
 func ListImages(dir string, recursive bool) ([]string, error) {
+	return ListImagesWithOptions(dir, ListOptions{Recursive: recursive})
+}
+
+// ListImagesWithOptions is ListImages with additional filters and a choice of order.
+func ListImagesWithOptions(dir string, opts ListOptions) ([]string, error) {
+	recursive := opts.Recursive
+	for _, patterns := range [][]string{opts.Include, opts.Exclude} {
+		if err := ValidatePatterns(patterns); err != nil {
+			return nil, err
+		}
+	}
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return nil, fmt.Errorf("directory does not exist: %s", dir)
 	}
@@ -27,32 +143,43 @@ func ListImages(dir string, recursive bool) ([]string, error) {
 	}
 
 	var images []string
-	extensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-	}
-
+	var totalBytes int64
 	walkFunc := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve relative path: %w", err)
+		}
+		rel = filepath.ToSlash(rel)
 		if info.IsDir() {
-			// If not recursive and this is a subdirectory, skip it
-			if !recursive && path != absDir {
+			if path == absDir {
+				return nil
+			}
+			// If not recursive or excluded, skip the subdirectory without reading it
+			if !recursive || !opts.Matches(rel, true) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if extensions[ext] {
+		if !opts.Matches(rel, false) {
+			return nil
+		}
+
+		if !opts.Since.IsZero() && info.ModTime().Before(opts.Since) {
+			return nil
+		}
+
+		if IsImage(path) {
 			// Convert to absolute path
 			absPath, err := filepath.Abs(path)
 			if err != nil {
 				return fmt.Errorf("failed to resolve path: %w", err)
 			}
 			images = append(images, absPath)
+			totalBytes += info.Size()
 		}
 		return nil
 	}
@@ -61,8 +188,22 @@ func ListImages(dir string, recursive bool) ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error walking directory: %w", err)
 	}
+	if (opts.MaxImages > 0 && len(images) > opts.MaxImages) || (opts.MaxTotalBytes > 0 && totalBytes > opts.MaxTotalBytes) {
+		return nil, &LimitError{Images: len(images), Bytes: totalBytes, MaxImages: opts.MaxImages, MaxTotalBytes: opts.MaxTotalBytes}
+	}
 
-	return NaturalSort(images), nil
+	if len(opts.Order) > 0 {
+		images, err = OrderByManifest(images, opts.Order)
+	} else {
+		images, err = SortImages(images, opts.Sort)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.Reverse {
+		reverse(images)
+	}
+	return images, nil
 }
 
 // NaturalSort sorts file paths using natural ordering.
@@ -78,6 +219,21 @@ func NaturalSort(paths []string) []string {
 	return sorted
 }
 
+// NaturalSortDesc sorts file paths in descending natural order, the exact reverse
+// of NaturalSort. For example, "IMG_10.jpg" comes before "IMG_9.jpg".
+func NaturalSortDesc(paths []string) []string {
+	sorted := NaturalSort(paths)
+	reverse(sorted)
+	return sorted
+}
+
+// reverse reverses paths in place.
+func reverse(paths []string) {
+	for i, j := 0, len(paths)-1; i < j; i, j = i+1, j-1 {
+		paths[i], paths[j] = paths[j], paths[i]
+	}
+}
+
 // naturalLess compares two strings using natural ordering.
 // For example, "IMG_9.jpg" comes before "IMG_10.jpg".
 func naturalLess(a, b string) bool {
@@ -173,11 +329,47 @@ func splitIntoSegments(s string) []string {
 	return segments
 }
 
+// StageOptions configures StageImagesWithOptions.
+type StageOptions struct {
+	// Retries is how many times a failed copy is retried (0 means no retries).
+	// Permanent errors such as a missing or unreadable source are never retried.
+	Retries int
+	// RetryBackoff is the wait before the first retry; it doubles on each later retry.
+	RetryBackoff time.Duration
+	// OnStaged, if set, is called with the number of images staged so far after each copy.
+	OnStaged func(done int)
+	// AutoOrient rotates staged JPEGs upright according to their EXIF orientation
+	// and drops the tag (see AutoOrientJPEG).
+	AutoOrient bool
+	// MaxDimension, if positive, downscales staged images whose longest edge is
+	// larger (see DownscaleImage).
+	MaxDimension int
+	// Preprocess converts staged images to grayscale or black and white after any
+	// downscaling (see PreprocessImage). Thresholded JPEGs are staged as PNGs.
+	Preprocess PreprocessMode
+}
+
+// copyFileFunc copies a single staged file; it can be swapped in tests.
+var copyFileFunc = copyFile
+
 // StageImages copies images to a preprocessed directory with sequential names.
-// Creates outDir/preprocessed/ and copies each image to 0001.jpg, 0002.png, etc.
-// Preserves original extensions. Returns list of staged file paths (absolute).
+// Creates outDir/preprocessed/, emptied of the images of any earlier run, and copies
+// each image to 0001.jpg, 0002.png, etc. Preserves original extensions. Returns list
+// of staged file paths (absolute).
 func StageImages(imagePaths []string, outDir string) ([]string, error) {
+	return StageImagesWithOptions(imagePaths, outDir, StageOptions{})
+}
+
+// StageImagesWithOptions is StageImages with per-file retries of transient copy errors,
+// optional EXIF orientation correction, downscaling and pixel preprocessing. Only the
+// staged copies are modified.
+func StageImagesWithOptions(imagePaths []string, outDir string, opts StageOptions) ([]string, error) {
 	preprocessedDir := filepath.Join(outDir, "preprocessed")
+	// An earlier run may have staged more images, or a page under another extension,
+	// which the PDF build would pick up alongside this run's
+	if err := os.RemoveAll(preprocessedDir); err != nil {
+		return nil, fmt.Errorf("failed to clear preprocessed directory: %w", err)
+	}
 	if err := os.MkdirAll(preprocessedDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create preprocessed directory: %w", err)
 	}
@@ -197,9 +389,21 @@ func StageImages(imagePaths []string, outDir string) ([]string, error) {
 		dstPath := filepath.Join(preprocessedDir, filename)
 
 		// Copy file
-		if err := copyFile(srcPath, dstPath); err != nil {
+		if err := copyWithRetry(srcPath, dstPath, opts); err != nil {
 			return nil, fmt.Errorf("failed to copy %s to %s: %w", srcPath, dstPath, err)
 		}
+		if opts.AutoOrient {
+			if _, err := AutoOrientJPEG(dstPath); err != nil {
+				return nil, fmt.Errorf("failed to orient %s: %w", srcPath, err)
+			}
+		}
+		if _, err := DownscaleImage(dstPath, opts.MaxDimension); err != nil {
+			return nil, fmt.Errorf("failed to downscale %s: %w", srcPath, err)
+		}
+		dstPath, err := PreprocessImage(dstPath, opts.Preprocess)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preprocess %s: %w", srcPath, err)
+		}
 
 		// Resolve absolute path of destination
 		absDstPath, err := filepath.Abs(dstPath)
@@ -208,11 +412,33 @@ func StageImages(imagePaths []string, outDir string) ([]string, error) {
 		}
 
 		stagedPaths = append(stagedPaths, absDstPath)
+		if opts.OnStaged != nil {
+			opts.OnStaged(len(stagedPaths))
+		}
 	}
 
 	return stagedPaths, nil
 }
 
+// copyWithRetry copies src to dst, retrying transient failures as configured by opts.
+func copyWithRetry(src, dst string, opts StageOptions) error {
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := copyFileFunc(src, dst)
+		if err == nil || attempt >= opts.Retries || isPermanentCopyError(err) {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isPermanentCopyError reports whether retrying a failed copy cannot help:
+// the source is missing or a path is not accessible.
+func isPermanentCopyError(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
 // copyFile copies a file from src to dst using io.Copy.
 func copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
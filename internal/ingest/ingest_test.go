@@ -1,11 +1,14 @@
 package ingest
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestListImages(t *testing.T) {
@@ -74,6 +77,22 @@ func TestListImages_EmptyDirectory(t *testing.T) {
 	}
 }
 
+func TestIsImage(t *testing.T) {
+	for path, want := range map[string]bool{
+		"scan.jpg":         true,
+		"/in/SCAN.JPEG":    true,
+		"page.Png":         true,
+		"notes.txt":        false,
+		"scan.jpg.part":    false,
+		".DS_Store":        false,
+		"/in/no-extension": false,
+	} {
+		if got := IsImage(path); got != want {
+			t.Errorf("IsImage(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
 func TestListImages_NestedDirectories(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -383,3 +402,292 @@ func TestStageImages_SequentialNaming(t *testing.T) {
 		}
 	}
 }
+
+func TestStageImagesWithOptions_RetriesTransientCopyError(t *testing.T) {
+	tmpDir := t.TempDir()
+	outDir := t.TempDir()
+
+	var imagePaths []string
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte("image "+name), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+		imagePaths = append(imagePaths, path)
+	}
+
+	// Fail the first copy of b.jpg once with a transient error
+	originalCopy := copyFileFunc
+	defer func() { copyFileFunc = originalCopy }()
+	calls := map[string]int{}
+	copyFileFunc = func(src, dst string) error {
+		calls[src]++
+		if filepath.Base(src) == "b.jpg" && calls[src] == 1 {
+			return errors.New("input/output error")
+		}
+		return originalCopy(src, dst)
+	}
+
+	staged, err := StageImagesWithOptions(imagePaths, outDir, StageOptions{Retries: 2})
+	if err != nil {
+		t.Fatalf("expected retry to recover, got: %v", err)
+	}
+	if len(staged) != 2 {
+		t.Fatalf("expected 2 staged files, got %d", len(staged))
+	}
+	if calls[imagePaths[1]] != 2 {
+		t.Errorf("expected 2 copy attempts for b.jpg, got %d", calls[imagePaths[1]])
+	}
+	content, err := os.ReadFile(staged[1])
+	if err != nil || string(content) != "image b.jpg" {
+		t.Errorf("expected staged copy of b.jpg, got %q (err %v)", content, err)
+	}
+}
+
+func TestStageImagesWithOptions_RetryLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "a.jpg")
+	if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+		t.Fatalf("failed to create test file: %v", err)
+	}
+
+	originalCopy := copyFileFunc
+	defer func() { copyFileFunc = originalCopy }()
+	attempts := 0
+	copyFileFunc = func(src, dst string) error {
+		attempts++
+		return errors.New("input/output error")
+	}
+
+	if _, err := StageImagesWithOptions([]string{path}, t.TempDir(), StageOptions{Retries: 2}); err == nil {
+		t.Fatal("expected error after retries are exhausted")
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts (1 + 2 retries), got %d", attempts)
+	}
+}
+
+func TestStageImagesWithOptions_MissingSourceNotRetried(t *testing.T) {
+	originalCopy := copyFileFunc
+	defer func() { copyFileFunc = originalCopy }()
+	attempts := 0
+	copyFileFunc = func(src, dst string) error {
+		attempts++
+		return originalCopy(src, dst)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.jpg")
+	_, err := StageImagesWithOptions([]string{missing}, t.TempDir(), StageOptions{Retries: 3})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not-exist error, got: %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected a missing source to be tried once, got %d attempts", attempts)
+	}
+}
+
+func TestListImagesWithOptions_Since(t *testing.T) {
+	tmpDir := t.TempDir()
+	subDir := filepath.Join(tmpDir, "sub")
+	if err := os.Mkdir(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	files := map[string]time.Time{
+		filepath.Join(tmpDir, "old.jpg"):    now.Add(-48 * time.Hour),
+		filepath.Join(tmpDir, "recent.jpg"): now.Add(-30 * time.Minute),
+		filepath.Join(subDir, "old.png"):    now.Add(-3 * time.Hour),
+		filepath.Join(subDir, "recent.png"): now.Add(-5 * time.Minute),
+		filepath.Join(tmpDir, "recent.txt"): now,
+	}
+	for path, modTime := range files {
+		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An old directory must still be walked
+	if err := os.Chtimes(subDir, now.Add(-72*time.Hour), now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	since := now.Add(-time.Hour)
+	images, err := ListImagesWithOptions(tmpDir, ListOptions{Recursive: true, Since: since})
+	if err != nil {
+		t.Fatalf("ListImagesWithOptions failed: %v", err)
+	}
+	want := []string{filepath.Join(tmpDir, "recent.jpg"), filepath.Join(subDir, "recent.png")}
+	if !reflect.DeepEqual(images, want) {
+		t.Errorf("expected %v, got %v", want, images)
+	}
+
+	images, err = ListImagesWithOptions(tmpDir, ListOptions{Since: since})
+	if err != nil {
+		t.Fatalf("ListImagesWithOptions failed: %v", err)
+	}
+	if !reflect.DeepEqual(images, want[:1]) {
+		t.Errorf("expected only top-level recent image without recursion, got %v", images)
+	}
+
+	all, err := ListImagesWithOptions(tmpDir, ListOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("ListImagesWithOptions failed: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("expected a zero Since to list all 4 images, got %v", all)
+	}
+}
+
+func TestListImagesWithOptions_IncludeExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{
+		"scan_1.jpg",
+		"scan_2.png",
+		"photo.jpg",
+		"2024/scan_10.jpg",
+		"2024/cover.jpg",
+		"2024/thumbnails/scan_1.jpg",
+		"thumbnails/scan_3.jpg",
+		"drafts/scan_4.jpg",
+	} {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	abs := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(tmpDir, filepath.FromSlash(name)))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{
+			name: "include base name at any depth",
+			opts: ListOptions{Include: []string{"scan_*"}},
+			want: abs("scan_1.jpg", "2024/thumbnails/scan_1.jpg", "scan_2.png", "thumbnails/scan_3.jpg", "drafts/scan_4.jpg", "2024/scan_10.jpg"),
+		},
+		{
+			name: "exclude prunes directories of that name",
+			opts: ListOptions{Include: []string{"scan_*"}, Exclude: []string{"thumbnails/"}},
+			want: abs("scan_1.jpg", "scan_2.png", "drafts/scan_4.jpg", "2024/scan_10.jpg"),
+		},
+		{
+			name: "exclude with a slash matches the relative path",
+			opts: ListOptions{Exclude: []string{"2024/*", "drafts"}},
+			want: abs("photo.jpg", "scan_1.jpg", "scan_2.png", "thumbnails/scan_3.jpg"),
+		},
+		{
+			name: "exclude wins over include",
+			opts: ListOptions{Include: []string{"scan_*"}, Exclude: []string{"*.png", "scan_1*"}},
+			want: abs("thumbnails/scan_3.jpg", "drafts/scan_4.jpg"),
+		},
+		{
+			name: "include with a slash",
+			opts: ListOptions{Include: []string{"2024/*.jpg"}},
+			want: abs("2024/cover.jpg", "2024/scan_10.jpg"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Recursive = true
+			images, err := ListImagesWithOptions(tmpDir, tt.opts)
+			if err != nil {
+				t.Fatalf("ListImagesWithOptions failed: %v", err)
+			}
+			if !reflect.DeepEqual(images, NaturalSort(tt.want)) {
+				t.Errorf("expected %v, got %v", NaturalSort(tt.want), images)
+			}
+		})
+	}
+}
+
+func TestListImagesWithOptions_ExcludedDirectoryNotRead(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "page.jpg"), []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Walking into an unreadable directory fails, so listing succeeds only if it is pruned
+	locked := filepath.Join(tmpDir, "thumbnails")
+	if err := os.Mkdir(locked, 0000); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(locked, 0755) })
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("directory permissions are not enforced (running as root?)")
+	}
+
+	images, err := ListImagesWithOptions(tmpDir, ListOptions{Recursive: true, Exclude: []string{"thumbnails"}})
+	if err != nil {
+		t.Fatalf("expected the excluded directory to be pruned, got %v", err)
+	}
+	if len(images) != 1 {
+		t.Errorf("expected 1 image, got %v", images)
+	}
+}
+
+func TestListImagesWithOptions_InvalidPattern(t *testing.T) {
+	_, err := ListImagesWithOptions(t.TempDir(), ListOptions{Exclude: []string{"[scan"}})
+	if err == nil || !strings.Contains(err.Error(), `invalid pattern "[scan"`) {
+		t.Errorf("expected invalid pattern error, got %v", err)
+	}
+}
+
+func TestListImagesWithOptions_Limits(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := 1; i <= 3; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("page%d.jpg", i))
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files that are not images count toward neither limit
+	if err := os.WriteFile(filepath.Join(tmpDir, "notes.txt"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want string
+	}{
+		{"too many images", ListOptions{MaxImages: 2}, "found 3 images (300 bytes), more than the limit of 2 images"},
+		{"too many bytes", ListOptions{MaxTotalBytes: 250}, "found 3 images totalling 300 bytes, more than the limit of 250 bytes"},
+		{"both exceeded", ListOptions{MaxImages: 1, MaxTotalBytes: 1}, "more than the limit of 1 images"},
+		{"at the limits", ListOptions{MaxImages: 3, MaxTotalBytes: 300}, ""},
+		{"no limits", ListOptions{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := ListImagesWithOptions(tmpDir, tt.opts)
+			if tt.want == "" {
+				if err != nil || len(images) != 3 {
+					t.Errorf("expected 3 images, got %v, %v", images, err)
+				}
+				return
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected *LimitError, got %v", err)
+			}
+			if limitErr.Images != 3 || limitErr.Bytes != 300 {
+				t.Errorf("expected 3 images and 300 bytes found, got %+v", limitErr)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %q", tt.want, err)
+			}
+		})
+	}
+}
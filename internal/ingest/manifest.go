@@ -0,0 +1,67 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// ManifestFile is the name of the staging manifest in the output directory.
+const ManifestFile = "manifest.json"
+
+// ManifestEntry maps a staged image back to the original it was copied from.
+type ManifestEntry struct {
+	Page     int    `json:"page"`     // 1-based page of the image in the OCR output
+	Staged   string `json:"staged"`   // Staged copy, relative to the output directory
+	Original string `json:"original"` // Absolute path of the original image
+}
+
+// NewManifest pairs staged images with their originals, which StageImages keeps in
+// the same order: the image on page N was staged from originals[N-1]. Staged paths
+// are made relative to outDir where possible.
+func NewManifest(outDir string, originals, staged []string) ([]ManifestEntry, error) {
+	if len(originals) != len(staged) {
+		return nil, fmt.Errorf("manifest: %d originals for %d staged images", len(originals), len(staged))
+	}
+	entries := make([]ManifestEntry, len(staged))
+	for i := range staged {
+		stagedPath := staged[i]
+		if rel, err := filepath.Rel(outDir, stagedPath); err == nil {
+			stagedPath = filepath.ToSlash(rel)
+		}
+		original, err := filepath.Abs(originals[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path: %w", err)
+		}
+		entries[i] = ManifestEntry{Page: i + 1, Staged: stagedPath, Original: original}
+	}
+	return entries, nil
+}
+
+// WriteManifest writes entries as indented JSON to outDir/manifest.json.
+func WriteManifest(outDir string, entries []ManifestEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(outDir, ManifestFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads a manifest written by WriteManifest.
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,68 @@
+package ingest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifest_MapsStagedImagesToOriginals(t *testing.T) {
+	inputDir := t.TempDir()
+	outDir := t.TempDir()
+	for _, name := range []string{"invoice_acme_10.jpg", "invoice_acme_2.PNG", "receipt.jpeg"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), []byte("image "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images, err := ListImages(inputDir, false)
+	if err != nil {
+		t.Fatalf("ListImages failed: %v", err)
+	}
+	staged, err := StageImages(images, outDir)
+	if err != nil {
+		t.Fatalf("StageImages failed: %v", err)
+	}
+
+	entries, err := NewManifest(outDir, images, staged)
+	if err != nil {
+		t.Fatalf("NewManifest failed: %v", err)
+	}
+	if err := WriteManifest(outDir, entries); err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	got, err := ReadManifest(filepath.Join(outDir, ManifestFile))
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+
+	want := []ManifestEntry{
+		{Page: 1, Staged: "preprocessed/0001.png", Original: filepath.Join(inputDir, "invoice_acme_2.PNG")},
+		{Page: 2, Staged: "preprocessed/0002.jpg", Original: filepath.Join(inputDir, "invoice_acme_10.jpg")},
+		{Page: 3, Staged: "preprocessed/0003.jpeg", Original: filepath.Join(inputDir, "receipt.jpeg")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected manifest %+v, got %+v", want, got)
+	}
+	// Each staged copy holds the bytes of the original it is mapped to
+	for _, entry := range got {
+		original, err := os.ReadFile(entry.Original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copied, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(entry.Staged)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(original, copied) {
+			t.Errorf("page %d: staged %s does not match %s", entry.Page, entry.Staged, entry.Original)
+		}
+	}
+}
+
+func TestNewManifest_LengthMismatch(t *testing.T) {
+	if _, err := NewManifest(t.TempDir(), []string{"a.jpg", "b.jpg"}, []string{"0001.jpg"}); err == nil {
+		t.Error("expected error for mismatched originals and staged images")
+	}
+}
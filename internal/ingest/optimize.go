@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// OptimizePNG re-encodes the PNG at path with maximum compression and replaces the
+// file if the result is smaller. Pixels are unchanged. Returns the bytes saved
+// (0 if the original was kept). Files without a .png extension are left alone.
+func OptimizePNG(path string) (int64, error) {
+	if strings.ToLower(filepath.Ext(path)) != ".png" {
+		return 0, nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	img, err := png.Decode(bytes.NewReader(original))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode PNG %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return 0, fmt.Errorf("failed to encode PNG %s: %w", path, err)
+	}
+	if buf.Len() >= len(original) {
+		return 0, nil
+	}
+
+	if err := fsutil.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write optimized PNG: %w", err)
+	}
+	return int64(len(original) - buf.Len()), nil
+}
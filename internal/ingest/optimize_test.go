@@ -0,0 +1,115 @@
+package ingest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSyntheticPNG writes a screenshot-like image (flat background with a few bars)
+// encoded without compression, as large PNGs often are.
+func writeSyntheticPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 200, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.RGBA{R: 250, G: 250, B: 250, A: 255}
+			if y%20 < 4 && x > 10 && x < 190 {
+				c = color.RGBA{R: 20, G: 20, B: 20, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write PNG: %v", err)
+	}
+	return img
+}
+
+func TestOptimizePNG_ShrinksAndKeepsPixels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.png")
+	img := writeSyntheticPNG(t, path)
+	before, _ := os.Stat(path)
+
+	saved, err := OptimizePNG(path)
+	if err != nil {
+		t.Fatalf("OptimizePNG failed: %v", err)
+	}
+
+	after, _ := os.Stat(path)
+	if after.Size() > before.Size() {
+		t.Errorf("expected optimized PNG to be no larger: %d > %d", after.Size(), before.Size())
+	}
+	if saved <= 0 {
+		t.Errorf("expected an uncompressed PNG to shrink, saved %d bytes", saved)
+	}
+	if saved != before.Size()-after.Size() {
+		t.Errorf("expected %d bytes saved, got %d", before.Size()-after.Size(), saved)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("optimized file is not a valid PNG: %v", err)
+	}
+	for _, p := range []image.Point{{0, 0}, {50, 2}, {100, 10}, {199, 119}} {
+		r1, g1, b1, a1 := img.At(p.X, p.Y).RGBA()
+		r2, g2, b2, a2 := decoded.At(p.X, p.Y).RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+			t.Errorf("pixel %v changed after optimization", p)
+		}
+	}
+}
+
+func TestOptimizePNG_KeepsSmallerOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.png")
+	writeSyntheticPNG(t, path)
+	if _, err := OptimizePNG(path); err != nil {
+		t.Fatalf("OptimizePNG failed: %v", err)
+	}
+	optimized, _ := os.ReadFile(path)
+
+	// Already at best compression: nothing left to save
+	saved, err := OptimizePNG(path)
+	if err != nil {
+		t.Fatalf("OptimizePNG failed: %v", err)
+	}
+	again, _ := os.ReadFile(path)
+	if saved != 0 || !bytes.Equal(optimized, again) {
+		t.Errorf("expected an optimized PNG to be left unchanged, saved %d", saved)
+	}
+}
+
+func TestOptimizePNG_SkipsOtherFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.jpg")
+	if err := os.WriteFile(path, []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := OptimizePNG(path); err != nil || saved != 0 {
+		t.Errorf("expected non-PNG files to be skipped, got saved=%d err=%v", saved, err)
+	}
+}
+
+func TestOptimizePNG_InvalidPNG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.png")
+	if err := os.WriteFile(path, []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OptimizePNG(path); err == nil {
+		t.Error("expected error for invalid PNG data")
+	}
+}
@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// reencodedJPEGQuality is the quality used when re-encoding a rotated or scaled JPEG.
+const reencodedJPEGQuality = 95
+
+// AutoOrientJPEG rotates or flips the JPEG at path so that it displays upright
+// without its EXIF orientation tag, as img2pdf ignores the tag. The re-encoded file
+// carries no EXIF data. Returns whether the file was changed: files without a
+// .jpg/.jpeg extension, without EXIF, or already at orientation 1 are left alone.
+func AutoOrientJPEG(path string) (bool, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".jpg" && ext != ".jpeg" {
+		return false, nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	orientation := exifOrientation(original)
+	if orientation < 2 || orientation > 8 {
+		return false, nil
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(original))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode JPEG %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(img, orientation), &jpeg.Options{Quality: reencodedJPEGQuality}); err != nil {
+		return false, fmt.Errorf("failed to encode JPEG %s: %w", path, err)
+	}
+	if err := fsutil.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return false, fmt.Errorf("failed to write oriented JPEG: %w", err)
+	}
+	return true, nil
+}
+
+// exifOrientation returns the EXIF orientation (1-8) of JPEG data, or 0 if the data
+// has no readable orientation tag.
+func exifOrientation(data []byte) int {
+	return tiffOrientation(exifTIFF(data))
+}
+
+// exifTIFF returns the TIFF structure embedded in the EXIF (APP1) segment of JPEG
+// data, or nil if the data has none before the image data.
+func exifTIFF(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	// Walk the marker segments before the image data looking for APP1 (Exif)
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return nil // Start of scan or end of image
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// tiffHeader returns the byte order of a TIFF structure and the offset of its first
+// IFD, or ok false if the header is malformed.
+func tiffHeader(tiff []byte) (order binary.ByteOrder, ifd int, ok bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, 0, false
+	}
+	ifd = int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return nil, 0, false
+	}
+	return order, ifd, true
+}
+
+// tiffEntry returns the offset of the 12-byte entry for tag in the IFD at ifd, or
+// ok false if the IFD has no such entry or is malformed.
+func tiffEntry(tiff []byte, order binary.ByteOrder, ifd int, tag uint16) (int, bool) {
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) == tag {
+			return entry, true
+		}
+	}
+	return 0, false
+}
+
+// tiffOrientation reads the orientation tag (0x0112) from the first IFD of a TIFF
+// header, as embedded in an EXIF segment. Returns 0 if it is missing or malformed.
+func tiffOrientation(tiff []byte) int {
+	order, ifd, ok := tiffHeader(tiff)
+	if !ok {
+		return 0
+	}
+	entry, ok := tiffEntry(tiff, order, ifd, 0x0112)
+	// Orientation is a single SHORT stored in the value field
+	if !ok || order.Uint16(tiff[entry+2:]) != 3 {
+		return 0
+	}
+	return int(order.Uint16(tiff[entry+8:]))
+}
+
+// orient returns img transformed from the given EXIF orientation to orientation 1.
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	// Keep grayscale scans grayscale
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(image.Rect(0, 0, dw, dh))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, dw, dh))
+	}
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Mirrored across the main diagonal
+				sx, sy = y, x
+			case 6: // Needs a 90 degree clockwise rotation
+				sx, sy = y, h-1-x
+			case 7: // Mirrored across the anti-diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // Needs a 90 degree counter-clockwise rotation
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,196 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeOrientedJPEG writes a 16x8 JPEG whose left half is black and right half white,
+// with an EXIF orientation tag in the given byte order.
+func writeOrientedJPEG(t *testing.T, path string, orientation uint16, order binary.ByteOrder) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			if x >= 8 {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	// TIFF header with one IFD holding the orientation tag
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	} else {
+		copy(tiff, "II")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	data := append([]byte{}, encoded[:2]...)
+	data = append(data, app1...)
+	data = append(data, encoded[2:]...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write JPEG: %v", err)
+	}
+}
+
+func decodeJPEGFile(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", path, err)
+	}
+	return img
+}
+
+func isDark(img image.Image, x, y int) bool {
+	gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+	return gray.Y < 128
+}
+
+func TestExifOrientation(t *testing.T) {
+	dir := t.TempDir()
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		path := filepath.Join(dir, "photo.jpg")
+		writeOrientedJPEG(t, path, 6, order)
+		data, _ := os.ReadFile(path)
+		if got := exifOrientation(data); got != 6 {
+			t.Errorf("%v: expected orientation 6, got %d", order, got)
+		}
+	}
+
+	if got := exifOrientation([]byte("not a jpeg")); got != 0 {
+		t.Errorf("expected 0 for non-JPEG data, got %d", got)
+	}
+}
+
+func TestAutoOrientJPEG_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	writeOrientedJPEG(t, path, 6, binary.LittleEndian)
+
+	changed, err := AutoOrientJPEG(path)
+	if err != nil {
+		t.Fatalf("AutoOrientJPEG failed: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected JPEG with orientation 6 to be rotated")
+	}
+
+	data, _ := os.ReadFile(path)
+	if got := exifOrientation(data); got != 0 {
+		t.Errorf("expected orientation tag to be cleared, got %d", got)
+	}
+
+	// Rotating 90 degrees clockwise turns the black left half into the top half
+	img := decodeJPEGFile(t, path)
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 16 {
+		t.Fatalf("expected 8x16 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	if !isDark(img, 4, 2) {
+		t.Error("expected top half to be dark")
+	}
+	if isDark(img, 4, 13) {
+		t.Error("expected bottom half to be light")
+	}
+}
+
+func TestAutoOrientJPEG_Orientations(t *testing.T) {
+	// Position of the black half after correction
+	tests := []struct {
+		orientation uint16
+		width       int
+		darkX       int
+		darkY       int
+	}{
+		{2, 16, 12, 4}, // Mirrored: black moves right
+		{3, 16, 12, 4}, // Rotated 180: black moves right
+		{4, 16, 4, 4},  // Flipped vertically: black stays left
+		{5, 8, 4, 2},   // Transposed: black moves to the top
+		{7, 8, 4, 13},  // Transversed: black moves to the bottom
+		{8, 8, 4, 13},  // Rotated counter-clockwise: black moves to the bottom
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "photo.jpg")
+		writeOrientedJPEG(t, path, tt.orientation, binary.BigEndian)
+		if _, err := AutoOrientJPEG(path); err != nil {
+			t.Fatalf("orientation %d: AutoOrientJPEG failed: %v", tt.orientation, err)
+		}
+		img := decodeJPEGFile(t, path)
+		if img.Bounds().Dx() != tt.width {
+			t.Errorf("orientation %d: expected width %d, got %d", tt.orientation, tt.width, img.Bounds().Dx())
+		}
+		if !isDark(img, tt.darkX, tt.darkY) {
+			t.Errorf("orientation %d: expected (%d,%d) to be dark", tt.orientation, tt.darkX, tt.darkY)
+		}
+	}
+}
+
+func TestAutoOrientJPEG_LeavesOtherFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+
+	upright := filepath.Join(dir, "upright.jpg")
+	writeOrientedJPEG(t, upright, 1, binary.LittleEndian)
+	pngPath := filepath.Join(dir, "0001.png")
+	writeSyntheticPNG(t, pngPath)
+
+	for _, path := range []string{upright, pngPath} {
+		before, _ := os.ReadFile(path)
+		changed, err := AutoOrientJPEG(path)
+		if err != nil {
+			t.Fatalf("AutoOrientJPEG(%s) failed: %v", filepath.Base(path), err)
+		}
+		after, _ := os.ReadFile(path)
+		if changed || !bytes.Equal(before, after) {
+			t.Errorf("expected %s to be unchanged", filepath.Base(path))
+		}
+	}
+}
+
+func TestStageImagesWithOptions_AutoOrient(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+	src := filepath.Join(srcDir, "IMG_1.JPG")
+	writeOrientedJPEG(t, src, 6, binary.LittleEndian)
+
+	staged, err := StageImagesWithOptions([]string{src}, outDir, StageOptions{AutoOrient: true})
+	if err != nil {
+		t.Fatalf("StageImagesWithOptions failed: %v", err)
+	}
+
+	if b := decodeJPEGFile(t, staged[0]).Bounds(); b.Dx() != 8 || b.Dy() != 16 {
+		t.Errorf("expected staged image to be rotated to 8x16, got %dx%d", b.Dx(), b.Dy())
+	}
+	// The source is left as it was
+	data, _ := os.ReadFile(src)
+	if got := exifOrientation(data); got != 6 {
+		t.Errorf("expected source to keep orientation 6, got %d", got)
+	}
+}
@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// PreprocessMode selects the pixel preprocessing applied to staged images.
+type PreprocessMode string
+
+const (
+	// PreprocessNone leaves staged images as they are.
+	PreprocessNone PreprocessMode = "none"
+	// PreprocessGrayscale converts images to grayscale, keeping their format.
+	PreprocessGrayscale PreprocessMode = "grayscale"
+	// PreprocessThreshold binarizes images to black and white with Otsu's method and
+	// writes them as PNG, which helps OCR of faded or low-contrast scans.
+	PreprocessThreshold PreprocessMode = "threshold"
+)
+
+// ParsePreprocessMode parses a mode name ("none", "grayscale" or "threshold",
+// case-insensitive). An empty name is PreprocessNone.
+func ParsePreprocessMode(s string) (PreprocessMode, error) {
+	switch mode := PreprocessMode(strings.ToLower(s)); mode {
+	case "", PreprocessNone:
+		return PreprocessNone, nil
+	case PreprocessGrayscale, PreprocessThreshold:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown preprocess mode %q (expected none, grayscale or threshold)", s)
+	}
+}
+
+// PreprocessImage applies mode to the JPEG or PNG at path in place and returns the
+// image's path afterwards. Thresholding writes a PNG, so a JPEG is replaced by a file
+// with a .png extension. Other formats and PreprocessNone leave the file alone.
+func PreprocessImage(path string, mode PreprocessMode) (string, error) {
+	if mode == "" || mode == PreprocessNone {
+		return path, nil
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	isJPEG := ext == ".jpg" || ext == ".jpeg"
+	if !isJPEG && ext != ".png" {
+		return path, nil
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	gray := toGray(img)
+	outPath := path
+	var buf bytes.Buffer
+	switch mode {
+	case PreprocessGrayscale:
+		if isJPEG {
+			err = jpeg.Encode(&buf, gray, &jpeg.Options{Quality: reencodedJPEGQuality})
+		} else {
+			err = png.Encode(&buf, gray)
+		}
+	case PreprocessThreshold:
+		outPath = strings.TrimSuffix(path, filepath.Ext(path)) + ".png"
+		err = png.Encode(&buf, binarize(gray, otsuThreshold(gray)))
+	default:
+		return "", fmt.Errorf("unknown preprocess mode %q", mode)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", outPath, err)
+	}
+
+	if err := fsutil.WriteFileAtomic(outPath, buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write preprocessed image: %w", err)
+	}
+	if outPath != path {
+		if err := os.Remove(path); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return outPath, nil
+}
+
+// toGray converts img to 8-bit grayscale using the luma weights of color.GrayModel.
+func toGray(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok {
+		return gray
+	}
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			gray.Set(x, y, color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)))
+		}
+	}
+	return gray
+}
+
+// otsuThreshold returns the gray level that best separates img into dark and light
+// pixels by maximizing the between-class variance of its histogram (Otsu's method).
+// Pixels at or below the level are dark.
+func otsuThreshold(img *image.Gray) uint8 {
+	var hist [256]int
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[(y-b.Min.Y)*img.Stride:]
+		for x := 0; x < b.Dx(); x++ {
+			hist[row[x]]++
+		}
+	}
+
+	total := b.Dx() * b.Dy()
+	var sumAll float64
+	for level, count := range hist {
+		sumAll += float64(level * count)
+	}
+
+	var best uint8
+	var bestVariance, sumDark float64
+	dark := 0
+	for level, count := range hist {
+		dark += count
+		if dark == 0 {
+			continue
+		}
+		light := total - dark
+		if light == 0 {
+			break
+		}
+		sumDark += float64(level * count)
+		meanDark := sumDark / float64(dark)
+		meanLight := (sumAll - sumDark) / float64(light)
+		variance := float64(dark) * float64(light) * (meanDark - meanLight) * (meanDark - meanLight)
+		if variance > bestVariance {
+			bestVariance = variance
+			best = uint8(level)
+		}
+	}
+	return best
+}
+
+// binarize returns a two-color image with pixels at or below threshold black and the
+// rest white. A two-color palette is encoded as a 1-bit PNG.
+func binarize(img *image.Gray, threshold uint8) *image.Paletted {
+	b := img.Bounds()
+	out := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), color.Palette{color.Gray{Y: 0}, color.Gray{Y: 255}})
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if img.GrayAt(b.Min.X+x, b.Min.Y+y).Y > threshold {
+				out.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,224 @@
+package ingest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeRedGradientPNG writes a 256x4 PNG whose red channel equals the x coordinate.
+func writeRedGradientPNG(t *testing.T, path string) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 256, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 256; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write PNG: %v", err)
+	}
+}
+
+// writeGrayGradientPNG writes a 256x4 grayscale PNG whose level equals the x coordinate.
+func writeGrayGradientPNG(t *testing.T, path string) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 256, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write PNG: %v", err)
+	}
+}
+
+func decodePNGFile(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", path, err)
+	}
+	return img
+}
+
+func TestParsePreprocessMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want PreprocessMode
+	}{
+		{"", PreprocessNone},
+		{"none", PreprocessNone},
+		{"Grayscale", PreprocessGrayscale},
+		{"threshold", PreprocessThreshold},
+	}
+	for _, tt := range tests {
+		got, err := ParsePreprocessMode(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePreprocessMode(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParsePreprocessMode("sepia"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestPreprocessImage_None(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.png")
+	writeRedGradientPNG(t, path)
+	before, _ := os.ReadFile(path)
+
+	got, err := PreprocessImage(path, PreprocessNone)
+	if err != nil {
+		t.Fatalf("PreprocessImage failed: %v", err)
+	}
+	after, _ := os.ReadFile(got)
+	if got != path || !bytes.Equal(before, after) {
+		t.Error("expected image to be left alone")
+	}
+}
+
+func TestPreprocessImage_Grayscale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.png")
+	writeRedGradientPNG(t, path)
+
+	got, err := PreprocessImage(path, PreprocessGrayscale)
+	if err != nil {
+		t.Fatalf("PreprocessImage failed: %v", err)
+	}
+	if got != path {
+		t.Errorf("expected path %s, got %s", path, got)
+	}
+
+	img, ok := decodePNGFile(t, got).(*image.Gray)
+	if !ok {
+		t.Fatal("expected a grayscale PNG")
+	}
+	// Pure red has a luma of about 0.299
+	for _, x := range []int{0, 100, 255} {
+		want := color.GrayModel.Convert(color.RGBA{R: uint8(x), A: 255}).(color.Gray).Y
+		if got := img.GrayAt(x, 1).Y; got != want {
+			t.Errorf("x=%d: expected gray %d, got %d", x, want, got)
+		}
+	}
+	if got := img.GrayAt(255, 0).Y; got != 76 {
+		t.Errorf("expected pure red to become 76, got %d", got)
+	}
+}
+
+func TestPreprocessImage_Threshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0001.png")
+	writeGrayGradientPNG(t, path)
+
+	got, err := PreprocessImage(path, PreprocessThreshold)
+	if err != nil {
+		t.Fatalf("PreprocessImage failed: %v", err)
+	}
+
+	img := decodePNGFile(t, got)
+	// An even gradient splits in the middle
+	for x := 0; x < 256; x++ {
+		gray := color.GrayModel.Convert(img.At(x, 2)).(color.Gray).Y
+		want := uint8(0)
+		if x > 127 {
+			want = 255
+		}
+		if gray != want {
+			t.Fatalf("x=%d: expected %d, got %d", x, want, gray)
+		}
+	}
+}
+
+func TestPreprocessImage_ThresholdJPEGBecomesPNG(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0001.jpg")
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if x >= 16 {
+				img.SetGray(x, y, color.Gray{Y: 230}) // Faded paper
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 90}) // Faded ink
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write JPEG: %v", err)
+	}
+
+	got, err := PreprocessImage(path, PreprocessThreshold)
+	if err != nil {
+		t.Fatalf("PreprocessImage failed: %v", err)
+	}
+	if want := filepath.Join(dir, "0001.png"); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected original JPEG to be removed")
+	}
+
+	out := decodePNGFile(t, got)
+	if c := color.GrayModel.Convert(out.At(4, 4)).(color.Gray).Y; c != 0 {
+		t.Errorf("expected ink to become black, got %d", c)
+	}
+	if c := color.GrayModel.Convert(out.At(28, 4)).(color.Gray).Y; c != 255 {
+		t.Errorf("expected paper to become white, got %d", c)
+	}
+}
+
+func TestStageImagesWithOptions_PreprocessThreshold(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+	src := filepath.Join(srcDir, "IMG_1.jpg")
+	writeGradientJPEG(t, src, 40, 30)
+
+	staged, err := StageImagesWithOptions([]string{src}, outDir, StageOptions{Preprocess: PreprocessThreshold})
+	if err != nil {
+		t.Fatalf("StageImagesWithOptions failed: %v", err)
+	}
+	if filepath.Base(staged[0]) != "0001.png" {
+		t.Errorf("expected staged image 0001.png, got %s", filepath.Base(staged[0]))
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected original image to be kept: %v", err)
+	}
+
+	// Restaging without thresholding leaves only the JPEG, not both copies of the page
+	if _, err := StageImagesWithOptions([]string{src}, outDir, StageOptions{}); err != nil {
+		t.Fatalf("StageImagesWithOptions failed: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(outDir, "preprocessed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "0001.jpg" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only 0001.jpg after restaging, got %v", names)
+	}
+}
@@ -0,0 +1,196 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortMode selects the order of listed images, which becomes the page order of the
+// combined PDF.
+type SortMode string
+
+const (
+	// SortNatural orders by file name with numbers compared by value (see NaturalSort).
+	SortNatural SortMode = "natural"
+	// SortLexical orders by file name byte by byte, so "IMG_10" comes before "IMG_9".
+	SortLexical SortMode = "lexical"
+	// SortMTime orders by file modification time, oldest first.
+	SortMTime SortMode = "mtime"
+	// SortEXIFDate orders by the EXIF DateTimeOriginal of JPEGs, oldest first. Images
+	// without the tag use their modification time instead.
+	SortEXIFDate SortMode = "exifdate"
+)
+
+// exifDateLayout is the format of EXIF date tags. They carry no time zone, so they
+// are compared as UTC, which keeps images from one camera in capture order.
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// exifReadLimit bounds how much of each file is read for its EXIF segment, which
+// must fit in one 64 KiB APP1 segment near the start of the file.
+const exifReadLimit = 128 << 10
+
+// ParseSortMode parses a mode name ("natural", "lexical", "mtime" or "exifdate",
+// case-insensitive). An empty name is SortNatural.
+func ParseSortMode(s string) (SortMode, error) {
+	switch mode := SortMode(strings.ToLower(s)); mode {
+	case "", SortNatural:
+		return SortNatural, nil
+	case SortLexical, SortMTime, SortEXIFDate:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown sort mode %q (expected natural, lexical, mtime or exifdate)", s)
+	}
+}
+
+// SortImages returns a sorted copy of paths. Images with equal times in the mtime and
+// exifdate modes keep their natural order, so the result is deterministic; so do
+// images with the same file name in different directories in lexical mode.
+func SortImages(paths []string, mode SortMode) ([]string, error) {
+	sorted := NaturalSort(paths)
+	switch mode {
+	case "", SortNatural:
+		return sorted, nil
+	case SortLexical:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return filepath.Base(sorted[i]) < filepath.Base(sorted[j])
+		})
+		return sorted, nil
+	case SortMTime, SortEXIFDate:
+		times := make(map[string]time.Time, len(sorted))
+		for _, path := range sorted {
+			t, err := imageTime(path, mode == SortEXIFDate)
+			if err != nil {
+				return nil, err
+			}
+			times[path] = t
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return times[sorted[i]].Before(times[sorted[j]])
+		})
+		return sorted, nil
+	default:
+		return nil, fmt.Errorf("unknown sort mode %q", mode)
+	}
+}
+
+// OrderByManifest orders paths as listed by order, a list of base names such as an
+// order file (see ReadOrderFile) gives. Paths not listed follow in natural order.
+// With recursive listing a base name may match several paths, which keep their
+// natural order at its position. Names listed twice, or matching no path, are an
+// error.
+func OrderByManifest(paths []string, order []string) ([]string, error) {
+	byName := map[string][]string{}
+	for _, path := range NaturalSort(paths) {
+		name := filepath.Base(path)
+		byName[name] = append(byName[name], path)
+	}
+
+	result := make([]string, 0, len(paths))
+	listed := map[string]bool{}
+	var missing []string
+	for _, name := range order {
+		if listed[name] {
+			return nil, fmt.Errorf("order lists %s more than once", name)
+		}
+		listed[name] = true
+		matches, ok := byName[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		result = append(result, matches...)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("order lists %d files not found among the images: %s", len(missing), strings.Join(missing, ", "))
+	}
+
+	for _, path := range NaturalSort(paths) {
+		if !listed[filepath.Base(path)] {
+			result = append(result, path)
+		}
+	}
+	return result, nil
+}
+
+// ReadOrderFile reads an order file for OrderByManifest: one image base name per
+// line. Surrounding whitespace, blank lines and lines starting with # are ignored.
+func ReadOrderFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order file: %w", err)
+	}
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("order file %s lists no images", path)
+	}
+	return names, nil
+}
+
+// imageTime returns the capture time of the image at path if useEXIF is set and the
+// image has a readable DateTimeOriginal tag, and its modification time otherwise.
+func imageTime(path string, useEXIF bool) (time.Time, error) {
+	if useEXIF {
+		if t, ok := exifDateTimeOriginal(path); ok {
+			return t, nil
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return info.ModTime(), nil
+}
+
+// exifDateTimeOriginal reads the DateTimeOriginal tag (0x9003) from the EXIF sub-IFD
+// of the JPEG at path. Returns false if the file cannot be read or lacks the tag.
+func exifDateTimeOriginal(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer func() { _ = file.Close() }()
+	data, err := io.ReadAll(io.LimitReader(file, exifReadLimit))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	tiff := exifTIFF(data)
+	order, ifd, ok := tiffHeader(tiff)
+	if !ok {
+		return time.Time{}, false
+	}
+	// The EXIF sub-IFD is found through the ExifIFDPointer tag of the first IFD
+	entry, ok := tiffEntry(tiff, order, ifd, 0x8769)
+	if !ok {
+		return time.Time{}, false
+	}
+	entry, ok = tiffEntry(tiff, order, int(order.Uint32(tiff[entry+8:])), 0x9003)
+	if !ok || order.Uint16(tiff[entry+2:]) != 2 {
+		return time.Time{}, false
+	}
+	// The ASCII value is 20 bytes with its NUL, too long to be stored in the entry
+	count := int(order.Uint32(tiff[entry+4:]))
+	offset := int(order.Uint32(tiff[entry+8:]))
+	if count <= 4 || offset+count > len(tiff) {
+		return time.Time{}, false
+	}
+	value := string(bytes.TrimRight(tiff[offset:offset+count], "\x00 "))
+	t, err := time.Parse(exifDateLayout, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
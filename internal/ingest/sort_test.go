@@ -0,0 +1,261 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeEXIFDateJPEG writes a small JPEG whose EXIF sub-IFD holds date as its
+// DateTimeOriginal tag.
+func writeEXIFDateJPEG(t *testing.T, path, date string, order binary.ByteOrder) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	// TIFF header, IFD0 pointing to the EXIF sub-IFD, and the sub-IFD's date value
+	const subIFD, value = 26, 44
+	tiff := make([]byte, value+20)
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	} else {
+		copy(tiff, "II")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x8769)
+	order.PutUint16(tiff[12:], 4)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint32(tiff[18:], subIFD)
+	order.PutUint16(tiff[subIFD:], 1)
+	order.PutUint16(tiff[subIFD+2:], 0x9003)
+	order.PutUint16(tiff[subIFD+4:], 2)
+	order.PutUint32(tiff[subIFD+6:], 20)
+	order.PutUint32(tiff[subIFD+10:], value)
+	copy(tiff[value:], date)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	data := append([]byte{}, encoded[:2]...)
+	data = append(data, app1...)
+	data = append(data, encoded[2:]...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write JPEG: %v", err)
+	}
+}
+
+// writeFileWithMTime writes a placeholder file and sets its modification time.
+func writeFileWithMTime(t *testing.T, path string, mtime time.Time) {
+	t.Helper()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSortMode(t *testing.T) {
+	for input, want := range map[string]SortMode{
+		"":         SortNatural,
+		"natural":  SortNatural,
+		"Lexical":  SortLexical,
+		"mtime":    SortMTime,
+		"EXIFDATE": SortEXIFDate,
+	} {
+		got, err := ParseSortMode(input)
+		if err != nil || got != want {
+			t.Errorf("ParseSortMode(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseSortMode("ctime"); err == nil {
+		t.Error("expected error for unknown sort mode")
+	}
+}
+
+func TestSortImages_NaturalAndLexical(t *testing.T) {
+	paths := []string{"/in/IMG_10.jpg", "/in/b/IMG_9.jpg", "/in/IMG_2.jpg", "/in/a/IMG_9.jpg"}
+
+	natural, err := SortImages(paths, SortNatural)
+	if err != nil {
+		t.Fatalf("SortImages failed: %v", err)
+	}
+	want := []string{"/in/IMG_2.jpg", "/in/a/IMG_9.jpg", "/in/b/IMG_9.jpg", "/in/IMG_10.jpg"}
+	if !reflect.DeepEqual(natural, want) {
+		t.Errorf("natural: expected %v, got %v", want, natural)
+	}
+
+	lexical, err := SortImages(paths, SortLexical)
+	if err != nil {
+		t.Fatalf("SortImages failed: %v", err)
+	}
+	want = []string{"/in/IMG_10.jpg", "/in/IMG_2.jpg", "/in/a/IMG_9.jpg", "/in/b/IMG_9.jpg"}
+	if !reflect.DeepEqual(lexical, want) {
+		t.Errorf("lexical: expected %v, got %v", want, lexical)
+	}
+}
+
+func TestSortImages_MTime(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	files := map[string]time.Time{
+		"page1.jpg":  base.Add(2 * time.Hour),
+		"page2.jpg":  base,
+		"page10.jpg": base.Add(time.Hour),
+		"page3.jpg":  base.Add(time.Hour), // Same time as page10: natural order decides
+	}
+	var paths []string
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		writeFileWithMTime(t, path, mtime)
+		paths = append(paths, path)
+	}
+
+	sorted, err := SortImages(paths, SortMTime)
+	if err != nil {
+		t.Fatalf("SortImages failed: %v", err)
+	}
+	var names []string
+	for _, path := range sorted {
+		names = append(names, filepath.Base(path))
+	}
+	want := []string{"page2.jpg", "page3.jpg", "page10.jpg", "page1.jpg"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v, got %v", want, names)
+	}
+
+	if _, err := SortImages([]string{filepath.Join(dir, "missing.jpg")}, SortMTime); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestSortImages_EXIFDateFallbacks(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// Capture dates disagree with modification times, which must be ignored for them
+	writeEXIFDateJPEG(t, filepath.Join(dir, "scan_a.jpg"), "2021:06:01 09:00:00", binary.LittleEndian)
+	writeFileWithMTime(t, filepath.Join(dir, "scan_a.jpg"), now)
+	writeEXIFDateJPEG(t, filepath.Join(dir, "scan_b.jpg"), "2019:01:15 18:30:00", binary.BigEndian)
+	writeFileWithMTime(t, filepath.Join(dir, "scan_b.jpg"), now)
+	// No EXIF: ordered by modification time among the capture dates
+	writeFileWithMTime(t, filepath.Join(dir, "scan_c.png"), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	// No EXIF and the same modification time: natural order
+	tie := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeFileWithMTime(t, filepath.Join(dir, "scan_10.png"), tie)
+	writeFileWithMTime(t, filepath.Join(dir, "scan_9.png"), tie)
+	// A malformed date falls back to the modification time too
+	writeEXIFDateJPEG(t, filepath.Join(dir, "scan_d.jpg"), "not a date at all!!", binary.LittleEndian)
+	writeFileWithMTime(t, filepath.Join(dir, "scan_d.jpg"), time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	images, err := ListImagesWithOptions(dir, ListOptions{Sort: SortEXIFDate})
+	if err != nil {
+		t.Fatalf("ListImagesWithOptions failed: %v", err)
+	}
+	var names []string
+	for _, path := range images {
+		names = append(names, filepath.Base(path))
+	}
+	want := []string{"scan_d.jpg", "scan_b.jpg", "scan_c.png", "scan_a.jpg", "scan_9.png", "scan_10.png"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v, got %v", want, names)
+	}
+
+	if got, ok := exifDateTimeOriginal(filepath.Join(dir, "scan_b.jpg")); !ok || !got.Equal(time.Date(2019, 1, 15, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected big-endian DateTimeOriginal to be read, got %v, %v", got, ok)
+	}
+}
+
+func TestNaturalSortDesc(t *testing.T) {
+	paths := []string{"/in/IMG_9.jpg", "/in/IMG_10.jpg", "/in/IMG_1.jpg", "/in/a.png"}
+	want := []string{"/in/a.png", "/in/IMG_10.jpg", "/in/IMG_9.jpg", "/in/IMG_1.jpg"}
+	if got := NaturalSortDesc(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if paths[0] != "/in/IMG_9.jpg" {
+		t.Error("expected the input slice to be left unchanged")
+	}
+}
+
+func TestOrderByManifest(t *testing.T) {
+	paths := []string{"/in/scan_10.jpg", "/in/cover.jpg", "/in/scan_2.jpg", "/in/b/notes.png", "/in/a/notes.png", "/in/scan_1.jpg"}
+
+	got, err := OrderByManifest(paths, []string{"cover.jpg", "notes.png", "scan_10.jpg"})
+	if err != nil {
+		t.Fatalf("OrderByManifest failed: %v", err)
+	}
+	// Listed names first in manifest order, then the rest in natural order
+	want := []string{"/in/cover.jpg", "/in/a/notes.png", "/in/b/notes.png", "/in/scan_10.jpg", "/in/scan_1.jpg", "/in/scan_2.jpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	_, err = OrderByManifest(paths, []string{"cover.jpg", "missing.jpg", "gone.png"})
+	if err == nil || err.Error() != "order lists 2 files not found among the images: missing.jpg, gone.png" {
+		t.Errorf("expected error naming the missing files, got %v", err)
+	}
+	if _, err := OrderByManifest(paths, []string{"cover.jpg", "cover.jpg"}); err == nil {
+		t.Error("expected error for a name listed twice")
+	}
+}
+
+func TestListImagesWithOptions_OrderAndReverse(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"page1.jpg", "page2.jpg", "page10.jpg", "cover.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orderPath := filepath.Join(dir, "order.txt")
+	if err := os.WriteFile(orderPath, []byte("# front matter first\ncover.png\n\n  page10.jpg  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	order, err := ReadOrderFile(orderPath)
+	if err != nil {
+		t.Fatalf("ReadOrderFile failed: %v", err)
+	}
+
+	names := func(opts ListOptions) []string {
+		t.Helper()
+		images, err := ListImagesWithOptions(dir, opts)
+		if err != nil {
+			t.Fatalf("ListImagesWithOptions failed: %v", err)
+		}
+		var names []string
+		for _, path := range images {
+			names = append(names, filepath.Base(path))
+		}
+		return names
+	}
+	if got, want := names(ListOptions{Order: order}), []string{"cover.png", "page10.jpg", "page1.jpg", "page2.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order file: expected %v, got %v", want, got)
+	}
+	if got, want := names(ListOptions{Reverse: true}), []string{"page10.jpg", "page2.jpg", "page1.jpg", "cover.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reverse: expected %v, got %v", want, got)
+	}
+	if got, want := names(ListOptions{Order: order, Reverse: true}), []string{"page2.jpg", "page1.jpg", "page10.jpg", "cover.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order file reversed: expected %v, got %v", want, got)
+	}
+
+	if err := os.WriteFile(orderPath, []byte("# nothing\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadOrderFile(orderPath); err == nil {
+		t.Error("expected error for an order file listing no images")
+	}
+}
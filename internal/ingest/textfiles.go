@@ -0,0 +1,51 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ListTextFiles returns the regular files matching a filepath.Glob pattern in natural order.
+// Returns an error if the pattern is malformed or matches no files.
+func ListTextFiles(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid text glob %q: %w", pattern, err)
+	}
+
+	var files []string
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no text files match %q", pattern)
+	}
+
+	return NaturalSort(files), nil
+}
+
+// ConcatTextFiles joins the contents of files with separator and writes the result to destPath.
+// Trailing newlines are trimmed from each file so the separator alone marks the boundary.
+func ConcatTextFiles(files []string, separator, destPath string) error {
+	parts := make([]string, 0, len(files))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read text file %s: %w", path, err)
+		}
+		parts = append(parts, strings.TrimRight(string(data), "\r\n"))
+	}
+
+	if err := os.WriteFile(destPath, []byte(strings.Join(parts, separator)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write combined text: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListTextFiles_NaturalOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"doc10.txt", "doc2.txt", "doc1.txt", "skip.md"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(tmpDir, "dir.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ListTextFiles(filepath.Join(tmpDir, "*.txt"))
+	if err != nil {
+		t.Fatalf("ListTextFiles failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(tmpDir, "doc1.txt"),
+		filepath.Join(tmpDir, "doc2.txt"),
+		filepath.Join(tmpDir, "doc10.txt"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("expected %v, got %v", want, files)
+	}
+}
+
+func TestListTextFiles_Errors(t *testing.T) {
+	if _, err := ListTextFiles(filepath.Join(t.TempDir(), "*.txt")); err == nil {
+		t.Error("expected error when nothing matches")
+	}
+	if _, err := ListTextFiles("[bad"); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
+
+func TestConcatTextFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	a := filepath.Join(tmpDir, "a.txt")
+	b := filepath.Join(tmpDir, "b.txt")
+	if err := os.WriteFile(a, []byte("alpha\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("beta"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmpDir, "combined.txt")
+	if err := ConcatTextFiles([]string{a, b}, "\f", dest); err != nil {
+		t.Fatalf("ConcatTextFiles failed: %v", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "alpha\fbeta\n" {
+		t.Errorf("expected %q, got %q", "alpha\fbeta\n", string(got))
+	}
+}
@@ -0,0 +1,51 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+// pngTrailer is the IEND chunk (empty, with its fixed CRC) that ends every PNG.
+var pngTrailer = []byte{0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xAE, 0x42, 0x60, 0x82}
+
+// supportedFormats are the image formats, as named by image.DecodeConfig, that
+// img2pdf accepts from staging.
+var supportedFormats = map[string]bool{"jpeg": true, "png": true}
+
+// ValidateImage checks that path is a readable JPEG or PNG, decoding only the header
+// with image.DecodeConfig. The format is taken from the content, as img2pdf does, so
+// a PNG saved as .jpg is accepted. Images with no pixels are rejected. A PNG must
+// also end with its IEND chunk, since a PNG cut short while being written still has
+// a valid header.
+func ValidateImage(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open image: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	cfg, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode image header: %w", err)
+	}
+	if !supportedFormats[format] {
+		return fmt.Errorf("unsupported image format %s", format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return fmt.Errorf("image has no pixels (%dx%d)", cfg.Width, cfg.Height)
+	}
+
+	if format == "png" {
+		trailer := make([]byte, len(pngTrailer))
+		if _, err := file.Seek(-int64(len(trailer)), io.SeekEnd); err != nil {
+			return fmt.Errorf("PNG is truncated: %w", err)
+		}
+		if _, err := io.ReadFull(file, trailer); err != nil || !bytes.Equal(trailer, pngTrailer) {
+			return fmt.Errorf("PNG is truncated: missing IEND chunk")
+		}
+	}
+	return nil
+}
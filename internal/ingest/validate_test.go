@@ -0,0 +1,71 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateImage_Valid(t *testing.T) {
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "page.png")
+	writeSyntheticPNG(t, pngPath)
+	jpegPath := filepath.Join(dir, "page.JPG")
+	writeGradientJPEG(t, jpegPath, 40, 30)
+
+	for _, path := range []string{pngPath, jpegPath} {
+		if err := ValidateImage(path); err != nil {
+			t.Errorf("ValidateImage(%s) failed: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestValidateImage_TruncatedPNG(t *testing.T) {
+	dir := t.TempDir()
+	validPath := filepath.Join(dir, "valid.png")
+	writeSyntheticPNG(t, validPath)
+	data, err := os.ReadFile(validPath)
+	if err != nil {
+		t.Fatalf("failed to read PNG: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		size int
+		want string
+	}{
+		{"header cut short", 20, "failed to decode image header"},
+		{"pixel data cut short", len(data) / 2, "missing IEND chunk"},
+		{"empty", 0, "failed to decode image header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "truncated.png")
+			if err := os.WriteFile(path, data[:tt.size], 0644); err != nil {
+				t.Fatalf("failed to write truncated PNG: %v", err)
+			}
+			err := ValidateImage(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateImage_FormatFromContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan.jpg")
+	writeSyntheticPNG(t, path)
+	if err := ValidateImage(path); err != nil {
+		t.Errorf("expected a PNG named .jpg to be accepted, got %v", err)
+	}
+
+	textPath := filepath.Join(dir, "notes.png")
+	if err := os.WriteFile(textPath, []byte("not an image"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := ValidateImage(textPath); err == nil {
+		t.Error("expected error for a text file named .png")
+	}
+}
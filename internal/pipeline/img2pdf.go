@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Img2PDFCommand is how BuildPDF runs img2pdf: through a Python interpreter that
+// imports its module, or as a standalone img2pdf executable.
+type Img2PDFCommand struct {
+	// Bin is the interpreter or executable, looked up on PATH if it has no slash.
+	Bin string
+	// Args come before img2pdf's own arguments: -m img2pdf for an interpreter.
+	Args []string
+}
+
+// DefaultImg2PDFCommand runs img2pdf as python3 -m img2pdf.
+var DefaultImg2PDFCommand = Img2PDFCommand{Bin: "python3", Args: []string{"-m", "img2pdf"}}
+
+// ParseImg2PDFCommand parses an --img2pdf-cmd value. A value whose file name starts
+// with "python" or "pypy", such as python, python3.11 or /opt/venv/bin/python, is an
+// interpreter that runs the img2pdf module; anything else, such as img2pdf or
+// /usr/local/bin/img2pdf, is run directly. An empty value is DefaultImg2PDFCommand.
+func ParseImg2PDFCommand(value string) Img2PDFCommand {
+	if value == "" {
+		return DefaultImg2PDFCommand
+	}
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(value), ".exe"))
+	if strings.HasPrefix(name, "python") || strings.HasPrefix(name, "pypy") {
+		return Img2PDFCommand{Bin: value, Args: []string{"-m", "img2pdf"}}
+	}
+	return Img2PDFCommand{Bin: value}
+}
+
+// args returns the arguments to run Bin with for img2pdf arguments extra.
+func (c Img2PDFCommand) args(extra ...string) []string {
+	return append(append([]string{}, c.Args...), extra...)
+}
+
+// ToolCheck returns the doctor check of the command, which runs img2pdf --version.
+func (c Img2PDFCommand) ToolCheck() ToolCheck {
+	return ToolCheck{Name: "img2pdf", Bin: c.Bin, VersionArgs: c.args("--version"), Required: true}
+}
+
+// img2pdf returns the Img2PDF command of o, or DefaultImg2PDFCommand if it is unset.
+func (o ExecOptions) img2pdf() Img2PDFCommand {
+	if o.Img2PDF.Bin == "" {
+		return DefaultImg2PDFCommand
+	}
+	return o.Img2PDF
+}
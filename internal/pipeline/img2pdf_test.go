@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+)
+
+func TestParseImg2PDFCommand(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Img2PDFCommand
+	}{
+		{"", Img2PDFCommand{Bin: "python3", Args: []string{"-m", "img2pdf"}}},
+		{"python", Img2PDFCommand{Bin: "python", Args: []string{"-m", "img2pdf"}}},
+		{"python3.11", Img2PDFCommand{Bin: "python3.11", Args: []string{"-m", "img2pdf"}}},
+		{"/opt/venv/bin/python", Img2PDFCommand{Bin: "/opt/venv/bin/python", Args: []string{"-m", "img2pdf"}}},
+		{"pypy3", Img2PDFCommand{Bin: "pypy3", Args: []string{"-m", "img2pdf"}}},
+		{"img2pdf", Img2PDFCommand{Bin: "img2pdf"}},
+		{"/usr/local/bin/img2pdf", Img2PDFCommand{Bin: "/usr/local/bin/img2pdf"}},
+	}
+	for _, tt := range tests {
+		if got := ParseImg2PDFCommand(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseImg2PDFCommand(%q) = %+v; want %+v", tt.value, got, tt.want)
+		}
+	}
+
+	check := ParseImg2PDFCommand("/usr/local/bin/img2pdf").ToolCheck()
+	if check.Bin != "/usr/local/bin/img2pdf" || !reflect.DeepEqual(check.VersionArgs, []string{"--version"}) {
+		t.Errorf("expected img2pdf --version for a binary, got %+v", check)
+	}
+	check = ParseImg2PDFCommand("python").ToolCheck()
+	if check.Bin != "python" || !reflect.DeepEqual(check.VersionArgs, []string{"-m", "img2pdf", "--version"}) {
+		t.Errorf("expected python -m img2pdf --version for an interpreter, got %+v", check)
+	}
+}
+
+func TestBuildPDF_Img2PDFCommand(t *testing.T) {
+	inputDir := t.TempDir()
+	image := createMockImage(t, inputDir, "image1.png")
+
+	tests := []struct {
+		value    string
+		wantBin  string
+		wantArgs []string
+	}{
+		{"/opt/venv/bin/python", "/opt/venv/bin/python", []string{"-m", "img2pdf", image, "-o"}},
+		{"/usr/local/bin/img2pdf", "/usr/local/bin/img2pdf", []string{image, "-o"}},
+	}
+	for _, tt := range tests {
+		execOpts := ExecOptions{Img2PDF: ParseImg2PDFCommand(tt.value)}
+		outputDir := t.TempDir()
+		var gotBin string
+		var gotArgs []string
+		mockR := &mockRunner{
+			runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+				gotBin, gotArgs = bin, args
+				_ = os.WriteFile(args[len(args)-1], []byte("%PDF-1.4\n"), 0644)
+				return runner.Result{}, nil
+			},
+		}
+		if _, err := buildPDFWithRunner(context.Background(), mockR, execOpts, inputDir, outputDir, 30*time.Second); err != nil {
+			t.Fatalf("%s: BuildPDF failed: %v", tt.value, err)
+		}
+		wantArgs := append(tt.wantArgs, filepath.Join(outputDir, "combined.pdf"))
+		if gotBin != tt.wantBin || !reflect.DeepEqual(gotArgs, wantArgs) {
+			t.Errorf("%s: expected %s %v, got %s %v", tt.value, tt.wantBin, wantArgs, gotBin, gotArgs)
+		}
+	}
+}
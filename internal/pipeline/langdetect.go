@@ -0,0 +1,325 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+)
+
+// AutoLang is the --lang value that asks for DetectLanguage.
+const AutoLang = "auto"
+
+// FallbackLang is the language used when detection is inconclusive.
+const FallbackLang = "eng"
+
+const (
+	// detectSamplePages is how many leading pages DetectLanguage samples.
+	detectSamplePages = 3
+	// detectDPI is the resolution of the sampled pages; enough to read body text.
+	detectDPI = 150
+	// maxDetectedLangs caps how many languages DetectLanguage combines.
+	maxDetectedLangs = 3
+	// minStopwordHits is the fewest stopwords a page needs to name a Latin-script language.
+	minStopwordHits = 3
+	// langListTimeout bounds `tesseract --list-langs`.
+	langListTimeout = 10 * time.Second
+)
+
+// scriptLangs maps tesseract OSD script names to the tessdata language for that script.
+var scriptLangs = map[string]string{
+	"Arabic":     "ara",
+	"Cyrillic":   "rus",
+	"Devanagari": "hin",
+	"Greek":      "ell",
+	"Han":        "chi_sim",
+	"Hangul":     "kor",
+	"Hebrew":     "heb",
+	"Japanese":   "jpn",
+	"Thai":       "tha",
+}
+
+// latinStopwords are frequent short words that tell Latin-script languages apart.
+var latinStopwords = map[string][]string{
+	"eng": {"the", "and", "of", "to", "is", "in", "that", "it", "with", "for", "this", "are", "was", "on"},
+	"fra": {"le", "la", "les", "des", "et", "est", "une", "du", "dans", "pour", "que", "qui", "sur", "pas"},
+	"deu": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "zu", "auf", "sich", "von"},
+	"spa": {"el", "los", "las", "del", "que", "por", "una", "con", "para", "es", "como", "se", "al", "y"},
+	"ita": {"il", "di", "che", "della", "per", "non", "una", "sono", "gli", "le", "con", "del", "nel", "è"},
+	"por": {"não", "que", "os", "uma", "com", "para", "do", "da", "em", "dos", "se", "por", "é", "ao"},
+}
+
+// DetectLanguage guesses the OCR language of a PDF for --lang auto. It renders the
+// first few pages at low resolution, identifies each page's script with tesseract's
+// orientation and script detection (OSD), and tells Latin-script languages apart by
+// their common words in a quick English OCR pass. Languages found on different pages
+// are combined (e.g. "eng+fra"), most frequent first. Only installed tessdata
+// languages are chosen; if none can be, FallbackLang is returned. The decision is logged.
+// The timeout covers the whole detection and is layered on ctx.
+func DetectLanguage(ctx context.Context, execOpts ExecOptions, pdfPath string, timeout time.Duration) (string, error) {
+	return detectLanguageWithRunner(ctx, execOpts.newRunner(), execOpts, pdfPath, timeout)
+}
+
+// detectLanguageWithRunner is the internal implementation that accepts a runner interface for testing
+func detectLanguageWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPath string, timeout time.Duration) (string, error) {
+	if execOpts.DryRun {
+		execOpts.logf("dry run: skipping language detection, using %s", FallbackLang)
+		return FallbackLang, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	opts := runner.RunOpts{
+		Timeout:    timeout,
+		StdoutMode: runner.Capture,
+		StderrMode: runner.Capture,
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(pdfPath), ".langdetect-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create language detection directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			execOpts.warnf("failed to remove %s: %v", tmpDir, err)
+		}
+	}()
+
+	// Render sample pages: pdftoppm -r <dpi> -gray -png -f 1 -l <n> input.pdf <dir>/page
+	args := []string{
+		"-r", fmt.Sprint(detectDPI),
+		"-gray", "-png",
+		"-f", "1", "-l", fmt.Sprint(detectSamplePages),
+		pdfPath, filepath.Join(tmpDir, "page"),
+	}
+	if result, err := r.Run(ctx, "pdftoppm", args, opts); err != nil {
+		return "", fmt.Errorf("pdftoppm failed: %w (stderr: %s)", err, result.Stderr)
+	}
+	pages, err := filepath.Glob(filepath.Join(tmpDir, "page-*.png"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list rendered pages: %w", err)
+	}
+	sort.Strings(pages)
+
+	installed, err := lookupInstalledLangs(ctx, r, execOpts, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	votes := map[string]int{}
+	var order []string
+	for _, page := range pages {
+		for _, lang := range detectPageLangs(ctx, r, opts, page, installed) {
+			if votes[lang] == 0 {
+				order = append(order, lang)
+			}
+			votes[lang]++
+		}
+	}
+
+	if len(order) == 0 {
+		execOpts.logf("language detection inconclusive for %s, using %s", filepath.Base(pdfPath), FallbackLang)
+		return FallbackLang, nil
+	}
+	sort.SliceStable(order, func(i, j int) bool { return votes[order[i]] > votes[order[j]] })
+	if len(order) > maxDetectedLangs {
+		order = order[:maxDetectedLangs]
+	}
+	lang := strings.Join(order, "+")
+	execOpts.logf("detected OCR language %s from %d sample pages", lang, len(pages))
+	return lang, nil
+}
+
+// detectPageLangs returns the installed languages that a rendered page appears to use.
+// Failures are treated as no evidence, since the page may simply have no text.
+func detectPageLangs(ctx context.Context, r runnerInterface, opts runner.RunOpts, page string, installed map[string]bool) []string {
+	script := ""
+	if installed["osd"] {
+		result, err := r.Run(ctx, "tesseract", []string{page, "stdout", "--psm", "0"}, opts)
+		if err == nil {
+			script = parseOSDScript(result.Stdout + result.Stderr)
+		}
+	}
+	if lang, ok := scriptLangs[script]; ok {
+		if installed[lang] {
+			return []string{lang}
+		}
+		return nil
+	}
+	if script != "" && script != "Latin" {
+		return nil
+	}
+
+	if !installed[FallbackLang] {
+		return nil
+	}
+	result, err := r.Run(ctx, "tesseract", []string{page, "stdout", "-l", FallbackLang}, opts)
+	if err != nil {
+		return nil
+	}
+	var langs []string
+	for _, lang := range latinLangs(result.Stdout) {
+		if installed[lang] {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// ParseTessLangs parses `tesseract --list-langs` output into language names, in the
+// order listed.
+func ParseTessLangs(output string) []string {
+	var langs []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "List of available languages") {
+			continue
+		}
+		langs = append(langs, line)
+	}
+	return langs
+}
+
+// installedLangs caches the languages tesseract has tessdata for, keyed by
+// installedLangsKey; see lookupInstalledLangs.
+var (
+	installedLangsMu sync.Mutex
+	installedLangs   = map[string]map[string]bool{}
+)
+
+// installedLangsKey identifies the tesseract that execOpts runs: its binary and the
+// environment overrides, which may point it at other tessdata (TESSDATA_PREFIX).
+func installedLangsKey(execOpts ExecOptions) string {
+	bin := "tesseract"
+	if override := execOpts.BinOverride[bin]; override != "" {
+		bin = override
+	}
+	names := make([]string, 0, len(execOpts.Env))
+	for name := range execOpts.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(bin)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\x00%s=%s", name, execOpts.Env[name])
+	}
+	return b.String()
+}
+
+// lookupInstalledLangs returns the set of languages tesseract has tessdata for. The
+// list is queried with `tesseract --list-langs` on first use by each tesseract binary
+// and environment, and cached afterwards.
+func lookupInstalledLangs(ctx context.Context, r runnerInterface, execOpts ExecOptions, timeout time.Duration) (map[string]bool, error) {
+	key := installedLangsKey(execOpts)
+	installedLangsMu.Lock()
+	defer installedLangsMu.Unlock()
+	if langs, ok := installedLangs[key]; ok {
+		return langs, nil
+	}
+
+	opts := runner.RunOpts{
+		Timeout:    timeout,
+		StdoutMode: runner.Capture,
+		StderrMode: runner.Capture,
+	}
+	result, err := r.Run(ctx, "tesseract", []string{"--list-langs"}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract --list-langs failed: %w (stderr: %s)", err, result.Stderr)
+	}
+	langs := map[string]bool{}
+	for _, lang := range ParseTessLangs(result.Stdout + result.Stderr) {
+		langs[lang] = true
+	}
+	if len(langs) == 0 {
+		return nil, fmt.Errorf("tesseract --list-langs listed no languages")
+	}
+	installedLangs[key] = langs
+	return langs, nil
+}
+
+// checkLangsWithRunner returns an error naming every language in lang (e.g. "eng+fra")
+// that tesseract has no tessdata for. If the installed languages cannot be listed the
+// check is skipped with a warning, leaving ocrmypdf to report any problem.
+func checkLangsWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, lang string) error {
+	installed, err := lookupInstalledLangs(ctx, r, execOpts, langListTimeout)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		execOpts.warnf("cannot check OCR languages: %v", err)
+		return nil
+	}
+
+	var missing []string
+	for _, code := range strings.Split(lang, "+") {
+		code = strings.TrimSpace(code)
+		if code != "" && !installed[code] {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	available := make([]string, 0, len(installed))
+	for code := range installed {
+		available = append(available, code)
+	}
+	sort.Strings(available)
+	return fmt.Errorf("tesseract language packs not installed: %s (installed: %s)",
+		strings.Join(missing, ", "), strings.Join(available, ", "))
+}
+
+// parseOSDScript returns the script named by tesseract --psm 0 output ("Script: Latin").
+func parseOSDScript(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "Script:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// latinLangs scores text against latinStopwords and returns the best language plus any
+// scoring at least half as well, best first. Text with too few stopwords gives nothing.
+func latinLangs(text string) []string {
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		counts[word]++
+	}
+
+	scores := map[string]int{}
+	var langs []string
+	for lang, words := range latinStopwords {
+		for _, w := range words {
+			scores[lang] += counts[w]
+		}
+		if scores[lang] >= minStopwordHits {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if scores[langs[i]] != scores[langs[j]] {
+			return scores[langs[i]] > scores[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+
+	var kept []string
+	for _, lang := range langs {
+		if 2*scores[lang] >= scores[langs[0]] {
+			kept = append(kept, lang)
+		}
+	}
+	return kept
+}
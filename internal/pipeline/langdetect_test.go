@@ -0,0 +1,252 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+)
+
+// resetInstalledLangs clears the cached tesseract language list before and after a test.
+func resetInstalledLangs(t *testing.T) {
+	installedLangs = map[string]map[string]bool{}
+	t.Cleanup(func() { installedLangs = map[string]map[string]bool{} })
+}
+
+// detectionRunner fakes pdftoppm and tesseract for DetectLanguage. pages maps each
+// rendered page file name to its OSD script and its English OCR text.
+func detectionRunner(t *testing.T, installed string, pages map[string][2]string) *mockRunner {
+	resetInstalledLangs(t)
+	return &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			switch {
+			case bin == "pdftoppm":
+				prefix := args[len(args)-1]
+				for name := range pages {
+					path := filepath.Join(filepath.Dir(prefix), name)
+					if err := os.WriteFile(path, []byte("png"), 0644); err != nil {
+						t.Fatalf("failed to write page: %v", err)
+					}
+				}
+				return runner.Result{}, nil
+			case bin == "tesseract" && args[0] == "--list-langs":
+				return runner.Result{Stdout: "List of available languages in \"/usr/share/tessdata/\" (3):\n" + installed}, nil
+			case bin == "tesseract" && len(args) >= 4 && args[2] == "--psm":
+				return runner.Result{Stdout: "Page number: 0\nScript: " + pages[filepath.Base(args[0])][0] + "\nScript confidence: 4.2\n"}, nil
+			case bin == "tesseract":
+				return runner.Result{Stdout: pages[filepath.Base(args[0])][1]}, nil
+			}
+			t.Fatalf("unexpected command %s %v", bin, args)
+			return runner.Result{}, nil
+		},
+	}
+}
+
+func TestDetectLanguage_MixedLatin(t *testing.T) {
+	pdfPath := createMockPDF(t, t.TempDir())
+	r := detectionRunner(t, "eng\nfra\nosd\n", map[string][2]string{
+		"page-1.png": {"Latin", "The results of the survey are in the appendix and the notes."},
+		"page-2.png": {"Latin", "Les résultats de la enquête sont dans les notes et la annexe est pour vous."},
+		"page-3.png": {"Latin", "This is the end of the report, and it is final."},
+	})
+
+	lang, err := detectLanguageWithRunner(context.Background(), r, ExecOptions{}, pdfPath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("DetectLanguage failed: %v", err)
+	}
+	if lang != "eng+fra" {
+		t.Errorf("expected eng+fra, got %q", lang)
+	}
+
+	// The rendered pages are removed
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(pdfPath), ".langdetect-*"))
+	if len(matches) != 0 {
+		t.Errorf("expected detection directory to be removed, found %v", matches)
+	}
+}
+
+func TestDetectLanguage_NonLatinScript(t *testing.T) {
+	pdfPath := createMockPDF(t, t.TempDir())
+	r := detectionRunner(t, "eng\nosd\nrus\n", map[string][2]string{
+		"page-1.png": {"Cyrillic", ""},
+	})
+
+	lang, err := detectLanguageWithRunner(context.Background(), r, ExecOptions{}, pdfPath, 30*time.Second)
+	if err != nil {
+		t.Fatalf("DetectLanguage failed: %v", err)
+	}
+	if lang != "rus" {
+		t.Errorf("expected rus, got %q", lang)
+	}
+}
+
+func TestDetectLanguage_InconclusiveFallsBack(t *testing.T) {
+	tests := map[string]struct {
+		installed string
+		pages     map[string][2]string
+	}{
+		"no text":                {"eng\nosd\n", map[string][2]string{"page-1.png": {"Latin", "12 34 56"}}},
+		"language not installed": {"eng\nosd\n", map[string][2]string{"page-1.png": {"Greek", ""}}},
+		"no pages":               {"eng\nosd\n", nil},
+	}
+	for name, tt := range tests {
+		pdfPath := createMockPDF(t, t.TempDir())
+		lang, err := detectLanguageWithRunner(context.Background(), detectionRunner(t, tt.installed, tt.pages), ExecOptions{}, pdfPath, 30*time.Second)
+		if err != nil {
+			t.Fatalf("%s: DetectLanguage failed: %v", name, err)
+		}
+		if lang != FallbackLang {
+			t.Errorf("%s: expected %s, got %q", name, FallbackLang, lang)
+		}
+	}
+}
+
+func TestDetectLanguage_RenderFailure(t *testing.T) {
+	pdfPath := createMockPDF(t, t.TempDir())
+	r := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			return runner.Result{ExitCode: 1, Stderr: "bad pdf"}, errors.New("exit status 1")
+		},
+	}
+
+	_, err := detectLanguageWithRunner(context.Background(), r, ExecOptions{}, pdfPath, 30*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "pdftoppm failed") {
+		t.Errorf("expected pdftoppm error, got %v", err)
+	}
+}
+
+func TestLatinLangs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The cat and the dog sat on the mat with the owner.", []string{"eng"}},
+		{"Der Hund und die Katze sind nicht auf dem Tisch, das ist mit der Zeit so.", []string{"deu"}},
+		{"Figure 3 2021 Table", nil},
+	}
+	for _, tt := range tests {
+		if got := latinLangs(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("latinLangs(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseTessLangs(t *testing.T) {
+	langs := ParseTessLangs("List of available languages in \"/usr/share/tessdata/\" (2):\neng\nosd\n")
+	if !reflect.DeepEqual(langs, []string{"eng", "osd"}) {
+		t.Errorf("unexpected languages: %v", langs)
+	}
+}
+
+func TestOCRPDF_MissingLanguageReportedBeforeOCR(t *testing.T) {
+	resetInstalledLangs(t)
+	pdfPath := createMockPDF(t, t.TempDir())
+
+	var bins []string
+	r := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			bins = append(bins, bin+" "+args[0])
+			return runner.Result{Stdout: "List of available languages in \"/usr/share/tessdata/\" (3):\neng\nfra\nosd\n"}, nil
+		},
+	}
+
+	_, err := checkedOCRPDFWithRunner(context.Background(), r, ExecOptions{}, pdfPath, t.TempDir(), "eng+frnch+deu", OCROptions{}, 30*time.Second)
+	if err == nil {
+		t.Fatal("expected error for missing languages")
+	}
+	if !strings.Contains(err.Error(), "not installed: frnch, deu") || !strings.Contains(err.Error(), "installed: eng, fra, osd") {
+		t.Errorf("expected missing and installed languages in error, got: %v", err)
+	}
+	if !reflect.DeepEqual(bins, []string{"tesseract --list-langs"}) {
+		t.Errorf("expected only tesseract --list-langs to run, got %v", bins)
+	}
+}
+
+func TestOCRPDF_InstalledLanguagesCached(t *testing.T) {
+	resetInstalledLangs(t)
+	pdfPath := createMockPDF(t, t.TempDir())
+	outputDir := t.TempDir()
+
+	listCalls := 0
+	r := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin == "tesseract" {
+				listCalls++
+				return runner.Result{Stdout: "eng\nfra\n"}, nil
+			}
+			_ = os.WriteFile(args[len(args)-1], []byte("%PDF-1.4\n"), 0644)
+			return runner.Result{}, nil
+		},
+	}
+
+	for _, lang := range []string{"eng+fra", "fra"} {
+		if _, err := checkedOCRPDFWithRunner(context.Background(), r, ExecOptions{}, pdfPath, outputDir, lang, OCROptions{}, 30*time.Second); err != nil {
+			t.Fatalf("OCRPDF(%s) failed: %v", lang, err)
+		}
+	}
+	if listCalls != 1 {
+		t.Errorf("expected languages to be listed once, got %d", listCalls)
+	}
+}
+
+func TestOCRPDF_InstalledLanguagesCachedPerTesseract(t *testing.T) {
+	resetInstalledLangs(t)
+
+	// Each listing adds a language, as if every tesseract had different tessdata
+	lists := []string{"eng\n", "eng\ndeu\n", "eng\ndeu\nfra\n"}
+	listCalls := 0
+	r := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			listCalls++
+			return runner.Result{Stdout: lists[listCalls-1]}, nil
+		},
+	}
+
+	if err := checkLangsWithRunner(context.Background(), r, ExecOptions{}, "deu"); err == nil {
+		t.Error("expected deu to be missing from the default tesseract")
+	}
+	tessdata := ExecOptions{Env: map[string]string{"TESSDATA_PREFIX": "/opt/tessdata"}}
+	if err := checkLangsWithRunner(context.Background(), r, tessdata, "deu"); err != nil {
+		t.Errorf("expected deu to be listed with another TESSDATA_PREFIX: %v", err)
+	}
+	other := ExecOptions{BinOverride: map[string]string{"tesseract": "/opt/bin/tesseract"}}
+	if err := checkLangsWithRunner(context.Background(), r, other, "fra"); err != nil {
+		t.Errorf("expected fra to be listed by another tesseract binary: %v", err)
+	}
+	if err := checkLangsWithRunner(context.Background(), r, ExecOptions{}, "eng"); err != nil {
+		t.Errorf("expected eng to be installed: %v", err)
+	}
+	if listCalls != 3 {
+		t.Errorf("expected one listing per tesseract, got %d", listCalls)
+	}
+}
+
+func TestOCRPDF_LanguageListFailureSkipsCheck(t *testing.T) {
+	resetInstalledLangs(t)
+	pdfPath := createMockPDF(t, t.TempDir())
+
+	ocrRan := false
+	r := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin == "tesseract" {
+				return runner.Result{ExitCode: 127}, errors.New("not found")
+			}
+			ocrRan = true
+			_ = os.WriteFile(args[len(args)-1], []byte("%PDF-1.4\n"), 0644)
+			return runner.Result{}, nil
+		},
+	}
+
+	if _, err := checkedOCRPDFWithRunner(context.Background(), r, ExecOptions{}, pdfPath, t.TempDir(), "eng", OCROptions{}, 30*time.Second); err != nil {
+		t.Fatalf("OCRPDF failed: %v", err)
+	}
+	if !ocrRan {
+		t.Error("expected ocrmypdf to run when languages cannot be listed")
+	}
+}
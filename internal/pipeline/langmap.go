@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LangRange assigns an OCR language to an inclusive, 1-based range of pages.
+type LangRange struct {
+	First int    `json:"first"`
+	Last  int    `json:"last"`
+	Lang  string `json:"lang"`
+}
+
+// LangMap assigns OCR languages to page ranges. Pages are staged images in order.
+type LangMap []LangRange
+
+// ParseLangMap parses a --lang-map value such as "1-50:eng,51-100:fra". A range may
+// be a single page ("7:deu"). Ranges must not overlap. An empty value gives a nil map.
+func ParseLangMap(value string) (LangMap, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var m LangMap
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		pages, lang, ok := strings.Cut(entry, ":")
+		if !ok || strings.TrimSpace(lang) == "" {
+			return nil, fmt.Errorf("lang map entry %q: expected <pages>:<lang>", entry)
+		}
+		r := LangRange{Lang: strings.TrimSpace(lang)}
+
+		firstStr, lastStr, isRange := strings.Cut(pages, "-")
+		var err error
+		if r.First, err = strconv.Atoi(strings.TrimSpace(firstStr)); err != nil {
+			return nil, fmt.Errorf("lang map entry %q: invalid page %q", entry, firstStr)
+		}
+		r.Last = r.First
+		if isRange {
+			if r.Last, err = strconv.Atoi(strings.TrimSpace(lastStr)); err != nil {
+				return nil, fmt.Errorf("lang map entry %q: invalid page %q", entry, lastStr)
+			}
+		}
+		if r.First < 1 || r.Last < r.First {
+			return nil, fmt.Errorf("lang map entry %q: pages must be a range like 1-50 starting at 1", entry)
+		}
+
+		for _, prev := range m {
+			if r.First <= prev.Last && prev.First <= r.Last {
+				return nil, fmt.Errorf("lang map entry %q overlaps %d-%d", entry, prev.First, prev.Last)
+			}
+		}
+		m = append(m, r)
+	}
+	return m, nil
+}
+
+// LangForPage returns the language for a 1-based page, or fallback if no range covers it.
+func (m LangMap) LangForPage(page int, fallback string) string {
+	for _, r := range m {
+		if page >= r.First && page <= r.Last {
+			return r.Lang
+		}
+	}
+	return fallback
+}
+
+// Languages returns the languages used by pages 1..pageCount joined with "+", in order
+// of first use, as accepted by ocrmypdf -l. Languages that are already combinations
+// (e.g. "eng+fra") are split so that each appears once.
+func (m LangMap) Languages(pageCount int, fallback string) string {
+	seen := map[string]bool{}
+	var langs []string
+	for page := 1; page <= pageCount; page++ {
+		for _, lang := range strings.Split(m.LangForPage(page, fallback), "+") {
+			if lang != "" && !seen[lang] {
+				seen[lang] = true
+				langs = append(langs, lang)
+			}
+		}
+	}
+	if len(langs) == 0 {
+		return fallback
+	}
+	return strings.Join(langs, "+")
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLangMap(t *testing.T) {
+	m, err := ParseLangMap("1-50:eng, 51-100:fra,101:deu")
+	if err != nil {
+		t.Fatalf("ParseLangMap() failed: %v", err)
+	}
+	want := LangMap{
+		{First: 1, Last: 50, Lang: "eng"},
+		{First: 51, Last: 100, Lang: "fra"},
+		{First: 101, Last: 101, Lang: "deu"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("expected %+v, got %+v", want, m)
+	}
+
+	if m, err := ParseLangMap(""); err != nil || m != nil {
+		t.Errorf("expected nil map for empty value, got %+v, %v", m, err)
+	}
+}
+
+func TestParseLangMap_Invalid(t *testing.T) {
+	for _, value := range []string{
+		"eng",
+		"1-50",
+		"1-50:",
+		"a-50:eng",
+		"1-b:eng",
+		"0-10:eng",
+		"50-1:eng",
+		"1-50:eng,40-60:fra",
+	} {
+		if _, err := ParseLangMap(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestLangMap_LangForPage(t *testing.T) {
+	m := LangMap{
+		{First: 1, Last: 2, Lang: "eng"},
+		{First: 5, Last: 6, Lang: "fra"},
+	}
+	tests := []struct {
+		page int
+		want string
+	}{
+		{1, "eng"},
+		{2, "eng"},
+		{3, "spa"},
+		{5, "fra"},
+		{6, "fra"},
+		{7, "spa"},
+	}
+	for _, tt := range tests {
+		if got := m.LangForPage(tt.page, "spa"); got != tt.want {
+			t.Errorf("LangForPage(%d) = %q, want %q", tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestLangMap_Languages(t *testing.T) {
+	m := LangMap{
+		{First: 1, Last: 2, Lang: "fra"},
+		{First: 3, Last: 4, Lang: "eng+fra"},
+	}
+	if got := m.Languages(4, "spa"); got != "fra+eng" {
+		t.Errorf("expected fra+eng, got %q", got)
+	}
+	// Unmapped pages add the fallback
+	if got := m.Languages(5, "spa"); got != "fra+eng+spa" {
+		t.Errorf("expected fra+eng+spa, got %q", got)
+	}
+	if got := LangMap(nil).Languages(3, "eng"); got != "eng" {
+		t.Errorf("expected eng for empty map, got %q", got)
+	}
+}
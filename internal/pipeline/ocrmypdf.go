@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OCRPolicy selects what ocrmypdf does with pages that already have text, such as
+// born-digital pages mixed in with scans. Without one, ocrmypdf fails on them.
+type OCRPolicy string
+
+const (
+	// OCRPolicySkip leaves pages that have text as they are (--skip-text). Default.
+	OCRPolicySkip OCRPolicy = "skip"
+	// OCRPolicyForce rasterizes every page and OCRs it again, replacing any text
+	// (--force-ocr).
+	OCRPolicyForce OCRPolicy = "force"
+	// OCRPolicyRedo replaces only earlier OCR text, keeping born-digital text
+	// (--redo-ocr). ocrmypdf cannot deskew pages in this mode, so --deskew is left out.
+	OCRPolicyRedo OCRPolicy = "redo"
+)
+
+// ParseOCRPolicy parses a policy name ("skip", "force" or "redo", case-insensitive).
+// An empty name is OCRPolicySkip. Only one policy may be given.
+func ParseOCRPolicy(s string) (OCRPolicy, error) {
+	if strings.ContainsAny(s, ",+ ") {
+		return "", fmt.Errorf("OCR policies %q are mutually exclusive: give one of skip, force or redo", s)
+	}
+	switch policy := OCRPolicy(strings.ToLower(s)); policy {
+	case "":
+		return OCRPolicySkip, nil
+	case OCRPolicySkip, OCRPolicyForce, OCRPolicyRedo:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown OCR policy %q (expected skip, force or redo)", s)
+	}
+}
+
+// flag returns the ocrmypdf flag selecting the policy.
+func (p OCRPolicy) flag() string {
+	switch p {
+	case OCRPolicyForce:
+		return "--force-ocr"
+	case OCRPolicyRedo:
+		return "--redo-ocr"
+	default:
+		return "--skip-text"
+	}
+}
+
+// OCROptions are the ocrmypdf settings for OCRPDF. The zero value skips pages that
+// already have text, and otherwise keeps ocrmypdf's own output defaults.
+type OCROptions struct {
+	// Policy is what to do with pages that already have text (empty = OCRPolicySkip).
+	Policy OCRPolicy
+	// PDFALevel is the PDF/A part to produce: "1", "2" or "3" for --output-type
+	// pdfa-1, pdfa-2 or pdfa-3 (level B conformance), or "none" for a plain PDF.
+	PDFALevel string
+	// OptimizeLevel is the --optimize level, "0" (off) to "3" (most aggressive).
+	// Levels 2 and 3 need pngquant, and use jbig2enc for monochrome images if present.
+	OptimizeLevel string
+	// JBIG2Lossy allows lossy JBIG2 compression of monochrome images (--jbig2-lossy).
+	// It is only applied from --optimize 1, and can change glyphs, e.g. 6 into 8.
+	JBIG2Lossy bool
+}
+
+// Validate checks the level values, so that ocrmypdf is not started with options it
+// would reject.
+func (o OCROptions) Validate() error {
+	switch o.Policy {
+	case "", OCRPolicySkip, OCRPolicyForce, OCRPolicyRedo:
+	default:
+		return fmt.Errorf("unknown OCR policy %q (expected skip, force or redo)", o.Policy)
+	}
+	switch o.PDFALevel {
+	case "", "none", "1", "2", "3":
+	default:
+		return fmt.Errorf("invalid PDF/A level %q (expected 1, 2, 3 or none)", o.PDFALevel)
+	}
+	switch o.OptimizeLevel {
+	case "", "0", "1", "2", "3":
+	default:
+		return fmt.Errorf("invalid optimize level %q (expected 0, 1, 2 or 3)", o.OptimizeLevel)
+	}
+	if o.JBIG2Lossy && o.OptimizeLevel == "0" {
+		return fmt.Errorf("lossy JBIG2 needs an optimize level of 1 or more")
+	}
+	return nil
+}
+
+// args returns the ocrmypdf arguments for OCR in lang with the options, all but the
+// input and output files.
+func (o OCROptions) args(lang string) []string {
+	args := []string{"--rotate-pages", "-l", lang, o.Policy.flag()}
+	if o.Policy != OCRPolicyRedo {
+		args = append([]string{"--deskew"}, args...)
+	}
+	switch o.PDFALevel {
+	case "":
+	case "none":
+		args = append(args, "--output-type", "pdf")
+	default:
+		args = append(args, "--output-type", "pdfa-"+o.PDFALevel)
+	}
+	if o.OptimizeLevel != "" {
+		args = append(args, "--optimize", o.OptimizeLevel)
+	}
+	if o.JBIG2Lossy {
+		args = append(args, "--jbig2-lossy")
+	}
+	return args
+}
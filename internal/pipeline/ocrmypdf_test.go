@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
+)
+
+func TestOCRPDF_OptionArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts OCROptions
+		want []string
+	}{
+		{"defaults", OCROptions{}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text"}},
+		{"skip", OCROptions{Policy: OCRPolicySkip}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text"}},
+		{"force", OCROptions{Policy: OCRPolicyForce}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--force-ocr"}},
+		// ocrmypdf rejects --deskew together with --redo-ocr
+		{"redo", OCROptions{Policy: OCRPolicyRedo}, []string{"--rotate-pages", "-l", "eng", "--redo-ocr"}},
+		{"pdfa-2", OCROptions{PDFALevel: "2"}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text", "--output-type", "pdfa-2"}},
+		{"plain pdf", OCROptions{PDFALevel: "none"}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text", "--output-type", "pdf"}},
+		{"optimize", OCROptions{OptimizeLevel: "3"}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text", "--optimize", "3"}},
+		{"optimize off", OCROptions{OptimizeLevel: "0"}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text", "--optimize", "0"}},
+		{"lossy", OCROptions{JBIG2Lossy: true}, []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text", "--jbig2-lossy"}},
+		{
+			"all",
+			OCROptions{Policy: OCRPolicyForce, PDFALevel: "1", OptimizeLevel: "2", JBIG2Lossy: true},
+			[]string{"--deskew", "--rotate-pages", "-l", "eng", "--force-ocr", "--output-type", "pdfa-1", "--optimize", "2", "--jbig2-lossy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdfPath := createMockPDF(t, t.TempDir())
+			outputDir := t.TempDir()
+
+			var got []string
+			mockR := &mockRunner{
+				runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+					got = args
+					_ = os.WriteFile(args[len(args)-1], []byte("%PDF-1.4\n"), 0644)
+					return runner.Result{}, nil
+				},
+			}
+			ocrPath, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", tt.opts, 30*time.Second)
+			if err != nil {
+				t.Fatalf("OCRPDF failed: %v", err)
+			}
+
+			want := append(tt.want, pdfPath, ocrPath)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected args %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestParseOCRPolicy(t *testing.T) {
+	for input, want := range map[string]OCRPolicy{
+		"":      OCRPolicySkip,
+		"skip":  OCRPolicySkip,
+		"Force": OCRPolicyForce,
+		"REDO":  OCRPolicyRedo,
+	} {
+		got, err := ParseOCRPolicy(input)
+		if err != nil || got != want {
+			t.Errorf("ParseOCRPolicy(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseOCRPolicy("ignore"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+	for _, input := range []string{"force,skip", "skip+redo", "force redo"} {
+		_, err := ParseOCRPolicy(input)
+		if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Errorf("ParseOCRPolicy(%q): expected mutual exclusion error, got %v", input, err)
+		}
+	}
+}
+
+func TestOCROptions_Validate(t *testing.T) {
+	for _, opts := range []OCROptions{
+		{PDFALevel: "4"},
+		{PDFALevel: "2b"},
+		{OptimizeLevel: "4"},
+		{OptimizeLevel: "-1"},
+		{OptimizeLevel: "0", JBIG2Lossy: true},
+		{Policy: "force-ocr"},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+
+	// Invalid options fail before ocrmypdf runs
+	ran := false
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			ran = true
+			return runner.Result{}, nil
+		},
+	}
+	if _, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, "in.pdf", t.TempDir(), "eng", OCROptions{PDFALevel: "5"}, 30*time.Second); err == nil {
+		t.Error("expected error for an invalid PDF/A level")
+	}
+	if ran {
+		t.Error("expected ocrmypdf not to run with invalid options")
+	}
+}
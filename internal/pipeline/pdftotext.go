@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PDFToTextMode selects how pdftotext lays out extracted text.
+type PDFToTextMode string
+
+const (
+	// PDFToTextLayout keeps the physical layout of the page (pdftotext -layout). Default.
+	PDFToTextLayout PDFToTextMode = "layout"
+	// PDFToTextRaw keeps text in content stream order (pdftotext -raw), which often reads
+	// more naturally for single-column documents.
+	PDFToTextRaw PDFToTextMode = "raw"
+	// PDFToTextBBox writes XHTML with a bounding box for every word, grouped into
+	// text blocks and lines (pdftotext -bbox-layout).
+	PDFToTextBBox PDFToTextMode = "bbox"
+	// PDFToTextHTMLMeta writes the layout text wrapped in an HTML document with the
+	// PDF's metadata in its head (pdftotext -htmlmeta -layout).
+	PDFToTextHTMLMeta PDFToTextMode = "htmlmeta"
+)
+
+// ParsePDFToTextMode parses a mode name ("layout", "raw", "bbox" or "htmlmeta",
+// case-insensitive). An empty name is PDFToTextLayout.
+func ParsePDFToTextMode(s string) (PDFToTextMode, error) {
+	switch mode := PDFToTextMode(strings.ToLower(s)); mode {
+	case "":
+		return PDFToTextLayout, nil
+	case PDFToTextLayout, PDFToTextRaw, PDFToTextBBox, PDFToTextHTMLMeta:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown pdftotext mode %q (expected layout, raw, bbox or htmlmeta)", s)
+	}
+}
+
+// flags returns the pdftotext flags that select the mode. The HTML modes keep the
+// paragraph breaks of the other modes: bbox asks for text blocks, and htmlmeta for
+// layout text, which separates paragraphs with blank lines.
+func (m PDFToTextMode) flags() []string {
+	switch m {
+	case PDFToTextBBox:
+		return []string{"-bbox-layout"}
+	case PDFToTextHTMLMeta:
+		return []string{"-htmlmeta", "-layout"}
+	default:
+		return []string{"-" + string(m)}
+	}
+}
+
+// isHTML reports whether the mode makes pdftotext write HTML rather than plain text.
+func (m PDFToTextMode) isHTML() bool {
+	return m == PDFToTextBBox || m == PDFToTextHTMLMeta
+}
+
+// htmlToText returns the plain text of pdftotext HTML output written in mode.
+func htmlToText(mode PDFToTextMode, content []byte) ([]byte, error) {
+	var text string
+	var err error
+	if mode == PDFToTextBBox {
+		text, err = bboxText(string(content))
+	} else {
+		text, err = htmlMetaText(string(content))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(text), nil
+}
+
+// htmlMetaText returns the text of pdftotext -htmlmeta output, which is the usual
+// plain text, HTML-escaped inside a <pre> element. Its blank lines, which separate
+// paragraphs in -layout text, are kept.
+func htmlMetaText(doc string) (string, error) {
+	start := strings.Index(doc, "<pre>")
+	end := strings.LastIndex(doc, "</pre>")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("no <pre> element in pdftotext -htmlmeta output")
+	}
+	return html.UnescapeString(strings.TrimPrefix(doc[start+len("<pre>"):end], "\n")), nil
+}
+
+// bboxText rebuilds plain text from pdftotext -bbox or -bbox-layout output. Words are
+// joined with spaces in document order, a word whose top edge moves by more than half
+// the previous word's height starts a new line, a blank line separates text blocks,
+// and each page ends with a form feed, as in pdftotext's plain text output.
+func bboxText(doc string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(doc))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var b strings.Builder
+	var inWord, lineStarted, blockEnded bool
+	var word strings.Builder
+	var yMin, yMax, prevYMin, prevHeight float64
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse pdftotext -bbox output: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "page":
+				lineStarted, blockEnded = false, false
+			case "word":
+				inWord = true
+				word.Reset()
+				yMin, yMax = 0, 0
+				for _, attr := range t.Attr {
+					v, _ := strconv.ParseFloat(attr.Value, 64)
+					switch attr.Name.Local {
+					case "yMin":
+						yMin = v
+					case "yMax":
+						yMax = v
+					}
+				}
+			}
+		case xml.CharData:
+			if inWord {
+				word.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "word":
+				inWord = false
+				if lineStarted {
+					if blockEnded {
+						b.WriteString("\n\n")
+					} else if math.Abs(yMin-prevYMin) > prevHeight/2 {
+						b.WriteString("\n")
+					} else {
+						b.WriteString(" ")
+					}
+				}
+				b.WriteString(strings.TrimSpace(word.String()))
+				lineStarted, blockEnded = true, false
+				prevYMin, prevHeight = yMin, yMax-yMin
+			case "block":
+				blockEnded = true
+			case "page":
+				if lineStarted {
+					b.WriteString("\n")
+				}
+				b.WriteString("\f")
+			}
+		}
+	}
+	return b.String(), nil
+}
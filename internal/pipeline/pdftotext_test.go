@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestParsePDFToTextMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want PDFToTextMode
+	}{
+		{"", PDFToTextLayout},
+		{"layout", PDFToTextLayout},
+		{"RAW", PDFToTextRaw},
+		{"bbox", PDFToTextBBox},
+		{"htmlmeta", PDFToTextHTMLMeta},
+	}
+	for _, tt := range tests {
+		got, err := ParsePDFToTextMode(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePDFToTextMode(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := ParsePDFToTextMode("html"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestBBoxText(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<title></title>
+<meta name="Producer" content="img2pdf"/>
+</head>
+<body>
+<doc>
+  <page width="612.000000" height="792.000000">
+    <word xMin="72.0" yMin="90.1" xMax="110.2" yMax="102.3">Hello</word>
+    <word xMin="114.0" yMin="90.4" xMax="150.5" yMax="102.3">world</word>
+    <word xMin="72.0" yMin="110.0" xMax="100.0" yMax="122.0">A&amp;B</word>
+  </page>
+  <page width="612.000000" height="792.000000">
+  </page>
+  <page width="612.000000" height="792.000000">
+    <word xMin="72.0" yMin="90.0" xMax="110.0" yMax="102.0">Third</word>
+  </page>
+</doc>
+</body>
+</html>
+`
+	got, err := bboxText(doc)
+	if err != nil {
+		t.Fatalf("bboxText failed: %v", err)
+	}
+	want := "Hello world\nA&B\n\f\fThird\n\f"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestHTMLMetaText(t *testing.T) {
+	doc := "<!DOCTYPE html><html><head><title>Doc</title></head><body>\n<pre>\nPage one &lt;1&gt;\n\fPage two\n\f</pre>\n</body></html>\n"
+	got, err := htmlMetaText(doc)
+	if err != nil {
+		t.Fatalf("htmlMetaText failed: %v", err)
+	}
+	if want := "Page one <1>\n\fPage two\n\f"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := htmlMetaText("<html></html>"); err == nil {
+		t.Error("expected error without a <pre> element")
+	}
+}
+
+func TestBBoxText_Blocks(t *testing.T) {
+	doc := `<html><body><doc>
+  <page width="612.000000" height="792.000000">
+    <flow>
+      <block xMin="72.0" yMin="90.0" xMax="150.0" yMax="122.0">
+        <line xMin="72.0" yMin="90.0" xMax="150.0" yMax="102.0">
+          <word xMin="72.0" yMin="90.0" xMax="110.0" yMax="102.0">First</word>
+          <word xMin="114.0" yMin="90.0" xMax="150.0" yMax="102.0">block</word>
+        </line>
+        <line xMin="72.0" yMin="110.0" xMax="100.0" yMax="122.0">
+          <word xMin="72.0" yMin="110.0" xMax="100.0" yMax="122.0">continues</word>
+        </line>
+      </block>
+      <block xMin="72.0" yMin="140.0" xMax="110.0" yMax="152.0">
+        <line xMin="72.0" yMin="140.0" xMax="110.0" yMax="152.0">
+          <word xMin="72.0" yMin="140.0" xMax="110.0" yMax="152.0">Second</word>
+        </line>
+      </block>
+    </flow>
+  </page>
+  <page width="612.000000" height="792.000000">
+    <flow>
+      <block xMin="72.0" yMin="90.0" xMax="110.0" yMax="102.0">
+        <line xMin="72.0" yMin="90.0" xMax="110.0" yMax="102.0">
+          <word xMin="72.0" yMin="90.0" xMax="110.0" yMax="102.0">Third</word>
+        </line>
+      </block>
+    </flow>
+  </page>
+</doc></body></html>
+`
+	got, err := bboxText(doc)
+	if err != nil {
+		t.Fatalf("bboxText failed: %v", err)
+	}
+	if want := "First block\ncontinues\n\nSecond\n\fThird\n\f"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestPDFToTextModes_ChunkCount checks that every mode's text splits into the same
+// paragraphs: two on the first page and one on the second.
+func TestPDFToTextModes_ChunkCount(t *testing.T) {
+	plain := "First paragraph of the page.\n\nSecond paragraph of the page.\n\fThird paragraph.\n\f"
+	outputs := map[PDFToTextMode]string{
+		PDFToTextLayout:   plain,
+		PDFToTextRaw:      plain,
+		PDFToTextHTMLMeta: "<html><head><title>t</title></head><body><pre>\n" + plain + "</pre></body></html>",
+		PDFToTextBBox: `<html><body><doc><page width="612" height="792"><flow>` +
+			`<block><line><word xMin="1" yMin="10" xMax="20" yMax="20">First</word><word xMin="25" yMin="10" xMax="40" yMax="20">paragraph</word></line></block>` +
+			`<block><line><word xMin="1" yMin="40" xMax="20" yMax="50">Second</word><word xMin="25" yMin="40" xMax="40" yMax="50">paragraph</word></line></block>` +
+			`</flow></page><page width="612" height="792"><flow>` +
+			`<block><line><word xMin="1" yMin="10" xMax="20" yMax="20">Third</word></line></block>` +
+			`</flow></page></doc></body></html>`,
+	}
+
+	for mode, output := range outputs {
+		content := []byte(output)
+		if mode.isHTML() {
+			var err error
+			if content, err = htmlToText(mode, content); err != nil {
+				t.Fatalf("%s: htmlToText failed: %v", mode, err)
+			}
+		}
+		chunks := text.ChunkText(string(content), 1, 1)
+		if len(chunks) != 3 {
+			t.Errorf("%s: expected 3 chunks, got %d from %q", mode, len(chunks), content)
+		}
+	}
+}
@@ -3,12 +3,15 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
 	"github.com/jonkmatsumo/bulk-ocr/internal/runner"
 )
 
@@ -17,15 +20,69 @@ type runnerInterface interface {
 	Run(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error)
 }
 
+// ExecOptions configure how the stages of this package run external commands. They
+// are passed to every stage call rather than set for the process, so that runs with
+// different options can overlap.
+type ExecOptions struct {
+	// DryRun makes BuildPDF, MergePDFs, OCRPDF and ExtractText log the command they
+	// would run instead of running it, skip checking their output, and return the path
+	// the output would have been written to.
+	DryRun bool
+	// OnResult is called with the result of every external command the stages run,
+	// including failed ones, before the stage sees it (see runner.Runner.OnResult).
+	OnResult func(runner.Result, error)
+	// BinOverride and Env are the runner.Runner BinOverride and Env of the commands,
+	// e.g. to run the ocrmypdf of a virtualenv.
+	BinOverride map[string]string
+	Env         map[string]string
+	// Img2PDF is how BuildPDF runs img2pdf; the zero value is DefaultImg2PDFCommand.
+	Img2PDF Img2PDFCommand
+	// Logger receives the stages' log lines; if nil they are written by the standard
+	// logger.
+	Logger *slog.Logger
+}
+
+// logf logs an informational line through Logger, or the standard logger if it is nil.
+func (o ExecOptions) logf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if o.Logger != nil {
+		o.Logger.Info(msg)
+		return
+	}
+	log.Print(msg)
+}
+
+// warnf logs a non-fatal problem: level WARN through Logger, or "warning: ..." on the
+// standard logger if it is nil.
+func (o ExecOptions) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if o.Logger != nil {
+		o.Logger.Warn(msg)
+		return
+	}
+	log.Printf("warning: %s", msg)
+}
+
+// newRunner returns the runner the stages use, with the overrides of o and
+// reporting to OnResult.
+func (o ExecOptions) newRunner() *runner.Runner {
+	r := runner.New()
+	r.OnResult = o.OnResult
+	r.BinOverride = o.BinOverride
+	r.Env = o.Env
+	return r
+}
+
 // BuildPDF combines staged images into a single PDF using img2pdf.
 // Takes staged images from preprocessedDir and writes combined.pdf to outputDir.
+// timeout limits img2pdf on top of ctx, whose cancellation kills it.
 // Returns the path to the created PDF file.
-func BuildPDF(preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
-	return buildPDFWithRunner(runner.New(), preprocessedDir, outputDir, timeout)
+func BuildPDF(ctx context.Context, execOpts ExecOptions, preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+	return buildPDFWithRunner(ctx, execOpts.newRunner(), execOpts, preprocessedDir, outputDir, timeout)
 }
 
 // buildPDFWithRunner is the internal implementation that accepts a runner interface for testing
-func buildPDFWithRunner(r runnerInterface, preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
+func buildPDFWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, preprocessedDir, outputDir string, timeout time.Duration) (string, error) {
 	// List all image files in preprocessed directory
 	files, err := filepath.Glob(filepath.Join(preprocessedDir, "*"))
 	if err != nil {
@@ -48,21 +105,39 @@ func buildPDFWithRunner(r runnerInterface, preprocessedDir, outputDir string, ti
 	// Sort for deterministic ordering
 	sort.Strings(imageFiles)
 
-	// Build command: python3 -m img2pdf <files...> -o combined.pdf
+	// Build command: python3 -m img2pdf <files...> -o combined.pdf, or as execOpts.Img2PDF says
+	// Large image sets are passed in a list file to stay under the OS argument size limit.
 	outputPath := filepath.Join(outputDir, "combined.pdf")
 	args := append(imageFiles, "-o", outputPath)
+	if len(imageFiles) > maxInlineImages {
+		listPath, err := writeImageList(outputDir, imageFiles)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			if err := os.Remove(listPath); err != nil {
+				execOpts.warnf("failed to remove image list %s: %v", listPath, err)
+			}
+		}()
+		args = []string{"--from-file", listPath, "-o", outputPath}
+	}
 
-	ctx := context.Background()
 	opts := runner.RunOpts{
 		Timeout:    timeout,
 		StdoutMode: runner.StreamAndCapture,
 		StderrMode: runner.StreamAndCapture,
+		DryRun:     execOpts.DryRun,
 	}
 
-	result, err := r.Run(ctx, "python3", append([]string{"-m", "img2pdf"}, args...), opts)
+	img2pdf := execOpts.img2pdf()
+	result, err := r.Run(ctx, img2pdf.Bin, img2pdf.args(args...), opts)
 	if err != nil {
 		return "", fmt.Errorf("img2pdf failed: %w (stderr: %s)", err, result.Stderr)
 	}
+	if opts.DryRun {
+		execOpts.logf("dry run: %s", result.Cmd)
+		return outputPath, nil
+	}
 
 	// Verify output file was created
 	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
@@ -72,37 +147,128 @@ func buildPDFWithRunner(r runnerInterface, preprocessedDir, outputDir string, ti
 	return outputPath, nil
 }
 
+// MergePDFs concatenates existing PDFs, in order, into combined.pdf in outputDir
+// using qpdf, so that they can be OCRed in one pass like a PDF built from images.
+// timeout limits qpdf on top of ctx, whose cancellation kills it.
+// Returns the path to the merged PDF file.
+func MergePDFs(ctx context.Context, execOpts ExecOptions, pdfPaths []string, outputDir string, timeout time.Duration) (string, error) {
+	return mergePDFsWithRunner(ctx, execOpts.newRunner(), execOpts, pdfPaths, outputDir, timeout)
+}
+
+// mergePDFsWithRunner is the internal implementation that accepts a runner interface for testing
+func mergePDFsWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPaths []string, outputDir string, timeout time.Duration) (string, error) {
+	if len(pdfPaths) == 0 {
+		return "", fmt.Errorf("no PDFs to merge")
+	}
+
+	// Build command: qpdf --empty --pages a.pdf b.pdf -- combined.pdf
+	outputPath := filepath.Join(outputDir, "combined.pdf")
+	args := append([]string{"--empty", "--pages"}, pdfPaths...)
+	args = append(args, "--", outputPath)
+
+	opts := runner.RunOpts{
+		Timeout:    timeout,
+		StdoutMode: runner.StreamAndCapture,
+		StderrMode: runner.StreamAndCapture,
+		DryRun:     execOpts.DryRun,
+	}
+
+	result, err := r.Run(ctx, "qpdf", args, opts)
+	if err != nil {
+		return "", fmt.Errorf("qpdf failed: %w (stderr: %s)", err, result.Stderr)
+	}
+	if opts.DryRun {
+		execOpts.logf("dry run: %s", result.Cmd)
+		return outputPath, nil
+	}
+
+	// Verify output file was created
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("qpdf completed but output file not found: %s", outputPath)
+	}
+
+	return outputPath, nil
+}
+
+// maxInlineImages is the most image paths BuildPDF passes to img2pdf as arguments;
+// beyond it they go in a list file read with --from-file.
+const maxInlineImages = 1000
+
+// writeImageList writes paths, NUL-separated as img2pdf --from-file expects, to a new
+// hidden file in dir and returns its path. Page order follows the order of paths.
+func writeImageList(dir string, paths []string) (string, error) {
+	file, err := os.CreateTemp(dir, ".img2pdf-*.list")
+	if err != nil {
+		return "", fmt.Errorf("failed to create image list: %w", err)
+	}
+	_, err = file.WriteString(strings.Join(paths, "\x00"))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write image list: %w", err)
+	}
+	return file.Name(), nil
+}
+
 // OCRPDF runs OCR on a PDF file using ocrmypdf.
 // Takes a PDF path and writes the OCR'd PDF to outputDir as combined_ocr.pdf.
+// Every language in lang ("eng" or "eng+fra") is first checked against tesseract's
+// installed languages, so a missing pack fails before ocrmypdf starts.
+// opts selects PDF/A output and optimization; invalid values fail before ocrmypdf starts too.
+// Cancelling ctx kills ocrmypdf; timeout applies within ctx.
 // Returns the path to the created OCR PDF file.
-func OCRPDF(pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
-	return ocrPDFWithRunner(runner.New(), pdfPath, outputDir, lang, timeout)
+func OCRPDF(ctx context.Context, execOpts ExecOptions, pdfPath, outputDir, lang string, opts OCROptions, timeout time.Duration) (string, error) {
+	return checkedOCRPDFWithRunner(ctx, execOpts.newRunner(), execOpts, pdfPath, outputDir, lang, opts, timeout)
+}
+
+// checkedOCRPDFWithRunner checks the OCR languages, then runs ocrPDFWithRunner.
+// The check is skipped in dry-run mode, which runs no commands.
+func checkedOCRPDFWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPath, outputDir, lang string, opts OCROptions, timeout time.Duration) (string, error) {
+	if !execOpts.DryRun {
+		if err := checkLangsWithRunner(ctx, r, execOpts, lang); err != nil {
+			return "", err
+		}
+	}
+	return ocrPDFWithRunner(ctx, r, execOpts, pdfPath, outputDir, lang, opts, timeout)
 }
 
 // ocrPDFWithRunner is the internal implementation that accepts a runner interface for testing
-func ocrPDFWithRunner(r runnerInterface, pdfPath, outputDir, lang string, timeout time.Duration) (string, error) {
+func ocrPDFWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPath, outputDir, lang string, opts OCROptions, timeout time.Duration) (string, error) {
+	return ocrmypdfWithRunner(ctx, r, execOpts, pdfPath, outputDir, lang, opts, "", timeout)
+}
+
+// ocrmypdfWithRunner runs ocrmypdf on pdfPath, also writing the recognized text to
+// sidecarPath unless it is empty.
+func ocrmypdfWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPath, outputDir, lang string, ocrOpts OCROptions, sidecarPath string, timeout time.Duration) (string, error) {
+	if err := ocrOpts.Validate(); err != nil {
+		return "", err
+	}
 	outputPath := filepath.Join(outputDir, "combined_ocr.pdf")
 
-	// Build command: ocrmypdf --deskew --rotate-pages -l <lang> input.pdf output.pdf
-	args := []string{
-		"--deskew",
-		"--rotate-pages",
-		"-l", lang,
-		pdfPath,
-		outputPath,
+	// Build command: ocrmypdf --deskew --rotate-pages -l <lang> --skip-text [options] [--sidecar <text>] input.pdf output.pdf
+	args := ocrOpts.args(lang)
+	if sidecarPath != "" {
+		args = append(args, "--sidecar", sidecarPath)
 	}
+	args = append(args, pdfPath, outputPath)
 
-	ctx := context.Background()
 	opts := runner.RunOpts{
 		Timeout:    timeout,
 		StdoutMode: runner.StreamAndCapture,
 		StderrMode: runner.StreamAndCapture,
+		DryRun:     execOpts.DryRun,
 	}
 
 	result, err := r.Run(ctx, "ocrmypdf", args, opts)
 	if err != nil {
 		return "", fmt.Errorf("ocrmypdf failed: %w (stderr: %s)", err, result.Stderr)
 	}
+	if opts.DryRun {
+		execOpts.logf("dry run: %s", result.Cmd)
+		return outputPath, nil
+	}
 
 	// Verify output file was created
 	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
@@ -112,51 +278,125 @@ func ocrPDFWithRunner(r runnerInterface, pdfPath, outputDir, lang string, timeou
 	return outputPath, nil
 }
 
+// OCRPDFWithSidecar runs OCRPDF with ocrmypdf's --sidecar option, which writes the
+// recognized text in the same pass instead of a separate pdftotext run. Returns the
+// OCR PDF and the text file, outputDir/extracted.txt, whose pages are separated by
+// form feeds as in pdftotext output. Text shorter than minChars is returned together
+// with a *TextTooShortError, as by ExtractText.
+func OCRPDFWithSidecar(ctx context.Context, execOpts ExecOptions, pdfPath, outputDir, lang string, opts OCROptions, minChars int, timeout time.Duration) (string, string, error) {
+	return ocrPDFWithSidecarWithRunner(ctx, execOpts.newRunner(), execOpts, pdfPath, outputDir, lang, opts, minChars, timeout)
+}
+
+// ocrPDFWithSidecarWithRunner is the internal implementation that accepts a runner interface for testing
+func ocrPDFWithSidecarWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPath, outputDir, lang string, opts OCROptions, minChars int, timeout time.Duration) (string, string, error) {
+	if !execOpts.DryRun {
+		if err := checkLangsWithRunner(ctx, r, execOpts, lang); err != nil {
+			return "", "", err
+		}
+	}
+	textPath := filepath.Join(outputDir, "extracted.txt")
+	ocrPath, err := ocrmypdfWithRunner(ctx, r, execOpts, pdfPath, outputDir, lang, opts, textPath, timeout)
+	if err != nil || execOpts.DryRun {
+		return ocrPath, textPath, err
+	}
+
+	content, err := os.ReadFile(textPath)
+	if err != nil {
+		return "", "", fmt.Errorf("ocrmypdf completed but sidecar text not readable: %w", err)
+	}
+	// ocrmypdf may write the sidecar before the PDF; resuming expects the text to be newer
+	now := time.Now()
+	if err := os.Chtimes(textPath, now, now); err != nil {
+		return "", "", fmt.Errorf("failed to update sidecar time: %w", err)
+	}
+
+	text := strings.TrimSpace(string(content))
+	if len(text) < minChars {
+		return ocrPath, textPath, &TextTooShortError{Chars: len(text), MinChars: minChars}
+	}
+	return ocrPath, textPath, nil
+}
+
+// DefaultMinExtractedChars is the default minimum length of extracted text.
+const DefaultMinExtractedChars = 20
+
+// TextTooShortError reports extracted text below the minimum length, which usually
+// means OCR failed or the PDF is empty. The text file is still written.
+type TextTooShortError struct {
+	Chars    int // Length of the extracted text, excluding surrounding whitespace
+	MinChars int
+}
+
+func (e *TextTooShortError) Error() string {
+	return fmt.Sprintf("extracted text is too short (%d chars, minimum %d): likely OCR failure or empty PDF", e.Chars, e.MinChars)
+}
+
 // ExtractText extracts text from an OCR'd PDF using pdftotext.
 // Takes a PDF path and writes extracted text to outputDir as extracted.txt.
-// Validates that the extracted text is not empty (minimum 20 characters).
+// Validates that the extracted text has at least minChars characters; shorter text
+// returns the path together with a *TextTooShortError so callers may accept it.
+// The bbox and htmlmeta modes write pdftotext's HTML to extracted.html and its text
+// to extracted.txt. An empty mode is PDFToTextLayout.
+// pdftotext is killed when ctx is cancelled or timeout elapses.
 // Returns the path to the created text file.
-func ExtractText(pdfPath, outputDir string, timeout time.Duration) (string, error) {
-	return extractTextWithRunner(runner.New(), pdfPath, outputDir, timeout)
+func ExtractText(ctx context.Context, execOpts ExecOptions, pdfPath, outputDir string, mode PDFToTextMode, minChars int, timeout time.Duration) (string, error) {
+	return extractTextWithRunner(ctx, execOpts.newRunner(), execOpts, pdfPath, outputDir, mode, minChars, timeout)
 }
 
 // extractTextWithRunner is the internal implementation that accepts a runner interface for testing
-func extractTextWithRunner(r runnerInterface, pdfPath, outputDir string, timeout time.Duration) (string, error) {
+func extractTextWithRunner(ctx context.Context, r runnerInterface, execOpts ExecOptions, pdfPath, outputDir string, mode PDFToTextMode, minChars int, timeout time.Duration) (string, error) {
+	if mode == "" {
+		mode = PDFToTextLayout
+	}
 	outputPath := filepath.Join(outputDir, "extracted.txt")
-
-	// Build command: pdftotext -layout input.pdf output.txt
-	args := []string{
-		"-layout",
-		pdfPath,
-		outputPath,
+	pdftotextPath := outputPath
+	if mode.isHTML() {
+		pdftotextPath = filepath.Join(outputDir, "extracted.html")
 	}
 
-	ctx := context.Background()
+	// Build command: pdftotext -<mode> input.pdf output.txt
+	// pdftotext ends each page with a form feed (\f); these are kept so chunks can record their page
+	args := append(mode.flags(), pdfPath, pdftotextPath)
+
 	opts := runner.RunOpts{
 		Timeout:    timeout,
 		StdoutMode: runner.StreamAndCapture,
 		StderrMode: runner.StreamAndCapture,
+		DryRun:     execOpts.DryRun,
 	}
 
 	result, err := r.Run(ctx, "pdftotext", args, opts)
 	if err != nil {
 		return "", fmt.Errorf("pdftotext failed: %w (stderr: %s)", err, result.Stderr)
 	}
+	if opts.DryRun {
+		execOpts.logf("dry run: %s", result.Cmd)
+		return outputPath, nil
+	}
 
 	// Verify output file was created
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("pdftotext completed but output file not found: %s", outputPath)
+	if _, err := os.Stat(pdftotextPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("pdftotext completed but output file not found: %s", pdftotextPath)
 	}
 
-	// Validate extracted text is not empty (minimum 20 characters)
-	content, err := os.ReadFile(outputPath)
+	// Validate extracted text is not empty (minimum minChars characters)
+	content, err := os.ReadFile(pdftotextPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read extracted text: %w", err)
 	}
+	if mode.isHTML() {
+		content, err = htmlToText(mode, content)
+		if err != nil {
+			return "", err
+		}
+		if err := fsutil.WriteFileAtomic(outputPath, content, 0644); err != nil {
+			return "", fmt.Errorf("failed to write extracted text: %w", err)
+		}
+	}
 
 	text := strings.TrimSpace(string(content))
-	if len(text) < 20 {
-		return "", fmt.Errorf("extracted text is too short (%d chars, minimum 20): likely OCR failure or empty PDF", len(text))
+	if len(text) < minChars {
+		return outputPath, &TextTooShortError{Chars: len(text), MinChars: minChars}
 	}
 
 	return outputPath, nil
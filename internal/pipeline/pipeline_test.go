@@ -1,9 +1,15 @@
 package pipeline
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -15,7 +21,7 @@ func TestBuildPDF_EmptyDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputDir := t.TempDir()
 
-	_, err := BuildPDF(tmpDir, outputDir, 30*time.Second)
+	_, err := BuildPDF(context.Background(), ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for empty directory, got nil")
 	}
@@ -34,7 +40,7 @@ func TestBuildPDF_NoImages(t *testing.T) {
 		t.Fatalf("failed to create test file: %v", err)
 	}
 
-	_, err := BuildPDF(tmpDir, outputDir, 30*time.Second)
+	_, err := BuildPDF(context.Background(), ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for no images, got nil")
 	}
@@ -220,7 +226,7 @@ func TestBuildPDF_SingleImage(t *testing.T) {
 		},
 	}
 
-	result, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	result, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err != nil {
 		t.Fatalf("BuildPDF failed: %v", err)
 	}
@@ -265,7 +271,7 @@ func TestBuildPDF_MultipleImages(t *testing.T) {
 		},
 	}
 
-	result, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	result, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err != nil {
 		t.Fatalf("BuildPDF failed: %v", err)
 	}
@@ -300,7 +306,7 @@ func TestBuildPDF_DifferentFormats(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err != nil {
 		t.Fatalf("BuildPDF failed: %v", err)
 	}
@@ -332,7 +338,7 @@ func TestBuildPDF_DeterministicOrdering(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err != nil {
 		t.Fatalf("BuildPDF failed: %v", err)
 	}
@@ -370,6 +376,87 @@ func TestBuildPDF_DeterministicOrdering(t *testing.T) {
 	}
 }
 
+// TestBuildPDF_LargeImageListUsesFromFile tests that large image sets are passed to
+// img2pdf in a list file, in sorted order, and that the list file is removed afterwards
+func TestBuildPDF_LargeImageListUsesFromFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	count := maxInlineImages + 1
+	for i := count; i >= 1; i-- {
+		createMockImage(t, tmpDir, fmt.Sprintf("image%04d.png", i))
+	}
+
+	var capturedArgs []string
+	var listPaths []string
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			capturedArgs = args
+			for i, arg := range args {
+				if arg == "--from-file" && i+1 < len(args) {
+					data, err := os.ReadFile(args[i+1])
+					if err != nil {
+						t.Fatalf("failed to read image list: %v", err)
+					}
+					listPaths = strings.Split(string(data), "\x00")
+				}
+				if arg == "-o" && i+1 < len(args) {
+					_ = os.WriteFile(args[i+1], []byte("%PDF-1.4\n"), 0644)
+				}
+			}
+			return runner.Result{ExitCode: 0}, nil
+		},
+	}
+
+	if _, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second); err != nil {
+		t.Fatalf("BuildPDF failed: %v", err)
+	}
+
+	for _, arg := range capturedArgs {
+		if strings.HasSuffix(arg, ".png") {
+			t.Fatalf("expected no inline image args, got %s", arg)
+		}
+	}
+	if len(listPaths) != count {
+		t.Fatalf("expected %d paths in image list, got %d", count, len(listPaths))
+	}
+	for i, path := range listPaths {
+		if want := fmt.Sprintf("image%04d.png", i+1); filepath.Base(path) != want {
+			t.Fatalf("list entry %d: expected %s, got %s", i, want, filepath.Base(path))
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(outputDir, ".img2pdf-*.list"))
+	if len(matches) != 0 {
+		t.Errorf("expected image list to be removed, found %v", matches)
+	}
+}
+
+// TestBuildPDF_ImageListRemovedOnError tests that the list file is removed when img2pdf fails
+func TestBuildPDF_ImageListRemovedOnError(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	for i := 1; i <= maxInlineImages+1; i++ {
+		createMockImage(t, tmpDir, fmt.Sprintf("image%04d.png", i))
+	}
+
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			return runner.Result{ExitCode: 1}, &runner.ExecError{Bin: bin, Args: args, Result: runner.Result{ExitCode: 1}}
+		},
+	}
+
+	if _, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second); err == nil {
+		t.Fatal("expected error for img2pdf failure, got nil")
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(outputDir, ".img2pdf-*.list"))
+	if len(matches) != 0 {
+		t.Errorf("expected image list to be removed, found %v", matches)
+	}
+}
+
 // TestBuildPDF_Img2pdfFailure tests error handling when img2pdf fails
 func TestBuildPDF_Img2pdfFailure(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -390,7 +477,7 @@ func TestBuildPDF_Img2pdfFailure(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for img2pdf failure, got nil")
 	}
@@ -418,7 +505,7 @@ func TestBuildPDF_Timeout(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 1*time.Nanosecond)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 1*time.Nanosecond)
 	if err == nil {
 		t.Error("expected error for timeout, got nil")
 	}
@@ -438,7 +525,7 @@ func TestBuildPDF_OutputFileNotCreated(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for missing output file, got nil")
 	}
@@ -478,7 +565,7 @@ func TestBuildPDF_NonImageFiles(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err != nil {
 		t.Fatalf("BuildPDF failed: %v", err)
 	}
@@ -513,12 +600,60 @@ func TestBuildPDF_CaseInsensitiveExtensions(t *testing.T) {
 		},
 	}
 
-	_, err := buildPDFWithRunner(mockR, tmpDir, outputDir, 30*time.Second)
+	_, err := buildPDFWithRunner(context.Background(), mockR, ExecOptions{}, tmpDir, outputDir, 30*time.Second)
 	if err != nil {
 		t.Fatalf("BuildPDF failed: %v", err)
 	}
 }
 
+// TestMergePDFs_Args tests that input PDFs are passed to qpdf in order
+func TestMergePDFs_Args(t *testing.T) {
+	outputDir := t.TempDir()
+	inputs := []string{"/scans/b.pdf", "/scans/a.pdf"}
+
+	var gotBin string
+	var gotArgs []string
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			gotBin, gotArgs = bin, args
+			_ = os.WriteFile(args[len(args)-1], []byte("%PDF-1.4\n"), 0644)
+			return runner.Result{}, nil
+		},
+	}
+
+	result, err := mergePDFsWithRunner(context.Background(), mockR, ExecOptions{}, inputs, outputDir, 30*time.Second)
+	if err != nil {
+		t.Fatalf("MergePDFs failed: %v", err)
+	}
+	expectedPath := filepath.Join(outputDir, "combined.pdf")
+	if result != expectedPath {
+		t.Errorf("expected path %s, got %s", expectedPath, result)
+	}
+	want := []string{"--empty", "--pages", "/scans/b.pdf", "/scans/a.pdf", "--", expectedPath}
+	if gotBin != "qpdf" || strings.Join(gotArgs, " ") != strings.Join(want, " ") {
+		t.Errorf("expected qpdf %v, got %s %v", want, gotBin, gotArgs)
+	}
+}
+
+// TestMergePDFs_Failure tests that qpdf errors and missing output are reported
+func TestMergePDFs_Failure(t *testing.T) {
+	failing := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			return runner.Result{ExitCode: 2, Stderr: "a.pdf: not a PDF file"}, errors.New("exit status 2")
+		},
+	}
+	_, err := mergePDFsWithRunner(context.Background(), failing, ExecOptions{}, []string{"a.pdf", "b.pdf"}, t.TempDir(), 30*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "not a PDF file") {
+		t.Errorf("expected qpdf stderr in error, got %v", err)
+	}
+
+	// Success without output
+	_, err = mergePDFsWithRunner(context.Background(), &mockRunner{}, ExecOptions{}, []string{"a.pdf", "b.pdf"}, t.TempDir(), 30*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "output file not found") {
+		t.Errorf("expected missing output error, got %v", err)
+	}
+}
+
 // OCRPDF Tests
 
 // TestOCRPDF_Success tests successful OCR processing
@@ -558,7 +693,7 @@ func TestOCRPDF_Success(t *testing.T) {
 		},
 	}
 
-	result, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "eng", 30*time.Second)
+	result, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, 30*time.Second)
 	if err != nil {
 		t.Fatalf("OCRPDF failed: %v", err)
 	}
@@ -597,7 +732,7 @@ func TestOCRPDF_DifferentLanguage(t *testing.T) {
 		},
 	}
 
-	_, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "fra", 30*time.Second)
+	_, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "fra", OCROptions{}, 30*time.Second)
 	if err != nil {
 		t.Fatalf("OCRPDF failed: %v", err)
 	}
@@ -622,7 +757,7 @@ func TestOCRPDF_OutputFileCreated(t *testing.T) {
 		},
 	}
 
-	result, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "eng", 30*time.Second)
+	result, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, 30*time.Second)
 	if err != nil {
 		t.Fatalf("OCRPDF failed: %v", err)
 	}
@@ -652,7 +787,7 @@ func TestOCRPDF_OcrmypdfFailure(t *testing.T) {
 		},
 	}
 
-	_, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "eng", 30*time.Second)
+	_, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for ocrmypdf failure, got nil")
 	}
@@ -682,7 +817,7 @@ func TestOCRPDF_NonExistentInputPDF(t *testing.T) {
 		},
 	}
 
-	_, err := ocrPDFWithRunner(mockR, nonExistentPath, outputDir, "eng", 30*time.Second)
+	_, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, nonExistentPath, outputDir, "eng", OCROptions{}, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for non-existent input, got nil")
 	}
@@ -701,7 +836,7 @@ func TestOCRPDF_Timeout(t *testing.T) {
 		},
 	}
 
-	_, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "eng", 1*time.Nanosecond)
+	_, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, 1*time.Nanosecond)
 	if err == nil {
 		t.Error("expected error for timeout, got nil")
 	}
@@ -721,7 +856,7 @@ func TestOCRPDF_OutputFileNotCreated(t *testing.T) {
 		},
 	}
 
-	_, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "eng", 30*time.Second)
+	_, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for missing output file, got nil")
 	}
@@ -747,12 +882,93 @@ func TestOCRPDF_SpecialCharactersInPath(t *testing.T) {
 		},
 	}
 
-	_, err := ocrPDFWithRunner(mockR, pdfPath, outputDir, "eng", 30*time.Second)
+	_, err := ocrPDFWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, 30*time.Second)
 	if err != nil {
 		t.Fatalf("OCRPDF failed with special characters: %v", err)
 	}
 }
 
+// sidecarRunner fakes ocrmypdf writing text to its --sidecar file.
+func sidecarRunner(t *testing.T, text string) *mockRunner {
+	resetInstalledLangs(t)
+	return &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			if bin == "tesseract" {
+				return runner.Result{Stdout: "eng\n"}, nil
+			}
+			for i, arg := range args {
+				if arg == "--sidecar" && i+1 < len(args) {
+					_ = os.WriteFile(args[i+1], []byte(text), 0644)
+				}
+			}
+			_ = os.WriteFile(args[len(args)-1], []byte("%PDF-1.4\n"), 0644)
+			return runner.Result{Cmd: bin + " " + strings.Join(args, " ")}, nil
+		},
+	}
+}
+
+// TestOCRPDFWithSidecar_Success tests that the sidecar flag is passed and its text returned
+func TestOCRPDFWithSidecar_Success(t *testing.T) {
+	pdfPath := createMockPDF(t, t.TempDir())
+	outputDir := t.TempDir()
+
+	var ocrArgs []string
+	r := sidecarRunner(t, "Recognized text of the first page.\fAnd the second page.\n")
+	fake := r.runFunc
+	r.runFunc = func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+		if bin == "ocrmypdf" {
+			ocrArgs = args
+		}
+		return fake(ctx, bin, args, opts)
+	}
+
+	ocrPath, textPath, err := ocrPDFWithSidecarWithRunner(context.Background(), r, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, DefaultMinExtractedChars, 30*time.Second)
+	if err != nil {
+		t.Fatalf("OCRPDFWithSidecar failed: %v", err)
+	}
+	if ocrPath != filepath.Join(outputDir, "combined_ocr.pdf") {
+		t.Errorf("unexpected OCR path %s", ocrPath)
+	}
+	if textPath != filepath.Join(outputDir, "extracted.txt") {
+		t.Errorf("unexpected text path %s", textPath)
+	}
+	want := []string{"--deskew", "--rotate-pages", "-l", "eng", "--skip-text", "--sidecar", textPath, pdfPath, ocrPath}
+	if strings.Join(ocrArgs, " ") != strings.Join(want, " ") {
+		t.Errorf("expected ocrmypdf args %v, got %v", want, ocrArgs)
+	}
+
+	// The text must be newer than the OCR PDF so resuming treats it as fresh
+	ocrInfo, err := os.Stat(ocrPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textInfo, err := os.Stat(textPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if textInfo.ModTime().Before(ocrInfo.ModTime()) {
+		t.Error("expected sidecar text to be newer than the OCR PDF")
+	}
+}
+
+// TestOCRPDFWithSidecar_TextTooShort tests that the sidecar is held to the minimum length
+func TestOCRPDFWithSidecar_TextTooShort(t *testing.T) {
+	pdfPath := createMockPDF(t, t.TempDir())
+	outputDir := t.TempDir()
+
+	_, textPath, err := ocrPDFWithSidecarWithRunner(context.Background(), sidecarRunner(t, "  \f short \n"), ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, DefaultMinExtractedChars, 30*time.Second)
+	var tooShort *TextTooShortError
+	if !errors.As(err, &tooShort) {
+		t.Fatalf("expected TextTooShortError, got %v", err)
+	}
+	if tooShort.Chars != 5 || tooShort.MinChars != DefaultMinExtractedChars {
+		t.Errorf("unexpected error details: %+v", tooShort)
+	}
+	if textPath != filepath.Join(outputDir, "extracted.txt") {
+		t.Errorf("expected the text path with the error, got %q", textPath)
+	}
+}
+
 // ExtractText Tests
 
 // TestExtractText_Success tests successful text extraction
@@ -781,7 +997,7 @@ func TestExtractText_Success(t *testing.T) {
 		},
 	}
 
-	result, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	result, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText failed: %v", err)
 	}
@@ -828,12 +1044,98 @@ func TestExtractText_WithLayout(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText failed: %v", err)
 	}
 }
 
+// TestExtractText_Modes tests that each pdftotext mode passes its flag and that HTML
+// output is converted to plain text in extracted.txt
+func TestExtractText_Modes(t *testing.T) {
+	pages := map[PDFToTextMode]string{
+		PDFToTextLayout:   "Layout text with enough characters.\f",
+		PDFToTextRaw:      "Raw text with enough characters here.\f",
+		PDFToTextBBox:     `<html><body><doc><page width="612" height="792"><word xMin="1" yMin="10" xMax="20" yMax="20">Boxed</word><word xMin="25" yMin="10" xMax="40" yMax="20">words</word><word xMin="1" yMin="30" xMax="20" yMax="40">with enough characters</word></page></doc></body></html>`,
+		PDFToTextHTMLMeta: "<html><head><title>t</title></head><body><pre>\nMeta text &amp; enough characters.\f</pre></body></html>",
+	}
+	want := map[PDFToTextMode]string{
+		PDFToTextLayout:   "Layout text with enough characters.\f",
+		PDFToTextRaw:      "Raw text with enough characters here.\f",
+		PDFToTextBBox:     "Boxed words\nwith enough characters\n\f",
+		PDFToTextHTMLMeta: "Meta text & enough characters.\f",
+	}
+
+	for _, mode := range []PDFToTextMode{PDFToTextLayout, PDFToTextRaw, PDFToTextBBox, PDFToTextHTMLMeta} {
+		tmpDir := t.TempDir()
+		outputDir := t.TempDir()
+		pdfPath := createMockPDF(t, tmpDir)
+
+		var capturedArgs []string
+		mockR := &mockRunner{
+			runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+				capturedArgs = args
+				if err := os.WriteFile(args[len(args)-1], []byte(pages[mode]), 0644); err != nil {
+					t.Fatalf("failed to create output file: %v", err)
+				}
+				return runner.Result{ExitCode: 0}, nil
+			},
+		}
+
+		result, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, mode, 20, 30*time.Second)
+		if err != nil {
+			t.Fatalf("%s: ExtractText failed: %v", mode, err)
+		}
+
+		if !reflect.DeepEqual(capturedArgs[:len(capturedArgs)-2], mode.flags()) {
+			t.Errorf("%s: expected flags %v, got args: %v", mode, mode.flags(), capturedArgs)
+		}
+		wantOutput := "extracted.txt"
+		if mode == PDFToTextBBox || mode == PDFToTextHTMLMeta {
+			wantOutput = "extracted.html"
+		}
+		if filepath.Base(capturedArgs[len(capturedArgs)-1]) != wantOutput {
+			t.Errorf("%s: expected pdftotext to write %s, got args: %v", mode, wantOutput, capturedArgs)
+		}
+
+		if result != filepath.Join(outputDir, "extracted.txt") {
+			t.Errorf("%s: expected extracted.txt, got %s", mode, result)
+		}
+		content, err := os.ReadFile(result)
+		if err != nil {
+			t.Fatalf("%s: failed to read extracted text: %v", mode, err)
+		}
+		if string(content) != want[mode] {
+			t.Errorf("%s: expected %q, got %q", mode, want[mode], content)
+		}
+	}
+}
+
+// TestExtractText_HTMLModeTooShort tests that the minimum length applies to the text
+// inside pdftotext HTML output, not to the markup
+func TestExtractText_HTMLModeTooShort(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+	pdfPath := createMockPDF(t, tmpDir)
+
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			doc := "<html><head><title>A long document title in the metadata</title></head><body><pre>\nHi\f</pre></body></html>"
+			_ = os.WriteFile(args[len(args)-1], []byte(doc), 0644)
+			return runner.Result{ExitCode: 0}, nil
+		},
+	}
+
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextHTMLMeta, 20, 30*time.Second)
+	var tooShort *TextTooShortError
+	if !errors.As(err, &tooShort) {
+		t.Fatalf("expected TextTooShortError, got %v", err)
+	}
+	if tooShort.Chars != 2 {
+		t.Errorf("expected 2 chars, got %d", tooShort.Chars)
+	}
+}
+
 // TestExtractText_OutputFileCreated tests that output file is verified
 func TestExtractText_OutputFileCreated(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -850,7 +1152,7 @@ func TestExtractText_OutputFileCreated(t *testing.T) {
 		},
 	}
 
-	result, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	result, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText failed: %v", err)
 	}
@@ -876,7 +1178,7 @@ func TestExtractText_ContentValidation(t *testing.T) {
 		},
 	}
 
-	result, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	result, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText failed: %v", err)
 	}
@@ -911,7 +1213,7 @@ func TestExtractText_PdftotextFailure(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for pdftotext failure, got nil")
 	}
@@ -940,7 +1242,7 @@ func TestExtractText_NonExistentInputPDF(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, nonExistentPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, nonExistentPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for non-existent input, got nil")
 	}
@@ -959,7 +1261,7 @@ func TestExtractText_Timeout(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 1*time.Nanosecond)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 1*time.Nanosecond)
 	if err == nil {
 		t.Error("expected error for timeout, got nil")
 	}
@@ -979,7 +1281,7 @@ func TestExtractText_OutputFileNotCreated(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for missing output file, got nil")
 	}
@@ -1004,7 +1306,7 @@ func TestExtractText_TextTooShort(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for text too short, got nil")
 	}
@@ -1013,6 +1315,37 @@ func TestExtractText_TextTooShort(t *testing.T) {
 	}
 }
 
+// TestExtractText_ConfigurableMinChars tests the minimum length boundary and the typed error
+func TestExtractText_ConfigurableMinChars(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	pdfPath := createMockPDF(t, tmpDir)
+	mockR := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			outputPath := args[len(args)-1]
+			_ = os.WriteFile(outputPath, []byte("  TOTAL $5\n"), 0644) // 8 chars once trimmed
+			return runner.Result{ExitCode: 0}, nil
+		},
+	}
+
+	if _, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 8, 30*time.Second); err != nil {
+		t.Errorf("expected 8 chars to meet a minimum of 8, got: %v", err)
+	}
+
+	path, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 9, 30*time.Second)
+	var tooShort *TextTooShortError
+	if !errors.As(err, &tooShort) {
+		t.Fatalf("expected *TextTooShortError for a minimum of 9, got: %v", err)
+	}
+	if tooShort.Chars != 8 || tooShort.MinChars != 9 {
+		t.Errorf("expected 8 chars against minimum 9, got %+v", tooShort)
+	}
+	if path != filepath.Join(outputDir, "extracted.txt") {
+		t.Errorf("expected the text path alongside the error, got %q", path)
+	}
+}
+
 // TestExtractText_EmptyText tests error when extracted text is empty
 func TestExtractText_EmptyText(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -1028,7 +1361,7 @@ func TestExtractText_EmptyText(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for empty text, got nil")
 	}
@@ -1057,7 +1390,7 @@ func TestExtractText_ReadFileError(t *testing.T) {
 	// We'll need to intercept the file creation and delete it
 	// Actually, we can't easily test this without modifying the function
 	// So we'll test the validation logic separately
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	// This should succeed normally, but if we could delete the file between
 	// Stat and ReadFile, it would fail. This is hard to test without race conditions.
 	if err != nil {
@@ -1084,7 +1417,7 @@ func TestExtractText_UnicodeText(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText failed with unicode: %v", err)
 	}
@@ -1106,7 +1439,7 @@ func TestExtractText_SpecialCharacters(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText failed with special characters: %v", err)
 	}
@@ -1128,7 +1461,7 @@ func TestExtractText_Exactly20Chars(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err != nil {
 		t.Fatalf("ExtractText should pass with exactly 20 characters, got error: %v", err)
 	}
@@ -1150,7 +1483,7 @@ func TestExtractText_19Chars(t *testing.T) {
 		},
 	}
 
-	_, err := extractTextWithRunner(mockR, pdfPath, outputDir, 30*time.Second)
+	_, err := extractTextWithRunner(context.Background(), mockR, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
 	if err == nil {
 		t.Error("expected error for 19 characters, got nil")
 	}
@@ -1194,3 +1527,152 @@ func TestCleanupArtifact_PermissionDenied(t *testing.T) {
 	// The existing TestCleanupArtifact_PermissionError already covers this concept
 	t.Log("Permission denied testing requires platform-specific setup")
 }
+
+// recordingRunner runs commands through a real runner and records each result.
+type recordingRunner struct {
+	results []runner.Result
+}
+
+func (r *recordingRunner) Run(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+	result, err := runner.New().Run(ctx, bin, args, opts)
+	r.results = append(r.results, result)
+	return result, err
+}
+
+// TestExecOptions_NewRunner tests that the stages' runner carries the exec options
+func TestExecOptions_NewRunner(t *testing.T) {
+	var calls int
+	execOpts := ExecOptions{
+		OnResult:    func(runner.Result, error) { calls++ },
+		BinOverride: map[string]string{"ocrmypdf": "/opt/venv/bin/ocrmypdf"},
+		Env:         map[string]string{"PATH": "/opt/venv/bin"},
+	}
+	r := execOpts.newRunner()
+	if !reflect.DeepEqual(r.BinOverride, execOpts.BinOverride) || !reflect.DeepEqual(r.Env, execOpts.Env) {
+		t.Errorf("expected overrides %v and %v, got %v and %v", execOpts.BinOverride, execOpts.Env, r.BinOverride, r.Env)
+	}
+	if r.OnResult == nil {
+		t.Fatal("expected the command hook to be set")
+	}
+	r.OnResult(runner.Result{}, nil)
+	if calls != 1 {
+		t.Errorf("expected the command hook to be called once, got %d", calls)
+	}
+
+	if r := (ExecOptions{}).newRunner(); r.OnResult != nil || r.BinOverride != nil || r.Env != nil {
+		t.Errorf("expected a plain runner without exec options, got %+v", r)
+	}
+}
+
+// TestStages_DryRun tests that ExecOptions.DryRun runs no commands and skips output checks
+func TestStages_DryRun(t *testing.T) {
+	dryRun := ExecOptions{DryRun: true}
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+	createMockImage(t, tmpDir, "0001.png")
+	rec := &recordingRunner{}
+
+	pdfPath, err := buildPDFWithRunner(context.Background(), rec, dryRun, tmpDir, outputDir, 30*time.Second)
+	if err != nil {
+		t.Fatalf("BuildPDF dry run failed: %v", err)
+	}
+	ocrPath, err := ocrPDFWithRunner(context.Background(), rec, dryRun, pdfPath, outputDir, "eng", OCROptions{}, 30*time.Second)
+	if err != nil {
+		t.Fatalf("OCRPDF dry run failed: %v", err)
+	}
+	textPath, err := extractTextWithRunner(context.Background(), rec, dryRun, ocrPath, outputDir, PDFToTextLayout, 20, 30*time.Second)
+	if err != nil {
+		t.Fatalf("ExtractText dry run failed: %v", err)
+	}
+
+	for _, path := range []string{pdfPath, ocrPath, textPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be created in dry run", path)
+		}
+	}
+	if textPath != filepath.Join(outputDir, "extracted.txt") {
+		t.Errorf("unexpected text path: %s", textPath)
+	}
+
+	want := []string{
+		"python3 -m img2pdf " + filepath.Join(tmpDir, "0001.png") + " -o " + pdfPath,
+		"ocrmypdf --deskew --rotate-pages -l eng --skip-text " + pdfPath + " " + ocrPath,
+		"pdftotext -layout " + ocrPath + " " + textPath,
+	}
+	if len(rec.results) != len(want) {
+		t.Fatalf("expected %d commands, got %d", len(want), len(rec.results))
+	}
+	for i, result := range rec.results {
+		if result.Cmd != want[i] {
+			t.Errorf("command %d: expected %q, got %q", i, want[i], result.Cmd)
+		}
+		if result.ExitCode != 0 || result.Stdout != "" || result.Stderr != "" {
+			t.Errorf("command %d: expected empty dry-run result, got %+v", i, result)
+		}
+	}
+}
+
+// TestStages_DryRunLogger tests that the dry-run lines go to ExecOptions.Logger
+// instead of the standard logger
+func TestStages_DryRunLogger(t *testing.T) {
+	var buf bytes.Buffer
+	dryRun := ExecOptions{DryRun: true, Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	tmpDir := t.TempDir()
+	createMockImage(t, tmpDir, "0001.png")
+
+	if _, err := buildPDFWithRunner(context.Background(), &recordingRunner{}, dryRun, tmpDir, t.TempDir(), 30*time.Second); err != nil {
+		t.Fatalf("BuildPDF dry run failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `"level":"INFO"`) || !strings.Contains(out, `"msg":"dry run: python3 -m img2pdf `) {
+		t.Errorf("expected the dry-run command as a JSON record, got %q", out)
+	}
+}
+
+// TestStages_ContextCancellation cancels each stage while its command runs and checks
+// that the command is killed and the stage returns promptly.
+func TestStages_ContextCancellation(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not available")
+	}
+	// Every command is replaced by a long sleep run through the real runner
+	sleeper := &mockRunner{
+		runFunc: func(ctx context.Context, bin string, args []string, opts runner.RunOpts) (runner.Result, error) {
+			return runner.New().Run(ctx, "sleep", []string{"30"}, opts)
+		},
+	}
+	tmpDir := t.TempDir()
+	outputDir := t.TempDir()
+	createMockImage(t, tmpDir, "image1.png")
+	pdfPath := filepath.Join(tmpDir, "input.pdf")
+
+	stages := map[string]func(ctx context.Context) error{
+		"pdf": func(ctx context.Context) error {
+			_, err := buildPDFWithRunner(ctx, sleeper, ExecOptions{}, tmpDir, outputDir, time.Minute)
+			return err
+		},
+		"ocr": func(ctx context.Context) error {
+			_, err := ocrPDFWithRunner(ctx, sleeper, ExecOptions{}, pdfPath, outputDir, "eng", OCROptions{}, time.Minute)
+			return err
+		},
+		"extract": func(ctx context.Context) error {
+			_, err := extractTextWithRunner(ctx, sleeper, ExecOptions{}, pdfPath, outputDir, PDFToTextLayout, 20, time.Minute)
+			return err
+		},
+	}
+	for name, stage := range stages {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			start := time.Now()
+			err := stage(ctx)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("stage returned %v after cancellation", elapsed)
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("expected context.Canceled, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"sync"
+)
+
+// Progress receives progress updates as a run moves through its stages.
+// Stages that run a single external tool only report StageStart and StageDone;
+// stages that process items one by one (e.g. staging images) also report StageProgress.
+// Implementations must be safe for concurrent use.
+type Progress interface {
+	// StageStart is called when a stage begins. total is the number of items it will
+	// process, or 0 if the stage cannot report granular progress.
+	StageStart(name string, total int)
+	// StageProgress is called with the number of items done so far.
+	StageProgress(name string, done int)
+	// StageDone is called when a stage ends, whether or not it succeeded.
+	StageDone(name string)
+}
+
+// ProgressOrNop returns p, or a Progress that discards updates if p is nil.
+func ProgressOrNop(p Progress) Progress {
+	if p == nil {
+		return nopProgress{}
+	}
+	return p
+}
+
+type nopProgress struct{}
+
+func (nopProgress) StageStart(string, int)    {}
+func (nopProgress) StageProgress(string, int) {}
+func (nopProgress) StageDone(string)          {}
+
+// consoleProgressStep is the share of a stage's items between console progress lines.
+const consoleProgressStep = 10 // percent
+
+// ConsoleProgress logs progress through a logger, or the standard logger. To keep the
+// log short, granular progress is logged at most once per 10% of a stage's total.
+type ConsoleProgress struct {
+	mu      sync.Mutex
+	logger  *slog.Logger
+	totals  map[string]int
+	percent map[string]int // Last logged percentage per stage
+}
+
+// NewConsoleProgress returns a Progress that logs to logger at level INFO, or to the
+// standard logger if logger is nil.
+func NewConsoleProgress(logger *slog.Logger) *ConsoleProgress {
+	return &ConsoleProgress{logger: logger, totals: map[string]int{}, percent: map[string]int{}}
+}
+
+// StageStart records the stage total; the stage itself is already logged by the caller.
+func (c *ConsoleProgress) StageStart(name string, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.totals[name] = total
+	c.percent[name] = 0
+}
+
+// StageProgress logs "name: done/total (pct%)" when another 10% of the total is done.
+func (c *ConsoleProgress) StageProgress(name string, done int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := c.totals[name]
+	if total <= 0 {
+		return
+	}
+	pct := done * 100 / total
+	if pct < c.percent[name]+consoleProgressStep && done < total {
+		return
+	}
+	c.percent[name] = pct
+	if c.logger != nil {
+		c.logger.Info(fmt.Sprintf("%s: %d/%d (%d%%)", name, done, total, pct))
+		return
+	}
+	log.Printf("%s: %d/%d (%d%%)", name, done, total, pct)
+}
+
+// StageDone forgets the stage total.
+func (c *ConsoleProgress) StageDone(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.totals, name)
+	delete(c.percent, name)
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestProgressOrNop_Nil(t *testing.T) {
+	p := ProgressOrNop(nil)
+	// Must not panic
+	p.StageStart("stage", 3)
+	p.StageProgress("stage", 1)
+	p.StageDone("stage")
+}
+
+func TestConsoleProgress_LogsEveryTenPercent(t *testing.T) {
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+
+	c := NewConsoleProgress(nil)
+	c.StageStart("stage", 50)
+	for done := 1; done <= 50; done++ {
+		c.StageProgress("stage", done)
+	}
+	c.StageDone("stage")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("expected 10 progress lines, got %d: %q", len(lines), lines)
+	}
+	if lines[0] != "stage: 5/50 (10%)" || lines[9] != "stage: 50/50 (100%)" {
+		t.Errorf("unexpected progress lines: %q", lines)
+	}
+
+	// Stages without a total log nothing
+	buf.Reset()
+	c.StageStart("ocr", 0)
+	c.StageProgress("ocr", 1)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output for a stage without a total, got %q", buf.String())
+	}
+}
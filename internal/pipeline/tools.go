@@ -0,0 +1,50 @@
+package pipeline
+
+// ToolCheck describes an external tool the pipeline runs and how to query its version.
+type ToolCheck struct {
+	Name        string   // Name shown in reports, e.g. "ghostscript"
+	Bin         string   // Executable looked up on PATH, e.g. "gs"
+	VersionArgs []string // Arguments that make the tool print its version
+	Required    bool     // Whether the pipeline cannot run without the tool
+	autoLang    bool     // Whether --lang auto cannot run without the tool
+}
+
+// Tools are the external tools the pipeline depends on, in the order they are
+// reported. Optional tools are checked but their absence is not an error; use
+// ToolsForLang to mark the tools of language detection as required.
+var Tools = []ToolCheck{
+	{Name: "python3", Bin: "python3", VersionArgs: []string{"--version"}, Required: true},
+	{Name: "ocrmypdf", Bin: "ocrmypdf", VersionArgs: []string{"--version"}, Required: true},
+	{Name: "tesseract", Bin: "tesseract", VersionArgs: []string{"--version"}, Required: true},
+	{Name: "pdftotext", Bin: "pdftotext", VersionArgs: []string{"-v"}, Required: true},                // Prints to stderr
+	{Name: "pdftoppm", Bin: "pdftoppm", VersionArgs: []string{"-v"}, Required: false, autoLang: true}, // For --lang auto; prints to stderr
+	{Name: "jbig2enc", Bin: "jbig2", VersionArgs: []string{"--version"}, Required: false},             // For --optimize-level and --jbig2-lossy
+	{Name: "pngquant", Bin: "pngquant", VersionArgs: []string{"--version"}, Required: false},          // For --optimize-level 2 and 3
+	{Name: "qpdf", Bin: "qpdf", VersionArgs: []string{"--version"}, Required: false},                  // For several --input-pdf files
+	{Name: "ghostscript", Bin: "gs", VersionArgs: []string{"--version"}, Required: false},
+}
+
+// ToolsForLang returns Tools with the tools needed by OCR language lang marked as
+// required: with AutoLang, DetectLanguage renders sample pages with pdftoppm.
+func ToolsForLang(lang string) []ToolCheck {
+	tools := make([]ToolCheck, len(Tools))
+	for i, tool := range Tools {
+		if tool.autoLang && lang == AutoLang {
+			tool.Required = true
+		}
+		tools[i] = tool
+	}
+	return tools
+}
+
+// RequiredTools returns the tools in Tools that a run with OCR language lang cannot
+// run without (see ToolsForLang).
+func RequiredTools(lang string) []ToolCheck {
+	var required []ToolCheck
+	for _, tool := range ToolsForLang(lang) {
+		if tool.Required {
+			required = append(required, tool)
+		}
+	}
+	return required
+}
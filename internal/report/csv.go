@@ -0,0 +1,56 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// csvHeader lists the columns of the dropped-chunk CSV report.
+var csvHeader = []string{"chunk_id", "reason", "matched_chunk_id", "distance", "preview"}
+
+// WriteReportCSV writes one row per dropped chunk to a CSV file, after a header row.
+// Fields are quoted as needed, so previews may contain commas, quotes and newlines.
+func WriteReportCSV(result dedupe.DedupeResult, path string) error {
+	rows := [][]string{csvHeader}
+	for _, d := range result.Dropped {
+		rows = append(rows, []string{d.ChunkID, d.Reason, d.MatchedChunkID, strconv.Itoa(d.Distance), d.Preview})
+	}
+	return writeCSV(rows, path)
+}
+
+// WriteSummaryCSV writes the report's summary counts and configuration as metric,value rows.
+// It complements WriteReportCSV, whose rows cover only the dropped chunks.
+func WriteSummaryCSV(result dedupe.DedupeResult, inputImages int, config dedupe.Config, path string) error {
+	rows := [][]string{
+		{"metric", "value"},
+		{"input_images", strconv.Itoa(inputImages)},
+		{"input_chunks", strconv.Itoa(result.Stats.InputCount)},
+		{"kept_chunks", strconv.Itoa(result.Stats.KeptCount)},
+		{"dropped_chunks", strconv.Itoa(result.Stats.DroppedCount)},
+		{"exact_duplicates", strconv.Itoa(result.Stats.ExactDups)},
+		{"near_duplicates", strconv.Itoa(result.Stats.NearDups)},
+		{"cross_run_duplicates", strconv.Itoa(result.Stats.CrossRunDups)},
+		{"method", config.Method},
+		{"simhash_k", strconv.Itoa(config.SimHashK)},
+		{"simhash_threshold", strconv.Itoa(config.SimHashThreshold)},
+		{"window", strconv.Itoa(config.Window)},
+	}
+	return writeCSV(rows, path)
+}
+
+func writeCSV(rows [][]string, path string) error {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package report
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open CSV: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV: %v", err)
+	}
+	return records
+}
+
+func TestWriteReportCSV_Escaping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe_report.csv")
+	tricky := "He said \"hi\", then left\nsecond line"
+	result := dedupe.DedupeResult{
+		Dropped: []dedupe.DroppedChunk{
+			{ChunkID: "c0002", Reason: "exact_duplicate", MatchedChunkID: "c0001", Distance: 0, Preview: "plain"},
+			{ChunkID: "c0005", Reason: "near_duplicate", MatchedChunkID: "c0003", Distance: 4, Preview: tricky},
+		},
+	}
+
+	if err := WriteReportCSV(result, path); err != nil {
+		t.Fatalf("WriteReportCSV failed: %v", err)
+	}
+
+	records := readCSV(t, path)
+	if len(records) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d records", len(records))
+	}
+	for i, rec := range records {
+		if len(rec) != 5 {
+			t.Errorf("record %d: expected 5 fields, got %d", i, len(rec))
+		}
+	}
+	if records[0][0] != "chunk_id" || records[0][4] != "preview" {
+		t.Errorf("unexpected header: %v", records[0])
+	}
+	if records[2][3] != "4" {
+		t.Errorf("expected distance 4, got %q", records[2][3])
+	}
+	if records[2][4] != tricky {
+		t.Errorf("preview did not round-trip: %q", records[2][4])
+	}
+}
+
+func TestWriteReportCSV_NoDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe_report.csv")
+	if err := WriteReportCSV(dedupe.DedupeResult{}, path); err != nil {
+		t.Fatalf("WriteReportCSV failed: %v", err)
+	}
+	if records := readCSV(t, path); len(records) != 1 {
+		t.Errorf("expected header only, got %d records", len(records))
+	}
+}
+
+func TestWriteSummaryCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe_summary.csv")
+	result := dedupe.DedupeResult{Stats: dedupe.Stats{InputCount: 10, KeptCount: 7, DroppedCount: 3, ExactDups: 2, NearDups: 1}}
+
+	if err := WriteSummaryCSV(result, 4, dedupe.DefaultConfig(), path); err != nil {
+		t.Fatalf("WriteSummaryCSV failed: %v", err)
+	}
+
+	values := make(map[string]string)
+	for _, rec := range readCSV(t, path)[1:] {
+		if len(rec) != 2 {
+			t.Fatalf("expected 2 fields, got %v", rec)
+		}
+		values[rec[0]] = rec[1]
+	}
+	if values["input_images"] != "4" || values["kept_chunks"] != "7" || values["method"] != "simhash" {
+		t.Errorf("unexpected summary values: %v", values)
+	}
+}
+
+func TestWriteReportCSV_CreateError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "dedupe_report.csv")
+	if err := WriteReportCSV(dedupe.DedupeResult{}, path); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
@@ -0,0 +1,220 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+)
+
+// diffSegment is a run of words that are shared, only in the matched chunk, or only in the dropped chunk.
+type diffSegment struct {
+	Op   string // "same", "del" (matched only), or "ins" (dropped only)
+	Text string
+}
+
+// htmlPair is one dropped chunk shown beside the chunk it matched.
+type htmlPair struct {
+	Dropped     dedupe.DroppedChunk
+	Identical   bool
+	CrossRun    bool // matched a chunk of an earlier run, whose text is not available
+	MatchedText string
+	Matched     []diffSegment // matched chunk words, with removals highlighted
+	DroppedDiff []diffSegment // dropped chunk words, with additions highlighted
+}
+
+// htmlData is the template input for WriteReportHTML.
+type htmlData struct {
+	Report Report
+	Pairs  []htmlPair
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>Deduplication Report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 0.4em; vertical-align: top; text-align: left; }
+td.text { white-space: pre-wrap; font-family: monospace; width: 40%; }
+del { background: #fdd; text-decoration: none; }
+ins { background: #dfd; text-decoration: none; }
+</style>
+</head>
+<body>
+<h1>Deduplication Report</h1>
+<h2>Summary</h2>
+<table>
+<tr><th>Input images</th><td>{{.Report.InputImages}}</td></tr>
+<tr><th>Input chunks</th><td>{{.Report.InputChunks}}</td></tr>
+<tr><th>Kept chunks</th><td>{{.Report.KeptChunks}}</td></tr>
+<tr><th>Dropped chunks</th><td>{{.Report.DroppedChunks}}</td></tr>
+<tr><th>Exact duplicates</th><td>{{.Report.ExactDuplicates}}</td></tr>
+<tr><th>Near duplicates</th><td>{{.Report.NearDuplicates}}</td></tr>
+<tr><th>Generated</th><td>{{.Report.Timestamp}}</td></tr>
+</table>
+<h2>Config</h2>
+<table>
+<tr><th>Method</th><td>{{.Report.Config.Method}}</td></tr>
+<tr><th>SimHash k</th><td>{{.Report.Config.SimHashK}}</td></tr>
+<tr><th>SimHash threshold</th><td>{{.Report.Config.SimHashThreshold}}</td></tr>
+<tr><th>Window</th><td>{{.Report.Config.Window}}</td></tr>
+</table>
+<h2>Dropped Chunks</h2>
+{{if .Pairs}}<table>
+<tr><th>Dropped</th><th>Matched</th><th>Reason</th><th>Dropped text</th><th>Matched text</th></tr>
+{{range .Pairs}}<tr id="{{.Dropped.ChunkID}}">
+<td>{{.Dropped.ChunkID}}</td>
+<td>{{.Dropped.MatchedChunkID}}</td>
+<td>{{.Dropped.Reason}}<br/>{{if .Identical}}identical{{else}}distance {{.Dropped.Distance}}{{end}}</td>
+{{if .CrossRun}}<td class="text">{{.Dropped.Preview}}</td>
+<td class="text"><em>chunk of an earlier run</em></td>
+{{else if .Identical}}<td class="text">{{.Dropped.Preview}}</td>
+<td class="text">{{.MatchedText}}</td>
+{{else}}<td class="text">{{range .DroppedDiff}}{{if eq .Op "ins"}}<ins>{{.Text}}</ins>{{else}}{{.Text}}{{end}}{{end}}</td>
+<td class="text">{{range .Matched}}{{if eq .Op "del"}}<del>{{.Text}}</del>{{else}}{{.Text}}{{end}}{{end}}</td>
+{{end}}</tr>
+{{end}}</table>{{else}}<p>No chunks were dropped.</p>{{end}}
+</body>
+</html>
+`))
+
+// WriteReportHTML writes a standalone HTML page listing each dropped chunk beside the
+// chunk it matched, with word-level differences highlighted for near-duplicates.
+// Matched text comes from the kept chunks, or from the dropped previews when the
+// matched chunk was itself dropped by a later pass. Cross-run duplicates reference
+// chunks of earlier runs, so they are listed without matched text.
+func WriteReportHTML(result dedupe.DedupeResult, inputImages int, config dedupe.Config, path string) error {
+	texts := make(map[string]string, len(result.KeptChunks)+len(result.Dropped))
+	for _, d := range result.Dropped {
+		texts[d.ChunkID] = d.Preview
+	}
+	for _, c := range result.KeptChunks {
+		texts[c.ID] = truncatePreview(c.Text)
+	}
+
+	data := htmlData{
+		Report: Report{
+			InputImages:     inputImages,
+			InputChunks:     result.Stats.InputCount,
+			KeptChunks:      result.Stats.KeptCount,
+			DroppedChunks:   result.Stats.DroppedCount,
+			ExactDuplicates: result.Stats.ExactDups,
+			NearDuplicates:  result.Stats.NearDups,
+			Config: Config{
+				Method:           config.Method,
+				SimHashK:         config.SimHashK,
+				SimHashThreshold: config.SimHashThreshold,
+				Window:           config.Window,
+			},
+			Timestamp: formatTimestamp(time.Time{}),
+		},
+	}
+	for _, d := range result.Dropped {
+		if d.Reason == "cross_run_duplicate" {
+			data.Pairs = append(data.Pairs, htmlPair{Dropped: d, CrossRun: true})
+			continue
+		}
+		matched := texts[d.MatchedChunkID]
+		pair := htmlPair{
+			Dropped:     d,
+			Identical:   d.Reason == "exact_duplicate",
+			MatchedText: matched,
+		}
+		if !pair.Identical {
+			pair.Matched, pair.DroppedDiff = wordDiff(matched, d.Preview)
+		}
+		data.Pairs = append(data.Pairs, pair)
+	}
+
+	var b strings.Builder
+	if err := htmlTemplate.Execute(&b, data); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
+// truncatePreview shortens text the same way dropped chunk previews are, so both sides compare evenly.
+func truncatePreview(s string) string {
+	if len(s) > 200 {
+		return s[:200] + "..."
+	}
+	return s
+}
+
+// wordDiff computes a word-level diff of a against b using the longest common subsequence.
+// It returns a's words marked "same" or "del" and b's words marked "same" or "ins";
+// whitespace between words is preserved.
+func wordDiff(a, b string) ([]diffSegment, []diffSegment) {
+	aw, bw := splitWords(a), splitWords(b)
+
+	// lcs[i][j] is the LCS length of aw[i:] and bw[j:]
+	lcs := make([][]int, len(aw)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bw)+1)
+	}
+	for i := len(aw) - 1; i >= 0; i-- {
+		for j := len(bw) - 1; j >= 0; j-- {
+			if strings.TrimSpace(aw[i]) == strings.TrimSpace(bw[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var left, right []diffSegment
+	i, j := 0, 0
+	for i < len(aw) || j < len(bw) {
+		switch {
+		case i < len(aw) && j < len(bw) && strings.TrimSpace(aw[i]) == strings.TrimSpace(bw[j]):
+			left = appendSegment(left, "same", aw[i])
+			right = appendSegment(right, "same", bw[j])
+			i++
+			j++
+		case j < len(bw) && (i == len(aw) || lcs[i][j+1] >= lcs[i+1][j]):
+			right = appendSegment(right, "ins", bw[j])
+			j++
+		default:
+			left = appendSegment(left, "del", aw[i])
+			i++
+		}
+	}
+	return left, right
+}
+
+// splitWords splits s into words, each carrying its trailing whitespace.
+func splitWords(s string) []string {
+	var words []string
+	start := 0
+	inSpace := false
+	for i, r := range s {
+		isSpace := r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		if inSpace && !isSpace {
+			words = append(words, s[start:i])
+			start = i
+		}
+		inSpace = isSpace
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+// appendSegment adds text to the last segment when the op matches, otherwise starts a new one.
+func appendSegment(segs []diffSegment, op, text string) []diffSegment {
+	if n := len(segs); n > 0 && segs[n-1].Op == op {
+		segs[n-1].Text += text
+		return segs
+	}
+	return append(segs, diffSegment{Op: op, Text: text})
+}
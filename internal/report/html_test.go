@@ -0,0 +1,120 @@
+package report
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
+)
+
+func TestWriteReportHTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe_report.html")
+	result := dedupe.DedupeResult{
+		KeptChunks: []text.Chunk{
+			{ID: "c0001", Text: "The quick brown fox jumps"},
+			{ID: "c0003", Text: "Alert <script>alert(1)</script> here"},
+		},
+		Dropped: []dedupe.DroppedChunk{
+			{ChunkID: "c0002", Reason: "exact_duplicate", MatchedChunkID: "c0001", Preview: "The quick brown fox jumps"},
+			{ChunkID: "c0004", Reason: "near_duplicate", MatchedChunkID: "c0001", Distance: 3, Preview: "The quick red fox jumps"},
+			{ChunkID: "c0005", Reason: "near_duplicate", MatchedChunkID: "c0003", Distance: 5, Preview: "Alert <script>alert(2)</script> here"},
+		},
+		Stats: dedupe.Stats{InputCount: 5, KeptCount: 2, DroppedCount: 3, ExactDups: 1, NearDups: 2},
+	}
+
+	if err := WriteReportHTML(result, 2, dedupe.DefaultConfig(), path); err != nil {
+		t.Fatalf("WriteReportHTML failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read HTML: %v", err)
+	}
+	page := string(data)
+
+	for _, want := range []string{
+		"<!DOCTYPE html>", "c0002", "c0004", "c0005",
+		"identical", "distance 3",
+		"<del>brown </del>", "<ins>red </ins>",
+		"<td>simhash</td>", "<td>5</td>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("chunk text was not escaped")
+	}
+
+	// The template is written to be well-formed, so an XML decoder can check its structure
+	dec := xml.NewDecoder(strings.NewReader(page))
+	dec.Strict = true
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("report is not well-formed: %v", err)
+		}
+	}
+}
+
+func TestWriteReportHTML_NoDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe_report.html")
+	if err := WriteReportHTML(dedupe.DedupeResult{}, 0, dedupe.DefaultConfig(), path); err != nil {
+		t.Fatalf("WriteReportHTML failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "No chunks were dropped.") {
+		t.Error("expected empty-state message")
+	}
+}
+
+func TestWriteReportHTML_CrossRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedupe_report.html")
+	result := dedupe.DedupeResult{
+		// The current run's c0001 shares its ID with the earlier run's chunk
+		KeptChunks: []text.Chunk{{ID: "c0001", Text: "Unrelated current text"}},
+		Dropped: []dedupe.DroppedChunk{
+			{ChunkID: "c0002", Reason: "cross_run_duplicate", MatchedChunkID: "run1/c0001", Preview: "Repeated earlier text"},
+		},
+		Stats: dedupe.Stats{InputCount: 2, KeptCount: 1, DroppedCount: 1, CrossRunDups: 1},
+	}
+
+	if err := WriteReportHTML(result, 1, dedupe.DefaultConfig(), path); err != nil {
+		t.Fatalf("WriteReportHTML failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{"run1/c0001", "Repeated earlier text", "chunk of an earlier run"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+	if strings.Contains(page, "Unrelated current text") {
+		t.Error("cross-run match was resolved against the current run's chunks")
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	left, right := wordDiff("a b c d", "a x c d e")
+	wantLeft := []diffSegment{{"same", "a "}, {"del", "b "}, {"same", "c d"}}
+	wantRight := []diffSegment{{"same", "a "}, {"ins", "x "}, {"same", "c d "}, {"ins", "e"}}
+	if !reflect.DeepEqual(left, wantLeft) {
+		t.Errorf("left: expected %+v, got %+v", wantLeft, left)
+	}
+	if !reflect.DeepEqual(right, wantRight) {
+		t.Errorf("right: expected %+v, got %+v", wantRight, right)
+	}
+}
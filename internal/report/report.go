@@ -4,68 +4,308 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/jonkmatsumo/bulk-ocr/internal/dedupe"
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
+	"github.com/jonkmatsumo/bulk-ocr/internal/text"
 )
 
 // Report contains deduplication report data.
 type Report struct {
-	InputImages     int                   `json:"input_images"`
-	InputChunks     int                   `json:"input_chunks"`
-	KeptChunks      int                   `json:"kept_chunks"`
-	DroppedChunks   int                   `json:"dropped_chunks"`
-	ExactDuplicates int                   `json:"exact_duplicates"`
-	NearDuplicates  int                   `json:"near_duplicates"`
-	Config          Config                `json:"config"`
-	Dropped         []dedupe.DroppedChunk `json:"dropped"`
-	Timestamp       string                `json:"timestamp"`
+	InputImages      int                   `json:"input_images"`
+	InputChunks      int                   `json:"input_chunks"`
+	KeptChunks       int                   `json:"kept_chunks"`
+	DroppedChunks    int                   `json:"dropped_chunks"`
+	ExactDuplicates  int                   `json:"exact_duplicates"`
+	NearDuplicates   int                   `json:"near_duplicates"`
+	CrossRunDups     int                   `json:"cross_run_duplicates,omitempty"`
+	CompressionRatio float64               `json:"compression_ratio"`     // KeptChunks / InputChunks (0 without input chunks)
+	BytesInput       int                   `json:"bytes_input,omitempty"` // Bytes of chunk text given to deduplication
+	BytesKept        int                   `json:"bytes_kept,omitempty"`  // Bytes of chunk text kept
+	BytesSaved       int                   `json:"bytes_saved,omitempty"` // BytesInput - BytesKept
+	Config           Config                `json:"config"`
+	Dropped          []dedupe.DroppedChunk `json:"dropped"`
+	ToolVersions     map[string]string     `json:"tool_versions,omitempty"`  // External tool name -> version
+	Warnings         []string              `json:"warnings,omitempty"`       // Non-fatal problems noticed during the run
+	SkippedImages    []SkippedImage        `json:"skipped_images,omitempty"` // Input images rejected as unreadable
+	SourceFiles      []string              `json:"source_files,omitempty"`   // Original image of each page, in page order
+	FilterStats      *FilterStats          `json:"filter_stats,omitempty"`   // Chunks removed by each filtering step
+	Timestamp        string                `json:"timestamp"`
+}
+
+// SkippedImage is an input image left out of a run because it failed validation.
+type SkippedImage struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
 }
 
 // Config holds deduplication configuration for the report.
 type Config struct {
-	Method           string `json:"method"`
-	SimHashK         int    `json:"simhash_k"`
-	SimHashThreshold int    `json:"simhash_threshold"`
-	Window           int    `json:"window"`
+	Method           string  `json:"method"`
+	SimHashK         int     `json:"simhash_k"`
+	SimHashThreshold int     `json:"simhash_threshold"`
+	Window           int     `json:"window"`
+	ShingleK         int     `json:"shingle_k,omitempty"`
+	MinHashNumHashes int     `json:"minhash_hashes,omitempty"`
+	MinHashBands     int     `json:"minhash_bands,omitempty"`
+	MinHashThreshold float64 `json:"minhash_threshold,omitempty"`
+	JaccardThreshold float64 `json:"jaccard_threshold,omitempty"`
 }
 
-// WriteReport writes a deduplication report to a JSON file.
+// WriteReport writes a deduplication report to a JSON file. Its timestamp is the
+// SOURCE_DATE_EPOCH time if that is set, for reproducible builds, and the current
+// time otherwise.
 func WriteReport(result dedupe.DedupeResult, inputImages int, config dedupe.Config, path string) error {
+	return WriteReportWithToolVersions(result, inputImages, config, nil, path)
+}
+
+// WriteReportWithToolVersions writes a deduplication report that also records the
+// versions of the external tools that produced it. A nil map omits tool_versions.
+func WriteReportWithToolVersions(result dedupe.DedupeResult, inputImages int, config dedupe.Config, toolVersions map[string]string, path string) error {
+	return WriteReportWithMetadata(result, inputImages, config, Metadata{ToolVersions: toolVersions}, path)
+}
+
+// Metadata is run information recorded in a report alongside the deduplication results.
+type Metadata struct {
+	ToolVersions  map[string]string // External tool name -> version (nil omits tool_versions)
+	Warnings      []string          // e.g. extracted text below the minimum length (nil omits warnings)
+	FilterStats   *FilterStats      // nil omits filter_stats
+	SkippedImages []SkippedImage    // Input images skipped as invalid (nil omits skipped_images)
+	SourceFiles   []string          // Original image of each page (nil omits source_files)
+	InputBytes    int               // Bytes of chunk text given to deduplication (see ChunkBytes); 0 omits the byte totals
+	Timestamp     time.Time         // Report time; zero means SOURCE_DATE_EPOCH if set, else now
+}
+
+// SourceDateEpoch returns the time given by the SOURCE_DATE_EPOCH environment
+// variable, in seconds since the Unix epoch, as used for reproducible builds. The
+// bool is false if the variable is unset or empty.
+func SourceDateEpoch() (time.Time, bool, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: must be a number of seconds", value)
+	}
+	return time.Unix(seconds, 0).UTC(), true, nil
+}
+
+// formatTimestamp formats t as a report timestamp. If t is zero it uses the
+// SOURCE_DATE_EPOCH time when that is set to a valid value, and the current time
+// otherwise.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		if epoch, ok, err := SourceDateEpoch(); ok && err == nil {
+			t = epoch
+		} else {
+			t = time.Now()
+		}
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ChunkBytes returns the total length in bytes of the chunks' text.
+func ChunkBytes(chunks []text.Chunk) int {
+	total := 0
+	for _, chunk := range chunks {
+		total += len(chunk.Text)
+	}
+	return total
+}
+
+// compressionRatio returns kept / input, or 0 if input is 0.
+func compressionRatio(kept, input int) float64 {
+	if input == 0 {
+		return 0
+	}
+	return float64(kept) / float64(input)
+}
+
+// FilterStats breaks down where chunks went: the count left after each filtering
+// step, and how many that step removed.
+type FilterStats struct {
+	RawChunks       int `json:"raw_chunks"`      // Non-empty paragraphs in the extracted text
+	AfterMinChars   int `json:"after_min_chars"` // Chunks at least --min-chunk-chars long
+	AfterChrome     int `json:"after_chrome"`    // Chunks left after chrome filtering, and the --noise-char-ratio filter run with it
+	AfterDedupe     int `json:"after_dedupe"`    // Chunks kept by deduplication
+	RemovedMinChars int `json:"removed_min_chars"`
+	RemovedChrome   int `json:"removed_chrome"`
+	RemovedMinWords int `json:"removed_min_words,omitempty"` // Removed by --min-words, after chrome filtering
+	RemovedDedupe   int `json:"removed_dedupe"`
+}
+
+// NewFilterStats returns the breakdown for the given counts, filling in the deltas.
+// afterMinWords is the count left by the --min-words filter, or afterChrome without it.
+func NewFilterStats(raw, afterMinChars, afterChrome, afterMinWords, afterDedupe int) FilterStats {
+	return FilterStats{
+		RawChunks:       raw,
+		AfterMinChars:   afterMinChars,
+		AfterChrome:     afterChrome,
+		AfterDedupe:     afterDedupe,
+		RemovedMinChars: raw - afterMinChars,
+		RemovedChrome:   afterMinChars - afterChrome,
+		RemovedMinWords: afterChrome - afterMinWords,
+		RemovedDedupe:   afterMinWords - afterDedupe,
+	}
+}
+
+// WriteReportWithMetadata writes a deduplication report that also records meta.
+func WriteReportWithMetadata(result dedupe.DedupeResult, inputImages int, config dedupe.Config, meta Metadata, path string) error {
 	report := Report{
-		InputImages:     inputImages,
-		InputChunks:     result.Stats.InputCount,
-		KeptChunks:      result.Stats.KeptCount,
-		DroppedChunks:   result.Stats.DroppedCount,
-		ExactDuplicates: result.Stats.ExactDups,
-		NearDuplicates:  result.Stats.NearDups,
+		InputImages:      inputImages,
+		InputChunks:      result.Stats.InputCount,
+		KeptChunks:       result.Stats.KeptCount,
+		DroppedChunks:    result.Stats.DroppedCount,
+		ExactDuplicates:  result.Stats.ExactDups,
+		NearDuplicates:   result.Stats.NearDups,
+		CrossRunDups:     result.Stats.CrossRunDups,
+		CompressionRatio: compressionRatio(result.Stats.KeptCount, result.Stats.InputCount),
 		Config: Config{
 			Method:           config.Method,
 			SimHashK:         config.SimHashK,
 			SimHashThreshold: config.SimHashThreshold,
 			Window:           config.Window,
 		},
-		Dropped:   result.Dropped,
-		Timestamp: time.Now().Format(time.RFC3339),
+		Dropped:       result.Dropped,
+		ToolVersions:  meta.ToolVersions,
+		Warnings:      meta.Warnings,
+		FilterStats:   meta.FilterStats,
+		SkippedImages: meta.SkippedImages,
+		SourceFiles:   meta.SourceFiles,
+		Timestamp:     formatTimestamp(meta.Timestamp),
+	}
+	if meta.InputBytes > 0 {
+		report.BytesInput = meta.InputBytes
+		report.BytesKept = ChunkBytes(result.KeptChunks)
+		report.BytesSaved = report.BytesInput - report.BytesKept
+	}
+	if config.Method == "minhash" {
+		report.Config.ShingleK = config.ShingleK
+		report.Config.MinHashNumHashes = config.MinHashNumHashes
+		report.Config.MinHashBands = config.MinHashBands
+		report.Config.MinHashThreshold = config.MinHashThreshold
+	}
+	if config.Method == "jaccard" {
+		report.Config.ShingleK = config.ShingleK
+		report.Config.JaccardThreshold = config.JaccardThreshold
+	}
+
+	return WriteReportJSON(report, path)
+}
+
+// ReadReport reads a JSON deduplication report written by WriteReportWithMetadata.
+func ReadReport(path string) (Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return Report{}, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return report, nil
+}
+
+// MergeReports returns a report covering the runs of prev and next, as when a run
+// processes a further batch of images. Counts, dropped chunks, warnings, source files
+// and filter stats are summed; the configuration, tool versions and timestamp are next's.
+func MergeReports(prev, next Report) Report {
+	merged := next
+	merged.InputImages += prev.InputImages
+	merged.InputChunks += prev.InputChunks
+	merged.KeptChunks += prev.KeptChunks
+	merged.DroppedChunks += prev.DroppedChunks
+	merged.ExactDuplicates += prev.ExactDuplicates
+	merged.NearDuplicates += prev.NearDuplicates
+	merged.CompressionRatio = compressionRatio(merged.KeptChunks, merged.InputChunks)
+	merged.BytesInput += prev.BytesInput
+	merged.BytesKept += prev.BytesKept
+	merged.BytesSaved += prev.BytesSaved
+	merged.CrossRunDups += prev.CrossRunDups
+	merged.Dropped = append(append([]dedupe.DroppedChunk{}, prev.Dropped...), next.Dropped...)
+	if len(prev.Warnings) > 0 {
+		merged.Warnings = append(append([]string{}, prev.Warnings...), next.Warnings...)
 	}
+	if len(prev.SkippedImages) > 0 {
+		merged.SkippedImages = append(append([]SkippedImage{}, prev.SkippedImages...), next.SkippedImages...)
+	}
+	if len(prev.SourceFiles) > 0 {
+		merged.SourceFiles = append(append([]string{}, prev.SourceFiles...), next.SourceFiles...)
+	}
+	if prev.FilterStats != nil && next.FilterStats != nil {
+		sum := NewFilterStats(
+			prev.FilterStats.RawChunks+next.FilterStats.RawChunks,
+			prev.FilterStats.AfterMinChars+next.FilterStats.AfterMinChars,
+			prev.FilterStats.AfterChrome+next.FilterStats.AfterChrome,
+			prev.FilterStats.AfterChrome-prev.FilterStats.RemovedMinWords+next.FilterStats.AfterChrome-next.FilterStats.RemovedMinWords,
+			prev.FilterStats.AfterDedupe+next.FilterStats.AfterDedupe,
+		)
+		merged.FilterStats = &sum
+	}
+	return merged
+}
 
+// WriteReportJSON writes an already assembled report to a JSON file.
+func WriteReportJSON(report Report, path string) error {
 	jsonData, err := json.MarshalIndent(report, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal report: %w", err)
 	}
+	if err := fsutil.WriteFileAtomic(path, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// RunSummary describes how far a run got. It is written when a run ends early.
+type RunSummary struct {
+	Status          string   `json:"status"`                 // "partial"
+	FailedStage     string   `json:"failed_stage,omitempty"` // Stage that stopped the run (e.g., "ocr")
+	Error           string   `json:"error,omitempty"`
+	CompletedStages []string `json:"completed_stages"`
+	Artifacts       []string `json:"artifacts"` // Output files kept from completed stages
+	InputImages     int      `json:"input_images"`
+	Timestamp       string   `json:"timestamp"`
+}
+
+// WriteRunSummary writes a run summary to a JSON file, filling in the timestamp.
+func WriteRunSummary(summary RunSummary, path string) error {
+	if summary.CompletedStages == nil {
+		summary.CompletedStages = []string{}
+	}
+	if summary.Artifacts == nil {
+		summary.Artifacts = []string{}
+	}
+	summary.Timestamp = formatTimestamp(time.Time{})
 
-	file, err := os.Create(path)
+	jsonData, err := json.MarshalIndent(summary, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create report file: %w", err)
+		return fmt.Errorf("failed to marshal run summary: %w", err)
 	}
-	defer func() {
-		if cerr := file.Close(); cerr != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to close report file %s: %v\n", path, cerr)
-		}
-	}()
 
-	if _, err := file.Write(jsonData); err != nil {
-		return fmt.Errorf("failed to write report: %w", err)
+	if err := fsutil.WriteFileAtomic(path, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write run summary: %w", err)
+	}
+
+	return nil
+}
+
+// WriteDistanceHistogram writes a {distance: count} JSON object of nearest-neighbor
+// SimHash distances (see dedupe.Stats.DistanceHistogram).
+func WriteDistanceHistogram(hist map[int]int, path string) error {
+	if hist == nil {
+		hist = map[int]int{}
+	}
+	jsonData, err := json.MarshalIndent(hist, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal distance histogram: %w", err)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write distance histogram: %w", err)
 	}
 
 	return nil
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -118,6 +119,50 @@ func TestWriteReport_TimestampFormat(t *testing.T) {
 	}
 }
 
+func TestWriteReport_SourceDateEpoch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	config := dedupe.DefaultConfig()
+	result := dedupe.Dedupe([]text.Chunk{{ID: "c0001", Text: "Test", Norm: "test", Index: 0}}, config)
+	timestamp := func() string {
+		t.Helper()
+		if err := WriteReport(result, 1, config, path); err != nil {
+			t.Fatalf("WriteReport failed: %v", err)
+		}
+		report, err := ReadReport(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report.Timestamp
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if got := timestamp(); got != "2023-11-14T22:13:20Z" {
+		t.Errorf("expected the SOURCE_DATE_EPOCH time, got %q", got)
+	}
+
+	// An explicit timestamp takes precedence
+	err := WriteReportWithMetadata(result, 1, config, Metadata{Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}, path)
+	if err != nil {
+		t.Fatalf("WriteReportWithMetadata failed: %v", err)
+	}
+	if report, err := ReadReport(path); err != nil || report.Timestamp != "2024-05-01T12:00:00Z" {
+		t.Errorf("expected the metadata timestamp, got %q, %v", report.Timestamp, err)
+	}
+
+	// Unset or invalid: the current time
+	for _, value := range []string{"", "not-a-number"} {
+		t.Setenv("SOURCE_DATE_EPOCH", value)
+		before := time.Now().Truncate(time.Second)
+		got, err := time.Parse(time.RFC3339, timestamp())
+		if err != nil {
+			t.Fatalf("SOURCE_DATE_EPOCH=%q: timestamp is not RFC3339: %v", value, err)
+		}
+		if got.Before(before) || got.After(time.Now()) {
+			t.Errorf("SOURCE_DATE_EPOCH=%q: expected the current time, got %v", value, got)
+		}
+	}
+}
+
 func TestWriteReport_DroppedChunksIncluded(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "report.json")
@@ -422,3 +467,214 @@ func TestWriteReport_LargePreviewTruncation(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteReport_MinhashConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "report.json")
+
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "Test", Norm: "test", Index: 0},
+	}
+	config := dedupe.DefaultConfig()
+	config.Method = "minhash"
+	config.MinHashNumHashes = 64
+	config.MinHashBands = 8
+	result := dedupe.Dedupe(chunks, config)
+
+	if err := WriteReport(result, 1, config, path); err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read report file: %v", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatalf("failed to parse report JSON: %v", err)
+	}
+	if report.Config.MinHashNumHashes != 64 || report.Config.MinHashBands != 8 {
+		t.Errorf("expected minhash settings in report, got %+v", report.Config)
+	}
+
+	// MinHash settings are omitted for other methods
+	config = dedupe.DefaultConfig()
+	if err := WriteReport(dedupe.Dedupe(chunks, config), 1, config, path); err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	if strings.Contains(string(content), "minhash_hashes") {
+		t.Error("expected minhash settings to be omitted for simhash method")
+	}
+}
+
+func TestWriteReportWithMetadata_Savings(t *testing.T) {
+	chunks := []text.Chunk{
+		{ID: "c0001", Text: "A paragraph that is repeated", Norm: "a paragraph that is repeated", Index: 0},
+		{ID: "c0002", Text: "Unique text", Norm: "unique text", Index: 1},
+		{ID: "c0003", Text: "A paragraph that is repeated", Norm: "a paragraph that is repeated", Index: 2},
+		{ID: "c0004", Text: "A paragraph that is repeated", Norm: "a paragraph that is repeated", Index: 3},
+	}
+	config := dedupe.DefaultConfig()
+	config.Method = "exact"
+	path := filepath.Join(t.TempDir(), "report.json")
+
+	if got := ChunkBytes(chunks); got != 3*28+11 {
+		t.Fatalf("expected %d input bytes, got %d", 3*28+11, got)
+	}
+	err := WriteReportWithMetadata(dedupe.Dedupe(chunks, config), 1, config, Metadata{InputBytes: ChunkBytes(chunks)}, path)
+	if err != nil {
+		t.Fatalf("WriteReportWithMetadata failed: %v", err)
+	}
+	report, err := ReadReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.CompressionRatio != 0.5 {
+		t.Errorf("expected compression ratio 0.5 (2 of 4 kept), got %v", report.CompressionRatio)
+	}
+	if report.BytesInput != 95 || report.BytesKept != 39 || report.BytesSaved != 56 {
+		t.Errorf("expected 95 bytes in, 39 kept and 56 saved, got %d, %d and %d", report.BytesInput, report.BytesKept, report.BytesSaved)
+	}
+
+	// No input chunks: no division by zero, and no byte totals without InputBytes
+	err = WriteReportWithMetadata(dedupe.Dedupe(nil, config), 1, config, Metadata{}, path)
+	if err != nil {
+		t.Fatalf("WriteReportWithMetadata failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"compression_ratio": 0,`) || strings.Contains(string(content), "bytes_") {
+		t.Errorf("expected a zero ratio and no byte totals, got:\n%s", content)
+	}
+}
+
+func TestWriteRunSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run_summary.json")
+	summary := RunSummary{
+		Status:      "partial",
+		FailedStage: "ocr",
+		Error:       "OCR failed: command timed out after 10m0s",
+		InputImages: 3,
+	}
+
+	if err := WriteRunSummary(summary, path); err != nil {
+		t.Fatalf("WriteRunSummary failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read summary: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got["status"] != "partial" || got["failed_stage"] != "ocr" {
+		t.Errorf("unexpected summary: %v", got)
+	}
+	// Empty lists serialize as [] rather than null
+	if stages, ok := got["completed_stages"].([]interface{}); !ok || len(stages) != 0 {
+		t.Errorf("expected empty completed_stages array, got %v", got["completed_stages"])
+	}
+	if _, err := time.Parse(time.RFC3339, got["timestamp"].(string)); err != nil {
+		t.Errorf("invalid timestamp: %v", err)
+	}
+}
+
+func TestWriteDistanceHistogram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "distance_histogram.json")
+	hist := map[int]int{-1: 1, 0: 2, 17: 3}
+
+	if err := WriteDistanceHistogram(hist, path); err != nil {
+		t.Fatalf("WriteDistanceHistogram failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	var got map[string]int
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got["-1"] != 1 || got["0"] != 2 || got["17"] != 3 || len(got) != 3 {
+		t.Errorf("unexpected histogram: %v", got)
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	first := NewFilterStats(5, 4, 4, 4, 3)
+	second := NewFilterStats(3, 3, 2, 1, 1)
+	prev := Report{
+		InputImages: 2, InputChunks: 4, KeptChunks: 3, DroppedChunks: 1, ExactDuplicates: 1,
+		CompressionRatio: 0.75, BytesInput: 400, BytesKept: 300, BytesSaved: 100,
+		Config:      Config{Method: "simhash", Window: 250},
+		Dropped:     []dedupe.DroppedChunk{{ChunkID: "c0004"}},
+		Warnings:    []string{"short text"},
+		SourceFiles: []string{"/in/a.jpg", "/in/b.jpg"},
+		FilterStats: &first,
+		Timestamp:   "2024-01-01T00:00:00Z",
+	}
+	next := Report{
+		InputImages: 1, InputChunks: 2, KeptChunks: 1, DroppedChunks: 1, CrossRunDups: 1,
+		CompressionRatio: 0.5, BytesInput: 200, BytesKept: 50, BytesSaved: 150,
+		Config:        Config{Method: "simhash", Window: 100},
+		Dropped:       []dedupe.DroppedChunk{{ChunkID: "c0002"}},
+		SkippedImages: []SkippedImage{{Path: "/in/broken.png", Reason: "PNG is truncated"}},
+		SourceFiles:   []string{"/in/c.jpg"},
+		FilterStats:   &second,
+		Timestamp:     "2024-01-02T00:00:00Z",
+	}
+
+	merged := MergeReports(prev, next)
+	if merged.InputImages != 3 || merged.InputChunks != 6 || merged.KeptChunks != 4 || merged.DroppedChunks != 2 {
+		t.Errorf("unexpected counts: %+v", merged)
+	}
+	if merged.CompressionRatio != 4.0/6 || merged.BytesInput != 600 || merged.BytesKept != 350 || merged.BytesSaved != 250 {
+		t.Errorf("expected the ratio recomputed and bytes summed, got %+v", merged)
+	}
+	if merged.ExactDuplicates != 1 || merged.CrossRunDups != 1 {
+		t.Errorf("unexpected duplicate counts: exact %d, cross-run %d", merged.ExactDuplicates, merged.CrossRunDups)
+	}
+	if len(merged.Dropped) != 2 || merged.Dropped[0].ChunkID != "c0004" || merged.Dropped[1].ChunkID != "c0002" {
+		t.Errorf("expected dropped chunks of both runs in order, got %+v", merged.Dropped)
+	}
+	if merged.Config.Window != 100 || merged.Timestamp != next.Timestamp {
+		t.Errorf("expected config and timestamp of the later run, got %+v", merged)
+	}
+	if len(merged.Warnings) != 1 {
+		t.Errorf("expected warnings to be kept, got %v", merged.Warnings)
+	}
+	if len(merged.SkippedImages) != 1 || merged.SkippedImages[0].Path != "/in/broken.png" {
+		t.Errorf("expected skipped images of the later run, got %+v", merged.SkippedImages)
+	}
+	if !reflect.DeepEqual(merged.SourceFiles, []string{"/in/a.jpg", "/in/b.jpg", "/in/c.jpg"}) {
+		t.Errorf("expected source files of both runs in order, got %v", merged.SourceFiles)
+	}
+	if *merged.FilterStats != NewFilterStats(8, 7, 6, 5, 4) {
+		t.Errorf("unexpected filter stats: %+v", *merged.FilterStats)
+	}
+}
+
+func TestReadReport_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	want := Report{InputImages: 2, KeptChunks: 3, Dropped: []dedupe.DroppedChunk{}, Timestamp: "2024-01-01T00:00:00Z"}
+	if err := WriteReportJSON(want, path); err != nil {
+		t.Fatalf("WriteReportJSON failed: %v", err)
+	}
+	got, err := ReadReport(path)
+	if err != nil {
+		t.Fatalf("ReadReport failed: %v", err)
+	}
+	if got.InputImages != 2 || got.KeptChunks != 3 || got.Timestamp != want.Timestamp {
+		t.Errorf("unexpected report: %+v", got)
+	}
+
+	if _, err := ReadReport(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected error for a missing report")
+	}
+}
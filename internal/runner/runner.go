@@ -2,10 +2,12 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -28,7 +30,9 @@ const (
 type RunOpts struct {
 	// Dir is the working directory (optional).
 	Dir string
-	// Env is extra environment variables (merged with current env).
+	// Env is extra environment variables (merged with current env, over Runner.Env).
+	// $VAR and ${VAR} in values are expanded from the current environment, so PATH
+	// can be extended as "/opt/venv/bin:$PATH". A PATH entry is also searched for bin.
 	Env map[string]string
 	// Timeout is the maximum execution time (0 means no timeout).
 	Timeout time.Duration
@@ -38,6 +42,29 @@ type RunOpts struct {
 	StderrMode OutputMode
 	// MaxCaptureBytes limits captured output to prevent OOM (default 2MB).
 	MaxCaptureBytes int
+	// OnStdoutLine and OnStderrLine, if set, are called with each line of output as it
+	// arrives (without the line terminator; \r also ends a line, for progress output).
+	// Lines longer than 64 KiB are delivered in pieces.
+	// They run on the goroutine copying the command's output, so they must return
+	// quickly: a slow callback stalls the copy and, once the pipe fills, the command.
+	// They are called regardless of the output mode; capture is unaffected.
+	OnStdoutLine func(string)
+	OnStderrLine func(string)
+	// Stdin is piped to the command's standard input (optional; nil means no input).
+	// Run returns once the command exits even if a Read from Stdin is still blocked.
+	// Retries rewind it if it is an io.Seeker, otherwise they see what remains unread.
+	Stdin io.Reader
+	// MaxRetries is how many times a failed command is re-run (0 means no retries).
+	// Timeouts and context cancellation are never retried.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry; it doubles on each later retry.
+	RetryBackoff time.Duration
+	// RetryOn decides whether a failed attempt is retried (optional).
+	// By default only non-zero exits (*ExecError) are retried.
+	RetryOn func(Result, error) bool
+	// DryRun skips spawning the process: Run returns a Result holding only the
+	// formatted command line (exit code 0, no output) and a nil error.
+	DryRun bool
 }
 
 // Result contains the result of a command execution.
@@ -77,21 +104,192 @@ func (e *ExecError) Unwrap() error {
 	return e.Cause
 }
 
+// TimeoutError reports a command killed because RunOpts.Timeout elapsed.
+// It matches context.DeadlineExceeded under errors.Is.
+type TimeoutError struct {
+	// Timeout is the limit that was exceeded.
+	Timeout time.Duration
+	// Cause is the underlying error from the killed process.
+	Cause error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("command timed out after %v: %v", e.Timeout, e.Cause)
+}
+
+func (e *TimeoutError) Unwrap() []error {
+	return []error{e.Cause, context.DeadlineExceeded}
+}
+
 // Runner executes external commands.
-type Runner struct{}
+//
+// A Runner is safe for concurrent use by multiple goroutines. The zero value and
+// New place no limit on how many commands run at once; NewWithConcurrency bounds it.
+type Runner struct {
+	// OnResult, if set, is called with the Result and error of every Run, failed or
+	// not, before Run returns them; with retries, those of the last attempt. It is not
+	// called in dry-run mode. Concurrent Runs call it concurrently.
+	OnResult func(Result, error)
+	// BinOverride maps binary names to the paths run instead, e.g. "ocrmypdf" to a
+	// virtualenv's bin/ocrmypdf. LookPath resolves the override in place of the name.
+	BinOverride map[string]string
+	// Env is environment variables set for every command, expanded like RunOpts.Env,
+	// whose entries take precedence. A PATH entry is where LookPath and Run look for
+	// binaries in place of the current PATH.
+	Env map[string]string
+
+	slots chan struct{} // Semaphore of running commands; nil means unlimited
+}
 
-// New creates a new Runner.
+// New creates a new Runner with no concurrency limit.
 func New() *Runner {
 	return &Runner{}
 }
 
-// LookPath finds the binary in PATH.
+// NewWithConcurrency creates a Runner that executes at most max commands at once.
+// Further Run calls block until a command finishes or their context is done.
+// A max of zero or less means no limit, like New.
+func NewWithConcurrency(max int) *Runner {
+	if max <= 0 {
+		return New()
+	}
+	return &Runner{slots: make(chan struct{}, max)}
+}
+
+// acquire waits for a free command slot. The caller must call release once the
+// command has finished.
+func (r *Runner) acquire(ctx context.Context) error {
+	if r.slots == nil {
+		return nil
+	}
+	select {
+	case r.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire.
+func (r *Runner) release() {
+	if r.slots != nil {
+		<-r.slots
+	}
+}
+
+// LookPath finds the binary in PATH, or in the PATH of Runner.Env if it sets one,
+// after applying BinOverride.
 func (r *Runner) LookPath(bin string) (string, error) {
-	return exec.LookPath(bin)
+	return lookPath(r.binFor(bin), r.environment(nil))
 }
 
-// Run executes an external command with the given options.
+// binFor returns the BinOverride path for bin, or bin itself.
+func (r *Runner) binFor(bin string) string {
+	if override, ok := r.BinOverride[bin]; ok && override != "" {
+		return override
+	}
+	return bin
+}
+
+// environment merges Runner.Env and extra, extra taking precedence, and expands
+// both from the current environment. It returns nil if neither sets anything.
+func (r *Runner) environment(extra map[string]string) map[string]string {
+	if len(r.Env) == 0 && len(extra) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(r.Env)+len(extra))
+	for _, vars := range []map[string]string{r.Env, extra} {
+		for k, v := range vars {
+			env[k] = os.ExpandEnv(v)
+		}
+	}
+	return env
+}
+
+// lookPath finds bin in the PATH of env if it sets one, and in the current PATH
+// otherwise. Like exec.LookPath, names containing a slash are not searched for.
+func lookPath(bin string, env map[string]string) (string, error) {
+	path, ok := env["PATH"]
+	if !ok || strings.Contains(bin, "/") {
+		return exec.LookPath(bin)
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		candidate := filepath.Join(dir, bin)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", &exec.Error{Name: bin, Err: exec.ErrNotFound}
+}
+
+// Run executes an external command with the given options, retrying failed attempts
+// as configured by MaxRetries, RetryBackoff and RetryOn. The returned Result and error
+// are those of the last attempt. On a Runner with a concurrency limit each attempt
+// waits for a free slot; the slot is not held during retry backoff, and the wait does
+// not count against Timeout.
 func (r *Runner) Run(ctx context.Context, bin string, args []string, opts RunOpts) (Result, error) {
+	bin = r.binFor(bin)
+	if opts.DryRun {
+		return Result{Cmd: formatCommand(bin, args)}, nil
+	}
+	result, err := r.runWithRetries(ctx, bin, args, opts)
+	if r.OnResult != nil {
+		r.OnResult(result, err)
+	}
+	return result, err
+}
+
+// runWithRetries runs the command until an attempt succeeds or may not be retried.
+func (r *Runner) runWithRetries(ctx context.Context, bin string, args []string, opts RunOpts) (Result, error) {
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if err := r.acquire(ctx); err != nil {
+			return Result{Cmd: formatCommand(bin, args), ExitCode: -1}, fmt.Errorf("waiting to run %s: %w", bin, err)
+		}
+		result, err := r.runOnce(ctx, bin, args, opts)
+		r.release()
+		if err == nil || attempt >= opts.MaxRetries || !shouldRetry(ctx, result, err, opts.RetryOn) {
+			return result, err
+		}
+
+		if seeker, ok := opts.Stdin.(io.Seeker); ok {
+			if _, serr := seeker.Seek(0, io.SeekStart); serr != nil {
+				return result, err
+			}
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return result, err
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// shouldRetry reports whether a failed attempt may be retried. Timeouts and
+// cancellations never are; otherwise retryOn decides, defaulting to non-zero exits.
+func shouldRetry(ctx context.Context, result Result, err error, retryOn func(Result, error) bool) bool {
+	var timeoutErr *TimeoutError
+	if ctx.Err() != nil || errors.As(err, &timeoutErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if retryOn != nil {
+		return retryOn(result, err)
+	}
+	var execErr *ExecError
+	return errors.As(err, &execErr)
+}
+
+// runOnce executes a single attempt of an external command.
+func (r *Runner) runOnce(ctx context.Context, bin string, args []string, opts RunOpts) (Result, error) {
 	start := time.Now()
 
 	// Apply defaults
@@ -112,24 +310,43 @@ func (r *Runner) Run(ctx context.Context, bin string, args []string, opts RunOpt
 		defer cancel()
 	}
 
+	// Format command string for Result.Cmd
+	cmdStr := formatCommand(bin, args)
+
+	// Resolve bin in the PATH of the command's environment, if that sets one
+	env := r.environment(opts.Env)
+	path, err := lookPath(bin, env)
+	if err != nil {
+		return Result{Cmd: cmdStr, ExitCode: -1}, fmt.Errorf("command execution failed: %w", err)
+	}
+
 	// Create command with context for cancellation
-	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Args[0] = bin
 
 	// Set working directory
 	if opts.Dir != "" {
 		cmd.Dir = opts.Dir
 	}
 
-	// Set environment variables
-	if len(opts.Env) > 0 {
+	// Set environment variables; later entries override those of os.Environ
+	if len(env) > 0 {
 		cmd.Env = os.Environ()
-		for k, v := range opts.Env {
+		for k, v := range env {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 		}
 	}
 
-	// Format command string for Result.Cmd
-	cmdStr := formatCommand(bin, args)
+	// Pipe stdin through our own copy so a blocked Read on opts.Stdin can't delay
+	// Wait after the process is killed on timeout or cancellation
+	var stdinPipe io.WriteCloser
+	if opts.Stdin != nil {
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			return Result{Cmd: cmdStr, ExitCode: -1}, fmt.Errorf("failed to create stdin pipe: %w", err)
+		}
+		stdinPipe = pipe
+	}
 
 	// Setup stdout
 	var stdoutWriter io.Writer
@@ -148,6 +365,11 @@ func (r *Runner) Run(ctx context.Context, bin string, args []string, opts RunOpt
 	if stdoutWriter == nil {
 		stdoutWriter = io.Discard
 	}
+	var stdoutLines *lineWriter
+	if opts.OnStdoutLine != nil {
+		stdoutLines = &lineWriter{fn: opts.OnStdoutLine}
+		stdoutWriter = io.MultiWriter(stdoutWriter, stdoutLines)
+	}
 	cmd.Stdout = stdoutWriter
 
 	// Setup stderr
@@ -167,10 +389,28 @@ func (r *Runner) Run(ctx context.Context, bin string, args []string, opts RunOpt
 	if stderrWriter == nil {
 		stderrWriter = io.Discard
 	}
+	var stderrLines *lineWriter
+	if opts.OnStderrLine != nil {
+		stderrLines = &lineWriter{fn: opts.OnStderrLine}
+		stderrWriter = io.MultiWriter(stderrWriter, stderrLines)
+	}
 	cmd.Stderr = stderrWriter
 
 	// Execute command
-	err := cmd.Run()
+	err = cmd.Start()
+	if err == nil {
+		if stdinPipe != nil {
+			go func() {
+				// Copy errors are ignored: commands may exit without reading all of their input
+				_, _ = io.Copy(stdinPipe, opts.Stdin)
+				_ = stdinPipe.Close()
+			}()
+		}
+		err = cmd.Wait()
+	}
+	// Deliver any final line that had no terminator
+	stdoutLines.flush()
+	stderrLines.flush()
 	duration := time.Since(start)
 
 	// Build result
@@ -192,10 +432,10 @@ func (r *Runner) Run(ctx context.Context, bin string, args []string, opts RunOpt
 	if err != nil {
 		// Check for context errors
 		if ctx.Err() == context.DeadlineExceeded {
-			return result, fmt.Errorf("command timed out after %v: %w", opts.Timeout, err)
+			return result, &TimeoutError{Timeout: opts.Timeout, Cause: err}
 		}
 		if ctx.Err() == context.Canceled {
-			return result, fmt.Errorf("command canceled: %w", err)
+			return result, fmt.Errorf("command canceled: %w", ctx.Err())
 		}
 
 		// Non-zero exit code
@@ -278,3 +518,48 @@ func (w *limitedWriter) String() string {
 	}
 	return s
 }
+
+// maxLineBytes caps the partial line a lineWriter buffers; longer lines are passed
+// to fn in pieces of this size.
+const maxLineBytes = 64 * 1024
+
+// lineWriter calls fn with each complete line written to it. Lines end at \n or \r;
+// a \r\n pair ends a single line. A line longer than maxLineBytes is split, so output
+// without line breaks cannot grow the buffer without bound.
+type lineWriter struct {
+	fn     func(string)
+	buf    []byte
+	lastCR bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch b {
+		case '\n':
+			if !w.lastCR {
+				w.emit()
+			}
+		case '\r':
+			w.emit()
+		default:
+			if len(w.buf) >= maxLineBytes {
+				w.emit()
+			}
+			w.buf = append(w.buf, b)
+		}
+		w.lastCR = b == '\r'
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) emit() {
+	w.fn(string(w.buf))
+	w.buf = w.buf[:0]
+}
+
+// flush delivers a trailing unterminated line. It is a no-op on a nil writer.
+func (w *lineWriter) flush() {
+	if w != nil && len(w.buf) > 0 {
+		w.emit()
+	}
+}
@@ -1,8 +1,17 @@
 package runner
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -101,6 +110,13 @@ func TestRunner_Run_Timeout(t *testing.T) {
 	if !hasTimeout {
 		t.Errorf("expected timeout error, got: %v", err)
 	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to match context.DeadlineExceeded, got: %v", err)
+	}
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Timeout != opts.Timeout {
+		t.Errorf("expected *TimeoutError with timeout %v, got: %v", opts.Timeout, err)
+	}
 
 	// Process should have been killed, so exit code might be non-zero or -1
 	if result.ExitCode == 0 {
@@ -108,6 +124,325 @@ func TestRunner_Run_Timeout(t *testing.T) {
 	}
 }
 
+func TestRunner_Run_Stdin(t *testing.T) {
+	r := New()
+	input := []byte("piped line one\npiped line two\n")
+
+	result, err := r.Run(context.Background(), "cat", nil, RunOpts{
+		StdoutMode: Capture,
+		Stdin:      bytes.NewReader(input),
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Stdout != string(input) {
+		t.Errorf("expected stdout %q, got %q", input, result.Stdout)
+	}
+}
+
+func TestRunner_Run_NilStdin(t *testing.T) {
+	r := New()
+
+	// Without Stdin the command reads from the null device and sees EOF immediately
+	result, err := r.Run(context.Background(), "cat", nil, RunOpts{StdoutMode: Capture})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Stdout != "" {
+		t.Errorf("expected empty stdout, got %q", result.Stdout)
+	}
+}
+
+func TestRunner_Run_StdinTimeout(t *testing.T) {
+	r := New()
+
+	// A reader that never yields data or EOF keeps the stdin copy blocked
+	pr, pw := io.Pipe()
+	defer func() { _ = pw.Close() }()
+
+	start := time.Now()
+	_, err := r.Run(context.Background(), "cat", nil, RunOpts{
+		Timeout:    100 * time.Millisecond,
+		StdoutMode: Capture,
+		Stdin:      pr,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected Run to return promptly after the timeout, took %v", elapsed)
+	}
+}
+
+func TestRunner_Run_LineCallbacks(t *testing.T) {
+	r := New()
+
+	var stdoutLines, stderrLines []string
+	script := `printf 'out one\nout two\nout three'; printf 'Page 1 of 3\rPage 2 of 3\rPage 3 of 3\r\ndone\n' >&2`
+	result, err := r.Run(context.Background(), "sh", []string{"-c", script}, RunOpts{
+		StdoutMode:   Capture,
+		StderrMode:   Capture,
+		OnStdoutLine: func(line string) { stdoutLines = append(stdoutLines, line) },
+		OnStderrLine: func(line string) { stderrLines = append(stderrLines, line) },
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	wantStdout := []string{"out one", "out two", "out three"}
+	if !reflect.DeepEqual(stdoutLines, wantStdout) {
+		t.Errorf("stdout lines = %q, want %q", stdoutLines, wantStdout)
+	}
+	wantStderr := []string{"Page 1 of 3", "Page 2 of 3", "Page 3 of 3", "done"}
+	if !reflect.DeepEqual(stderrLines, wantStderr) {
+		t.Errorf("stderr lines = %q, want %q", stderrLines, wantStderr)
+	}
+
+	// Capture still sees the raw output
+	if result.Stdout != "out one\nout two\nout three" {
+		t.Errorf("unexpected captured stdout: %q", result.Stdout)
+	}
+	if !strings.Contains(result.Stderr, "Page 3 of 3\r\ndone") {
+		t.Errorf("unexpected captured stderr: %q", result.Stderr)
+	}
+}
+
+func TestRunner_Run_LineCallbackWithDiscard(t *testing.T) {
+	r := New()
+
+	count := 0
+	_, err := r.Run(context.Background(), "sh", []string{"-c", "printf 'a\n\nb\n'"}, RunOpts{
+		StdoutMode:   Discard,
+		OnStdoutLine: func(string) { count++ },
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	// Empty lines are delivered too
+	if count != 3 {
+		t.Errorf("expected 3 callback invocations, got %d", count)
+	}
+}
+
+func TestLineWriter_SplitsLongLines(t *testing.T) {
+	var lines []string
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+
+	long := strings.Repeat("x", 2*maxLineBytes+10)
+	if _, err := w.Write([]byte(long + "\n" + strings.Repeat("y", maxLineBytes) + "\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	w.flush()
+
+	want := []string{long[:maxLineBytes], long[maxLineBytes : 2*maxLineBytes], long[2*maxLineBytes:], strings.Repeat("y", maxLineBytes)}
+	if !reflect.DeepEqual(lines, want) {
+		got := make([]int, len(lines))
+		for i, line := range lines {
+			got[i] = len(line)
+		}
+		t.Errorf("expected lines of %d, %d, 10 and %d bytes, got %v", maxLineBytes, maxLineBytes, maxLineBytes, got)
+	}
+	if cap(w.buf) > 2*maxLineBytes {
+		t.Errorf("expected the line buffer to stay near %d bytes, got capacity %d", maxLineBytes, cap(w.buf))
+	}
+}
+
+// flakyScript fails until it has run failures times, counting runs in countFile.
+func flakyScript(countFile string, failures int) []string {
+	script := fmt.Sprintf(`n=$(cat %[1]q 2>/dev/null || echo 0); n=$((n+1)); echo $n > %[1]q; echo "attempt $n"; [ $n -gt %[2]d ] || exit 15`, countFile, failures)
+	return []string{"-c", script}
+}
+
+func TestRunner_NewWithConcurrency_LimitsConcurrentRuns(t *testing.T) {
+	const limit, jobs = 2, 8
+	r := NewWithConcurrency(limit)
+
+	var running, maxSeen atomic.Int32
+	onLine := func(line string) {
+		switch line {
+		case "start":
+			n := running.Add(1)
+			for {
+				m := maxSeen.Load()
+				if n <= m || maxSeen.CompareAndSwap(m, n) {
+					break
+				}
+			}
+		case "end":
+			running.Add(-1)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, jobs)
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Run(context.Background(), "sh", []string{"-c", "echo start; sleep 0.05; echo end"}, RunOpts{
+				StdoutMode:   Discard,
+				StderrMode:   Discard,
+				OnStdoutLine: onLine,
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Run() failed: %v", err)
+		}
+	}
+	if got := maxSeen.Load(); got < 1 || got > limit {
+		t.Errorf("expected at most %d concurrent runs, saw %d", limit, got)
+	}
+}
+
+func TestRunner_NewWithConcurrency_WaitRespectsContext(t *testing.T) {
+	r := NewWithConcurrency(1)
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(context.Background(), "sh", []string{"-c", "echo start; sleep 0.5"}, RunOpts{
+			StdoutMode:   Discard,
+			OnStdoutLine: func(string) { close(started) },
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := r.Run(ctx, "echo", []string{"never"}, RunOpts{StdoutMode: Discard})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded while waiting for a slot, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("expected wait to stop at context deadline, took %v", elapsed)
+	}
+	<-done
+}
+
+func TestNewWithConcurrency_NonPositiveIsUnlimited(t *testing.T) {
+	if r := NewWithConcurrency(0); r.slots != nil {
+		t.Error("expected NewWithConcurrency(0) to be unlimited")
+	}
+}
+
+func TestRunner_OnResult(t *testing.T) {
+	type call struct {
+		result Result
+		err    error
+	}
+	var calls []call
+	r := New()
+	r.OnResult = func(result Result, err error) {
+		calls = append(calls, call{result, err})
+	}
+	ctx := context.Background()
+
+	if _, err := r.Run(ctx, "sh", []string{"-c", "echo done"}, RunOpts{StdoutMode: Capture}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	_, failErr := r.Run(ctx, "sh", []string{"-c", "echo broken >&2; exit 3"}, RunOpts{StderrMode: Capture})
+	if failErr == nil {
+		t.Fatal("expected error for non-zero exit")
+	}
+	if _, err := r.Run(ctx, "sh", []string{"-c", "exit 1"}, RunOpts{DryRun: true}); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("expected OnResult for the two commands that ran, got %d calls", len(calls))
+	}
+	if calls[0].err != nil || calls[0].result.ExitCode != 0 || calls[0].result.Cmd != `sh -c "echo done"` {
+		t.Errorf("expected the successful result first, got %+v", calls[0])
+	}
+	if calls[1].err != failErr || calls[1].result.ExitCode != 3 || !strings.Contains(calls[1].result.Stderr, "broken") {
+		t.Errorf("expected the failed result with its error and stderr, got %+v", calls[1])
+	}
+}
+
+func TestRunner_Run_RetrySucceedsAfterFailures(t *testing.T) {
+	r := New()
+	countFile := filepath.Join(t.TempDir(), "count")
+
+	result, err := r.Run(context.Background(), "sh", flakyScript(countFile, 2), RunOpts{
+		StdoutMode:   Capture,
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("expected success after retries, got: %v", err)
+	}
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "attempt 3") {
+		t.Errorf("expected result of the third attempt, got exit %d stdout %q", result.ExitCode, result.Stdout)
+	}
+}
+
+func TestRunner_Run_RetryLimit(t *testing.T) {
+	r := New()
+	countFile := filepath.Join(t.TempDir(), "count")
+
+	result, err := r.Run(context.Background(), "sh", flakyScript(countFile, 5), RunOpts{
+		StdoutMode: Capture,
+		MaxRetries: 2,
+	})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected ExecError after exhausting retries, got: %v", err)
+	}
+	if result.ExitCode != 15 || !strings.Contains(result.Stdout, "attempt 3") {
+		t.Errorf("expected last attempt (3) result, got exit %d stdout %q", result.ExitCode, result.Stdout)
+	}
+}
+
+func TestRunner_Run_RetryOnPredicate(t *testing.T) {
+	r := New()
+	countFile := filepath.Join(t.TempDir(), "count")
+
+	var calls int
+	_, err := r.Run(context.Background(), "sh", flakyScript(countFile, 2), RunOpts{
+		StdoutMode: Capture,
+		MaxRetries: 3,
+		RetryOn: func(result Result, err error) bool {
+			calls++
+			return result.ExitCode == 14 // never matches the script's exit code 15
+		},
+	})
+	if err == nil {
+		t.Fatal("expected failure when the predicate rejects retries")
+	}
+	if calls != 1 {
+		t.Errorf("expected predicate to be consulted once, got %d", calls)
+	}
+	if data, _ := os.ReadFile(countFile); strings.TrimSpace(string(data)) != "1" {
+		t.Errorf("expected a single attempt, got count %q", data)
+	}
+}
+
+func TestRunner_Run_NoRetryOnTimeout(t *testing.T) {
+	r := New()
+	countFile := filepath.Join(t.TempDir(), "count")
+	script := fmt.Sprintf(`echo x >> %q; exec sleep 5`, countFile)
+
+	_, err := r.Run(context.Background(), "sh", []string{"-c", script}, RunOpts{
+		Timeout:    50 * time.Millisecond,
+		MaxRetries: 3,
+		RetryOn:    func(Result, error) bool { return true },
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+	if data, _ := os.ReadFile(countFile); strings.Count(string(data), "x") != 1 {
+		t.Errorf("expected a single attempt on timeout, got %q", data)
+	}
+}
+
 func TestRunner_Run_ContextCancellation(t *testing.T) {
 	r := New()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -127,6 +462,9 @@ func TestRunner_Run_ContextCancellation(t *testing.T) {
 	if !strings.Contains(err.Error(), "cancel") {
 		t.Errorf("expected cancellation error, got: %v", err)
 	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got: %v", err)
+	}
 
 	_ = result // Result may be incomplete
 }
@@ -236,6 +574,79 @@ func TestRunner_Run_EnvironmentVariables(t *testing.T) {
 	}
 }
 
+// writeScript writes an executable shell script named name into dir.
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunner_BinOverride(t *testing.T) {
+	venv := t.TempDir()
+	fake := writeScript(t, venv, "fake-ocrmypdf", `echo "venv ocrmypdf $1"`)
+
+	r := New()
+	r.BinOverride = map[string]string{"ocrmypdf-xyz123": fake}
+	result, err := r.Run(context.Background(), "ocrmypdf-xyz123", []string{"--version"}, RunOpts{StdoutMode: Capture})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if strings.TrimSpace(result.Stdout) != "venv ocrmypdf --version" {
+		t.Errorf("expected the override to run, got stdout %q", result.Stdout)
+	}
+	if result.Cmd != fake+" --version" {
+		t.Errorf("expected Cmd to show the override path, got %q", result.Cmd)
+	}
+
+	if path, err := r.LookPath("ocrmypdf-xyz123"); err != nil || path != fake {
+		t.Errorf("expected LookPath to return the override, got %q, %v", path, err)
+	}
+	if _, err := New().LookPath("ocrmypdf-xyz123"); err == nil {
+		t.Error("expected the name not to be found without the override")
+	}
+}
+
+func TestRunner_EnvPath(t *testing.T) {
+	venv := t.TempDir()
+	writeScript(t, venv, "venv-tool-xyz123", `echo "PATH=$PATH"`)
+	ctx := context.Background()
+
+	// RunOpts.Env PATH resolves the binary and is passed to the child, expanded
+	r := New()
+	result, err := r.Run(ctx, "venv-tool-xyz123", nil, RunOpts{
+		StdoutMode: Capture,
+		Env:        map[string]string{"PATH": venv + ":$PATH"},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := "PATH=" + venv + ":" + os.Getenv("PATH"); strings.TrimSpace(result.Stdout) != want {
+		t.Errorf("expected child %q, got %q", want, strings.TrimSpace(result.Stdout))
+	}
+	if _, err := r.Run(ctx, "venv-tool-xyz123", nil, RunOpts{StdoutMode: Capture}); err == nil {
+		t.Error("expected the binary not to be found without the PATH override")
+	}
+
+	// Runner.Env PATH applies to LookPath and every Run; RunOpts.Env takes precedence
+	r.Env = map[string]string{"PATH": venv + ":$PATH", "TOOL_MODE": "runner"}
+	if path, err := r.LookPath("venv-tool-xyz123"); err != nil || path != filepath.Join(venv, "venv-tool-xyz123") {
+		t.Errorf("expected LookPath to search the Runner PATH, got %q, %v", path, err)
+	}
+	if _, err := r.LookPath("nonexistent-binary-xyz123"); err == nil {
+		t.Error("expected error for a binary in neither PATH")
+	}
+	result, err = r.Run(ctx, "sh", []string{"-c", "echo $TOOL_MODE"}, RunOpts{StdoutMode: Capture, Env: map[string]string{"TOOL_MODE": "opts"}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if strings.TrimSpace(result.Stdout) != "opts" {
+		t.Errorf("expected RunOpts.Env to take precedence, got %q", result.Stdout)
+	}
+}
+
 func TestRunner_Run_CommandFormatting(t *testing.T) {
 	r := New()
 	ctx := context.Background()
@@ -366,6 +777,33 @@ func TestLimitedWriter(t *testing.T) {
 	}
 }
 
+func TestRunner_Run_DryRun(t *testing.T) {
+	r := New()
+	dir := t.TempDir()
+
+	result, err := r.Run(context.Background(), "sh", []string{"-c", "touch marker"}, RunOpts{
+		Dir:    dir,
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatalf("expected dry run to succeed, got: %v", err)
+	}
+	if result.Cmd != `sh -c "touch marker"` {
+		t.Errorf("unexpected command: %q", result.Cmd)
+	}
+	if result.ExitCode != 0 || result.Stdout != "" || result.Stderr != "" {
+		t.Errorf("expected empty result, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "marker")); !os.IsNotExist(err) {
+		t.Error("expected dry run not to execute the command")
+	}
+
+	// A missing binary is not an error because nothing is spawned
+	if _, err := r.Run(context.Background(), "nonexistent-binary-12345", nil, RunOpts{DryRun: true}); err != nil {
+		t.Errorf("expected no error for missing binary in dry run, got: %v", err)
+	}
+}
+
 func TestFormatCommand(t *testing.T) {
 	tests := []struct {
 		name string
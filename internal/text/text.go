@@ -1,21 +1,35 @@
 package text
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"text/template"
+	"time"
 	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/jonkmatsumo/bulk-ocr/internal/fsutil"
 )
 
 // Chunk represents a text chunk with original and normalized versions.
 type Chunk struct {
-	ID    string // sequential id: c0001, c0002, etc.
-	Text  string // original text (trimmed, human-readable)
-	Norm  string // normalized for hashing (lowercase, collapsed whitespace, no punctuation)
-	Index int    // original position in document
+	ID         string `json:"id"`                    // sequential id: c0001, c0002, etc.
+	Text       string `json:"text"`                  // original text (trimmed, human-readable)
+	Norm       string `json:"norm"`                  // normalized for hashing (lowercase, collapsed whitespace, no punctuation)
+	Index      int    `json:"index"`                 // original position in document
+	Page       int    `json:"page,omitempty"`        // 1-based source page the chunk starts on (pages are separated by form feeds)
+	SourceFile string `json:"source_file,omitempty"` // Original image of Page, when known (see SetSourceFiles)
 }
 
 // DefaultChromePatterns returns the default regex patterns for chrome filtering.
@@ -29,15 +43,152 @@ func DefaultChromePatterns() []string {
 	}
 }
 
+// UnicodeForm selects the Unicode normalization form applied before lowercasing.
+type UnicodeForm string
+
+const (
+	// FormNFC composes characters canonically (e.g. "e" + U+0301 becomes "é").
+	FormNFC UnicodeForm = "nfc"
+	// FormNFKC also folds compatibility characters such as ligatures and full-width digits.
+	FormNFKC UnicodeForm = "nfkc"
+)
+
+// ParseUnicodeForm parses a form name ("nfc" or "nfkc", case-insensitive).
+func ParseUnicodeForm(s string) (UnicodeForm, error) {
+	switch UnicodeForm(strings.ToLower(s)) {
+	case FormNFC:
+		return FormNFC, nil
+	case FormNFKC:
+		return FormNFKC, nil
+	default:
+		return "", fmt.Errorf("unknown unicode normalization form %q (expected nfc or nfkc)", s)
+	}
+}
+
+// NormalizeOpts configures how Normalize builds hashing text.
+type NormalizeOpts struct {
+	// Form is the Unicode normalization form (default: NFC).
+	Form UnicodeForm
+	// FoldAccents strips diacritics (e.g. "número" becomes "numero") so accented and
+	// unaccented spellings hash identically. Only Norm is affected; Text keeps accents.
+	FoldAccents bool
+	// Steps selects and orders the transforms applied before whitespace collapsing and
+	// punctuation removal (see NormalizeStepNames). Empty means DefaultNormalizeSteps.
+	// Unknown names are skipped; validate them with ParseNormalizeSteps.
+	Steps []string
+}
+
+// NormalizeStepNames lists the transforms that NormalizeOpts.Steps can select:
+//
+//   - unicode: Unicode normalization with NormalizeOpts.Form
+//   - quotes: curly and angle quotes to ASCII ' and "
+//   - ligatures: œ, æ, ĳ and the ﬀ–ﬆ presentation forms to their letters; uppercase
+//     Œ, Æ and Ĳ are only expanded if lowercase runs first
+//   - accents: strip diacritics; compatibility characters such as "ǆ" only fold to
+//     "dz" if unicode (with FormNFKC) runs first, otherwise they become "dž"
+//   - lowercase: lowercase
+var NormalizeStepNames = []string{"unicode", "quotes", "ligatures", "accents", "lowercase"}
+
+// DefaultNormalizeSteps returns the steps Normalize applies when opts.Steps is empty:
+// unicode, accents (if opts.FoldAccents), then lowercase.
+func DefaultNormalizeSteps(opts NormalizeOpts) []string {
+	if opts.FoldAccents {
+		return []string{"unicode", "accents", "lowercase"}
+	}
+	return []string{"unicode", "lowercase"}
+}
+
+// ParseNormalizeSteps parses a comma-separated list of step names, e.g.
+// "unicode,accents,lowercase". Unknown and repeated names are errors.
+func ParseNormalizeSteps(s string) ([]string, error) {
+	var steps []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if normalizeStep(name, NormalizeOpts{}) == nil {
+			return nil, fmt.Errorf("unknown normalize step %q (expected one of %s)", name, strings.Join(NormalizeStepNames, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("normalize step %q listed twice", name)
+		}
+		seen[name] = true
+		steps = append(steps, name)
+	}
+	return steps, nil
+}
+
+// normalizeStep returns the transform named name, or nil if there is none.
+func normalizeStep(name string, opts NormalizeOpts) func(string) string {
+	switch name {
+	case "unicode":
+		if opts.Form == FormNFKC {
+			return norm.NFKC.String
+		}
+		return norm.NFC.String
+	case "quotes":
+		return quoteReplacer.Replace
+	case "ligatures":
+		return ligatureReplacer.Replace
+	case "accents":
+		return foldAccents
+	case "lowercase":
+		return strings.ToLower
+	default:
+		return nil
+	}
+}
+
+// composeSteps returns a transform applying each of steps in order.
+func composeSteps(steps ...func(string) string) func(string) string {
+	return func(s string) string {
+		for _, step := range steps {
+			s = step(s)
+		}
+		return s
+	}
+}
+
+// quoteReplacer maps typographic quotes to their ASCII forms.
+var quoteReplacer = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201A", "'", "\u201B", "'", "\u2032", "'", "\u2039", "'", "\u203A", "'",
+	"\u201C", `"`, "\u201D", `"`, "\u201E", `"`, "\u201F", `"`, "\u2033", `"`, "\u00AB", `"`, "\u00BB", `"`,
+)
+
+// ligatureReplacer expands lowercase ligatures into their letters.
+var ligatureReplacer = strings.NewReplacer(
+	"\uFB00", "ff", "\uFB01", "fi", "\uFB02", "fl", "\uFB03", "ffi", "\uFB04", "ffl", "\uFB05", "st", "\uFB06", "st",
+	"œ", "oe", "æ", "ae", "ĳ", "ij",
+)
+
 // Normalize normalizes text for hashing by lowercasing, collapsing whitespace, and removing punctuation.
+// Unicode is normalized first (NFC) so composed and decomposed forms hash identically.
 // Preserves newlines for chunking boundaries.
 func Normalize(raw string) string {
+	return NormalizeWithOpts(raw, NormalizeOpts{})
+}
+
+// NormalizeWithOpts is Normalize with explicit options. The zero NormalizeOpts
+// normalizes as Normalize does.
+func NormalizeWithOpts(raw string, opts NormalizeOpts) string {
 	if raw == "" {
 		return ""
 	}
 
-	// Convert to lowercase
-	normalized := strings.ToLower(raw)
+	// Apply the configured transforms (by default Unicode normalization, then lowercasing)
+	names := opts.Steps
+	if len(names) == 0 {
+		names = DefaultNormalizeSteps(opts)
+	}
+	steps := make([]func(string) string, 0, len(names))
+	for _, name := range names {
+		if step := normalizeStep(name, opts); step != nil {
+			steps = append(steps, step)
+		}
+	}
+	normalized := composeSteps(steps...)(raw)
 
 	// Collapse multiple whitespace (but preserve newlines)
 	// First, replace all non-newline whitespace with single space
@@ -64,26 +215,109 @@ func Normalize(raw string) string {
 	return normalized
 }
 
-// ChunkText splits text into chunks by paragraph boundaries (blank lines).
-// Returns chunks with sequential IDs and normalized versions.
-func ChunkText(text string, minChars int) []Chunk {
+// foldAccents removes combining marks after canonical decomposition, then recomposes
+// what remains.
+func foldAccents(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return folded
+}
+
+// NormalizeLineEndings converts \r\n and lone \r line endings to \n.
+func NormalizeLineEndings(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
+
+// displaySpaceRegex matches runs of horizontal whitespace (tabs and Unicode spaces,
+// such as no-break spaces), and displayLineEdgeRegex a space around a line break.
+var (
+	displaySpaceRegex    = regexp.MustCompile(`[\t\v\p{Zs}]+`)
+	displayLineEdgeRegex = regexp.MustCompile(` ?\n ?`)
+)
+
+// NormalizeForDisplay is a light normalization for rendered text: line endings become
+// \n, runs of spaces and tabs become one space, and whitespace at the start and end of
+// lines is removed. Unlike Normalize it keeps case, punctuation and line breaks.
+func NormalizeForDisplay(raw string) string {
+	s := displaySpaceRegex.ReplaceAllString(NormalizeLineEndings(raw), " ")
+	s = displayLineEdgeRegex.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(s)
+}
+
+// paragraphSeparatorRegex matches the boundaries ChunkText splits on: blank lines
+// (one or more consecutive newlines) and page breaks (form feeds).
+var paragraphSeparatorRegex = regexp.MustCompile(`\n\s*\n+|\s*\f\s*`)
+
+// paragraphSeparator returns the regex matching paragraph boundaries: runs of at
+// least maxBlankLines blank lines (values below 1 count as 1), and page breaks.
+func paragraphSeparator(maxBlankLines int) *regexp.Regexp {
+	if maxBlankLines <= 1 {
+		return paragraphSeparatorRegex
+	}
+	return regexp.MustCompile(fmt.Sprintf(`\n(?:[\t\r ]*\n){%d,}|\s*\f\s*`, maxBlankLines))
+}
+
+// ChunkText splits text into chunks by paragraph boundaries (blank lines and form-feed page breaks).
+// A boundary is a run of at least maxBlankLines consecutive blank lines, so with 2 or more,
+// single blank lines stay within a chunk; 1 splits on every blank line. Page breaks always split.
+// Line endings are normalized to \n first, so \r\n and \r input chunks the same as \n.
+// Returns chunks with sequential IDs and versions normalized as by Normalize.
+func ChunkText(text string, minChars, maxBlankLines int) []Chunk {
+	chunks, _ := ChunkTextWithDiscards(text, minChars, maxBlankLines, NormalizeOpts{})
+	return chunks
+}
+
+// ChunkTextWithDiscards is ChunkText that normalizes with normOpts and also returns
+// the paragraphs dropped for being shorter than minChars, as StageMinChars discards.
+// They have no chunk ID.
+func ChunkTextWithDiscards(text string, minChars, maxBlankLines int, normOpts NormalizeOpts) ([]Chunk, []FilteredChunk) {
 	if text == "" {
-		return []Chunk{}
+		return []Chunk{}, nil
 	}
+	text = NormalizeLineEndings(text)
 
-	// Split on blank lines (one or more consecutive newlines)
-	blankLineRegex := regexp.MustCompile(`\n\s*\n+`)
-	segments := blankLineRegex.Split(text, -1)
+	// Split on runs of blank lines and on page breaks (form feeds)
+	separators := paragraphSeparator(maxBlankLines).FindAllStringIndex(text, -1)
 
 	var chunks []Chunk
+	var discards []FilteredChunk
 	chunkIndex := 0
+	segStart := 0
+	page, counted := 1, 0 // form feeds in text[:counted] advance page
+
+	for i := 0; i <= len(separators); i++ {
+		segEnd := len(text)
+		if i < len(separators) {
+			segEnd = separators[i][0]
+		}
+		segment := text[segStart:segEnd]
+		offset := segStart
+		if i < len(separators) {
+			segStart = separators[i][1]
+		}
 
-	for _, segment := range segments {
 		// Trim whitespace from segment
 		trimmed := strings.TrimSpace(segment)
 
+		// Page is counted up to the first non-space character of the segment
+		leading := len(segment) - len(strings.TrimLeftFunc(segment, unicode.IsSpace))
+		page += strings.Count(text[counted:offset+leading], "\f")
+		counted = offset + leading
+
 		// Skip if too short
 		if len(trimmed) < minChars {
+			if trimmed != "" {
+				discards = append(discards, FilteredChunk{
+					Stage:  StageMinChars,
+					Reason: fmt.Sprintf("%d chars, under the minimum of %d", len(trimmed), minChars),
+					Page:   page,
+					Text:   trimmed,
+				})
+			}
 			continue
 		}
 
@@ -91,13 +325,14 @@ func ChunkText(text string, minChars int) []Chunk {
 		chunkID := fmt.Sprintf("c%04d", chunkIndex+1)
 
 		// Normalize for hashing
-		normalized := Normalize(trimmed)
+		normalized := NormalizeWithOpts(trimmed, normOpts)
 
 		chunk := Chunk{
 			ID:    chunkID,
 			Text:  trimmed,
 			Norm:  normalized,
 			Index: chunkIndex,
+			Page:  page,
 		}
 
 		chunks = append(chunks, chunk)
@@ -108,24 +343,196 @@ func ChunkText(text string, minChars int) []Chunk {
 	if len(chunks) == 0 && len(strings.TrimSpace(text)) >= minChars {
 		trimmed := strings.TrimSpace(text)
 		chunkID := fmt.Sprintf("c%04d", 1)
-		normalized := Normalize(trimmed)
+		normalized := NormalizeWithOpts(trimmed, normOpts)
+		leading := len(text) - len(strings.TrimLeftFunc(text, unicode.IsSpace))
 		chunks = append(chunks, Chunk{
 			ID:    chunkID,
 			Text:  trimmed,
 			Norm:  normalized,
 			Index: 0,
+			Page:  strings.Count(text[:leading], "\f") + 1,
 		})
+		// The short paragraphs are all in the single chunk, so none was lost
+		discards = nil
 	}
 
-	return chunks
+	return chunks, discards
+}
+
+// CountParagraphs returns the number of non-empty paragraphs in text, split as in
+// ChunkText. It is the chunk count ChunkText would return with no minimum length.
+func CountParagraphs(text string, maxBlankLines int) int {
+	count := 0
+	for _, segment := range paragraphSeparator(maxBlankLines).Split(NormalizeLineEndings(text), -1) {
+		if strings.TrimSpace(segment) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// pageNumberRegex matches a whole line that is only a page number: "42", "- 42 -",
+// "Page 42", "Page 42 of 50", "p. 42" or "42 / 50".
+var pageNumberRegex = regexp.MustCompile(`(?i)^(?:\d+|-\s*\d+\s*-|(?:page|pg\.?|p\.)\s*\d+(?:\s*(?:of|/)\s*\d+)?|\d+\s*(?:of|/)\s*\d+)$`)
+
+// StripPageNumbers removes lines that contain only a page number (see pageNumberRegex).
+// Form feeds count as line breaks and are kept, so page tracking in ChunkText is unaffected.
+func StripPageNumbers(s string) string {
+	pages := strings.Split(s, "\f")
+	for i, page := range pages {
+		lines := strings.Split(page, "\n")
+		kept := lines[:0]
+		for _, line := range lines {
+			if !pageNumberRegex.MatchString(strings.TrimSpace(line)) {
+				kept = append(kept, line)
+			}
+		}
+		pages[i] = strings.Join(kept, "\n")
+	}
+	return strings.Join(pages, "\f")
+}
+
+// hyphenBreakRegex matches a word broken across lines with a hyphen, capturing the
+// parts before and after the break. wordRegex and compoundRegex match the words and
+// hyphenated compounds DehyphenateText looks for elsewhere in the text.
+var (
+	hyphenBreakRegex = regexp.MustCompile(`(\p{L}+)-[ \t]*\r?\n[ \t]*(\p{L}+)`)
+	wordRegex        = regexp.MustCompile(`\p{L}+`)
+	compoundRegex    = regexp.MustCompile(`\p{L}+-\p{L}+`)
+)
+
+// compoundPrefixes are words that start hyphenated compounds ("well-known",
+// "self-evident") far more often than they end a line mid-word.
+var compoundPrefixes = map[string]bool{
+	"all": true, "ex": true, "half": true, "high": true, "long": true, "low": true,
+	"non": true, "quasi": true, "self": true, "short": true, "well": true,
+}
+
+// DehyphenateText joins words that OCR of justified text splits across lines with a
+// hyphen, so "informa-\ntion" becomes "information". Only lowercase alphabetic parts
+// are joined. A break is taken to be a real compound, and becomes "well-known" on one
+// line instead, when the text uses the hyphenated compound elsewhere but not the
+// joined word, or when the first part is a common compound prefix such as "well".
+func DehyphenateText(s string) string {
+	words := map[string]bool{}
+	for _, word := range wordRegex.FindAllString(s, -1) {
+		words[word] = true
+	}
+	compounds := map[string]bool{}
+	for _, compound := range compoundRegex.FindAllString(s, -1) {
+		compounds[compound] = true
+	}
+
+	return hyphenBreakRegex.ReplaceAllStringFunc(s, func(match string) string {
+		parts := hyphenBreakRegex.FindStringSubmatch(match)
+		head, tail := parts[1], parts[2]
+		if !isLowerAlpha(head) || !isLowerAlpha(tail) {
+			return match
+		}
+		if !words[head+tail] && (compounds[head+"-"+tail] || compoundPrefixes[head]) {
+			return head + "-" + tail
+		}
+		return head + tail
+	})
+}
+
+// isLowerAlpha reports whether s consists only of lowercase letters.
+func isLowerAlpha(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLower(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// urlRegex matches URL-like tokens along with any horizontal whitespace before them.
+var urlRegex = regexp.MustCompile(`(?i)[ \t]*\b(?:(?:https?|ftp)://|www\.)[^\s<>"']+`)
+
+// StripURLs removes URL-like tokens (http, https, ftp and www. prefixes) from text.
+func StripURLs(s string) string {
+	return strings.TrimSpace(urlRegex.ReplaceAllString(s, ""))
+}
+
+// StripChunkURLs removes URLs from each chunk's normalized text so they don't dominate hashing.
+// If stripText is true, URLs are also removed from the human-readable Text.
+// Norm is recomputed with normOpts from the URL-free text because normalization drops
+// URL punctuation.
+func StripChunkURLs(chunks []Chunk, stripText bool, normOpts NormalizeOpts) []Chunk {
+	result := make([]Chunk, len(chunks))
+	for i, chunk := range chunks {
+		stripped := StripURLs(chunk.Text)
+		chunk.Norm = NormalizeWithOpts(stripped, normOpts)
+		if stripText {
+			chunk.Text = stripped
+		}
+		result[i] = chunk
+	}
+	return result
+}
+
+// SetSourceFiles returns chunks with SourceFile set from their page: a chunk on page N
+// comes from files[N-1]. Chunks without a page, or past the end of files, keep an
+// empty SourceFile.
+func SetSourceFiles(chunks []Chunk, files []string) []Chunk {
+	result := make([]Chunk, len(chunks))
+	for i, chunk := range chunks {
+		if chunk.Page > 0 && chunk.Page <= len(files) {
+			chunk.SourceFile = files[chunk.Page-1]
+		}
+		result[i] = chunk
+	}
+	return result
+}
+
+// PrefixChunkIDs returns chunks with prefix prepended to their IDs.
+func PrefixChunkIDs(chunks []Chunk, prefix string) []Chunk {
+	result := make([]Chunk, len(chunks))
+	for i, chunk := range chunks {
+		chunk.ID = prefix + chunk.ID
+		result[i] = chunk
+	}
+	return result
+}
+
+// CompileChromePatterns compiles chrome regex patterns, failing on the first invalid
+// one with an error naming the pattern and its 1-based position in patterns.
+func CompileChromePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("chrome pattern %d %q: %w", i+1, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
 }
 
 // FilterChrome removes chunks that match chrome patterns and are short.
 // Only filters chunks that match pattern AND are below maxLength.
 // Longer chunks matching patterns are kept (likely real content).
+// Invalid patterns are skipped; use CompileChromePatterns and FilterChromeCompiled
+// to report them instead.
 func FilterChrome(chunks []Chunk, patterns []string, maxLength int) []Chunk {
+	filtered, _ := FilterChromeVerbose(chunks, patterns, maxLength)
+	return filtered
+}
+
+// ChromeMatch records a chunk removed by chrome filtering: the pattern that removed
+// it, and the part of its normalized text the pattern matched.
+type ChromeMatch struct {
+	ChunkID     string
+	Pattern     string
+	MatchedText string
+}
+
+// FilterChromeVerbose is FilterChrome that also returns a ChromeMatch for each chunk
+// it removes, to show what the patterns match when tuning them. A chunk matching
+// several patterns is attributed to the first of them in patterns.
+func FilterChromeVerbose(chunks []Chunk, patterns []string, maxLength int) ([]Chunk, []ChromeMatch) {
 	if len(patterns) == 0 {
-		return chunks
+		return chunks, nil
 	}
 
 	// Compile regex patterns
@@ -139,7 +546,43 @@ func FilterChrome(chunks []Chunk, patterns []string, maxLength int) []Chunk {
 		compiledPatterns = append(compiledPatterns, re)
 	}
 
-	var filtered []Chunk
+	filtered, _, matches := filterChrome(chunks, compiledPatterns, maxLength)
+	return filtered, matches
+}
+
+// FilterChromeCompiled is FilterChrome with pre-compiled patterns.
+func FilterChromeCompiled(chunks []Chunk, compiledPatterns []*regexp.Regexp, maxLength int) []Chunk {
+	filtered, _, _ := filterChrome(chunks, compiledPatterns, maxLength)
+	return filtered
+}
+
+// FilterChromeWithDiscards is FilterChromeCompiled that also returns the chunks it
+// removes, as StageChrome discards naming the first pattern each one matched.
+func FilterChromeWithDiscards(chunks []Chunk, compiledPatterns []*regexp.Regexp, maxLength int) ([]Chunk, []FilteredChunk) {
+	filtered, removed, matches := filterChrome(chunks, compiledPatterns, maxLength)
+	var discards []FilteredChunk
+	for i, chunk := range removed {
+		discards = append(discards, FilteredChunk{
+			Stage:  StageChrome,
+			Reason: "matched chrome pattern " + matches[i].Pattern,
+			Match:  matches[i].MatchedText,
+			ID:     chunk.ID,
+			Page:   chunk.Page,
+			Text:   chunk.Text,
+		})
+	}
+	return filtered, discards
+}
+
+// filterChrome splits chunks into those kept and those removed by the patterns, with
+// a ChromeMatch for each removed chunk.
+func filterChrome(chunks []Chunk, compiledPatterns []*regexp.Regexp, maxLength int) ([]Chunk, []Chunk, []ChromeMatch) {
+	if len(compiledPatterns) == 0 {
+		return chunks, nil, nil
+	}
+
+	var filtered, removed []Chunk
+	var matches []ChromeMatch
 
 	for _, chunk := range chunks {
 		shouldFilter := false
@@ -147,8 +590,14 @@ func FilterChrome(chunks []Chunk, patterns []string, maxLength int) []Chunk {
 		// Check if chunk matches any pattern and is short
 		if len(chunk.Norm) < maxLength {
 			for _, re := range compiledPatterns {
-				if re.MatchString(chunk.Norm) {
+				if loc := re.FindStringIndex(chunk.Norm); loc != nil {
 					shouldFilter = true
+					removed = append(removed, chunk)
+					matches = append(matches, ChromeMatch{
+						ChunkID:     chunk.ID,
+						Pattern:     re.String(),
+						MatchedText: chunk.Norm[loc[0]:loc[1]],
+					})
 					break
 				}
 			}
@@ -159,30 +608,194 @@ func FilterChrome(chunks []Chunk, patterns []string, maxLength int) []Chunk {
 		}
 	}
 
+	return filtered, removed, matches
+}
+
+// noiseCharSetSize is how many of a chunk's most frequent characters FilterNoise
+// counts together, so alternating noise such as "|l|l|l" is caught as well as runs
+// of one character.
+const noiseCharSetSize = 2
+
+// FilterNoise removes chunks of OCR noise, such as "||||||" or "........" from scanned
+// borders and shading: chunks where the noiseCharSetSize most frequent characters make
+// up more than ratio of the characters other than whitespace. Characters are Unicode
+// code points of the original text. ratio <= 0 keeps every chunk.
+func FilterNoise(chunks []Chunk, ratio float64) []Chunk {
+	filtered, _ := FilterNoiseWithDiscards(chunks, ratio)
 	return filtered
 }
 
-// WriteChunksJSONL writes chunks to a JSONL file (one JSON object per line).
-func WriteChunksJSONL(chunks []Chunk, path string) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create JSONL file: %w", err)
+// FilterNoiseWithDiscards is FilterNoise that also returns the chunks it removes, as
+// StageNoise discards.
+func FilterNoiseWithDiscards(chunks []Chunk, ratio float64) ([]Chunk, []FilteredChunk) {
+	if ratio <= 0 {
+		return chunks, nil
 	}
-	defer func() {
-		if cerr := file.Close(); cerr != nil {
-			// Log the error, but don't return it as it's a cleanup error
-			// The main error (if any) should have been returned already
-			fmt.Fprintf(os.Stderr, "warning: failed to close JSONL file %s: %v\n", path, cerr)
+
+	var filtered []Chunk
+	var discards []FilteredChunk
+	for _, chunk := range chunks {
+		chars, share := dominantChars(chunk.Text)
+		if share <= ratio {
+			filtered = append(filtered, chunk)
+			continue
 		}
-	}()
+		discards = append(discards, FilteredChunk{
+			Stage:  StageNoise,
+			Reason: fmt.Sprintf("%.0f%% of characters are %q, over %.0f%%", share*100, chars, ratio*100),
+			ID:     chunk.ID,
+			Page:   chunk.Page,
+			Text:   chunk.Text,
+		})
+	}
+	return filtered, discards
+}
 
-	writer := bufio.NewWriter(file)
-	defer func() {
-		if ferr := writer.Flush(); ferr != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to flush JSONL writer for %s: %v\n", path, ferr)
+// dominantChars returns the noiseCharSetSize most frequent characters of s other than
+// whitespace, most frequent first, and the fraction of those characters they make up.
+func dominantChars(s string) (string, float64) {
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			counts[r]++
+			total++
 		}
-	}()
+	}
+	if total == 0 {
+		return "", 0
+	}
 
+	chars := make([]rune, 0, len(counts))
+	for r := range counts {
+		chars = append(chars, r)
+	}
+	sort.Slice(chars, func(i, j int) bool {
+		if counts[chars[i]] != counts[chars[j]] {
+			return counts[chars[i]] > counts[chars[j]]
+		}
+		return chars[i] < chars[j]
+	})
+	if len(chars) > noiseCharSetSize {
+		chars = chars[:noiseCharSetSize]
+	}
+	dominant := 0
+	for _, r := range chars {
+		dominant += counts[r]
+	}
+	return string(chars), float64(dominant) / float64(total)
+}
+
+// unspacedScripts are scripts written without spaces between words, whose chunks
+// FilterMinWords keeps whatever their token count.
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+}
+
+// FilterMinWords removes chunks with fewer than minWords whitespace-separated tokens in
+// their normalized text, such as long runs of OCR noise that pass the character
+// minimum. Chunks containing Chinese, Japanese or other text written without spaces
+// are kept, since their tokens are not words. minWords <= 1 keeps every chunk.
+func FilterMinWords(chunks []Chunk, minWords int) []Chunk {
+	filtered, _ := FilterMinWordsWithDiscards(chunks, minWords)
+	return filtered
+}
+
+// FilterMinWordsWithDiscards is FilterMinWords that also returns the chunks it
+// removes, as StageMinWords discards.
+func FilterMinWordsWithDiscards(chunks []Chunk, minWords int) ([]Chunk, []FilteredChunk) {
+	if minWords <= 1 {
+		return chunks, nil
+	}
+
+	var filtered []Chunk
+	var discards []FilteredChunk
+	for _, chunk := range chunks {
+		words := len(strings.Fields(chunk.Norm))
+		if words >= minWords || hasUnspacedScript(chunk.Norm) {
+			filtered = append(filtered, chunk)
+			continue
+		}
+		discards = append(discards, FilteredChunk{
+			Stage:  StageMinWords,
+			Reason: fmt.Sprintf("word count %d, under the minimum of %d", words, minWords),
+			ID:     chunk.ID,
+			Page:   chunk.Page,
+			Text:   chunk.Text,
+		})
+	}
+	return filtered, discards
+}
+
+// hasUnspacedScript reports whether s contains letters of a script in unspacedScripts.
+func hasUnspacedScript(s string) bool {
+	for _, r := range s {
+		if r >= utf8.RuneSelf && unicode.IsOneOf(unspacedScripts, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChromeSuggestion is a short chunk that recurs often enough to be a chrome candidate.
+type ChromeSuggestion struct {
+	Norm    string // normalized chunk text
+	Count   int    // number of chunks with this normalized text
+	Pattern string // anchored regex matching exactly this normalized text
+}
+
+// SuggestChrome counts short chunks (normalized text below maxLength) and returns those
+// seen at least twice as candidate chrome patterns, most frequent first (ties by text).
+// At most limit suggestions are returned; limit <= 0 returns all.
+func SuggestChrome(chunks []Chunk, maxLength, limit int) []ChromeSuggestion {
+	counts := make(map[string]int)
+	for _, chunk := range chunks {
+		if chunk.Norm != "" && len(chunk.Norm) < maxLength {
+			counts[chunk.Norm]++
+		}
+	}
+
+	var suggestions []ChromeSuggestion
+	for norm, count := range counts {
+		if count < 2 {
+			continue
+		}
+		suggestions = append(suggestions, ChromeSuggestion{
+			Norm:    norm,
+			Count:   count,
+			Pattern: "^" + regexp.QuoteMeta(norm) + "$",
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		return suggestions[i].Norm < suggestions[j].Norm
+	})
+
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// WriteChromeSuggestions writes one count<TAB>pattern line per suggestion, after a comment header.
+func WriteChromeSuggestions(suggestions []ChromeSuggestion, path string) error {
+	var b strings.Builder
+	b.WriteString("# Candidate chrome patterns for --chrome-regex (count<TAB>pattern), most frequent first\n")
+	for _, s := range suggestions {
+		fmt.Fprintf(&b, "%d\t%s\n", s.Count, s.Pattern)
+	}
+
+	if err := fsutil.WriteFileAtomic(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write chrome suggestions: %w", err)
+	}
+	return nil
+}
+
+// WriteChunksJSONL writes chunks to a JSONL file (one JSON object per line).
+func WriteChunksJSONL(chunks []Chunk, path string) error {
+	var writer bytes.Buffer
 	for _, chunk := range chunks {
 		// Truncate text to 500 chars for readability in JSON
 		textPreview := chunk.Text
@@ -195,6 +808,10 @@ func WriteChunksJSONL(chunks []Chunk, path string) error {
 			"text":  textPreview,
 			"index": chunk.Index,
 			"len":   len(chunk.Text),
+			"page":  chunk.Page,
+		}
+		if chunk.SourceFile != "" {
+			entry["source_file"] = chunk.SourceFile
 		}
 
 		jsonData, err := json.Marshal(entry)
@@ -211,69 +828,347 @@ func WriteChunksJSONL(chunks []Chunk, path string) error {
 		}
 	}
 
+	if err := fsutil.WriteFileAtomic(path, writer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write JSONL file: %w", err)
+	}
 	return nil
 }
 
+// Stages of FilteredChunk, in pipeline order.
+const (
+	StageMinChars = "min_chars" // shorter than the minimum chunk length
+	StageChrome   = "chrome"    // short and matching a chrome pattern
+	StageNoise    = "noise"     // mostly one or two repeated characters
+	StageMinWords = "min_words" // fewer words than the minimum
+	StageExact    = "exact"     // exact duplicate of a kept chunk
+	StageNear     = "near"      // near-duplicate of a kept chunk
+	StageCrossRun = "cross_run" // duplicate of a chunk kept by an earlier run
+)
+
+// FilteredChunk is text removed on the way to the output, recording the stage that
+// removed it and why.
+type FilteredChunk struct {
+	Stage  string `json:"stage"`           // one of the Stage constants
+	Reason string `json:"reason"`          // what matched, e.g. the chrome pattern or the kept chunk
+	Match  string `json:"match,omitempty"` // normalized text the chrome pattern matched (StageChrome)
+	ID     string `json:"id,omitempty"`    // chunk ID; empty for StageMinChars, which runs before IDs are given
+	Page   int    `json:"page,omitempty"`  // 1-based source page, when known
+	Text   string `json:"text"`
+}
+
+// WriteFilteredJSONL writes one JSON object per filtered chunk to path.
+func WriteFilteredJSONL(filtered []FilteredChunk, path string) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, f := range filtered {
+		if err := encoder.Encode(f); err != nil {
+			return fmt.Errorf("failed to marshal filtered chunk: %w", err)
+		}
+	}
+	if err := fsutil.WriteFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write filtered chunks: %w", err)
+	}
+	return nil
+}
+
+// WriteAlignmentTSV writes a page<TAB>chunk_id<TAB>char_count row for each chunk, after a header row.
+// char_count is the number of characters (runes) in the chunk text.
+func WriteAlignmentTSV(chunks []Chunk, path string) error {
+	var b strings.Builder
+	b.WriteString("page\tchunk_id\tchar_count\n")
+	for _, chunk := range chunks {
+		fmt.Fprintf(&b, "%d\t%s\t%d\n", chunk.Page, chunk.ID, utf8.RuneCountInString(chunk.Text))
+	}
+
+	if err := fsutil.WriteFileAtomic(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write alignment TSV: %w", err)
+	}
+	return nil
+}
+
+// MarkdownOptions controls optional annotations in rendered Markdown.
+type MarkdownOptions struct {
+	IncludeChunkIDs    bool      // Add an HTML comment with the chunk ID before each chunk
+	ShowPages          bool      // Prefix each chunk with its source page number
+	IncludeFrontmatter bool      // Start with a YAML frontmatter block (title, date, source_images, chunks)
+	IncludeTOC         bool      // Add a table of contents and a heading per chunk to link to
+	ChunkHeadingLevel  int       // Level (1-6) of a heading before each chunk; 0 means none, or 2 with IncludeTOC
+	SeparatorRule      bool      // Separate chunks with a horizontal rule (---) as well as a blank line
+	CleanDisplay       bool      // Render chunk text through NormalizeForDisplay
+	SourceImages       int       // Source image count recorded in the frontmatter
+	Date               time.Time // Frontmatter date; zero means now
+	DateFormat         string    // Go time layout for the frontmatter date; empty means RFC3339
+
+	// ChunkLabel is the text of chunk headings and table of contents entries (see
+	// ParseChunkLabel). Nil means "Chunk <id>", which is also used for chunks the
+	// template fails on, such as a template using .Page for a chunk without a page.
+	ChunkLabel *template.Template
+
+	// Summary, if non-empty, is appended as a "## Processing Summary" table.
+	Summary []SummaryRow
+}
+
+// SummaryRow is one row of the Markdown processing summary table.
+type SummaryRow struct {
+	Name  string
+	Value string
+}
+
 // RenderMarkdown renders chunks into Markdown format with a title.
 // If includeChunkIDs is true, adds HTML comments before each chunk.
 func RenderMarkdown(title string, chunks []Chunk, includeChunkIDs bool) string {
+	return RenderMarkdownWithOptions(title, chunks, MarkdownOptions{IncludeChunkIDs: includeChunkIDs})
+}
+
+// RenderMarkdownWithOptions renders chunks into Markdown format with a title and the
+// annotations selected in opts. Chunks without a page (Page 0) get no page prefix.
+func RenderMarkdownWithOptions(title string, chunks []Chunk, opts MarkdownOptions) string {
 	// Use default title if empty
 	if title == "" {
 		title = "Extracted Notes"
 	}
 
 	var result strings.Builder
+	if opts.IncludeFrontmatter {
+		writeFrontmatter(&result, title, len(chunks), opts)
+	}
+
 	// Write title header
 	result.WriteString("# ")
 	result.WriteString(title)
 	result.WriteString("\n\n")
 
+	headingLevel := opts.ChunkHeadingLevel
+	if headingLevel == 0 && opts.IncludeTOC {
+		headingLevel = 2
+	}
+	var anchors []string
+	if opts.IncludeTOC {
+		anchors = chunkAnchors(chunks)
+		result.WriteString("## Contents\n\n")
+		for i, chunk := range chunks {
+			fmt.Fprintf(&result, "- [%s](#%s)\n", chunkLabel(chunk, opts.ChunkLabel), anchors[i])
+		}
+		result.WriteString("\n")
+	}
+
 	// Write chunks
-	for _, chunk := range chunks {
-		if includeChunkIDs {
+	for i, chunk := range chunks {
+		if opts.SeparatorRule && i > 0 {
+			result.WriteString("---\n\n")
+		}
+		if opts.IncludeTOC {
+			// Explicit anchor so links resolve even where renderers slug headings differently
+			fmt.Fprintf(&result, "<a id=\"%s\"></a>\n\n", anchors[i])
+		}
+		if headingLevel > 0 {
+			fmt.Fprintf(&result, "%s %s\n\n", strings.Repeat("#", headingLevel), chunkLabel(chunk, opts.ChunkLabel))
+		}
+		if opts.IncludeChunkIDs {
 			// Add HTML comment with chunk ID
 			result.WriteString("<!-- ")
 			result.WriteString(chunk.ID)
 			result.WriteString(" -->\n")
 		}
+		if opts.ShowPages && chunk.Page > 0 {
+			fmt.Fprintf(&result, "*Page %d*\n\n", chunk.Page)
+		}
 		// Write chunk text
-		result.WriteString(chunk.Text)
+		if opts.CleanDisplay {
+			result.WriteString(NormalizeForDisplay(chunk.Text))
+		} else {
+			result.WriteString(chunk.Text)
+		}
 		// Add blank line separator
 		result.WriteString("\n\n")
 	}
 
+	if len(opts.Summary) > 0 {
+		writeSummary(&result, opts.Summary)
+	}
+
 	return result.String()
 }
 
-// WriteMarkdown writes Markdown content to a file with consistent line endings.
-func WriteMarkdown(content string, path string) error {
-	file, err := os.Create(path)
+// ParseChunkLabel parses a chunk label template for MarkdownOptions.ChunkLabel, such
+// as "Page {{.Page}}". Templates can use .ID, .Index, .Page and .SourceFile; .Page and
+// .SourceFile are missing for chunks without them, which then get the default label.
+func ParseChunkLabel(s string) (*template.Template, error) {
+	tmpl, err := template.New("chunk-label").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk label template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// chunkLabel returns the label of chunk from tmpl, on a single line, or "Chunk <id>"
+// if tmpl is nil, fails on the chunk or gives an empty label.
+func chunkLabel(chunk Chunk, tmpl *template.Template) string {
+	fallback := "Chunk " + chunk.ID
+	if tmpl == nil {
+		return fallback
+	}
+	data := map[string]any{"ID": chunk.ID, "Index": chunk.Index}
+	if chunk.Page > 0 {
+		data["Page"] = chunk.Page
+	}
+	if chunk.SourceFile != "" {
+		data["SourceFile"] = chunk.SourceFile
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fallback
+	}
+	label := strings.Join(strings.Fields(b.String()), " ")
+	if label == "" {
+		return fallback
+	}
+	return label
+}
+
+// writeSummary writes the processing summary section as a two-column table.
+func writeSummary(b *strings.Builder, rows []SummaryRow) {
+	cell := strings.NewReplacer("|", `\|`, "\n", " ")
+	b.WriteString("## Processing Summary\n\n")
+	b.WriteString("| Item | Value |\n")
+	b.WriteString("| --- | --- |\n")
+	for _, row := range rows {
+		fmt.Fprintf(b, "| %s | %s |\n", cell.Replace(row.Name), cell.Replace(row.Value))
+	}
+	b.WriteString("\n")
+}
+
+// RenderJSON renders chunks as an indented JSON array of {id, text, norm, index, page,
+// source_file} objects; page and source_file are omitted when unknown. The output unmarshals back into []Chunk.
+func RenderJSON(chunks []Chunk) ([]byte, error) {
+	if chunks == nil {
+		chunks = []Chunk{}
+	}
+	data, err := json.MarshalIndent(chunks, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to create Markdown file: %w", err)
+		return nil, fmt.Errorf("failed to marshal chunks: %w", err)
 	}
-	defer func() {
-		if cerr := file.Close(); cerr != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to close Markdown file %s: %v\n", path, cerr)
+	return append(data, '\n'), nil
+}
+
+// RenderPlainText renders chunk texts separated by blank lines, with no title or annotations.
+func RenderPlainText(chunks []Chunk) string {
+	var result strings.Builder
+	for i, chunk := range chunks {
+		if i > 0 {
+			result.WriteString("\n\n")
 		}
-	}()
+		result.WriteString(chunk.Text)
+	}
+	if len(chunks) > 0 {
+		result.WriteString("\n")
+	}
+	return result.String()
+}
 
-	writer := bufio.NewWriter(file)
-	defer func() {
-		if ferr := writer.Flush(); ferr != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to flush Markdown writer for %s: %v\n", path, ferr)
+// writeFrontmatter writes a YAML frontmatter block. Strings are written as JSON, which is valid YAML.
+func writeFrontmatter(b *strings.Builder, title string, chunkCount int, opts MarkdownOptions) {
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	layout := opts.DateFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	quotedTitle, _ := json.Marshal(title)
+	quotedDate, _ := json.Marshal(date.Format(layout))
+
+	b.WriteString("---\n")
+	fmt.Fprintf(b, "title: %s\n", quotedTitle)
+	fmt.Fprintf(b, "date: %s\n", quotedDate)
+	fmt.Fprintf(b, "source_images: %d\n", opts.SourceImages)
+	fmt.Fprintf(b, "chunks: %d\n", chunkCount)
+	b.WriteString("---\n\n")
+}
+
+// chunkAnchors returns a unique anchor per chunk, slugified from "chunk-<id>".
+// Repeated slugs get a numeric suffix (-1, -2, ...).
+func chunkAnchors(chunks []Chunk) []string {
+	anchors := make([]string, len(chunks))
+	used := make(map[string]bool, len(chunks))
+	for i, chunk := range chunks {
+		base := slugify("chunk-" + chunk.ID)
+		anchor := base
+		for n := 1; used[anchor]; n++ {
+			anchor = fmt.Sprintf("%s-%d", base, n)
 		}
-	}()
+		used[anchor] = true
+		anchors[i] = anchor
+	}
+	return anchors
+}
 
+// slugify lowercases s and replaces each run of characters other than letters and digits with a hyphen.
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// WriteMarkdown writes Markdown content to a file with consistent line endings.
+func WriteMarkdown(content string, path string) error {
 	// Normalize line endings to \n and ensure file ends with single newline
-	normalized := strings.ReplaceAll(content, "\r\n", "\n")
-	normalized = strings.ReplaceAll(normalized, "\r", "\n")
+	normalized := NormalizeLineEndings(content)
 	// Trim trailing newlines and add single newline
 	normalized = strings.TrimRight(normalized, "\n")
 	normalized += "\n"
 
-	if _, err := writer.WriteString(normalized); err != nil {
-		return fmt.Errorf("failed to write Markdown content: %w", err)
+	if err := fsutil.WriteFileAtomic(path, []byte(normalized), 0644); err != nil {
+		return fmt.Errorf("failed to write Markdown file: %w", err)
 	}
 
 	return nil
 }
+
+// AppendMarkdown appends rendered Markdown content to the file at path, separated
+// from the existing content by one blank line. The frontmatter and title header of
+// content are dropped, since the file already has its own. A missing or empty file
+// is written with content in full, as by WriteMarkdown.
+func AppendMarkdown(content string, path string) error {
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && strings.TrimSpace(string(existing)) == "") {
+		return WriteMarkdown(content, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Markdown file: %w", err)
+	}
+
+	body := strings.Trim(markdownBody(NormalizeLineEndings(content)), "\n")
+	if body == "" {
+		return nil
+	}
+	prefix := strings.TrimRight(NormalizeLineEndings(string(existing)), "\n")
+	return WriteMarkdown(prefix+"\n\n"+body, path)
+}
+
+// markdownBody returns content without a leading frontmatter block and "# " title
+// header, as written by RenderMarkdownWithOptions.
+func markdownBody(content string) string {
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		if _, after, found := strings.Cut(rest, "\n---\n"); found {
+			content = after
+		}
+	}
+	content = strings.TrimLeft(content, "\n")
+	if strings.HasPrefix(content, "# ") {
+		_, content, _ = strings.Cut(content, "\n")
+	}
+	return content
+}
@@ -1,12 +1,18 @@
 package text
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"regexp/syntax"
 	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestNormalize_EmptyString(t *testing.T) {
@@ -77,8 +83,31 @@ func TestNormalize_OnlyNumbers(t *testing.T) {
 	}
 }
 
+func TestNormalizeForDisplay(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Hello,  World!", "Hello, World!"},
+		{"Tabs\tand \t spaces", "Tabs and spaces"},
+		{"Line one  \r\n  Line two\rLine three", "Line one\nLine two\nLine three"},
+		{"  Keep CASE, punctuation: (yes) & \"quotes\".  ", "Keep CASE, punctuation: (yes) & \"quotes\"."},
+		{"Café\u00a0\u00a0crème", "Café crème"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeForDisplay(tt.input); got != tt.want {
+			t.Errorf("NormalizeForDisplay(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	// Hashing normalization is unaffected
+	if got := Normalize("Hello,  World!"); got != "hello world" {
+		t.Errorf("expected Normalize to be unchanged, got %q", got)
+	}
+}
+
 func TestChunk_EmptyInput(t *testing.T) {
-	result := ChunkText("", 60)
+	result := ChunkText("", 60, 1)
 	if len(result) != 0 {
 		t.Errorf("expected empty slice, got %d chunks", len(result))
 	}
@@ -86,7 +115,7 @@ func TestChunk_EmptyInput(t *testing.T) {
 
 func TestChunk_SingleParagraph(t *testing.T) {
 	text := "This is a single paragraph with enough text to pass the minimum character threshold for chunking."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	if len(result) != 1 {
 		t.Errorf("expected 1 chunk, got %d", len(result))
 	}
@@ -100,7 +129,7 @@ func TestChunk_SingleParagraph(t *testing.T) {
 
 func TestChunk_MultipleParagraphs(t *testing.T) {
 	text := "First paragraph with enough text to pass the minimum character threshold.\n\nSecond paragraph with enough text to pass the minimum character threshold.\n\nThird paragraph with enough text to pass the minimum character threshold."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	if len(result) != 3 {
 		t.Errorf("expected 3 chunks, got %d", len(result))
 	}
@@ -117,7 +146,7 @@ func TestChunk_MultipleParagraphs(t *testing.T) {
 
 func TestChunk_ChunksBelowThreshold(t *testing.T) {
 	text := "Short.\n\nAlso short.\n\nThis is a longer paragraph that should pass the minimum character threshold and be included in the chunks."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	// Should only include the long paragraph
 	if len(result) != 1 {
 		t.Errorf("expected 1 chunk (only long paragraph), got %d", len(result))
@@ -126,7 +155,7 @@ func TestChunk_ChunksBelowThreshold(t *testing.T) {
 
 func TestChunk_AllChunksTooShort(t *testing.T) {
 	text := "Short.\n\nAlso short."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	if len(result) != 0 {
 		t.Errorf("expected 0 chunks, got %d", len(result))
 	}
@@ -134,25 +163,66 @@ func TestChunk_AllChunksTooShort(t *testing.T) {
 
 func TestChunk_MixedLineEndings(t *testing.T) {
 	text := "First paragraph with enough text to pass the minimum character threshold.\r\n\r\nSecond paragraph with enough text to pass the minimum character threshold.\n\nThird paragraph with enough text to pass the minimum character threshold."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	// Should handle both \n and \r\n
-	if len(result) < 2 {
-		t.Errorf("expected at least 2 chunks, got %d", len(result))
+	if len(result) != 3 {
+		t.Errorf("expected 3 chunks, got %d", len(result))
+	}
+}
+
+func TestChunk_LineEndingsIdenticalBoundaries(t *testing.T) {
+	paragraphs := []string{
+		"First paragraph line one\nline two of the first paragraph",
+		"Second paragraph with enough text to stand alone",
+		"Third paragraph\nspanning two lines as well",
+	}
+	want := ChunkText(strings.Join(paragraphs, "\n\n"), 10, 1)
+	if len(want) != 3 {
+		t.Fatalf("expected 3 chunks for \\n\\n separators, got %d", len(want))
+	}
+
+	for name, eol := range map[string]string{"crlf": "\r\n", "cr": "\r"} {
+		t.Run(name, func(t *testing.T) {
+			converted := make([]string, len(paragraphs))
+			for i, p := range paragraphs {
+				converted[i] = strings.ReplaceAll(p, "\n", eol)
+			}
+			got := ChunkText(strings.Join(converted, eol+eol), 10, 1)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("chunks differ from \\n\\n case:\n got %+v\nwant %+v", got, want)
+			}
+		})
 	}
 }
 
 func TestChunk_ConsecutiveBlankLines(t *testing.T) {
 	text := "First paragraph with enough text to pass the minimum character threshold.\n\n\n\nSecond paragraph with enough text to pass the minimum character threshold."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	// Should split on multiple blank lines
 	if len(result) < 2 {
 		t.Errorf("expected at least 2 chunks, got %d", len(result))
 	}
 }
 
+func TestChunk_MaxBlankLinesThreshold(t *testing.T) {
+	text := "Address line one\nAddress line two\n\nPhone number\n\n\nNext record"
+	for maxBlankLines, want := range map[int]int{0: 3, 1: 3, 2: 2, 3: 1, 4: 1} {
+		if got := len(ChunkText(text, 1, maxBlankLines)); got != want {
+			t.Errorf("maxBlankLines %d: expected %d chunks, got %d", maxBlankLines, want, got)
+		}
+	}
+	// Values below 1 count as 1
+	if !reflect.DeepEqual(ChunkText(text, 1, 0), ChunkText(text, 1, 1)) {
+		t.Error("expected maxBlankLines 0 to chunk like 1")
+	}
+	if chunks := ChunkText(text, 1, 2); chunks[0].Text != "Address line one\nAddress line two\n\nPhone number" {
+		t.Errorf("expected the single blank line to stay within the chunk, got %q", chunks[0].Text)
+	}
+}
+
 func TestChunk_SequentialIDs(t *testing.T) {
 	text := "First paragraph with enough text to pass the minimum character threshold for chunking.\n\nSecond paragraph with enough text to pass the minimum character threshold for chunking.\n\nThird paragraph with enough text to pass the minimum character threshold for chunking."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	expectedIDs := []string{"c0001", "c0002", "c0003"}
 	actualIDs := make([]string, len(result))
 	for i, chunk := range result {
@@ -165,7 +235,7 @@ func TestChunk_SequentialIDs(t *testing.T) {
 
 func TestChunk_NormalizationPreserved(t *testing.T) {
 	text := "Hello, World! This is a test with enough text to pass the minimum character threshold for chunking."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 chunk, got %d", len(result))
 	}
@@ -183,6 +253,33 @@ func TestChunk_NormalizationPreserved(t *testing.T) {
 	}
 }
 
+func TestChunk_PageTracking(t *testing.T) {
+	para := func(word string) string { return strings.Repeat(word+" ", 15) }
+	text := para("one") + "\n\n" + para("two") + "\n\f" + para("three") + "\n\n" + para("four") + "\n\f\n\n" + para("five")
+	result := ChunkText(text, 20, 1)
+	want := []int{1, 1, 2, 2, 3}
+	if len(result) != len(want) {
+		t.Fatalf("expected %d chunks, got %d", len(want), len(result))
+	}
+	for i, chunk := range result {
+		if chunk.Page != want[i] {
+			t.Errorf("chunk %s: expected page %d, got %d", chunk.ID, want[i], chunk.Page)
+		}
+	}
+}
+
+func TestChunk_PageTrackingSkippedPages(t *testing.T) {
+	// Blank pages and dropped short chunks still advance the page count
+	text := "short\f\f" + strings.Repeat("long paragraph ", 10)
+	result := ChunkText(text, 20, 1)
+	if len(result) != 1 {
+		t.Fatalf("expected 1 chunk, got %d", len(result))
+	}
+	if result[0].Page != 3 {
+		t.Errorf("expected page 3, got %d", result[0].Page)
+	}
+}
+
 func TestFilterChrome_NoPatterns(t *testing.T) {
 	chunks := []Chunk{
 		{ID: "c0001", Text: "Test chunk", Norm: "test chunk", Index: 0},
@@ -268,13 +365,282 @@ func TestFilterChrome_InvalidPattern(t *testing.T) {
 	}
 }
 
+func TestCompileChromePatterns(t *testing.T) {
+	compiled, err := CompileChromePatterns(DefaultChromePatterns())
+	if err != nil {
+		t.Fatalf("CompileChromePatterns() failed on default patterns: %v", err)
+	}
+	if len(compiled) != len(DefaultChromePatterns()) {
+		t.Errorf("expected %d compiled patterns, got %d", len(DefaultChromePatterns()), len(compiled))
+	}
+
+	_, err = CompileChromePatterns([]string{`^menu$`, `[invalid regex(`, `^share$`})
+	if err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+	if !strings.Contains(err.Error(), `chrome pattern 2 "[invalid regex("`) {
+		t.Errorf("expected error naming pattern 2, got %v", err)
+	}
+	var syntaxErr *syntax.Error
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected wrapped *syntax.Error, got %T", err)
+	}
+}
+
+func TestFilterChromeCompiled(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "Share", Norm: "share", Index: 0},
+		{ID: "c0002", Text: "Real content", Norm: "real content", Index: 1},
+	}
+	compiled, err := CompileChromePatterns([]string{`^share$`})
+	if err != nil {
+		t.Fatalf("CompileChromePatterns() failed: %v", err)
+	}
+	result := FilterChromeCompiled(chunks, compiled, 50)
+	if len(result) != 1 || result[0].ID != "c0002" {
+		t.Errorf("expected only c0002 to remain, got %+v", result)
+	}
+	if !reflect.DeepEqual(result, FilterChrome(chunks, []string{`^share$`}, 50)) {
+		t.Error("expected FilterChromeCompiled to match FilterChrome")
+	}
+}
+
+func TestFilterChromeVerbose_FirstMatchingPattern(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "Battery 85%", Norm: "battery 85"},
+		{ID: "c0002", Text: "Real content", Norm: "real content"},
+		{ID: "c0003", Text: "Home · 10:30", Norm: "home 1030"},
+	}
+	// c0003 matches both valid patterns and is attributed to the first listed
+	patterns := []string{`[`, `\d{2}\s*\d{2}`, `battery|home`}
+	kept, matches := FilterChromeVerbose(chunks, patterns, 50)
+	if len(kept) != 1 || kept[0].ID != "c0002" {
+		t.Errorf("expected only c0002 to remain, got %+v", kept)
+	}
+	want := []ChromeMatch{
+		{ChunkID: "c0001", Pattern: `battery|home`, MatchedText: "battery"},
+		{ChunkID: "c0003", Pattern: `\d{2}\s*\d{2}`, MatchedText: "1030"},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("expected matches %+v, got %+v", want, matches)
+	}
+	if !reflect.DeepEqual(kept, FilterChrome(chunks, patterns, 50)) {
+		t.Error("expected FilterChromeVerbose to filter like FilterChrome")
+	}
+
+	kept, matches = FilterChromeVerbose(chunks, []string{`battery|home`, `\d{2}\s*\d{2}`}, 50)
+	if len(kept) != 1 || len(matches) != 2 || matches[1].Pattern != `battery|home` || matches[1].MatchedText != "home" {
+		t.Errorf("expected c0003 to be attributed to the word pattern listed first, got %+v", matches)
+	}
+}
+
+func TestFilterChromeWithDiscards(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "Share", Norm: "share", Page: 1},
+		{ID: "c0002", Text: "Real content", Norm: "real content", Page: 1},
+		{ID: "c0003", Text: "12:30", Norm: "1230", Page: 2},
+	}
+	compiled, err := CompileChromePatterns([]string{`^share$`, `^\d{4}$`})
+	if err != nil {
+		t.Fatalf("CompileChromePatterns() failed: %v", err)
+	}
+	kept, discards := FilterChromeWithDiscards(chunks, compiled, 50)
+	if len(kept) != 1 || kept[0].ID != "c0002" {
+		t.Errorf("expected only c0002 to remain, got %+v", kept)
+	}
+	want := []FilteredChunk{
+		{Stage: StageChrome, Reason: "matched chrome pattern ^share$", Match: "share", ID: "c0001", Page: 1, Text: "Share"},
+		{Stage: StageChrome, Reason: `matched chrome pattern ^\d{4}$`, Match: "1230", ID: "c0003", Page: 2, Text: "12:30"},
+	}
+	if !reflect.DeepEqual(discards, want) {
+		t.Errorf("expected discards %+v, got %+v", want, discards)
+	}
+}
+
+func TestChunkTextWithDiscards(t *testing.T) {
+	input := "A paragraph long enough to be kept as a chunk.\n\nToo short\f\nAlso short\n\nAnother paragraph long enough to be kept."
+	chunks, discards := ChunkTextWithDiscards(input, 20, 1, NormalizeOpts{})
+	if len(chunks) != 2 || chunks[1].Page != 2 {
+		t.Fatalf("expected 2 chunks, the second on page 2, got %+v", chunks)
+	}
+	want := []FilteredChunk{
+		{Stage: StageMinChars, Reason: "9 chars, under the minimum of 20", Page: 1, Text: "Too short"},
+		{Stage: StageMinChars, Reason: "10 chars, under the minimum of 20", Page: 2, Text: "Also short"},
+	}
+	if !reflect.DeepEqual(discards, want) {
+		t.Errorf("expected discards %+v, got %+v", want, discards)
+	}
+	if !reflect.DeepEqual(chunks, ChunkText(input, 20, 1)) {
+		t.Error("expected ChunkTextWithDiscards to chunk like ChunkText")
+	}
+
+	// Short paragraphs joined into a single chunk are not lost
+	chunks, discards = ChunkTextWithDiscards("Short one\n\nShort two", 15, 1, NormalizeOpts{})
+	if len(chunks) != 1 || len(discards) != 0 {
+		t.Errorf("expected 1 chunk and no discards, got %+v and %+v", chunks, discards)
+	}
+}
+
+func TestWriteFilteredJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filtered_out.jsonl")
+	filtered := []FilteredChunk{
+		{Stage: StageMinChars, Reason: "3 chars, under the minimum of 60", Page: 1, Text: "Hi!"},
+		{Stage: StageExact, Reason: "exact_duplicate of c0001", ID: "c0004", Page: 3, Text: "Repeated"},
+	}
+	if err := WriteFilteredJSONL(filtered, path); err != nil {
+		t.Fatalf("WriteFilteredJSONL() failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"stage":"min_chars","reason":"3 chars, under the minimum of 60","page":1,"text":"Hi!"}` + "\n" +
+		`{"stage":"exact","reason":"exact_duplicate of c0001","id":"c0004","page":3,"text":"Repeated"}` + "\n"
+	if string(content) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, content)
+	}
+}
+
+func TestFilterNoise(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "||||||||||||||||||||||||||||||"},
+		{ID: "c0002", Text: ". . . . . . . . . . . . . . . . . . . .", Page: 3},
+		{ID: "c0003", Text: "l|l|l|I|l|l|l|l|l|l|l|l|l|l|l"},
+		{ID: "c0004", Text: "────────────────────────── ═"},
+		// A real paragraph with a row of asterisks stays well below the threshold
+		{ID: "c0005", Text: "Chapter two begins here.\n**********\nThe morning was cold and grey."},
+		// Borderline: a short rating line is mostly stars, but not over 70%
+		{ID: "c0006", Text: "Rating: ★★★★★★★★ (eight)"},
+		{ID: "c0007", Text: "   "},
+	}
+
+	kept, discards := FilterNoiseWithDiscards(chunks, 0.7)
+	var ids []string
+	for _, chunk := range kept {
+		ids = append(ids, chunk.ID)
+	}
+	if want := []string{"c0005", "c0006", "c0007"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected %v kept, got %v", want, ids)
+	}
+	if len(discards) != 4 || discards[0].Stage != StageNoise || discards[1].Page != 3 {
+		t.Fatalf("expected 4 noise discards, got %+v", discards)
+	}
+	if want := `100% of characters are "|", over 70%`; discards[0].Reason != want {
+		t.Errorf("expected reason %q, got %q", want, discards[0].Reason)
+	}
+	if !reflect.DeepEqual(kept, FilterNoise(chunks, 0.7)) {
+		t.Error("expected FilterNoiseWithDiscards to filter like FilterNoise")
+	}
+
+	// The borderline chunk is dropped at a lower ratio
+	if got := FilterNoise(chunks[5:6], 0.4); len(got) != 0 {
+		t.Errorf("expected the rating line dropped at 0.4, got %+v", got)
+	}
+	if got := FilterNoise(chunks, 0); len(got) != len(chunks) {
+		t.Errorf("expected ratio 0 to keep every chunk, got %d", len(got))
+	}
+}
+
+func TestFilterMinWords(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "A real sentence with several words in it."},
+		{ID: "c0002", Text: "llllIIIl1l|l|llIIl1lIl!!lllIIl1lIIlll||Il1IlIlllI1lIl"},
+		{ID: "c0003", Text: "~~ ## wvvw ## ~~", Page: 2},
+		{ID: "c0004", Text: "東京都の天気は晴れです。"},
+		{ID: "c0005", Text: "สวัสดีครับ"},
+		{ID: "c0006", Text: "Two words"},
+	}
+	for i := range chunks {
+		chunks[i].Norm = Normalize(chunks[i].Text)
+	}
+
+	kept, discards := FilterMinWordsWithDiscards(chunks, 3)
+	var ids []string
+	for _, chunk := range kept {
+		ids = append(ids, chunk.ID)
+	}
+	// Japanese and Thai have no spaces between words and are kept
+	if want := []string{"c0001", "c0004", "c0005"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected %v kept, got %v", want, ids)
+	}
+	want := []FilteredChunk{
+		{Stage: StageMinWords, Reason: "word count 1, under the minimum of 3", ID: "c0002", Text: chunks[1].Text},
+		{Stage: StageMinWords, Reason: "word count 1, under the minimum of 3", ID: "c0003", Page: 2, Text: chunks[2].Text},
+		{Stage: StageMinWords, Reason: "word count 2, under the minimum of 3", ID: "c0006", Text: "Two words"},
+	}
+	if !reflect.DeepEqual(discards, want) {
+		t.Errorf("expected discards %+v, got %+v", want, discards)
+	}
+	if !reflect.DeepEqual(kept, FilterMinWords(chunks, 3)) {
+		t.Error("expected FilterMinWordsWithDiscards to filter like FilterMinWords")
+	}
+
+	for _, minWords := range []int{0, 1} {
+		if got := FilterMinWords(chunks, minWords); len(got) != len(chunks) {
+			t.Errorf("minWords %d: expected every chunk kept, got %d", minWords, len(got))
+		}
+	}
+}
+
+func TestSuggestChrome_FrequentShortChunks(t *testing.T) {
+	var chunks []Chunk
+	for i := 0; i < 5; i++ {
+		chunks = append(chunks,
+			Chunk{Text: "Back", Norm: "back"},
+			Chunk{Text: "Home", Norm: "home"},
+		)
+	}
+	chunks = append(chunks,
+		Chunk{Text: "Home", Norm: "home"},
+		Chunk{Text: "Once only", Norm: "once only"},
+		Chunk{Text: strings.Repeat("long ", 30), Norm: strings.Repeat("long ", 30)},
+		Chunk{Text: strings.Repeat("long ", 30), Norm: strings.Repeat("long ", 30)},
+	)
+
+	result := SuggestChrome(chunks, 100, 10)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 suggestions, got %d: %+v", len(result), result)
+	}
+	if result[0].Norm != "home" || result[0].Count != 6 {
+		t.Errorf("expected home (6) first, got %s (%d)", result[0].Norm, result[0].Count)
+	}
+	if result[1].Norm != "back" || result[1].Count != 5 {
+		t.Errorf("expected back (5) second, got %s (%d)", result[1].Norm, result[1].Count)
+	}
+
+	// Suggested patterns should filter exactly the suggested chunks
+	filtered := FilterChrome(chunks, []string{result[0].Pattern, result[1].Pattern}, 100)
+	if len(filtered) != 3 {
+		t.Errorf("expected suggested patterns to leave 3 chunks, got %d", len(filtered))
+	}
+
+	if limited := SuggestChrome(chunks, 100, 1); len(limited) != 1 || limited[0].Norm != "home" {
+		t.Errorf("expected limit to keep only the top suggestion, got %+v", limited)
+	}
+}
+
+func TestWriteChromeSuggestions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chrome_suggestions.txt")
+	suggestions := []ChromeSuggestion{{Norm: "back", Count: 3, Pattern: "^back$"}}
+	if err := WriteChromeSuggestions(suggestions, path); err != nil {
+		t.Fatalf("WriteChromeSuggestions failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read suggestions: %v", err)
+	}
+	if !strings.Contains(string(content), "3\t^back$\n") {
+		t.Errorf("expected count and pattern line, got:\n%s", content)
+	}
+}
+
 func TestWriteChunksJSONL(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "chunks.jsonl")
 
 	chunks := []Chunk{
 		{ID: "c0001", Text: "First chunk", Norm: "first chunk", Index: 0},
-		{ID: "c0002", Text: "Second chunk", Norm: "second chunk", Index: 1},
+		{ID: "c0002", Text: "Second chunk", Norm: "second chunk", Index: 1, Page: 2},
 	}
 
 	err := WriteChunksJSONL(chunks, path)
@@ -305,6 +671,9 @@ func TestWriteChunksJSONL(t *testing.T) {
 	if !strings.Contains(lines[0], `"text":"First chunk"`) {
 		t.Errorf("expected text in first line, got: %s", lines[0])
 	}
+	if !strings.Contains(lines[1], `"page":2`) {
+		t.Errorf("expected page in second line, got: %s", lines[1])
+	}
 }
 
 func TestWriteChunksJSONL_LongTextTruncation(t *testing.T) {
@@ -335,6 +704,27 @@ func TestWriteChunksJSONL_LongTextTruncation(t *testing.T) {
 	}
 }
 
+func TestWriteAlignmentTSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alignment.tsv")
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk", Page: 1},
+		{ID: "c0003", Text: "Café chunk", Page: 2},
+	}
+
+	if err := WriteAlignmentTSV(chunks, path); err != nil {
+		t.Fatalf("WriteAlignmentTSV failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read TSV: %v", err)
+	}
+	want := "page\tchunk_id\tchar_count\n1\tc0001\t11\n2\tc0003\t10\n"
+	if string(content) != want {
+		t.Errorf("expected %q, got %q", want, string(content))
+	}
+}
+
 func TestDefaultChromePatterns(t *testing.T) {
 	patterns := DefaultChromePatterns()
 	if len(patterns) == 0 {
@@ -351,7 +741,7 @@ func TestDefaultChromePatterns(t *testing.T) {
 
 func TestChunk_EdgeCase_OnlyNewlines(t *testing.T) {
 	text := "\n\n\n"
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	if len(result) != 0 {
 		t.Errorf("expected 0 chunks for only newlines, got %d", len(result))
 	}
@@ -359,7 +749,7 @@ func TestChunk_EdgeCase_OnlyNewlines(t *testing.T) {
 
 func TestChunk_EdgeCase_NoNewlines(t *testing.T) {
 	text := "This is a single long paragraph with no newlines that should still be chunked if it meets the minimum character requirement."
-	result := ChunkText(text, 60)
+	result := ChunkText(text, 60, 1)
 	if len(result) != 1 {
 		t.Errorf("expected 1 chunk for single paragraph, got %d", len(result))
 	}
@@ -368,7 +758,7 @@ func TestChunk_EdgeCase_NoNewlines(t *testing.T) {
 func TestChunk_EdgeCase_VeryLongParagraph(t *testing.T) {
 	// Create a very long paragraph (should still be chunked as one)
 	longText := strings.Repeat("This is a sentence. ", 100)
-	result := ChunkText(longText, 60)
+	result := ChunkText(longText, 60, 1)
 	if len(result) != 1 {
 		t.Errorf("expected 1 chunk for very long paragraph, got %d", len(result))
 	}
@@ -515,6 +905,251 @@ func TestRenderMarkdown_WithChunkIDs(t *testing.T) {
 	}
 }
 
+func TestRenderMarkdownWithOptions_ShowPages(t *testing.T) {
+	chunks := ChunkText("First page text\fSecond page text\n\nMore on page two", 1, 1)
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{IncludeChunkIDs: true, ShowPages: true})
+
+	for _, want := range []string{
+		"<!-- c0001 -->\n*Page 1*\n\nFirst page text",
+		"<!-- c0002 -->\n*Page 2*\n\nSecond page text",
+		"<!-- c0003 -->\n*Page 2*\n\nMore on page two",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, result)
+		}
+	}
+
+	// Chunks without page information are rendered without a prefix
+	result = RenderMarkdownWithOptions("Test", []Chunk{{ID: "c0001", Text: "No page"}}, MarkdownOptions{ShowPages: true})
+	if strings.Contains(result, "*Page") {
+		t.Errorf("expected no page prefix for Page 0, got:\n%s", result)
+	}
+}
+
+func TestRenderMarkdownWithOptions_Summary(t *testing.T) {
+	chunks := []Chunk{{ID: "c0001", Text: "Only chunk"}}
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{
+		Summary: []SummaryRow{
+			{Name: "Chunks kept", Value: "1"},
+			{Name: "Pattern", Value: "a|b"},
+		},
+	})
+	want := "Only chunk\n\n## Processing Summary\n\n| Item | Value |\n| --- | --- |\n| Chunks kept | 1 |\n| Pattern | a\\|b |\n"
+	if !strings.HasSuffix(result, want+"\n") {
+		t.Errorf("expected summary table at the end, got:\n%s", result)
+	}
+
+	if result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{}); strings.Contains(result, "Processing Summary") {
+		t.Errorf("expected no summary without rows, got:\n%s", result)
+	}
+}
+
+func TestRenderJSON_RoundTrip(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First \"quoted\" chunk", Norm: "first quoted chunk", Index: 0, Page: 1},
+		{ID: "c0002", Text: "Second chunk", Norm: "second chunk", Index: 1},
+	}
+	data, err := RenderJSON(chunks)
+	if err != nil {
+		t.Fatalf("RenderJSON failed: %v", err)
+	}
+
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("output is not a JSON array: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, key := range []string{"id", "text", "norm", "index", "page"} {
+		if _, ok := entries[0][key]; !ok {
+			t.Errorf("expected key %q in first entry", key)
+		}
+	}
+	if _, ok := entries[1]["page"]; ok {
+		t.Error("expected page to be omitted when unknown")
+	}
+
+	var decoded []Chunk
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal into chunks: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, chunks) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", decoded, chunks)
+	}
+
+	empty, err := RenderJSON(nil)
+	if err != nil || strings.TrimSpace(string(empty)) != "[]" {
+		t.Errorf("expected empty array for no chunks, got %q (err %v)", empty, err)
+	}
+}
+
+func TestRenderPlainText(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk", Page: 1},
+		{ID: "c0002", Text: "Second chunk\nwith two lines", Page: 2},
+	}
+	want := "First chunk\n\nSecond chunk\nwith two lines\n"
+	if got := RenderPlainText(chunks); got != want {
+		t.Errorf("RenderPlainText() = %q, want %q", got, want)
+	}
+	if got := RenderPlainText(nil); got != "" {
+		t.Errorf("expected empty output for no chunks, got %q", got)
+	}
+}
+
+func TestRenderMarkdownWithOptions_Frontmatter(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk"},
+		{ID: "c0002", Text: "Second chunk"},
+	}
+	date := time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)
+	result := RenderMarkdownWithOptions(`Notes: "draft"`, chunks, MarkdownOptions{
+		IncludeFrontmatter: true,
+		SourceImages:       7,
+		Date:               date,
+	})
+
+	if !strings.HasPrefix(result, "---\n") {
+		t.Fatalf("expected frontmatter at start, got:\n%s", result)
+	}
+	end := strings.Index(result[4:], "\n---\n")
+	if end < 0 {
+		t.Fatalf("expected closing frontmatter delimiter, got:\n%s", result)
+	}
+
+	var fm struct {
+		Title        string `yaml:"title"`
+		Date         string `yaml:"date"`
+		SourceImages int    `yaml:"source_images"`
+		Chunks       int    `yaml:"chunks"`
+	}
+	if err := yaml.Unmarshal([]byte(result[4:4+end]), &fm); err != nil {
+		t.Fatalf("frontmatter is not valid YAML: %v", err)
+	}
+	if fm.Title != `Notes: "draft"` || fm.Date != "2024-03-05T10:30:00Z" || fm.SourceImages != 7 || fm.Chunks != 2 {
+		t.Errorf("unexpected frontmatter: %+v", fm)
+	}
+	if !strings.Contains(result, "---\n\n# Notes: \"draft\"\n") {
+		t.Errorf("expected title header after frontmatter, got:\n%s", result)
+	}
+
+	custom := RenderMarkdownWithOptions("T", chunks, MarkdownOptions{IncludeFrontmatter: true, Date: date, DateFormat: "2006-01-02"})
+	if !strings.Contains(custom, `date: "2024-03-05"`) {
+		t.Errorf("expected custom date format, got:\n%s", custom)
+	}
+}
+
+func TestRenderMarkdownWithOptions_TOC(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk"},
+		{ID: "c0002", Text: "Second chunk"},
+		{ID: "c0002", Text: "Repeated ID"},
+	}
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{IncludeTOC: true})
+
+	links := regexp.MustCompile(`\]\(#([^)]+)\)`).FindAllStringSubmatch(result, -1)
+	if len(links) != len(chunks) {
+		t.Fatalf("expected %d TOC links, got %d:\n%s", len(chunks), len(links), result)
+	}
+	seen := make(map[string]bool)
+	for i, link := range links {
+		anchor := link[1]
+		if seen[anchor] {
+			t.Errorf("duplicate anchor %q", anchor)
+		}
+		seen[anchor] = true
+
+		// Each link must resolve to an anchored heading placed before its chunk
+		target := "<a id=\"" + anchor + "\"></a>\n\n## Chunk " + chunks[i].ID + "\n\n" + chunks[i].Text
+		if !strings.Contains(result, target) {
+			t.Errorf("TOC link #%s does not resolve to a heading for %s", anchor, chunks[i].ID)
+		}
+	}
+	if links[0][1] != "chunk-c0001" || links[2][1] != "chunk-c0002-1" {
+		t.Errorf("unexpected anchors: %v", links)
+	}
+}
+
+func TestRenderMarkdownWithOptions_ChunkHeadings(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk", Page: 1},
+		{ID: "c0002", Text: "Second chunk", Page: 3},
+	}
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{ChunkHeadingLevel: 3})
+	want := "# Test\n\n### Chunk c0001\n\nFirst chunk\n\n### Chunk c0002\n\nSecond chunk\n\n"
+	if result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+
+	// Zero values keep the plain output
+	result = RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{})
+	if want := "# Test\n\nFirst chunk\n\nSecond chunk\n\n"; result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+}
+
+func TestRenderMarkdownWithOptions_SeparatorRule(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk"},
+		{ID: "c0002", Text: "Second chunk"},
+		{ID: "c0003", Text: "Third chunk"},
+	}
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{SeparatorRule: true})
+	want := "# Test\n\nFirst chunk\n\n---\n\nSecond chunk\n\n---\n\nThird chunk\n\n"
+	if result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+
+	// The rule goes before the next chunk's heading
+	result = RenderMarkdownWithOptions("Test", chunks[:2], MarkdownOptions{SeparatorRule: true, ChunkHeadingLevel: 2})
+	want = "# Test\n\n## Chunk c0001\n\nFirst chunk\n\n---\n\n## Chunk c0002\n\nSecond chunk\n\n"
+	if result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+}
+
+func TestRenderMarkdownWithOptions_CleanDisplay(t *testing.T) {
+	chunks := []Chunk{{ID: "c0001", Text: "Doubled  spaces,\tkept CASE.  \r\n Next line"}}
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{CleanDisplay: true})
+	want := "# Test\n\nDoubled spaces, kept CASE.\nNext line\n\n"
+	if result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+	if result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{}); !strings.Contains(result, chunks[0].Text) {
+		t.Errorf("expected text as is without CleanDisplay, got %q", result)
+	}
+}
+
+func TestRenderMarkdownWithOptions_ChunkLabel(t *testing.T) {
+	label, err := ParseChunkLabel("Page {{.Page}} ({{.ID}})")
+	if err != nil {
+		t.Fatalf("ParseChunkLabel failed: %v", err)
+	}
+	chunks := []Chunk{
+		{ID: "c0001", Text: "First chunk", Page: 2},
+		{ID: "c0002", Text: "No page"},
+	}
+	result := RenderMarkdownWithOptions("Test", chunks, MarkdownOptions{ChunkHeadingLevel: 2, ChunkLabel: label})
+	// A chunk without a page falls back to the default label
+	want := "# Test\n\n## Page 2 (c0001)\n\nFirst chunk\n\n## Chunk c0002\n\nNo page\n\n"
+	if result != want {
+		t.Errorf("expected %q, got %q", want, result)
+	}
+
+	// Table of contents entries use the label too
+	result = RenderMarkdownWithOptions("Test", chunks[:1], MarkdownOptions{IncludeTOC: true, ChunkLabel: label})
+	for _, want := range []string{"- [Page 2 (c0001)](#chunk-c0001)", "<a id=\"chunk-c0001\"></a>\n\n## Page 2 (c0001)\n\n"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, result)
+		}
+	}
+
+	if _, err := ParseChunkLabel("Page {{.Page"); err == nil {
+		t.Error("expected error for a malformed template")
+	}
+}
+
 func TestRenderMarkdown_WithoutChunkIDs(t *testing.T) {
 	chunks := []Chunk{
 		{ID: "c0001", Text: "Test chunk", Norm: "test chunk", Index: 0},
@@ -635,6 +1270,54 @@ func TestWriteMarkdown_EndsWithSingleNewline(t *testing.T) {
 	}
 }
 
+func TestAppendMarkdown_ExistingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "test.md")
+	if err := WriteMarkdown("# Notes\n\nFirst chunk\n", path); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+
+	// Frontmatter and title of the appended content are dropped
+	content := "---\ntitle: \"Notes\"\n---\n\n# Notes\r\n\r\nSecond chunk\r\n\r\nThird chunk\r\n\r\n\r\n"
+	if err := AppendMarkdown(content, path); err != nil {
+		t.Fatalf("AppendMarkdown failed: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read Markdown file: %v", err)
+	}
+	expected := "# Notes\n\nFirst chunk\n\nSecond chunk\n\nThird chunk\n"
+	if string(written) != expected {
+		t.Errorf("expected %q, got %q", expected, string(written))
+	}
+
+	// Content with nothing but a title leaves the file unchanged
+	if err := AppendMarkdown("# Notes\n\n", path); err != nil {
+		t.Fatalf("AppendMarkdown failed: %v", err)
+	}
+	if written, _ := os.ReadFile(path); string(written) != expected {
+		t.Errorf("expected %q, got %q", expected, string(written))
+	}
+}
+
+func TestAppendMarkdown_MissingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "test.md")
+
+	if err := AppendMarkdown("# Notes\n\nFirst chunk\n\n", path); err != nil {
+		t.Fatalf("AppendMarkdown failed: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read Markdown file: %v", err)
+	}
+	// Written in full, title included, as by WriteMarkdown
+	expected := "# Notes\n\nFirst chunk\n"
+	if string(written) != expected {
+		t.Errorf("expected %q, got %q", expected, string(written))
+	}
+}
+
 func TestWriteMarkdown_FileWriteError(t *testing.T) {
 	// Try to write to invalid path
 	invalidPath := "/nonexistent/directory/test.md"
@@ -703,3 +1386,387 @@ func TestRenderMarkdown_VeryLongChunk(t *testing.T) {
 		t.Error("expected very long chunk to be preserved")
 	}
 }
+
+func TestStripPageNumbers(t *testing.T) {
+	input := strings.Join([]string{
+		"Chapter one begins here.",
+		"It has 3 apples and 12 pears.",
+		"",
+		"42",
+		"  Page 7 of 120  ",
+		"- 8 -",
+		"p. 9",
+		"10 / 120",
+		"Page 11",
+		"",
+		"The page 12 reference stays in a sentence.",
+		"2 + 2 = 4",
+	}, "\n")
+
+	result := StripPageNumbers(input)
+
+	for _, removed := range []string{"42", "Page 7 of 120", "- 8 -", "p. 9", "10 / 120", "Page 11"} {
+		for _, line := range strings.Split(result, "\n") {
+			if strings.TrimSpace(line) == removed {
+				t.Errorf("expected page-number line %q to be removed", removed)
+			}
+		}
+	}
+	for _, keptLine := range []string{
+		"Chapter one begins here.",
+		"It has 3 apples and 12 pears.",
+		"The page 12 reference stays in a sentence.",
+		"2 + 2 = 4",
+	} {
+		if !strings.Contains(result, keptLine) {
+			t.Errorf("expected content %q to be preserved, got:\n%s", keptLine, result)
+		}
+	}
+}
+
+func TestStripPageNumbers_KeepsFormFeeds(t *testing.T) {
+	input := "First page content here\n\n1\fSecond page content here\n\n2\n\f"
+	result := StripPageNumbers(input)
+
+	if strings.Count(result, "\f") != 2 {
+		t.Errorf("expected form feeds to be preserved, got %q", result)
+	}
+	chunks := ChunkText(result, 1, 1)
+	if len(chunks) != 2 || chunks[0].Page != 1 || chunks[1].Page != 2 {
+		t.Errorf("expected two chunks on pages 1 and 2, got %+v", chunks)
+	}
+}
+
+func TestDehyphenateText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"join", "the informa-\ntion was lost", "the information was lost"},
+		{"join with spaces and CRLF", "an exam- \r\n  ple of it", "an example of it"},
+		{"join non-ASCII", "une déci-\nsion rapide", "une décision rapide"},
+		{"compound prefix", "a well-\nknown fact", "a well-known fact"},
+		{"compound used elsewhere", "one co-\nworker and another co-worker", "one co-worker and another co-worker"},
+		{"joined word used elsewhere", "the well-\nbeing of wellbeing", "the wellbeing of wellbeing"},
+		{"capitalized", "see Smith-\nJones and Informa-\ntion", "see Smith-\nJones and Informa-\ntion"},
+		{"digits", "room 12-\n14 and a-\n3", "room 12-\n14 and a-\n3"},
+		{"paragraph break", "a list-\n\nitem", "a list-\n\nitem"},
+		{"hyphen mid-line", "a mid-line hyphen stays", "a mid-line hyphen stays"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DehyphenateText(tt.input); got != tt.want {
+				t.Errorf("DehyphenateText(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	// Joined words normalize like the unbroken word, so they dedup with it
+	if got, want := Normalize(DehyphenateText("informa-\ntion")), Normalize("information"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestStripURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"HTTPS", "Read more at https://example.com/a?utm_source=x today", "Read more at today"},
+		{"HTTP", "http://example.org", ""},
+		{"WWW", "Visit www.example.com/page now", "Visit now"},
+		{"FTP", "Files on ftp://files.example.com/pub", "Files on"},
+		{"CaseInsensitive", "See HTTPS://EXAMPLE.COM for details", "See for details"},
+		{"NoURL", "Plain text without links", "Plain text without links"},
+		{"Multiple", "a https://x.io b https://y.io c", "a b c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripURLs(tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStripChunkURLs_NormOnly(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "Article body https://example.com/?ref=abc", Norm: Normalize("Article body https://example.com/?ref=abc")},
+	}
+
+	result := StripChunkURLs(chunks, false, NormalizeOpts{})
+
+	if result[0].Norm != "article body" {
+		t.Errorf("expected URL removed from Norm, got %q", result[0].Norm)
+	}
+	if result[0].Text != chunks[0].Text {
+		t.Errorf("expected Text to be unchanged, got %q", result[0].Text)
+	}
+	// Input slice must not be modified
+	if chunks[0].Norm == "article body" {
+		t.Error("StripChunkURLs should not modify the input slice")
+	}
+}
+
+func TestStripChunkURLs_TextToo(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "c0001", Text: "Article body https://example.com/?ref=abc", Norm: "ignored"},
+	}
+
+	result := StripChunkURLs(chunks, true, NormalizeOpts{})
+
+	if result[0].Text != "Article body" {
+		t.Errorf("expected URL removed from Text, got %q", result[0].Text)
+	}
+	if result[0].Norm != "article body" {
+		t.Errorf("expected URL removed from Norm, got %q", result[0].Norm)
+	}
+}
+
+func TestSetSourceFiles(t *testing.T) {
+	chunks := ChunkText("First page paragraph.\n\nStill the first page.\f\fThird page paragraph.\fFourth page.", 1, 1)
+	files := []string{"invoice_acme_2023.jpg", "blank.jpg", "receipt.png"}
+
+	result := SetSourceFiles(chunks, files)
+
+	want := []string{"invoice_acme_2023.jpg", "invoice_acme_2023.jpg", "receipt.png", ""}
+	if len(result) != len(want) {
+		t.Fatalf("expected %d chunks, got %d", len(want), len(result))
+	}
+	for i, chunk := range result {
+		if chunk.SourceFile != want[i] {
+			t.Errorf("chunk %d on page %d: expected source file %q, got %q", i, chunk.Page, want[i], chunk.SourceFile)
+		}
+	}
+	if chunks[0].SourceFile != "" {
+		t.Error("expected the input chunks to be left unchanged")
+	}
+}
+
+func TestPrefixChunkIDs(t *testing.T) {
+	chunks := ChunkText("First paragraph.\n\nSecond paragraph.", 1, 1)
+
+	result := PrefixChunkIDs(chunks, "b2-")
+
+	if len(result) != 2 || result[0].ID != "b2-c0001" || result[1].ID != "b2-c0002" {
+		t.Errorf("expected prefixed IDs, got %+v", result)
+	}
+	if chunks[0].ID != "c0001" {
+		t.Error("expected the input chunks to be left unchanged")
+	}
+}
+
+func TestNormalize_ComposedAndDecomposedMatch(t *testing.T) {
+	composed := "Caf\u00e9 r\u00e9sum\u00e9"      // é as a single rune
+	decomposed := "Cafe\u0301 re\u0301sume\u0301" // e + combining acute accent
+
+	if composed == decomposed {
+		t.Fatal("test inputs should differ byte-wise")
+	}
+	if Normalize(composed) != Normalize(decomposed) {
+		t.Errorf("expected identical normalization, got %q and %q", Normalize(composed), Normalize(decomposed))
+	}
+	if Normalize(decomposed) != "caf\u00e9 r\u00e9sum\u00e9" {
+		t.Errorf("expected accents to be preserved in composed form, got %q", Normalize(decomposed))
+	}
+}
+
+func TestNormalizeWithOpts_NFKC(t *testing.T) {
+	input := "\ufb01le \uff11\uff12\uff13" // "ﬁle １２３" (ligature + full-width digits)
+
+	nfc := NormalizeWithOpts(input, NormalizeOpts{Form: FormNFC})
+	if nfc == "file 123" {
+		t.Errorf("NFC should not fold compatibility characters, got %q", nfc)
+	}
+
+	nfkc := NormalizeWithOpts(input, NormalizeOpts{Form: FormNFKC})
+	if nfkc != "file 123" {
+		t.Errorf("expected NFKC to fold to %q, got %q", "file 123", nfkc)
+	}
+}
+
+func TestNormalizeWithOpts_FoldAccents(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"número", "numero"},
+		{"Crème Brûlée", "creme brulee"},
+		{"nu\u0301mero", "numero"}, // decomposed input
+		{"año", "ano"},
+		{"plain text", "plain text"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeWithOpts(tt.input, NormalizeOpts{FoldAccents: true}); got != tt.want {
+			t.Errorf("NormalizeWithOpts(%q, fold) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	if got := NormalizeWithOpts("número", NormalizeOpts{}); got != "número" {
+		t.Errorf("expected accents to be kept without FoldAccents, got %q", got)
+	}
+}
+
+func TestNormalizeWithOpts_DefaultStepsMatchNormalize(t *testing.T) {
+	inputs := []string{
+		"Hello, World!  How are\n\nyou?",
+		"Café “quoted” ﬁle １２３",
+		"Crème Brûlée ŒUVRE",
+	}
+	for _, opts := range []NormalizeOpts{{Form: FormNFC}, {Form: FormNFKC}, {Form: FormNFC, FoldAccents: true}} {
+		explicit := opts
+		explicit.Steps = DefaultNormalizeSteps(opts)
+		for _, input := range inputs {
+			if got, want := NormalizeWithOpts(input, explicit), NormalizeWithOpts(input, opts); got != want {
+				t.Errorf("steps %v on %q = %q, want %q", explicit.Steps, input, got, want)
+			}
+		}
+	}
+
+	// The defaults are today's Normalize
+	if got := NormalizeWithOpts("Hello, World!", NormalizeOpts{Steps: []string{"unicode", "lowercase"}}); got != "hello world" {
+		t.Errorf("expected %q, got %q", "hello world", got)
+	}
+}
+
+func TestNormalizeWithOpts_StepOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  NormalizeOpts
+		want  string
+	}{
+		{"ligatures after lowercase expand uppercase", "ŒUVRE", NormalizeOpts{Steps: []string{"lowercase", "ligatures"}}, "oeuvre"},
+		{"ligatures before lowercase miss uppercase", "ŒUVRE", NormalizeOpts{Steps: []string{"ligatures", "lowercase"}}, "œuvre"},
+		{"accents after nfkc fold compatibility", "ǆ", NormalizeOpts{Form: FormNFKC, Steps: []string{"unicode", "accents"}}, "dz"},
+		{"accents before nfkc keep caron", "ǆ", NormalizeOpts{Form: FormNFKC, Steps: []string{"accents", "unicode"}}, "dž"},
+		{"no lowercase step keeps case", "Hello", NormalizeOpts{Steps: []string{"unicode"}}, "Hello"},
+		{"ligature presentation forms", "ﬁle ﬂow", NormalizeOpts{Steps: []string{"ligatures"}}, "file flow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeWithOpts(tt.input, tt.opts); got != tt.want {
+				t.Errorf("NormalizeWithOpts(%q, %v) = %q, want %q", tt.input, tt.opts.Steps, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNormalizeSteps(t *testing.T) {
+	steps, err := ParseNormalizeSteps(" Quotes, ligatures,accents ,lowercase")
+	if err != nil {
+		t.Fatalf("ParseNormalizeSteps() failed: %v", err)
+	}
+	if want := []string{"quotes", "ligatures", "accents", "lowercase"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("expected %v, got %v", want, steps)
+	}
+	if steps, err := ParseNormalizeSteps(""); err != nil || steps != nil {
+		t.Errorf("expected no steps for empty value, got %v, %v", steps, err)
+	}
+	for _, value := range []string{"lowercase,digits", "lowercase,lowercase"} {
+		if _, err := ParseNormalizeSteps(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestCountParagraphs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"whitespace only", " \n\n \f ", 0},
+		{"single", "one paragraph\nwith two lines", 1},
+		{"blank lines and page break", "first\n\nsecond\r\n\r\nthird\fpage two", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountParagraphs(tt.text, 1); got != tt.want {
+				t.Errorf("CountParagraphs() = %d, want %d", got, tt.want)
+			}
+			if got := len(ChunkText(tt.text, 1, 1)); got != tt.want {
+				t.Errorf("expected ChunkText with minChars 1 to agree, got %d chunks", got)
+			}
+		})
+	}
+}
+
+func TestChunkTextWithDiscards_MaxBlankLines(t *testing.T) {
+	input := "Name: Ada\nRole: Engineer\n\nNotes: first entry\n\n\nName: Grace\n\n\n\nRole: Admiral\fPage two"
+	tests := []struct {
+		maxBlankLines int
+		want          []string
+	}{
+		{1, []string{"Name: Ada\nRole: Engineer", "Notes: first entry", "Name: Grace", "Role: Admiral", "Page two"}},
+		{2, []string{"Name: Ada\nRole: Engineer\n\nNotes: first entry", "Name: Grace", "Role: Admiral", "Page two"}},
+		{3, []string{"Name: Ada\nRole: Engineer\n\nNotes: first entry\n\n\nName: Grace", "Role: Admiral", "Page two"}},
+	}
+	for _, tt := range tests {
+		chunks, _ := ChunkTextWithDiscards(input, 1, tt.maxBlankLines, NormalizeOpts{})
+		var got []string
+		for _, chunk := range chunks {
+			got = append(got, chunk.Text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("maxBlankLines %d: expected %q, got %q", tt.maxBlankLines, tt.want, got)
+		}
+		if n := CountParagraphs(input, tt.maxBlankLines); n != len(tt.want) {
+			t.Errorf("maxBlankLines %d: expected CountParagraphs to agree, got %d", tt.maxBlankLines, n)
+		}
+		if last := chunks[len(chunks)-1]; last.Page != 2 {
+			t.Errorf("maxBlankLines %d: expected the page break to split, got %+v", tt.maxBlankLines, last)
+		}
+	}
+
+	// Blank lines holding only spaces or CRLF line endings count as blank
+	chunks, _ := ChunkTextWithDiscards("first\r\n  \r\n\t\r\nsecond", 1, 2, NormalizeOpts{})
+	if len(chunks) != 2 {
+		t.Errorf("expected whitespace-only lines to count as blank, got %+v", chunks)
+	}
+}
+
+func TestChunkTextWithDiscards_NormalizeOpts(t *testing.T) {
+	input := "\ufb01nal n\u00famero"
+	nfkc := NormalizeOpts{Form: FormNFKC, FoldAccents: true}
+
+	chunks, _ := ChunkTextWithDiscards(input, 1, 1, nfkc)
+	if len(chunks) != 1 || chunks[0].Norm != "final numero" {
+		t.Errorf("expected the given options to build Norm, got %+v", chunks)
+	}
+	if got := StripChunkURLs(chunks, false, nfkc); got[0].Norm != "final numero" {
+		t.Errorf("expected StripChunkURLs to normalize with the given options, got %q", got[0].Norm)
+	}
+
+	// Other calls keep the default normalization
+	if got := ChunkText(input, 1, 1)[0].Norm; got != "\ufb01nal número" {
+		t.Errorf("expected ChunkText to use the default options, got %q", got)
+	}
+}
+
+func TestParseUnicodeForm(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    UnicodeForm
+		wantErr bool
+	}{
+		{"nfc", FormNFC, false},
+		{"NFKC", FormNFKC, false},
+		{"nfd", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUnicodeForm(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUnicodeForm(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseUnicodeForm(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}